@@ -0,0 +1,461 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// =============================================================================
+// Monthly attestation - a compliance summary of one month's backups
+// =============================================================================
+//
+// Reports describe one run each. Auditors want the month: every run, how many
+// succeeded, the longest any dataset went without a good backup, what the
+// backup pool actually holds, whether it was scrubbed, and which health
+// findings are still open. `zfs-backup attest --month 2026-09` writes that as a
+// PDF and a JSON document next to the run reports.
+
+// attestationVersion is bumped when a JSON field changes meaning.
+const attestationVersion = 1
+
+// attestation is one month's summary for a host and backup pool.
+type attestation struct {
+	Version     int                  `json:"version"`
+	Month       string               `json:"month"` // 2026-09
+	Host        string               `json:"host"`
+	Pool        string               `json:"pool"`
+	PeriodStart time.Time            `json:"period_start"`
+	PeriodEnd   time.Time            `json:"period_end"`
+	GeneratedAt time.Time            `json:"generated_at"`
+	Runs        []historyRecord      `json:"runs"`
+	Successful  int                  `json:"successful"`
+	Partial     int                  `json:"partial"`
+	Failed      int                  `json:"failed"`
+	SuccessRate float64              `json:"success_rate"` // 0 to 1
+	Datasets    []attestationDataset `json:"datasets"`
+	// RetentionError explains why the backup pool's snapshots could not be
+	// read, e.g. because the pool was not imported.
+	RetentionError string   `json:"retention_error,omitempty"`
+	Scrub          string   `json:"scrub,omitempty"` // the scan: line of zpool status
+	ScrubError     string   `json:"scrub_error,omitempty"`
+	Findings       []string `json:"doctor_findings"`
+	DoctorError    string   `json:"doctor_error,omitempty"`
+}
+
+// attestationDataset is one dataset's record over the month.
+type attestationDataset struct {
+	Name              string     `json:"name"`
+	SuccessfulRuns    int        `json:"successful_runs"`
+	LastSuccess       *time.Time `json:"last_success,omitempty"`
+	LongestGapSeconds float64    `json:"longest_gap_seconds"`
+	LongestGapStart   time.Time  `json:"longest_gap_start"`
+	LongestGapEnd     time.Time  `json:"longest_gap_end"`
+	SnapshotsHeld     int        `json:"snapshots_held"`
+	OldestSnapshot    *time.Time `json:"oldest_snapshot,omitempty"`
+	NewestSnapshot    *time.Time `json:"newest_snapshot,omitempty"`
+}
+
+// longestGap returns the gap between a dataset's successful backups.
+func (d attestationDataset) longestGap() time.Duration {
+	return time.Duration(d.LongestGapSeconds * float64(time.Second))
+}
+
+// parseAttestMonth parses --month, e.g. 2026-09, into the month's bounds.
+func parseAttestMonth(value string, loc *time.Location) (start, end time.Time, err error) {
+	start, err = time.ParseInLocation("2006-01", value, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid --month %q - use YYYY-MM, e.g. 2026-09", value)
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// datasetSucceeded reports whether a run replicated a dataset.
+func datasetSucceeded(r historyRecord, dataset string) bool {
+	for _, ds := range r.Datasets {
+		if ds.Name == dataset {
+			return ds.Status == "done"
+		}
+	}
+	return false
+}
+
+// summariseRuns fills in the runs, outcome counts and per-dataset gaps from
+// the history. records must already be filtered to the host and pool; runs
+// before the month are used only to find when each dataset last succeeded
+// going into it. Gaps are measured up to until, the month's end or now.
+func (a *attestation) summariseRuns(records []historyRecord, until time.Time) {
+	sorted := append([]historyRecord(nil), records...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].StartTime.Before(sorted[j].StartTime) })
+
+	seen := map[string]bool{}
+	var names []string
+	for _, r := range sorted {
+		if r.StartTime.Before(a.PeriodStart) || !r.StartTime.Before(a.PeriodEnd) {
+			continue
+		}
+		a.Runs = append(a.Runs, r)
+		switch r.Outcome {
+		case notifySuccess:
+			a.Successful++
+		case notifyPartial:
+			a.Partial++
+		default:
+			a.Failed++
+		}
+		for _, ds := range r.Datasets {
+			if !seen[ds.Name] {
+				seen[ds.Name] = true
+				names = append(names, ds.Name)
+			}
+		}
+	}
+	if len(a.Runs) > 0 {
+		a.SuccessRate = float64(a.Successful) / float64(len(a.Runs))
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		ds := attestationDataset{Name: name}
+		last := a.PeriodStart
+		var lastSuccess time.Time
+		record := func(t time.Time) {
+			if gap := t.Sub(last); gap.Seconds() > ds.LongestGapSeconds {
+				ds.LongestGapSeconds = gap.Seconds()
+				ds.LongestGapStart, ds.LongestGapEnd = last, t
+			}
+			last = t
+		}
+		for _, r := range sorted {
+			if !datasetSucceeded(r, name) || !r.EndTime.Before(until) {
+				continue
+			}
+			if r.EndTime.Before(a.PeriodStart) {
+				// A success before the month starts its first gap.
+				last, lastSuccess = r.EndTime, r.EndTime
+				continue
+			}
+			if r.StartTime.Before(a.PeriodEnd) {
+				ds.SuccessfulRuns++
+			}
+			record(r.EndTime)
+			lastSuccess = r.EndTime
+		}
+		record(until)
+		if !lastSuccess.IsZero() {
+			ds.LastSuccess = &lastSuccess
+		}
+		a.Datasets = append(a.Datasets, ds)
+	}
+}
+
+// addRetention fills in the oldest and newest backup snapshot each dataset
+// holds on the backup pool.
+func (a *attestation) addRetention(entries []snapshotEntry) {
+	root := a.Pool + "/" + a.Host + "/"
+	byDataset := map[string][]snapshotEntry{}
+	for _, e := range filterBackupSnapshots(entries) {
+		if name, ok := strings.CutPrefix(e.Dataset, root); ok {
+			byDataset[name] = append(byDataset[name], e)
+		}
+	}
+
+	index := map[string]int{}
+	for i, ds := range a.Datasets {
+		index[ds.Name] = i
+	}
+	for name, snaps := range byDataset {
+		i, ok := index[name]
+		if !ok {
+			// Held on the pool but not backed up this month.
+			i = len(a.Datasets)
+			index[name] = i
+			a.Datasets = append(a.Datasets, attestationDataset{Name: name})
+		}
+		sortSnapshotsNewestFirst(snaps)
+		newest, oldest := snaps[0].Creation, snaps[len(snaps)-1].Creation
+		a.Datasets[i].SnapshotsHeld = len(snaps)
+		a.Datasets[i].NewestSnapshot = &newest
+		a.Datasets[i].OldestSnapshot = &oldest
+	}
+	sort.SliceStable(a.Datasets, func(i, j int) bool { return a.Datasets[i].Name < a.Datasets[j].Name })
+}
+
+// scrubStatusLine extracts the scan: line of `zpool status`, joining the
+// continuation lines zpool indents under it.
+func scrubStatusLine(status string) string {
+	var parts []string
+	inScan := false
+	for _, line := range strings.Split(status, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "scan:"):
+			inScan = true
+			parts = append(parts, strings.TrimSpace(strings.TrimPrefix(trimmed, "scan:")))
+		case inScan && trimmed != "" && !strings.Contains(trimmed, ":"):
+			parts = append(parts, trimmed)
+		default:
+			inScan = false
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// attestOptions controls the attest subcommand.
+type attestOptions struct {
+	Month      string
+	Host       string
+	Pool       string // backup pool
+	SourcePool string // for doctor findings; only read for the local host
+}
+
+// buildAttestation gathers one month's attestation. Anything that cannot be
+// read - an exported backup pool, a remote host's source pool - is recorded
+// as such rather than failing the whole document.
+func buildAttestation(ctx context.Context, r commandRunner, opts attestOptions, records []historyRecord, now time.Time) (*attestation, error) {
+	start, end, err := parseAttestMonth(opts.Month, now.Location())
+	if err != nil {
+		return nil, err
+	}
+	a := &attestation{
+		Version:     attestationVersion,
+		Month:       opts.Month,
+		Host:        opts.Host,
+		Pool:        opts.Pool,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		GeneratedAt: now,
+		Findings:    []string{},
+	}
+
+	filter := historyFilter{Host: opts.Host, Pool: opts.Pool}
+	until := end
+	if now.Before(until) {
+		until = now
+	}
+	a.summariseRuns(filterHistory(records, filter), until)
+
+	if entries, err := listSnapshotEntries(ctx, r, opts.Pool+"/"+opts.Host, 0); err != nil {
+		a.RetentionError = fmt.Sprintf("could not list snapshots on %s/%s - is the backup pool imported?", opts.Pool, opts.Host)
+	} else {
+		a.addRetention(entries)
+	}
+
+	if status, err := r.Output(ctx, "zpool", "status", opts.Pool); err != nil {
+		a.ScrubError = fmt.Sprintf("could not read the status of %s", opts.Pool)
+	} else if a.Scrub = scrubStatusLine(status); a.Scrub == "" {
+		a.Scrub = "none requested"
+	}
+
+	switch {
+	case opts.SourcePool == "":
+		a.DoctorError = "no source pool to check"
+	case !strings.EqualFold(opts.Host, getLocalHostname()):
+		a.DoctorError = fmt.Sprintf("doctor checks run on %s itself", opts.Host)
+	default:
+		scan, err := prepareDoctorScan(ctx, r, opts.SourcePool, opts.Pool)
+		if err != nil {
+			a.DoctorError = err.Error()
+		} else {
+			a.Findings = doctorFindings(runDoctorChecks(ctx, r, scan, doctorChecks))
+		}
+	}
+	return a, nil
+}
+
+// attestationBaseName is the file name, without extension, an attestation is
+// saved under in the reports directory.
+func attestationBaseName(a *attestation) string {
+	return fmt.Sprintf("Attestation-%s-%s-%s", a.Host, a.Pool, a.Month)
+}
+
+// attestationRunRows returns the run table as cells: started, operation,
+// source to destination, duration, outcome, failed datasets.
+func attestationRunRows(a *attestation) [][]string {
+	rows := make([][]string, 0, len(a.Runs))
+	for _, r := range a.Runs {
+		rows = append(rows, []string{
+			r.StartTime.Local().Format("2006-01-02 15:04"),
+			operationLabel(r.Operation),
+			r.Source + " -> " + r.Destination,
+			historyDurationLabel(r.DurationSeconds),
+			r.Outcome,
+			strings.Join(r.failedDatasets(), ", "),
+		})
+	}
+	return rows
+}
+
+// dateOrDash formats an optional time.
+func dateOrDash(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// generateAttestationPDF renders an attestation with the run report's PDF
+// helpers and branding.
+func generateAttestationPDF(a *attestation, pdfPath string) error {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetAutoPageBreak(true, 15)
+	pdf.AddPage()
+
+	// Kartoza brand colors
+	gold := [3]int{223, 158, 47}  // #DF9E2F
+	blue := [3]int{86, 159, 198}  // #569FC6
+	teal := [3]int{6, 150, 154}   // #06969A
+	gray := [3]int{138, 139, 139} // #8A8B8B
+	red := [3]int{204, 4, 3}      // #CC0403
+	dark := [3]int{30, 30, 30}    // #1E1E1E
+
+	pdfHeaderBar(pdf, dark, gold, blue, "Backup Attestation",
+		fmt.Sprintf("%s  |  %s on %s", a.PeriodStart.Format("January 2006"), a.Host, a.Pool))
+
+	pdfSectionHeader(pdf, dark, gray, "Summary")
+	pdfKeyValue(pdf, dark, gray, "Host", a.Host)
+	pdfKeyValue(pdf, dark, gray, "Backup Pool", a.Pool)
+	pdfKeyValue(pdf, dark, gray, "Period", fmt.Sprintf("%s to %s",
+		a.PeriodStart.Format("2006-01-02"), a.PeriodEnd.AddDate(0, 0, -1).Format("2006-01-02")))
+	pdfKeyValue(pdf, dark, gray, "Runs", fmt.Sprintf("%d (%d successful, %d partial, %d failed)",
+		len(a.Runs), a.Successful, a.Partial, a.Failed))
+	pdfKeyValue(pdf, dark, gray, "Success Rate", fmt.Sprintf("%.1f%%", a.SuccessRate*100))
+	scrub := a.Scrub
+	if a.ScrubError != "" {
+		scrub = a.ScrubError
+	}
+	pdfKeyValue(pdf, dark, gray, "Last Scrub", scrub)
+	pdfKeyValue(pdf, dark, gray, "Generated", a.GeneratedAt.Format("2006-01-02 15:04:05"))
+	pdf.Ln(5)
+
+	// Per-dataset coverage and retention
+	pdfSectionHeader(pdf, dark, gray, "Datasets")
+	if a.RetentionError != "" {
+		pdf.SetFont("Helvetica", "I", 8)
+		pdf.SetTextColor(red[0], red[1], red[2])
+		pdf.MultiCell(0, 4, a.RetentionError, "", "L", false)
+		pdf.Ln(2)
+	}
+	colWidths := []float64{32, 16, 34, 26, 12, 30, 30}
+	headers := []string{"Dataset", "Backups", "Last Success", "Longest Gap", "Held", "Oldest", "Newest"}
+	pdf.SetFont("Helvetica", "B", 8)
+	pdf.SetFillColor(dark[0], dark[1], dark[2])
+	pdf.SetTextColor(255, 255, 255)
+	for i, h := range headers {
+		pdf.CellFormat(colWidths[i], 6, h, "1", 0, "C", true, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetFont("Helvetica", "", 8)
+	for _, ds := range a.Datasets {
+		pdf.SetTextColor(dark[0], dark[1], dark[2])
+		if ds.LastSuccess == nil {
+			pdf.SetTextColor(red[0], red[1], red[2])
+		}
+		cells := []string{
+			ds.Name,
+			fmt.Sprintf("%d", ds.SuccessfulRuns),
+			dateOrDash(ds.LastSuccess),
+			durationOrDash(ds.longestGap().Round(time.Minute)),
+			fmt.Sprintf("%d", ds.SnapshotsHeld),
+			dateOrDash(ds.OldestSnapshot),
+			dateOrDash(ds.NewestSnapshot),
+		}
+		for i, cell := range cells {
+			align := "R"
+			if i == 0 {
+				align = "L"
+			}
+			pdf.CellFormat(colWidths[i], 5, cell, "1", 0, align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	pdf.Ln(5)
+
+	// Open health findings
+	pdfSectionHeader(pdf, dark, gray, "Unresolved Health Findings")
+	pdf.SetFont("Helvetica", "", 9)
+	switch {
+	case a.DoctorError != "":
+		pdf.SetTextColor(gray[0], gray[1], gray[2])
+		pdf.MultiCell(0, 4.5, "Not checked: "+a.DoctorError, "", "L", false)
+	case len(a.Findings) == 0:
+		pdf.SetTextColor(teal[0], teal[1], teal[2])
+		pdf.MultiCell(0, 4.5, "None. The doctor found the source pool healthy.", "", "L", false)
+	default:
+		pdf.SetTextColor(red[0], red[1], red[2])
+		for _, f := range a.Findings {
+			pdf.MultiCell(0, 4.5, "- "+f, "", "L", false)
+		}
+	}
+	pdf.Ln(5)
+
+	// Every run in the month
+	pdfSectionHeader(pdf, dark, gray, "Runs")
+	runWidths := []float64{28, 32, 52, 18, 16, 34}
+	runHeaders := []string{"Started", "Operation", "Source -> Destination", "Duration", "Outcome", "Failed"}
+	pdf.SetFont("Helvetica", "B", 8)
+	pdf.SetFillColor(dark[0], dark[1], dark[2])
+	pdf.SetTextColor(255, 255, 255)
+	for i, h := range runHeaders {
+		pdf.CellFormat(runWidths[i], 6, h, "1", 0, "C", true, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetFont("Helvetica", "", 7.5)
+	for _, row := range attestationRunRows(a) {
+		switch row[4] {
+		case notifySuccess:
+			pdf.SetTextColor(dark[0], dark[1], dark[2])
+		case notifyPartial:
+			pdf.SetTextColor(gold[0], gold[1], gold[2])
+		default:
+			pdf.SetTextColor(red[0], red[1], red[2])
+		}
+		for i, cell := range row {
+			pdf.CellFormat(runWidths[i], 5, cell, "1", 0, "L", false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	if len(a.Runs) == 0 {
+		pdf.SetTextColor(red[0], red[1], red[2])
+		pdf.CellFormat(0, 5, "No runs were recorded this month.", "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(5)
+
+	pdfFooter(pdf, gray)
+	return pdf.OutputFileAndClose(pdfPath)
+}
+
+// writeAttestation saves an attestation as PDF and JSON in the reports
+// directory and returns both paths.
+func writeAttestation(a *attestation) (pdfPath, jsonPath string, err error) {
+	dir, err := getReportsDir()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create reports directory: %w", err)
+	}
+	base := filepath.Join(dir, attestationBaseName(a))
+
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return "", "", err
+	}
+	jsonPath = base + ".json"
+	if err := writeFileAtomic(jsonPath, append(data, '\n'), 0644); err != nil {
+		return "", "", err
+	}
+	pdfPath = base + ".pdf"
+	if err := generateAttestationPDF(a, pdfPath); err != nil {
+		return "", jsonPath, fmt.Errorf("failed to write PDF attestation: %w", err)
+	}
+	chownToRealUser(jsonPath)
+	chownToRealUser(pdfPath)
+	return pdfPath, jsonPath, nil
+}
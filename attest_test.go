@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// attestRun is a recorded backup of home and atuin, with atuin failing when
+// failed is set.
+func attestRun(end time.Time, failed bool) historyRecord {
+	outcome, atuin := notifySuccess, "done"
+	if failed {
+		outcome, atuin = notifyPartial, "error"
+	}
+	return historyRecord{
+		Operation: "backup", Host: "abyss", Source: "NIXROOT", Destination: "NIXBACKUPS",
+		StartTime: end.Add(-time.Hour), EndTime: end, DurationSeconds: 3600, Outcome: outcome,
+		Datasets: []historyDataset{{Name: "home", Status: "done"}, {Name: "atuin", Status: atuin}},
+	}
+}
+
+func TestParseAttestMonth(t *testing.T) {
+	start, end, err := parseAttestMonth("2026-09", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !start.Equal(time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)) || !end.Equal(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected bounds %s to %s", start, end)
+	}
+	if _, _, err := parseAttestMonth("September", time.UTC); err == nil {
+		t.Error("a month that is not YYYY-MM should be an error")
+	}
+}
+
+func TestSummariseRunsCountsOutcomesAndLongestGaps(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 9, d, 2, 0, 0, 0, time.UTC) }
+	a := &attestation{PeriodStart: day(1).Add(-2 * time.Hour), PeriodEnd: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)}
+	records := []historyRecord{
+		attestRun(day(20), false),
+		attestRun(day(1).AddDate(0, 0, -2), false), // August: starts the first gap
+		attestRun(day(5), true),
+		attestRun(day(10), false),
+	}
+
+	a.summariseRuns(records, a.PeriodEnd)
+	if len(a.Runs) != 3 || a.Successful != 2 || a.Partial != 1 || a.Failed != 0 {
+		t.Errorf("expected 3 runs, 2 successful and 1 partial, got %d runs %d/%d/%d", len(a.Runs), a.Successful, a.Partial, a.Failed)
+	}
+	if a.SuccessRate < 0.66 || a.SuccessRate > 0.67 {
+		t.Errorf("expected a success rate of 2/3, got %f", a.SuccessRate)
+	}
+
+	gaps := map[string]attestationDataset{}
+	for _, ds := range a.Datasets {
+		gaps[ds.Name] = ds
+	}
+	// home: 30 Aug, 5, 10, 20 Sep and the month end - the last stretch is longest.
+	if home := gaps["home"]; !home.LongestGapStart.Equal(day(20)) || home.SuccessfulRuns != 3 {
+		t.Errorf("home's longest gap should run from its last backup to the month end, got %+v", home)
+	}
+	// atuin failed on the 5th, so its gap runs from 30 August to 10 September.
+	if atuin := gaps["atuin"]; !atuin.LongestGapEnd.Equal(day(10)) || atuin.longestGap() != day(10).Sub(day(1).AddDate(0, 0, -2)) {
+		t.Errorf("atuin's longest gap should span its failed run, got %+v", atuin)
+	}
+}
+
+func TestAddRetentionReadsHostNamespace(t *testing.T) {
+	a := &attestation{Host: "abyss", Pool: "NIXBACKUPS", Datasets: []attestationDataset{{Name: "home"}}}
+	old := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	recent := time.Date(2026, 9, 30, 0, 0, 0, 0, time.UTC)
+	a.addRetention([]snapshotEntry{
+		{Dataset: "NIXBACKUPS/abyss/home", Tag: "2026-09-30.00h-00-Backup", Creation: recent},
+		{Dataset: "NIXBACKUPS/abyss/home", Tag: "2026-06-01.00h-00-Backup", Creation: old},
+		{Dataset: "NIXBACKUPS/abyss/home", Tag: "autosnap_2026-09-30_hourly", Creation: recent.Add(time.Hour)},
+		{Dataset: "NIXBACKUPS/abyss/nix", Tag: "2026-09-30.00h-00-Backup", Creation: recent},
+		{Dataset: "NIXBACKUPS/server/home", Tag: "2026-09-30.00h-00-Backup", Creation: recent},
+	})
+
+	if len(a.Datasets) != 2 || a.Datasets[0].Name != "home" || a.Datasets[1].Name != "nix" {
+		t.Fatalf("expected home and the held-only nix, got %+v", a.Datasets)
+	}
+	home := a.Datasets[0]
+	if home.SnapshotsHeld != 2 || !home.OldestSnapshot.Equal(old) || !home.NewestSnapshot.Equal(recent) {
+		t.Errorf("expected two backup snapshots from June to September, got %+v", home)
+	}
+}
+
+func TestScrubStatusLine(t *testing.T) {
+	status := "  pool: NIXBACKUPS\n state: ONLINE\n  scan: scrub repaired 0B in 01:02:03 with 0 errors on Sun Sep 13 03:00:00 2026\nconfig:\n"
+	if got := scrubStatusLine(status); got != "scrub repaired 0B in 01:02:03 with 0 errors on Sun Sep 13 03:00:00 2026" {
+		t.Errorf("unexpected scan line %q", got)
+	}
+	if got := scrubStatusLine("  pool: X\n state: ONLINE\nconfig:\n"); got != "" {
+		t.Errorf("a pool never scrubbed has no scan line, got %q", got)
+	}
+}
+
+func TestBuildAttestationRecordsWhatItCannotRead(t *testing.T) {
+	useTempHome(t)
+	r := &fakeRunner{respond: func(name string, args []string) (string, error) {
+		if name == "zpool" {
+			return "  scan: scrub repaired 0B in 00:10:00 with 0 errors on Sun Sep 13 03:00:00 2026\n", nil
+		}
+		return "", errors.New("dataset does not exist")
+	}}
+	now := time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC)
+	opts := attestOptions{Month: "2026-09", Host: "server-not-this-one", Pool: "NIXBACKUPS", SourcePool: "NIXROOT"}
+
+	a, err := buildAttestation(context.Background(), r, opts, nil, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.RetentionError == "" || !strings.Contains(a.Scrub, "0 errors") || a.DoctorError == "" {
+		t.Errorf("expected the retention and doctor gaps recorded and the scrub read, got %+v", a)
+	}
+
+	pdfPath, jsonPath, err := writeAttestation(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{pdfPath, jsonPath} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %s to be written: %v", path, err)
+		}
+	}
+	if want := fmt.Sprintf("Attestation-%s-NIXBACKUPS-2026-09.json", opts.Host); !strings.HasSuffix(jsonPath, want) {
+		t.Errorf("expected the JSON saved as %s, got %s", want, jsonPath)
+	}
+}
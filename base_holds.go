@@ -0,0 +1,283 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// Incremental base holds
+// =============================================================================
+//
+// The newest snapshot a dataset shares with its backup is the only thing that
+// keeps the next send incremental: destroy it on either side and the dataset
+// has to be sent in full again. After each successful sync zfs-backup places
+// a zfs-backup-base hold on that snapshot on both sides, which makes
+// `zfs destroy` refuse it whoever runs it, and moves the hold forward on the
+// next sync.
+
+// baseHoldTag is the user hold zfs-backup keeps on each incremental base.
+const baseHoldTag = "zfs-backup-base"
+
+// errIncrementalBase is returned when pruning reaches a snapshot that is
+// still held as the incremental base.
+var errIncrementalBase = errors.New("snapshot is held as the incremental base")
+
+// newestCommonSnapshot returns the tag of the newest snapshot the source
+// shares with the destination, or "" when they share none.
+func newestCommonSnapshot(source, dest []snapshotEntry) string {
+	onDest := map[string]bool{}
+	for _, e := range dest {
+		onDest[e.Tag] = true
+	}
+	sorted := append([]snapshotEntry(nil), source...)
+	sortSnapshotsNewestFirst(sorted)
+	for _, e := range sorted {
+		if onDest[e.Tag] {
+			return e.Tag
+		}
+	}
+	return ""
+}
+
+// findIncrementalBase lists both sides of a replication and returns the tag
+// of their newest common snapshot. Each side is read through its own runner,
+// so either may be on a remote host.
+func findIncrementalBase(ctx context.Context, src commandRunner, source string, dst commandRunner, dest string) (string, error) {
+	sourceEntries, err := listSnapshotEntries(ctx, src, source, 1)
+	if err != nil {
+		return "", fmt.Errorf("could not list snapshots of %s: %w", source, err)
+	}
+	destEntries, err := listSnapshotEntries(ctx, dst, dest, 1)
+	if err != nil {
+		return "", fmt.Errorf("could not list snapshots of %s: %w", dest, err)
+	}
+	return newestCommonSnapshot(sourceEntries, destEntries), nil
+}
+
+// moveBaseHold puts the base hold on dataset@tag and then releases it from
+// every other snapshot of the dataset. The new hold is placed before any old
+// one is released, so at no point is the dataset left without a held base.
+func moveBaseHold(ctx context.Context, r commandRunner, dataset, tag string) error {
+	holds, err := listHoldsUnder(ctx, r, dataset, 1)
+	if err != nil {
+		return fmt.Errorf("could not list holds on %s: %w", dataset, err)
+	}
+	target := dataset + "@" + tag
+
+	held := false
+	for _, h := range holds {
+		if h.Tag == baseHoldTag && h.Snapshot == target {
+			held = true
+		}
+	}
+	if !held {
+		if err := r.Run(ctx, "zfs", "hold", baseHoldTag, target); err != nil {
+			return fmt.Errorf("could not hold %s: %w", target, err)
+		}
+	}
+
+	for _, h := range holds {
+		if h.Tag != baseHoldTag || h.Snapshot == target {
+			continue
+		}
+		if err := r.Run(ctx, "zfs", "release", baseHoldTag, h.Snapshot); err != nil {
+			return fmt.Errorf("could not release the old base %s: %w", h.Snapshot, err)
+		}
+	}
+	return nil
+}
+
+// holdIncrementalBase moves the base hold on both sides of a replication to
+// their newest common snapshot, and returns its tag. Nothing is held when
+// the two sides share no snapshot.
+func holdIncrementalBase(ctx context.Context, src commandRunner, source string, dst commandRunner, dest string) (string, error) {
+	tag, err := findIncrementalBase(ctx, src, source, dst, dest)
+	if err != nil || tag == "" {
+		return "", err
+	}
+	if err := moveBaseHold(ctx, src, source, tag); err != nil {
+		return "", err
+	}
+	if err := moveBaseHold(ctx, dst, dest, tag); err != nil {
+		return "", err
+	}
+	return tag, nil
+}
+
+// holdPulledBase moves the base hold on a pull's copy on the backup pool.
+// Pulls keep syncoid's sync snapshots, so the newest common snapshot is
+// usually syncoid's own, and a hold on it would stop syncoid pruning it on
+// the next pull. Only the newest common zfs-backup snapshot is held; with
+// none, the copy holds no base at all. The remote side is never held.
+func holdPulledBase(ctx context.Context, src commandRunner, source string, dst commandRunner, dest string) (string, error) {
+	sourceEntries, err := listSnapshotEntries(ctx, src, source, 1)
+	if err != nil {
+		return "", fmt.Errorf("could not list snapshots of %s: %w", source, err)
+	}
+	destEntries, err := listSnapshotEntries(ctx, dst, dest, 1)
+	if err != nil {
+		return "", fmt.Errorf("could not list snapshots of %s: %w", dest, err)
+	}
+	tag := newestCommonSnapshot(filterBackupSnapshots(sourceEntries), filterBackupSnapshots(destEntries))
+	if tag == "" {
+		return "", releaseBaseHolds(ctx, dst, dest)
+	}
+	if err := moveBaseHold(ctx, dst, dest, tag); err != nil {
+		return "", err
+	}
+	return tag, nil
+}
+
+// releaseBaseHolds releases the base hold from every snapshot of a dataset.
+// Force Backup needs it: syncoid --force-delete must be free to destroy
+// destination snapshots the source no longer has, including the old base.
+func releaseBaseHolds(ctx context.Context, r commandRunner, dataset string) error {
+	holds, err := listHoldsUnder(ctx, r, dataset, 1)
+	if err != nil {
+		return fmt.Errorf("could not list holds on %s: %w", dataset, err)
+	}
+	for _, h := range holds {
+		if h.Tag != baseHoldTag {
+			continue
+		}
+		if err := r.Run(ctx, "zfs", "release", baseHoldTag, h.Snapshot); err != nil {
+			return fmt.Errorf("could not release %s: %w", h.Snapshot, err)
+		}
+	}
+	return nil
+}
+
+// writeBaseHold reports the outcome of holdIncrementalBase in a run's output.
+// A hold that could not be moved is only a warning: the data is replicated,
+// the base is just not protected until the next run.
+func writeBaseHold(output *strings.Builder, dataset, tag string, err error) {
+	switch {
+	case err != nil:
+		output.WriteString(fmt.Sprintf("Warning: could not hold the incremental base of %s: %v\n", dataset, err))
+	case tag != "":
+		output.WriteString(fmt.Sprintf("Held %s@%s as the incremental base\n", dataset, tag))
+	}
+}
+
+// snapshotHoldTags returns the tags of every user hold on a snapshot.
+func snapshotHoldTags(ctx context.Context, r commandRunner, snapshot string) ([]string, error) {
+	output, err := r.Output(ctx, "zfs", "holds", "-H", snapshot)
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	for _, row := range strings.Split(strings.TrimSpace(output), "\n") {
+		if fields := strings.Split(row, "\t"); len(fields) >= 2 {
+			tags = append(tags, fields[1])
+		}
+	}
+	return tags, nil
+}
+
+// allowRetiredHolds clears snapshots vetOrphans skipped only for holds that
+// no longer protect anything once a dataset is retired: its base hold, since
+// nothing will ever send to it again, and retention holds that have aged out
+// of the window. It is for --retire alone. The holds are released just
+// before the snapshot is destroyed; a retention hold still inside the window
+// keeps the snapshot.
+func allowRetiredHolds(ctx context.Context, r commandRunner, decisions []destroyDecision, window time.Duration, now time.Time) {
+	for i, d := range decisions {
+		if d.SkipReason != skipHeld {
+			continue
+		}
+		tags, err := snapshotHoldTags(ctx, r, d.Orphan.Name)
+		if err != nil || len(tags) == 0 {
+			continue
+		}
+		releasable := true
+		for _, tag := range tags {
+			switch {
+			case tag == baseHoldTag:
+			case tag == retentionHoldTag && retentionExpired(d.Orphan.Creation, window, now):
+			default:
+				releasable = false
+			}
+		}
+		if !releasable {
+			continue
+		}
+		if snapshotHasClones(ctx, r, d.Orphan.Name) {
+			decisions[i].SkipReason = skipCloned
+			continue
+		}
+		decisions[i] = destroyDecision{Orphan: d.Orphan, Safe: true, Release: tags}
+	}
+}
+
+// =============================================================================
+// Doctor
+// =============================================================================
+
+// checkUnheldBases flags datasets whose newest common snapshot with the
+// backup pool is missing the base hold on either side, so anything that
+// destroys it forces a full resend.
+func checkUnheldBases(ctx context.Context, r commandRunner, scan *orphanScan) []doctorFinding {
+	view := scan.backupView(ctx, r)
+	if view.Err != nil {
+		return backupPoolSkipped(view.Err)
+	}
+	held := map[string]bool{}
+	for _, pool := range []string{scan.Pool, scan.BackupPool} {
+		holds, err := listHolds(ctx, r, pool)
+		if err != nil {
+			return []doctorFinding{{
+				Severity: severityWarning,
+				Summary:  fmt.Sprintf("could not list holds on %s: %v", pool, err),
+			}}
+		}
+		for _, h := range holds {
+			if h.Tag == baseHoldTag {
+				held[h.Snapshot] = true
+			}
+		}
+	}
+
+	bySource := map[string][]snapshotEntry{}
+	for _, e := range scan.Entries {
+		bySource[e.Dataset] = append(bySource[e.Dataset], e)
+	}
+
+	var findings []doctorFinding
+	for _, ds := range scan.InScope {
+		source := fmt.Sprintf("%s/%s", scan.Pool, ds)
+		dest := view.destinationFor(scan.BackupPool, scan.Host, ds)
+		tag := newestCommonSnapshot(bySource[source], view.Snapshots[dest])
+		if tag == "" {
+			continue // no base at all: the broken-chains check says so
+		}
+
+		var unheld []string
+		var commands [][]string
+		for _, snapshot := range []string{source + "@" + tag, dest + "@" + tag} {
+			if !held[snapshot] {
+				unheld = append(unheld, snapshot)
+				commands = append(commands, []string{"hold", baseHoldTag, snapshot})
+			}
+		}
+		if len(unheld) == 0 {
+			continue
+		}
+		findings = append(findings, doctorFinding{
+			Severity: severityWarning,
+			Dataset:  source,
+			Summary:  "incremental base " + tag + " is not held, so anything can destroy it",
+			Evidence: []string{fmt.Sprintf("no %s hold on %s", baseHoldTag, strings.Join(unheld, " or "))},
+			Remediation: "the next successful backup holds it, or sudo zfs hold " + baseHoldTag + " " +
+				strings.Join(unheld, " "),
+			Fix: zfsFix(commands...),
+		})
+	}
+	return findings
+}
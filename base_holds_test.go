@@ -0,0 +1,157 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHoldIncrementalBaseMovesTheHoldForward(t *testing.T) {
+	day := func(dataset string, days ...int) string {
+		var b strings.Builder
+		for _, d := range days {
+			fmt.Fprintf(&b, "%s@2026-10-%02d.02h-00-Backup\t%d\t1024\n",
+				dataset, d, time.Date(2026, 10, d, 2, 0, 0, 0, time.UTC).Unix())
+		}
+		return b.String()
+	}
+	r := pruneFixtureRunner(map[string]string{
+		"NIXROOT/home":          day("NIXROOT/home", 16, 17, 18),
+		"NIXBACKUPS/abyss/home": day("NIXBACKUPS/abyss/home", 16, 17),
+	}, map[string][]string{
+		"NIXROOT/home@2026-10-16.02h-00-Backup":          {baseHoldTag},
+		"NIXBACKUPS/abyss/home@2026-10-16.02h-00-Backup": {baseHoldTag, "keep"},
+	})
+
+	tag, err := holdIncrementalBase(context.Background(), r, "NIXROOT/home", r, "NIXBACKUPS/abyss/home")
+	if err != nil || tag != "2026-10-17.02h-00-Backup" {
+		t.Fatalf("expected the newest common snapshot as the base, got %q, %v", tag, err)
+	}
+	var changes []string
+	for _, line := range r.commandLines() {
+		if strings.Contains(line, " hold ") || strings.Contains(line, " release ") {
+			changes = append(changes, line)
+		}
+	}
+	want := []string{
+		"zfs hold zfs-backup-base NIXROOT/home@2026-10-17.02h-00-Backup",
+		"zfs release zfs-backup-base NIXROOT/home@2026-10-16.02h-00-Backup",
+		"zfs hold zfs-backup-base NIXBACKUPS/abyss/home@2026-10-17.02h-00-Backup",
+		"zfs release zfs-backup-base NIXBACKUPS/abyss/home@2026-10-16.02h-00-Backup",
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("expected each side held before its old base is released, got %v", changes)
+	}
+}
+
+func TestPruneKeepsTheHeldBase(t *testing.T) {
+	var listing strings.Builder
+	for d := 1; d <= 10; d++ {
+		fmt.Fprintf(&listing, "NIXROOT/home@2026-08-%02d.10h-00-Backup\t%d\t1024\n",
+			d, time.Date(2026, 8, d, 10, 0, 0, 0, time.UTC).Unix())
+	}
+	r := pruneFixtureRunner(map[string]string{"NIXROOT/home": listing.String()},
+		map[string][]string{"NIXROOT/home@2026-08-02.10h-00-Backup": {baseHoldTag}})
+
+	result := pruneLocalSnapshots(context.Background(), r, "NIXROOT", []string{"home"}, 7)
+	if len(result.Warnings) != 0 || len(result.Pruned) != 2 {
+		t.Errorf("expected the base kept quietly and the other two pruned, got %+v", result)
+	}
+	if r.ran("2026-08-02.10h-00-Backup", "bookmark") || r.ran("destroy NIXROOT/home@2026-08-02") {
+		t.Error("the held base must not be bookmarked or destroyed")
+	}
+}
+
+func TestUnheldBasesAndRetiredBases(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	tag := "2026-10-18.02h-00-Backup"
+	r := pruneFixtureRunner(map[string]string{
+		"NIXBACKUPS": fmt.Sprintf("NIXBACKUPS/abyss/home@%s\t%d\t1024\nNIXBACKUPS/abyss/nix@%s\t%d\t1024\n",
+			tag, now.Unix(), tag, now.Unix()),
+	}, map[string][]string{
+		"NIXROOT/home@" + tag:          {baseHoldTag},
+		"NIXBACKUPS/abyss/home@" + tag: {baseHoldTag},
+		"NIXROOT/nix@" + tag:           {baseHoldTag},
+		"NIXBACKUPS/abyss/nix@" + tag:  {"keep"},
+	})
+	snapshots := r.respond
+	r.respond = func(name string, args []string) (string, error) {
+		if strings.Join(args, " ") == "list -H -o name -r NIXBACKUPS" {
+			return "NIXBACKUPS\nNIXBACKUPS/abyss\nNIXBACKUPS/abyss/home\nNIXBACKUPS/abyss/nix\n", nil
+		}
+		return snapshots(name, args)
+	}
+	scan := &orphanScan{
+		Pool:    "NIXROOT",
+		InScope: []string{"home", "nix"},
+		Entries: []snapshotEntry{
+			{Name: "NIXROOT/home@" + tag, Dataset: "NIXROOT/home", Tag: tag, Creation: now},
+			{Name: "NIXROOT/nix@" + tag, Dataset: "NIXROOT/nix", Tag: tag, Creation: now},
+		},
+		ScanTime:   now,
+		BackupPool: "NIXBACKUPS",
+		Host:       "abyss",
+	}
+
+	findings := checkUnheldBases(context.Background(), r, scan)
+	if len(findings) != 1 || findings[0].Dataset != "NIXROOT/nix" ||
+		!reflect.DeepEqual(findings[0].Fix.Plan, []string{"zfs hold zfs-backup-base NIXBACKUPS/abyss/nix@" + tag}) {
+		t.Fatalf("expected nix's unheld destination base with a hold fix, got %+v", findings)
+	}
+
+	// Retiring a dataset may destroy its base, but not a snapshot someone
+	// else holds too.
+	orphan := func(name string) orphanSnapshot {
+		dataset, tag, _ := splitSnapshot(name)
+		return orphanSnapshot{snapshotEntry: snapshotEntry{Name: name, Dataset: dataset, Tag: tag}}
+	}
+	decisions := []destroyDecision{
+		{Orphan: orphan("NIXBACKUPS/abyss/home@" + tag), SkipReason: skipHeld},
+		{Orphan: orphan("NIXBACKUPS/abyss/nix@" + tag), SkipReason: skipHeld},
+	}
+	allowRetiredHolds(context.Background(), r, decisions, 30*24*time.Hour, now)
+	if !decisions[0].Safe || !reflect.DeepEqual(decisions[0].Release, []string{baseHoldTag}) || decisions[1].Safe {
+		t.Errorf("expected only the base-held snapshot cleared for release, got %+v", decisions)
+	}
+}
+
+func TestPullNeverHoldsASyncoidSnapshot(t *testing.T) {
+	at := func(d int) int64 { return time.Date(2026, 10, d, 2, 0, 0, 0, time.UTC).Unix() }
+	listing := func(dataset string) string {
+		return fmt.Sprintf("%s@2026-10-16.02h-00-Backup\t%d\t1024\n%s@syncoid_abyss_2026-10-17:02:00:00\t%d\t1024\n",
+			dataset, at(16), dataset, at(17))
+	}
+	r := pruneFixtureRunner(map[string]string{
+		"NIXROOT/home":           listing("NIXROOT/home"),
+		"NIXBACKUPS/server/home": listing("NIXBACKUPS/server/home"),
+	}, nil)
+
+	tag, err := holdPulledBase(context.Background(), r, "NIXROOT/home", r, "NIXBACKUPS/server/home")
+	if err != nil || tag != "2026-10-16.02h-00-Backup" {
+		t.Fatalf("expected the newest common zfs-backup snapshot held, not syncoid's, got %q, %v", tag, err)
+	}
+	if r.ran("hold zfs-backup-base", "syncoid_") || r.ran("hold zfs-backup-base NIXROOT/home") {
+		t.Errorf("syncoid's snapshot and the remote side must not be held, ran %v", r.commandLines())
+	}
+
+	// A remote with only syncoid's snapshots in common holds no base, and a
+	// hold an earlier version left on syncoid's snapshot is released.
+	syncoidOnly := fmt.Sprintf("NIXBACKUPS/server/home@syncoid_abyss_2026-10-17:02:00:00\t%d\t1024\n", at(17))
+	r = pruneFixtureRunner(map[string]string{
+		"NIXROOT/home":           syncoidOnly,
+		"NIXBACKUPS/server/home": syncoidOnly,
+	}, map[string][]string{"NIXBACKUPS/server/home@syncoid_abyss_2026-10-17:02:00:00": {baseHoldTag}})
+
+	if tag, err := holdPulledBase(context.Background(), r, "NIXROOT/home", r, "NIXBACKUPS/server/home"); err != nil || tag != "" {
+		t.Fatalf("expected no base held, got %q, %v", tag, err)
+	}
+	if r.ran("zfs hold ") || !r.ran("zfs release zfs-backup-base NIXBACKUPS/server/home@syncoid_abyss_2026-10-17:02:00:00") {
+		t.Errorf("expected the stale hold on syncoid's snapshot released and nothing held, ran %v", r.commandLines())
+	}
+}
@@ -0,0 +1,336 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// Bookmark retention
+// =============================================================================
+//
+// Every prune turns a snapshot into a bookmark, so without a rule of their own
+// bookmarks pile up by the thousand. Only the newest bookmarks are ever needed
+// as incremental bases, so zfs-backup keeps bookmarksKept of its own per
+// dataset, plus whichever one is the latest base the source shares with the
+// backup pool. Bookmarks that syncoid or anyone else made are left alone.
+
+// bookmarksKept is how many of zfs-backup's own bookmarks stay per dataset.
+const bookmarksKept = 30
+
+// Bookmark verdict reasons.
+const (
+	reasonCommonBase  = "latest common incremental base"
+	reasonBaseUnknown = "backup pool not readable, so the common base is unknown"
+)
+
+// splitBookmark splits POOL/ds#tag into its dataset and tag.
+func splitBookmark(name string) (dataset, tag string, ok bool) {
+	idx := strings.Index(name, "#")
+	if idx <= 0 || idx == len(name)-1 {
+		return "", "", false
+	}
+	return name[:idx], name[idx+1:], true
+}
+
+// parseBookmarkEntries parses the output of
+// `zfs list -H -p -t bookmark -o name,creation`. Bookmarks hold no data of
+// their own, so Used is always zero.
+func parseBookmarkEntries(output string) []snapshotEntry {
+	var entries []snapshotEntry
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		dataset, tag, ok := splitBookmark(strings.TrimSpace(fields[0]))
+		if !ok {
+			continue
+		}
+		entry := snapshotEntry{Name: strings.TrimSpace(fields[0]), Dataset: dataset, Tag: tag}
+		if len(fields) > 1 {
+			if secs, err := strconv.ParseInt(strings.TrimSpace(fields[1]), 10, 64); err == nil {
+				entry.Creation = time.Unix(secs, 0)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// listBookmarkEntries lists bookmarks at or below the given target, with the
+// same depth rules as listSnapshotEntries.
+func listBookmarkEntries(ctx context.Context, r commandRunner, target string, depth int) ([]snapshotEntry, error) {
+	args := []string{"list", "-H", "-p", "-t", "bookmark", "-o", "name,creation"}
+	if depth > 0 {
+		args = append(args, "-d", strconv.Itoa(depth))
+	} else {
+		args = append(args, "-r")
+	}
+	args = append(args, target)
+
+	output, err := r.Output(ctx, "zfs", args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseBookmarkEntries(output), nil
+}
+
+// explainBookmarkPrune decides every zfs-backup bookmark of one dataset,
+// newest first: the newest `keep` stay, as does base - the tag of the latest
+// incremental base - and the rest are destroyed.
+func explainBookmarkPrune(bookmarks []snapshotEntry, keep int, base string) []pruneVerdict {
+	own := filterBackupSnapshots(bookmarks)
+	sortSnapshotsNewestFirst(own)
+
+	verdicts := make([]pruneVerdict, 0, len(own))
+	for i, e := range own {
+		v := pruneVerdict{snapshotEntry: e}
+		switch {
+		case base != "" && e.Tag == base:
+			v.Reason = reasonCommonBase
+		case i < keep:
+			v.Reason = fmt.Sprintf("within keep=%d", keep)
+		default:
+			v.Prune, v.Reason = true, fmt.Sprintf("beyond keep=%d", keep)
+		}
+		verdicts = append(verdicts, v)
+	}
+	return verdicts
+}
+
+// datasetBookmarkPlan is one dataset's bookmarks and the retention decision
+// for each of zfs-backup's own.
+type datasetBookmarkPlan struct {
+	Dataset  string
+	Backup   bool // on the backup pool rather than the source
+	Verdicts []pruneVerdict
+	Other    int   // bookmarks zfs-backup did not make, never touched
+	Err      error // the dataset could not be read
+}
+
+// pruneCount is how many bookmarks the plan destroys.
+func (p datasetBookmarkPlan) pruneCount() int {
+	return len(prunedEntries(p.Verdicts))
+}
+
+// planDatasetBookmarks lists one dataset's bookmarks and decides them. base is
+// the latest common incremental base; known is false when it could not be
+// worked out, in which case nothing is destroyed.
+func planDatasetBookmarks(ctx context.Context, r commandRunner, dataset string, backup bool, keep int, base string, known bool) datasetBookmarkPlan {
+	plan := datasetBookmarkPlan{Dataset: dataset, Backup: backup}
+	bookmarks, err := listBookmarkEntries(ctx, r, dataset, 1)
+	if err != nil {
+		plan.Err = err
+		return plan
+	}
+	plan.Verdicts = explainBookmarkPrune(bookmarks, keep, base)
+	plan.Other = len(bookmarks) - len(plan.Verdicts)
+	if !known {
+		for i, v := range plan.Verdicts {
+			if v.Prune {
+				plan.Verdicts[i].Prune, plan.Verdicts[i].Reason = false, reasonBaseUnknown
+			}
+		}
+	}
+	return plan
+}
+
+// planBookmarks decides the bookmarks of every source dataset and, when
+// destinations is not nil, of their copies on the backup pool. destinations
+// must line up with sources, as backupDestinations returns them. Nothing is
+// changed.
+func planBookmarks(ctx context.Context, r commandRunner, sources, destinations []string, keep int) []datasetBookmarkPlan {
+	if keep < 1 {
+		keep = 1
+	}
+	var plans []datasetBookmarkPlan
+	for i, source := range sources {
+		// The latest base is the newest snapshot on the backup pool the
+		// source still has as a snapshot or a bookmark. Without the backup
+		// pool it cannot be known, so nothing on the source is destroyed.
+		base, known := "", false
+		if destinations != nil {
+			destEntries, destErr := listSnapshotEntries(ctx, r, destinations[i], 1)
+			sourceEntries, sourceErr := listSnapshotEntries(ctx, r, source, 1)
+			bookmarks, bookmarkErr := listBookmarkEntries(ctx, r, source, 1)
+			if destErr == nil && sourceErr == nil && bookmarkErr == nil {
+				base, known = newestCommonSnapshot(append(sourceEntries, bookmarks...), destEntries), true
+			}
+		}
+		plans = append(plans, planDatasetBookmarks(ctx, r, source, false, keep, base, known))
+	}
+	for _, dest := range destinations {
+		// The backup pool's own bookmarks are never a base for the next
+		// send, but keep the one matching its newest snapshot all the same.
+		entries, err := listSnapshotEntries(ctx, r, dest, 1)
+		if err != nil {
+			continue // not backed up yet: nothing to prune
+		}
+		base := ""
+		if own := filterBackupSnapshots(entries); len(own) > 0 {
+			sortSnapshotsNewestFirst(own)
+			base = own[0].Tag
+		}
+		plans = append(plans, planDatasetBookmarks(ctx, r, dest, true, keep, base, true))
+	}
+	return plans
+}
+
+// pruneBookmarks destroys the bookmarks the plans prune.
+func pruneBookmarks(ctx context.Context, r commandRunner, plans []datasetBookmarkPlan) pruneResult {
+	var result pruneResult
+	for _, p := range plans {
+		for _, e := range prunedEntries(p.Verdicts) {
+			if err := r.Run(ctx, "zfs", "destroy", e.Name); err != nil {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("failed to destroy bookmark %s: %v", e.Name, err))
+				continue
+			}
+			result.Pruned = append(result.Pruned, e.Name)
+		}
+	}
+	return result
+}
+
+// writeBookmarkResult appends a bookmark prune to a run's output. A first run
+// under the rule can remove thousands, so only the count is written.
+func writeBookmarkResult(output *strings.Builder, result pruneResult) {
+	if len(result.Pruned) == 0 {
+		output.WriteString("No bookmarks to prune.\n")
+	} else {
+		output.WriteString(fmt.Sprintf("Removed %d old bookmark(s), keeping the newest %d per dataset\n", len(result.Pruned), bookmarksKept))
+	}
+	for _, warning := range result.Warnings {
+		output.WriteString(fmt.Sprintf("Warning:%s\n", warning))
+	}
+}
+
+// renderBookmarkPlan renders bookmark plans for people to read. Shared by the
+// CLI and the TUI's Bookmarks screen.
+func renderBookmarkPlan(plans []datasetBookmarkPlan, now time.Time) string {
+	var b strings.Builder
+	total, pruned := 0, 0
+	for _, p := range plans {
+		side := "source"
+		if p.Backup {
+			side = "backup pool"
+		}
+		b.WriteString(fmt.Sprintf("%s (%s)\n", p.Dataset, side))
+		if p.Err != nil {
+			b.WriteString(fmt.Sprintf("  could not list bookmarks: %v\n\n", p.Err))
+			continue
+		}
+		if len(p.Verdicts) == 0 && p.Other == 0 {
+			b.WriteString("  no bookmarks\n\n")
+			continue
+		}
+		for _, v := range p.Verdicts {
+			action := "keep "
+			if v.Prune {
+				action = "PRUNE"
+			}
+			b.WriteString(fmt.Sprintf("  %s  %-28s %9s  %s\n", action, v.Tag, ageLabel(now.Sub(v.Creation)), v.Reason))
+		}
+		if p.Other > 0 {
+			b.WriteString(fmt.Sprintf("  plus %d bookmark(s) zfs-backup did not make, left alone\n", p.Other))
+		}
+		total += len(p.Verdicts) + p.Other
+		if n := p.pruneCount(); n > 0 {
+			pruned += n
+			b.WriteString(fmt.Sprintf("  %d to prune\n", n))
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString(fmt.Sprintf("%d bookmark(s) in total, %d beyond the retention rule.\n", total, pruned))
+	return b.String()
+}
+
+// =============================================================================
+// bookmarks
+// =============================================================================
+
+// bookmarkOptions are the command-line options for bookmarks.
+type bookmarkOptions struct {
+	Pool       string
+	BackupPool string // empty when no backup pool is imported
+	Dataset    string // limit to this dataset of the scope
+	Keep       int
+	Confirm    bool // --yes: actually prune
+	Force      bool // --force: skip the typed confirmation
+}
+
+// runBookmarks lists the bookmarks of a pool's scope and, when a backup pool
+// is given, of its copies there, with the retention decision for each. With
+// --yes and the typed confirmation it destroys the ones beyond the rule. It
+// returns the process exit code.
+func runBookmarks(ctx context.Context, r commandRunner, opts bookmarkOptions, destinations func([]string) []string, confirmFn func(string) bool) int {
+	datasets, _, err := resolveBackupDatasets(opts.Pool)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: failed to resolve backup scope: " + err.Error()))
+		return 1
+	}
+	if opts.Dataset != "" {
+		scoped := false
+		for _, ds := range datasets {
+			scoped = scoped || ds == opts.Dataset
+		}
+		if !scoped {
+			fmt.Println(errorStyle.Render(fmt.Sprintf("Error: %s is not in the backup scope of %s", opts.Dataset, opts.Pool)))
+			return 1
+		}
+		datasets = []string{opts.Dataset}
+	}
+
+	title := "Bookmarks: " + opts.Pool
+	var dests []string
+	if opts.BackupPool != "" {
+		title += " → " + opts.BackupPool
+		dests = destinations(datasets)
+	}
+	fmt.Println(titleStyle.Render(title))
+	fmt.Println()
+	if opts.BackupPool == "" {
+		fmt.Println(infoStyle.Render("No backup pool is imported - source bookmarks are listed but none can be pruned. Pass --dest POOL."))
+		fmt.Println()
+	}
+
+	plans := planBookmarks(ctx, r, qualifyDatasets(opts.Pool, datasets), dests, opts.Keep)
+	fmt.Print(renderBookmarkPlan(plans, time.Now()))
+	fmt.Println()
+
+	pruned := 0
+	for _, p := range plans {
+		pruned += p.pruneCount()
+	}
+	if pruned == 0 {
+		fmt.Println(statusStyle.Render("Nothing to prune."))
+		fmt.Println()
+		return 0
+	}
+	if !opts.Confirm {
+		fmt.Println(infoStyle.Render(fmt.Sprintf(
+			"Dry run - nothing has been pruned. Re-run with --yes to destroy these %d bookmark(s).", pruned)))
+		fmt.Println()
+		return 0
+	}
+	if !opts.Force && !confirmFn(fmt.Sprintf("Destroy %d bookmark(s)? Type PRUNE to continue: ", pruned)) {
+		fmt.Println(statusStyle.Render("Aborted. Nothing was pruned."))
+		fmt.Println()
+		return 1
+	}
+
+	result := pruneBookmarks(ctx, r, plans)
+	for _, warning := range result.Warnings {
+		fmt.Println(errorStyle.Render("  " + warning))
+	}
+	fmt.Println(statusStyle.Render(fmt.Sprintf("Destroyed %d of %d bookmark(s).", len(result.Pruned), pruned)))
+	fmt.Println()
+	if len(result.Warnings) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,128 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// bookmarkListing lists one bookmark a day for the days given, as
+// `zfs list -H -p -t bookmark -o name,creation` would.
+func bookmarkListing(dataset string, days ...int) string {
+	var b strings.Builder
+	for _, d := range days {
+		fmt.Fprintf(&b, "%s#2026-10-%02d.02h-00-Backup\t%d\n", dataset, d, time.Date(2026, 10, d, 2, 0, 0, 0, time.UTC).Unix())
+	}
+	return b.String()
+}
+
+func TestExplainBookmarkPruneKeepsTheNewestAndTheCommonBase(t *testing.T) {
+	bookmarks := parseBookmarkEntries(bookmarkListing("NIXROOT/home", 1, 2, 3, 4, 5) +
+		"NIXROOT/home#syncoid_abyss_2026-10-01:02:00:00\t1790000000\n")
+
+	var got []string
+	for _, v := range explainBookmarkPrune(bookmarks, 2, "2026-10-01.02h-00-Backup") {
+		got = append(got, fmt.Sprintf("%s %v %s", v.Tag, v.Prune, v.Reason))
+	}
+	want := []string{
+		"2026-10-05.02h-00-Backup false within keep=2",
+		"2026-10-04.02h-00-Backup false within keep=2",
+		"2026-10-03.02h-00-Backup true beyond keep=2",
+		"2026-10-02.02h-00-Backup true beyond keep=2",
+		"2026-10-01.02h-00-Backup false latest common incremental base",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("verdicts %v, want %v", got, want)
+	}
+}
+
+func TestPlanBookmarksNeedsTheBackupPoolToPruneTheSource(t *testing.T) {
+	r := &fakeRunner{respond: func(_ string, args []string) (string, error) {
+		joined := strings.Join(args, " ")
+		switch {
+		case joined == "list -H -p -t bookmark -o name,creation -d 1 NIXROOT/home":
+			return bookmarkListing("NIXROOT/home", 10, 11, 12, 13, 14), nil
+		case joined == "list -H -p -t bookmark -o name,creation -d 1 NIXBACKUPS/abyss/home":
+			return bookmarkListing("NIXBACKUPS/abyss/home", 8, 9, 10), nil
+		case joined == "list -H -p -t snapshot -o name,creation,used -d 1 NIXROOT/home":
+			return "NIXROOT/home@2026-10-18.02h-00-Backup\t1792288800\t0\n", nil
+		case joined == "list -H -p -t snapshot -o name,creation,used -d 1 NIXBACKUPS/abyss/home":
+			// The drive has been away: its newest snapshot is now only a
+			// bookmark on the source.
+			return "NIXBACKUPS/abyss/home@2026-10-10.02h-00-Backup\t1791597600\t0\n", nil
+		case args[0] == "destroy":
+			return "", nil
+		}
+		return "", fmt.Errorf("unexpected zfs %s", joined)
+	}}
+	ctx := context.Background()
+
+	unplugged := planBookmarks(ctx, r, []string{"NIXROOT/home"}, nil, 2)
+	if len(unplugged) != 1 || unplugged[0].pruneCount() != 0 {
+		t.Fatalf("without the backup pool no source bookmark may go, got %+v", unplugged)
+	}
+
+	plans := planBookmarks(ctx, r, []string{"NIXROOT/home"}, []string{"NIXBACKUPS/abyss/home"}, 2)
+	result := pruneBookmarks(ctx, r, plans)
+	want := []string{
+		"NIXROOT/home#2026-10-12.02h-00-Backup",
+		"NIXROOT/home#2026-10-11.02h-00-Backup",
+		"NIXBACKUPS/abyss/home#2026-10-08.02h-00-Backup",
+	}
+	if !reflect.DeepEqual(result.Pruned, want) {
+		t.Errorf("pruned %v, want %v", result.Pruned, want)
+	}
+	if r.ran("destroy NIXROOT/home#2026-10-10.02h-00-Backup") {
+		t.Error("the latest common base must survive the retention rule")
+	}
+	if rendered := renderBookmarkPlan(plans, time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)); !strings.Contains(rendered, "8 bookmark(s) in total, 3 beyond the retention rule.") {
+		t.Errorf("expected the totals in the listing:\n%s", rendered)
+	}
+}
+
+func TestCheckExcessBookmarks(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	var days []int
+	for d := 1; d <= 18; d++ {
+		days = append(days, d)
+	}
+	// 36 bookmarks over September and October.
+	listing := bookmarkListing("NIXROOT/home", days...) +
+		strings.ReplaceAll(bookmarkListing("NIXROOT/home", days...), "-10-", "-09-")
+	r := &fakeRunner{respond: func(_ string, args []string) (string, error) {
+		joined := strings.Join(args, " ")
+		switch {
+		case strings.Contains(joined, "-t bookmark"):
+			return listing, nil
+		case strings.Contains(joined, "-t snapshot"):
+			return fmt.Sprintf("NIXBACKUPS/abyss/home@2026-09-01.02h-00-Backup\t%d\t0\n", now.AddDate(0, -1, 0).Unix()), nil
+		case strings.HasPrefix(joined, "list -H -o name -r NIXBACKUPS"):
+			return "NIXBACKUPS\nNIXBACKUPS/abyss\nNIXBACKUPS/abyss/home\n", nil
+		}
+		return "", fmt.Errorf("unexpected zfs %s", joined)
+	}}
+	scan := &orphanScan{Pool: "NIXROOT", InScope: []string{"home"}, ScanTime: now, BackupPool: "NIXBACKUPS", Host: "abyss"}
+
+	findings := checkExcessBookmarks(context.Background(), r, scan)
+	if len(findings) != 1 {
+		t.Fatalf("expected one finding, got %+v", findings)
+	}
+	f := findings[0]
+	if f.Summary != "36 zfs-backup bookmarks, 5 beyond the newest 30" {
+		t.Errorf("unexpected summary %q", f.Summary)
+	}
+	if f.Fix == nil || len(f.Fix.Plan) != 5 {
+		t.Fatalf("expected a fix destroying the five excess bookmarks, got %+v", f.Fix)
+	}
+	for _, line := range f.Fix.Plan {
+		if strings.Contains(line, "2026-09-01") {
+			t.Errorf("the fix must keep the latest common base, planned %q", line)
+		}
+	}
+}
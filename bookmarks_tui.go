@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// stateBookmarks is the Bookmarks screen.
+const stateBookmarks sessionState = 106
+
+// =============================================================================
+// Bookmarks
+// =============================================================================
+
+// bookmarksLoadedMsg carries a pool's rendered bookmark listing.
+type bookmarksLoadedMsg struct {
+	pool       string
+	backupPool string
+	content    string
+	excess     int
+	err        error
+}
+
+// loadBookmarks lists the bookmarks of a pool's scope and, if a backup pool
+// is imported, of its copies there, with the retention decision for each.
+func loadBookmarks(pool string) tea.Cmd {
+	return func() tea.Msg {
+		datasets, _, err := resolveBackupDatasets(pool)
+		if err != nil {
+			return bookmarksLoadedMsg{pool: pool, err: fmt.Errorf("failed to resolve backup scope: %w", err)}
+		}
+		var backupPool string
+		var destinations []string
+		if _, detected := detectPools(getAvailablePools()); detected != pool {
+			backupPool = detected
+		}
+		if backupPool != "" {
+			destinations = backupDestinations(backupPool, getLocalHostname(), datasets)
+		}
+
+		plans := planBookmarks(context.Background(), defaultRunner, qualifyDatasets(pool, datasets), destinations, bookmarksKept)
+		excess := 0
+		for _, p := range plans {
+			excess += p.pruneCount()
+		}
+		return bookmarksLoadedMsg{pool: pool, backupPool: backupPool, content: renderBookmarkPlan(plans, time.Now()), excess: excess}
+	}
+}
+
+// updateBookmarksScreen handles keys for the Bookmarks screen.
+func (m model) updateBookmarksScreen(msg tea.KeyMsg) (model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		m.quitting = true
+		return m, tea.Quit
+	case "esc", "q":
+		m.state = stateMenu
+		m.bookmarksReady = false
+		return m, nil
+	case "r":
+		m.bookmarksReady = false
+		return m, tea.Batch(m.spinner.Tick, loadBookmarks(m.bookmarksPool))
+	default:
+		var cmd tea.Cmd
+		m.bookmarksViewport, cmd = m.bookmarksViewport.Update(msg)
+		return m, cmd
+	}
+}
+
+// renderBookmarksContent draws the Bookmarks screen.
+func (m model) renderBookmarksContent(width int) string {
+	if !m.bookmarksReady {
+		return lipgloss.NewStyle().
+			Width(width).
+			Align(lipgloss.Center).
+			Render(m.spinner.View() + " Listing bookmarks...")
+	}
+
+	var b strings.Builder
+
+	heading := "Bookmarks: " + m.bookmarksPool
+	if m.bookmarksBackupPool != "" {
+		heading += " → " + m.bookmarksBackupPool
+	}
+	title := selectedItemStyle.Render(heading)
+	b.WriteString(lipgloss.NewStyle().Width(width).Align(lipgloss.Center).Render(title))
+	b.WriteString("\n\n")
+
+	b.WriteString(m.bookmarksViewport.View())
+	b.WriteString("\n")
+
+	verdict := statusStyle.Render(fmt.Sprintf("Every dataset is within the newest %d bookmarks", bookmarksKept))
+	if m.bookmarksExcess > 0 {
+		verdict = infoStyle.Render(fmt.Sprintf("%d bookmark(s) beyond the rule - the next run prunes them, or run: sudo zfs-backup bookmarks --yes", m.bookmarksExcess))
+	}
+	if m.bookmarksBackupPool == "" {
+		verdict += "\n" + warningStyle.Render("No backup pool is imported - the common base is unknown, so source bookmarks are all kept")
+	}
+	b.WriteString(lipgloss.NewStyle().Width(width).Align(lipgloss.Center).Render(verdict))
+	b.WriteString("\n")
+
+	scrollInfo := subtitleStyle.Render(fmt.Sprintf(
+		"Scroll: j/k or arrows | %d%% | r refresh | esc/q to return",
+		int(m.bookmarksViewport.ScrollPercent()*100)))
+	b.WriteString(lipgloss.NewStyle().Width(width).Align(lipgloss.Center).Render(scrollInfo))
+
+	return b.String()
+}
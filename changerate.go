@@ -0,0 +1,292 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// =============================================================================
+// Change-rate anomaly detection
+// =============================================================================
+//
+// Ransomware encrypting a home directory, or a runaway job rewriting a
+// database, shows up first as a dataset writing far more between two backups
+// than it ever has before. Each backup measures what every dataset in scope
+// wrote since its previous backup snapshot - the new snapshot's written@
+// property - and records it in the run history. A dataset writing
+// changeRateAnomalyFactor times its usual rate is flagged in the run log, the
+// report and the notification, and its snapshots on the backup pool are not
+// pruned that run: if the change is an attack, the backups from before it
+// are the ones worth keeping.
+
+const (
+	// changeRateAnomalyFactor flags a dataset writing this many times its
+	// usual rate.
+	changeRateAnomalyFactor = 10
+	// changeRateMinSamples is how many earlier measurements a dataset needs
+	// before its rate is judged; until then nothing is "usual" yet.
+	changeRateMinSamples = 3
+	// changeRateSamples is how many of the latest measurements make up the
+	// usual rate.
+	changeRateSamples = 10
+)
+
+// changeRate is what one dataset wrote between two backup snapshots.
+type changeRate struct {
+	Dataset  string // relative to the pool, as in the scope
+	Written  int64  // bytes written since the previous backup snapshot
+	Interval time.Duration
+	Since    string // tag of the previous backup snapshot
+}
+
+// perHour is the rate in bytes per hour.
+func (c changeRate) perHour() float64 {
+	if c.Interval <= 0 {
+		return 0
+	}
+	return float64(c.Written) / c.Interval.Hours()
+}
+
+// measureChangeRate reads what pool/dataset wrote between its previous backup
+// snapshot and dataset@tag. It returns false when there is no earlier backup
+// snapshot to measure from, as on a dataset's first backup.
+func measureChangeRate(ctx context.Context, r commandRunner, pool, dataset, tag string) (changeRate, bool, error) {
+	full := fmt.Sprintf("%s/%s", pool, dataset)
+	entries, err := listSnapshotEntries(ctx, r, full, 1)
+	if err != nil {
+		return changeRate{}, false, fmt.Errorf("could not list snapshots of %s: %w", full, err)
+	}
+	sortSnapshotsNewestFirst(entries)
+
+	var current *snapshotEntry
+	for i, e := range entries {
+		if e.Tag == tag {
+			current = &entries[i]
+			continue
+		}
+		if current == nil || !isBackupSnapshotTag(e.Tag) || !e.Creation.Before(current.Creation) {
+			continue
+		}
+		output, err := r.Output(ctx, "zfs", "get", "-H", "-p", "-o", "value", "written@"+e.Tag, current.Name)
+		if err != nil {
+			return changeRate{}, false, fmt.Errorf("could not read written@%s of %s: %w", e.Tag, current.Name, err)
+		}
+		written, err := strconv.ParseInt(strings.TrimSpace(output), 10, 64)
+		if err != nil {
+			return changeRate{}, false, fmt.Errorf("could not parse written@%s of %s: %q", e.Tag, current.Name, output)
+		}
+		return changeRate{
+			Dataset:  dataset,
+			Written:  written,
+			Interval: current.Creation.Sub(e.Creation),
+			Since:    e.Tag,
+		}, true, nil
+	}
+	return changeRate{}, false, nil
+}
+
+// writeChangeRate logs one measurement.
+func writeChangeRate(output *strings.Builder, c changeRate) {
+	output.WriteString(fmt.Sprintf("Change rate: %s wrote %d bytes (%s) in %ds since @%s\n",
+		c.Dataset, c.Written, formatSize(c.Written), int64(c.Interval.Seconds()), c.Since))
+}
+
+// usualChangeRate is the median of a dataset's latest recorded rates, in
+// bytes per hour, over every run that backed up the source pool - the rate is
+// the source's, whichever destination the run sent it to. The median, rather
+// than the mean, keeps one earlier anomaly from raising the bar for the
+// next. It also returns how many measurements it was taken over.
+func usualChangeRate(records []historyRecord, source, dataset string) (float64, int) {
+	matching := make([]historyRecord, 0, len(records))
+	for _, r := range records {
+		if r.Source == source {
+			matching = append(matching, r)
+		}
+	}
+	sort.SliceStable(matching, func(i, j int) bool { return matching[i].StartTime.After(matching[j].StartTime) })
+
+	var rates []float64
+	for _, r := range matching {
+		for _, ds := range r.Datasets {
+			if ds.Name == dataset && ds.WrittenSeconds > 0 {
+				rates = append(rates, float64(ds.WrittenBytes)/(ds.WrittenSeconds/3600))
+			}
+		}
+		if len(rates) == changeRateSamples {
+			break
+		}
+	}
+	if len(rates) == 0 {
+		return 0, 0
+	}
+	sort.Float64s(rates)
+	mid := len(rates) / 2
+	if len(rates)%2 == 0 {
+		return (rates[mid-1] + rates[mid]) / 2, len(rates)
+	}
+	return rates[mid], len(rates)
+}
+
+// changeAnomaly is a dataset that wrote far more than usual.
+type changeAnomaly struct {
+	changeRate
+	Usual float64 // usual bytes per hour
+}
+
+// String describes the anomaly for the log, report and notification.
+func (a changeAnomaly) String() string {
+	description := fmt.Sprintf("%s wrote %s in %s", a.Dataset, formatSize(a.Written), formatDuration(a.Interval))
+	if a.Usual > 0 {
+		description += fmt.Sprintf(", %.0fx its usual %s/h", a.perHour()/a.Usual, formatSize(int64(a.Usual)))
+	} else {
+		description += ", where it usually writes next to nothing"
+	}
+	return description
+}
+
+// detectChangeAnomalies compares this run's measurements with the history.
+// Writes under comparisonMinBytes are never flagged, and neither is a
+// dataset with fewer than changeRateMinSamples earlier measurements. The
+// usual rate is floored at comparisonMinBytes over the interval, so a dataset
+// that is normally idle is not flagged for a modest write.
+func detectChangeAnomalies(rates []changeRate, records []historyRecord, source string) []changeAnomaly {
+	var anomalies []changeAnomaly
+	for _, c := range rates {
+		if c.Written < comparisonMinBytes || c.Interval <= 0 {
+			continue
+		}
+		usual, samples := usualChangeRate(records, source, c.Dataset)
+		if samples < changeRateMinSamples {
+			continue
+		}
+		expected := max(usual*c.Interval.Hours(), float64(comparisonMinBytes))
+		if float64(c.Written) >= changeRateAnomalyFactor*expected {
+			anomalies = append(anomalies, changeAnomaly{changeRate: c, Usual: usual})
+		}
+	}
+	return anomalies
+}
+
+// checkChangeRates measures every dataset's change rate after a backup's
+// snapshots are taken, logs the measurements, flags the anomalies and records
+// both in the run's findings for the history, report and notification. It
+// returns the anomalous datasets, whose backups the run must not prune. A
+// measurement that fails is a warning; the backup goes on.
+func checkChangeRates(ctx context.Context, r commandRunner, sourcePool string, datasets []string, tag string, output *strings.Builder, findings *runFindings) map[string]bool {
+	var rates []changeRate
+	for _, ds := range datasets {
+		c, ok, err := measureChangeRate(ctx, r, sourcePool, ds, tag)
+		if err != nil {
+			output.WriteString(fmt.Sprintf("Warning: change rate of %s: %v\n", ds, err))
+			continue
+		}
+		if ok {
+			writeChangeRate(output, c)
+			rates = append(rates, c)
+		}
+	}
+	findings.ChangeRates = rates
+	if len(rates) == 0 {
+		return nil
+	}
+
+	records, err := loadRunHistory()
+	if err != nil {
+		output.WriteString(fmt.Sprintf("Warning: change rates not compared with earlier runs: %v\n", err))
+		return nil
+	}
+	anomalous := map[string]bool{}
+	for _, a := range detectChangeAnomalies(rates, records, sourcePool) {
+		output.WriteString(fmt.Sprintf("CHANGE-RATE ANOMALY: %s\n", a))
+		findings.Anomalies = append(findings.Anomalies, a.String())
+		anomalous[a.Dataset] = true
+	}
+	return anomalous
+}
+
+// withoutDatasets returns datasets minus the excluded ones.
+func withoutDatasets(datasets []string, excluded map[string]bool) []string {
+	kept := make([]string, 0, len(datasets))
+	for _, ds := range datasets {
+		if !excluded[ds] {
+			kept = append(kept, ds)
+		}
+	}
+	return kept
+}
+
+// =============================================================================
+// Reporting
+// =============================================================================
+
+// changeRateWarning is the explanation every report format gives with the
+// anomalies.
+const changeRateWarning = "These datasets wrote far more since the previous backup than they usually do. " +
+	"That can be a large but legitimate change, or ransomware encrypting files. Their older " +
+	"snapshots on the backup pool were kept this run; check the data before the next backup prunes them."
+
+// renderChangeRateAnomalies renders the anomalies for the TUI's result screen.
+func renderChangeRateAnomalies(anomalies []string) string {
+	var b strings.Builder
+	b.WriteString(errorStyle.Render("⚠ CHANGE-RATE ANOMALY") + "\n")
+	for _, a := range anomalies {
+		b.WriteString(warningStyle.Render("  "+a) + "\n")
+	}
+	b.WriteString(infoStyle.Render("  Destination pruning was skipped for these datasets - check them before the next backup."))
+	return b.String()
+}
+
+// writeMarkdownChangeAnomalies renders the anomaly section of the markdown
+// report.
+func writeMarkdownChangeAnomalies(b *strings.Builder, anomalies []string) {
+	if len(anomalies) == 0 {
+		return
+	}
+	b.WriteString("## ⚠ Change-Rate Anomalies\n\n")
+	b.WriteString(changeRateWarning + "\n\n")
+	for _, a := range anomalies {
+		b.WriteString(fmt.Sprintf("- **%s**\n", a))
+	}
+	b.WriteString("\n")
+}
+
+// writeHTMLChangeAnomalies renders the anomaly section of the HTML report.
+func writeHTMLChangeAnomalies(b *strings.Builder, anomalies []string) {
+	if len(anomalies) == 0 {
+		return
+	}
+	b.WriteString("<h2 class=\"failed\">&#9888; Change-Rate Anomalies</h2>\n")
+	b.WriteString("<p>" + html.EscapeString(changeRateWarning) + "</p>\n<ul>\n")
+	for _, a := range anomalies {
+		b.WriteString("<li class=\"failed\"><strong>" + html.EscapeString(a) + "</strong></li>\n")
+	}
+	b.WriteString("</ul>\n")
+}
+
+// pdfChangeAnomalySection renders the anomaly section of the PDF report.
+func pdfChangeAnomalySection(pdf *fpdf.Fpdf, anomalies []string, dark, gray, red [3]int) {
+	if len(anomalies) == 0 {
+		return
+	}
+	pdfSectionHeader(pdf, dark, gray, "Change-Rate Anomalies")
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.SetTextColor(dark[0], dark[1], dark[2])
+	pdf.MultiCell(0, 4.5, changeRateWarning, "", "L", false)
+	pdf.Ln(2)
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.SetTextColor(red[0], red[1], red[2])
+	for _, a := range anomalies {
+		pdf.MultiCell(0, 4.5, "Anomaly: "+a, "", "L", false)
+	}
+	pdf.Ln(3)
+}
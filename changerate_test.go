@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMeasureChangeRate(t *testing.T) {
+	day := func(d int) int64 { return time.Date(2026, 10, d, 2, 0, 0, 0, time.UTC).Unix() }
+	r := &fakeRunner{respond: func(_ string, args []string) (string, error) {
+		switch args[0] {
+		case "list":
+			return fmt.Sprintf("NIXROOT/home@2026-10-16.02h-00-Backup\t%d\t1024\n"+
+				"NIXROOT/home@syncoid_abyss_2026-10-17\t%d\t1024\n"+
+				"NIXROOT/home@2026-10-17.02h-00-Backup\t%d\t1024\n"+
+				"NIXROOT/home@2026-10-18.02h-00-Backup\t%d\t0\n", day(16), day(17), day(17), day(18)), nil
+		case "get":
+			return "734003200\n", nil
+		}
+		return "", nil
+	}}
+
+	c, ok, err := measureChangeRate(context.Background(), r, "NIXROOT", "home", "2026-10-18.02h-00-Backup")
+	if err != nil || !ok {
+		t.Fatalf("expected a measurement, got %v, %v", ok, err)
+	}
+	if c.Written != 734003200 || c.Interval != 24*time.Hour || c.Since != "2026-10-17.02h-00-Backup" {
+		t.Errorf("expected 700 MiB over the day since the previous backup snapshot, got %+v", c)
+	}
+	if !r.ran("get -H -p -o value written@2026-10-17.02h-00-Backup NIXROOT/home@2026-10-18.02h-00-Backup") {
+		t.Errorf("expected written@ read against the previous backup snapshot, ran %v", r.commandLines())
+	}
+
+	if _, ok, err := measureChangeRate(context.Background(), r, "NIXROOT", "home", "2026-10-16.02h-00-Backup"); ok || err != nil {
+		t.Errorf("the oldest snapshot has nothing to measure from, got %v, %v", ok, err)
+	}
+}
+
+func TestDetectChangeAnomalies(t *testing.T) {
+	// Three earlier runs where home wrote about 100 MiB a day.
+	var records []historyRecord
+	for i, written := range []int64{90 << 20, 100 << 20, 120 << 20} {
+		records = append(records, historyRecord{
+			Operation: "backup",
+			Source:    "NIXROOT",
+			StartTime: time.Date(2026, 10, 14+i, 2, 0, 0, 0, time.UTC),
+			Datasets:  []historyDataset{{Name: "home", WrittenBytes: written, WrittenSeconds: 86400}},
+		})
+	}
+	rates := []changeRate{
+		{Dataset: "home", Written: 40 << 30, Interval: 24 * time.Hour},
+		{Dataset: "nix", Written: 40 << 30, Interval: 24 * time.Hour},
+	}
+
+	anomalies := detectChangeAnomalies(rates, records, "NIXROOT")
+	if len(anomalies) != 1 || anomalies[0].Dataset != "home" {
+		t.Fatalf("expected only home flagged - nix has no history yet - got %+v", anomalies)
+	}
+	if got := anomalies[0].String(); !strings.Contains(got, "home wrote 40.0 GB") || !strings.Contains(got, "410x its usual") {
+		t.Errorf("expected the anomaly described against the usual rate, got %q", got)
+	}
+
+	rates[0].Written = 500 << 20
+	if anomalies := detectChangeAnomalies(rates, records, "NIXROOT"); len(anomalies) != 0 {
+		t.Errorf("five times the usual rate is a busy day, not an anomaly, got %+v", anomalies)
+	}
+	if anomalies := detectChangeAnomalies(rates, records[:2], "NIXROOT"); len(anomalies) != 0 {
+		t.Errorf("two earlier measurements are too few to judge, got %+v", anomalies)
+	}
+}
+
+func TestAnomalousDatasetIsNotPruned(t *testing.T) {
+	r := &fakeRunner{respond: func(string, []string) (string, error) { return "", nil }}
+
+	var log strings.Builder
+	pruneBackupPool(context.Background(), r, "NIXROOT", "NIXBACKUPS", "abyss", []string{"home", "nix"}, map[string]bool{"home": true}, &log)
+	for _, line := range r.commandLines() {
+		if strings.Contains(line, "/home") {
+			t.Errorf("neither the snapshots nor the bookmarks of an anomalous dataset may be touched, ran %q", line)
+		}
+	}
+	if !r.ran("list -H -p -t bookmark -o name,creation -d 1 NIXROOT/nix") {
+		t.Errorf("expected the other datasets' bookmarks still pruned, ran %v", r.commandLines())
+	}
+}
+
+func TestChangeRateAnomalyReachesHistoryReportAndNotification(t *testing.T) {
+	useTempHome(t)
+	anomalyOnly, requests, bodies := captureRequests(t, http.StatusOK)
+	writeNotifyConfig(t, NotifyConfig{Notifiers: []NotifierConfig{
+		{Type: notifierWebhook, URL: anomalyOnly.URL, On: []string{notifyFailure, notifyAnomaly}},
+	}})
+
+	// Three earlier runs where home wrote about 100 MiB a day, then 40 GiB.
+	for i := 0; i < 3; i++ {
+		if err := appendHistoryRecord(historyRecord{
+			Operation: "backup",
+			Source:    "NIXROOT",
+			StartTime: time.Date(2026, 10, 14+i, 2, 0, 0, 0, time.UTC),
+			Datasets:  []historyDataset{{Name: "home", WrittenBytes: 100 << 20, WrittenSeconds: 86400}},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	day := func(d int) int64 { return time.Date(2026, 10, d, 2, 0, 0, 0, time.UTC).Unix() }
+	r := &fakeRunner{respond: func(_ string, args []string) (string, error) {
+		switch args[0] {
+		case "list":
+			return fmt.Sprintf("NIXROOT/home@2026-10-17.02h-00-Backup\t%d\t1024\n"+
+				"NIXROOT/home@2026-10-18.02h-00-Backup\t%d\t0\n", day(17), day(18)), nil
+		case "get":
+			return fmt.Sprintf("%d\n", int64(40<<30)), nil
+		}
+		return "", nil
+	}}
+
+	var log strings.Builder
+	info := sampleReportInfo()
+	info.Success = true
+	anomalous := checkChangeRates(context.Background(), r, "NIXROOT", []string{"home"}, "2026-10-18.02h-00-Backup", &log, &info.runFindings)
+	if !anomalous["home"] || len(info.Anomalies) != 1 {
+		t.Fatalf("expected home flagged and recorded in the findings, got %v, %+v", anomalous, info.runFindings)
+	}
+	info.OperationLog = "" // nothing may depend on the log's wording
+
+	record := newHistoryRecord(info, "")
+	if record.Datasets[0].WrittenBytes != 40<<30 || record.Datasets[0].WrittenSeconds != 86400 {
+		t.Errorf("expected home's change rate recorded in the history, got %+v", record.Datasets[0])
+	}
+	if report := generateMarkdownReport(info); !strings.Contains(report, "## ⚠ Change-Rate Anomalies") {
+		t.Error("expected the anomaly flagged in its own report section")
+	}
+
+	if errs := notifyRun(info, ""); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if len(*requests) != 1 || !strings.Contains((*bodies)[0], "Change-rate anomaly: home wrote 40.0 GB") {
+		t.Errorf("a notifier subscribed to anomalies must hear a successful run that flagged one, got %v", *bodies)
+	}
+}
@@ -0,0 +1,371 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// stateCleanup is the orphan selection screen, reached from the health check.
+const stateCleanup sessionState = 104
+
+// =============================================================================
+// Orphan selection
+// =============================================================================
+
+// orphansLoadedMsg carries a pool's orphans with their vetting results.
+type orphansLoadedMsg struct {
+	pool      string
+	decisions []destroyDecision
+	err       error
+}
+
+// reclaimEstimateMsg carries the space `zfs destroy -nv` would reclaim for
+// one selection. seq discards estimates for selections since changed.
+type reclaimEstimateMsg struct {
+	seq   int
+	bytes int64
+	err   error
+}
+
+// orphansDestroyedMsg reports a destroy from the selection screen.
+type orphansDestroyedMsg struct {
+	destroyed []string
+	skipped   []destroyDecision // failed the re-vet just before destroying
+	failures  []string
+}
+
+// loadOrphanSelection scans a pool and vets every orphan, so the screen can
+// show which ones cleanup would refuse before anything is selected.
+func loadOrphanSelection(pool string) tea.Cmd {
+	return func() tea.Msg {
+		ctx := context.Background()
+		scan, err := collectOrphanScan(ctx, defaultRunner, pool)
+		if err != nil {
+			return orphansLoadedMsg{pool: pool, err: err}
+		}
+		// Oldest first, so the age selections read top to bottom.
+		orphans := append([]orphanSnapshot(nil), scan.Orphans...)
+		sort.SliceStable(orphans, func(i, j int) bool {
+			if orphans[i].Creation.Equal(orphans[j].Creation) {
+				return orphans[i].Name < orphans[j].Name
+			}
+			return orphans[i].Creation.Before(orphans[j].Creation)
+		})
+		return orphansLoadedMsg{pool: pool, decisions: vetOrphans(ctx, defaultRunner, orphans)}
+	}
+}
+
+// parseReclaim reads the total from `zfs destroy -nvp` output.
+func parseReclaim(output string) (int64, bool) {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "reclaim" {
+			bytes, err := strconv.ParseInt(fields[1], 10, 64)
+			return bytes, err == nil
+		}
+	}
+	return 0, false
+}
+
+// estimateReclaim asks ZFS what destroying exactly these snapshots would
+// free. Snapshots of one dataset are estimated together, as a comma list, so
+// blocks shared only among the selected snapshots are counted; the datasets'
+// estimates are then added up. Only the dry run ever takes a list.
+func estimateReclaim(ctx context.Context, r commandRunner, names []string) (int64, error) {
+	var order []string
+	tags := map[string][]string{}
+	for _, name := range names {
+		dataset, tag, ok := splitSnapshot(name)
+		if !ok {
+			continue
+		}
+		if _, seen := tags[dataset]; !seen {
+			order = append(order, dataset)
+		}
+		tags[dataset] = append(tags[dataset], tag)
+	}
+
+	var total int64
+	for _, dataset := range order {
+		target := dataset + "@" + strings.Join(tags[dataset], ",")
+		output, err := r.Output(ctx, "zfs", "destroy", "-nvp", target)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", dataset, err)
+		}
+		bytes, ok := parseReclaim(output)
+		if !ok {
+			return 0, fmt.Errorf("%s: no reclaim estimate in zfs output", dataset)
+		}
+		total += bytes
+	}
+	return total, nil
+}
+
+// estimateSelection runs estimateReclaim in the background.
+func estimateSelection(seq int, names []string) tea.Cmd {
+	return func() tea.Msg {
+		bytes, err := estimateReclaim(context.Background(), defaultRunner, names)
+		return reclaimEstimateMsg{seq: seq, bytes: bytes, err: err}
+	}
+}
+
+// destroyOrphans destroys the given orphans one at a time, vetting them again
+// first: a hold or clone may have appeared since the screen was loaded.
+func destroyOrphans(ctx context.Context, r commandRunner, orphans []orphanSnapshot) orphansDestroyedMsg {
+	var msg orphansDestroyedMsg
+	for _, d := range vetOrphans(ctx, r, orphans) {
+		if !d.Safe {
+			msg.skipped = append(msg.skipped, d)
+			continue
+		}
+		if err := r.Run(ctx, "zfs", "destroy", d.Orphan.Name); err != nil {
+			msg.failures = append(msg.failures, fmt.Sprintf("%s: %v", d.Orphan.Name, err))
+			continue
+		}
+		msg.destroyed = append(msg.destroyed, d.Orphan.Name)
+	}
+	return msg
+}
+
+// destroySelection runs destroyOrphans in the background.
+func destroySelection(orphans []orphanSnapshot) tea.Cmd {
+	return func() tea.Msg {
+		return destroyOrphans(context.Background(), defaultRunner, orphans)
+	}
+}
+
+// selectedOrphans returns the selected orphans that passed vetting, in list
+// order.
+func (m model) selectedOrphans() []orphanSnapshot {
+	var selected []orphanSnapshot
+	for _, d := range m.cleanupDecisions {
+		if d.Safe && m.cleanupSelected[d.Orphan.Name] {
+			selected = append(selected, d.Orphan)
+		}
+	}
+	return selected
+}
+
+// selectOrphansWhere sets every vetted orphan matching match to on, leaving
+// the rest as they are.
+func (m *model) selectOrphansWhere(on bool, match func(o orphanSnapshot) bool) {
+	for _, d := range m.cleanupDecisions {
+		if d.Safe && match(d.Orphan) {
+			m.cleanupSelected[d.Orphan.Name] = on
+		}
+	}
+}
+
+// reestimate starts a fresh estimate for the current selection.
+func (m model) reestimate() (model, tea.Cmd) {
+	m.cleanupSeq++
+	m.cleanupReclaim = -1
+	m.cleanupEstimateErr = ""
+	names := make([]string, 0, len(m.cleanupSelected))
+	for _, o := range m.selectedOrphans() {
+		names = append(names, o.Name)
+	}
+	if len(names) == 0 {
+		m.cleanupReclaim = 0
+		return m, nil
+	}
+	return m, estimateSelection(m.cleanupSeq, names)
+}
+
+// updateCleanupScreen handles keys for the orphan selection screen.
+func (m model) updateCleanupScreen(msg tea.KeyMsg) (model, tea.Cmd) {
+	if m.cleanupConfirming {
+		switch msg.String() {
+		case "ctrl+c":
+			m.quitting = true
+			return m, tea.Quit
+		case "esc":
+			m.cleanupConfirming = false
+			m.cleanupMessage = "Aborted. Nothing was destroyed."
+			return m, nil
+		case "enter":
+			m.cleanupConfirming = false
+			if strings.TrimSpace(m.cleanupInput.Value()) != "DESTROY" {
+				m.cleanupMessage = "Aborted. Nothing was destroyed."
+				return m, nil
+			}
+			m.cleanupDestroying = true
+			return m, tea.Batch(m.spinner.Tick, destroySelection(m.selectedOrphans()))
+		}
+		var cmd tea.Cmd
+		m.cleanupInput, cmd = m.cleanupInput.Update(msg)
+		return m, cmd
+	}
+	if m.cleanupDestroying {
+		return m, nil
+	}
+
+	var current orphanSnapshot
+	if len(m.cleanupDecisions) > 0 {
+		current = m.cleanupDecisions[m.cleanupIndex].Orphan
+	}
+	switch msg.String() {
+	case "ctrl+c":
+		m.quitting = true
+		return m, tea.Quit
+	case "esc", "q":
+		// Back to a fresh health report, which may have changed.
+		m.state = stateDoctor
+		m.cleanupMessage = ""
+		m.doctorReady = false
+		return m, tea.Batch(m.spinner.Tick, loadDoctorReport(m.doctorPool))
+	case "up", "k":
+		if m.cleanupIndex > 0 {
+			m.cleanupIndex--
+		}
+		return m, nil
+	case "down", "j":
+		if m.cleanupIndex < len(m.cleanupDecisions)-1 {
+			m.cleanupIndex++
+		}
+		return m, nil
+	case " ":
+		if len(m.cleanupDecisions) == 0 {
+			return m, nil
+		}
+		if !m.cleanupDecisions[m.cleanupIndex].Safe {
+			m.cleanupMessage = "Cleanup will not touch this one: " + m.cleanupDecisions[m.cleanupIndex].SkipReason
+			return m, nil
+		}
+		m.cleanupSelected[current.Name] = !m.cleanupSelected[current.Name]
+	case "d":
+		// Toggle the whole dataset, following the cursor's state.
+		on := !m.cleanupSelected[current.Name]
+		m.selectOrphansWhere(on, func(o orphanSnapshot) bool { return o.Dataset == current.Dataset })
+	case "o":
+		m.selectOrphansWhere(true, func(o orphanSnapshot) bool { return !o.Creation.After(current.Creation) })
+	case "y":
+		m.selectOrphansWhere(true, func(o orphanSnapshot) bool { return !o.Creation.Before(current.Creation) })
+	case "a":
+		m.selectOrphansWhere(true, func(orphanSnapshot) bool { return true })
+	case "n":
+		m.selectOrphansWhere(false, func(orphanSnapshot) bool { return true })
+	case "x":
+		if len(m.selectedOrphans()) == 0 {
+			m.cleanupMessage = "Select at least one snapshot to destroy."
+			return m, nil
+		}
+		m.cleanupConfirming = true
+		m.cleanupMessage = ""
+		m.cleanupInput = newReportInput("DESTROY", "")
+		return m, nil
+	case "r":
+		return m, loadOrphanSelection(m.cleanupPool)
+	default:
+		return m, nil
+	}
+	m.cleanupMessage = ""
+	return m.reestimate()
+}
+
+// renderCleanupContent draws the orphan selection screen.
+func (m model) renderCleanupContent(width int) string {
+	var b strings.Builder
+
+	title := selectedItemStyle.Render(fmt.Sprintf("Orphan Cleanup: %s", m.cleanupPool))
+	b.WriteString(lipgloss.NewStyle().Width(width).Align(lipgloss.Center).Render(title))
+	b.WriteString("\n\n")
+
+	if m.cleanupDestroying {
+		b.WriteString(lipgloss.NewStyle().Width(width).Align(lipgloss.Center).
+			Render(m.spinner.View() + " Destroying the selected snapshots one at a time..."))
+		return b.String()
+	}
+	if len(m.cleanupDecisions) == 0 {
+		b.WriteString(statusStyle.Render("  [OK] Nothing to clean up."))
+		b.WriteString("\n")
+		if m.cleanupMessage != "" {
+			b.WriteString("\n" + infoStyle.Render("  "+m.cleanupMessage) + "\n")
+		}
+		return b.String()
+	}
+
+	b.WriteString(subtitleStyle.Render(fmt.Sprintf("       %-44s %10s %10s  %s", "Snapshot", "Age", "Unique", "Vetting")))
+	b.WriteString("\n")
+
+	// Keep the cursor on screen: show a window of rows around it.
+	rows := max(m.height-18, 5)
+	start := max(0, min(m.cleanupIndex-rows/2, len(m.cleanupDecisions)-rows))
+	end := min(len(m.cleanupDecisions), start+rows)
+	now := time.Now()
+	for i := start; i < end; i++ {
+		d := m.cleanupDecisions[i]
+		cursor := "  "
+		if i == m.cleanupIndex {
+			cursor = "> "
+		}
+		box := "[ ]"
+		if m.cleanupSelected[d.Orphan.Name] {
+			box = "[x]"
+		}
+		vetting := "ok"
+		if !d.Safe {
+			box = " - "
+			vetting = d.SkipReason
+		}
+		name := d.Orphan.Name
+		if len(name) > 44 {
+			name = "…" + name[len(name)-43:]
+		}
+		age := "?"
+		if !d.Orphan.Creation.IsZero() {
+			age = ageLabel(now.Sub(d.Orphan.Creation))
+		}
+		unique := "?"
+		if d.Orphan.Used >= 0 {
+			unique = formatSize(d.Orphan.Used)
+		}
+		row := fmt.Sprintf("%s%s %-44s %10s %10s  %s", cursor, box, name, age, unique, vetting)
+		switch {
+		case i == m.cleanupIndex:
+			b.WriteString(selectedItemStyle.Render(row))
+		case !d.Safe:
+			b.WriteString(warningStyle.Render(row))
+		case m.cleanupSelected[d.Orphan.Name]:
+			b.WriteString(statusStyle.Render(row))
+		default:
+			b.WriteString(infoStyle.Render(row))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+
+	selected := len(m.selectedOrphans())
+	var reclaim string
+	switch {
+	case m.cleanupEstimateErr != "":
+		reclaim = "estimate failed: " + m.cleanupEstimateErr
+	case m.cleanupReclaim < 0:
+		reclaim = m.spinner.View() + " estimating..."
+	default:
+		reclaim = formatSize(m.cleanupReclaim) + " reclaimable"
+	}
+	b.WriteString(labelStyle.Render(fmt.Sprintf("  %d of %d selected - %s", selected, len(m.cleanupDecisions), reclaim)))
+	b.WriteString("\n")
+
+	if m.cleanupConfirming {
+		b.WriteString("\n")
+		b.WriteString(destructiveWarningStyle.Render("  DESTROYING SNAPSHOTS IS IRREVERSIBLE  "))
+		b.WriteString("\n\n")
+		b.WriteString("  " + subtitleStyle.Render(fmt.Sprintf("Type DESTROY to destroy %d snapshot(s): ", selected)) + m.cleanupInput.View() + "\n")
+	}
+	if m.cleanupMessage != "" {
+		b.WriteString("\n" + warningStyle.Render("  "+m.cleanupMessage) + "\n")
+	}
+	return b.String()
+}
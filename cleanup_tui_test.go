@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestEstimateReclaimGroupsByDataset(t *testing.T) {
+	r := &fakeRunner{respond: func(name string, args []string) (string, error) {
+		switch args[len(args)-1] {
+		case "NIXROOT/root@a-Backup,b-Backup":
+			return "destroy\tNIXROOT/root@a-Backup\ndestroy\tNIXROOT/root@b-Backup\nreclaim\t3000\n", nil
+		case "NIXROOT/nix@c-Backup":
+			return "destroy\tNIXROOT/nix@c-Backup\nreclaim\t500\n", nil
+		}
+		return "", errors.New("unexpected " + strings.Join(args, " "))
+	}}
+
+	total, err := estimateReclaim(context.Background(), r, []string{"NIXROOT/root@a-Backup", "NIXROOT/nix@c-Backup", "NIXROOT/root@b-Backup"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3500 || len(r.calls) != 2 {
+		t.Errorf("expected one dry run per dataset totalling 3500, got %d from %v", total, r.commandLines())
+	}
+	if _, err := estimateReclaim(context.Background(), r, []string{"NIXROOT/home@x"}); err == nil {
+		t.Error("a failed dry run should fail the estimate, not count as nothing")
+	}
+}
+
+func TestDestroyOrphansVetsAgain(t *testing.T) {
+	r := &fakeRunner{respond: func(name string, args []string) (string, error) {
+		if args[0] == "holds" && args[len(args)-1] == "NIXROOT/root@held" {
+			return "NIXROOT/root@held\tkeep\tSun Oct 18 02:00 2026\n", nil
+		}
+		return "", nil
+	}}
+	orphans := []orphanSnapshot{
+		{snapshotEntry: snapshotEntry{Name: "NIXROOT/root@held", Dataset: "NIXROOT/root", Tag: "held"}},
+		{snapshotEntry: snapshotEntry{Name: "NIXROOT/root@free", Dataset: "NIXROOT/root", Tag: "free"}},
+	}
+
+	msg := destroyOrphans(context.Background(), r, orphans)
+	if !reflect.DeepEqual(msg.destroyed, []string{"NIXROOT/root@free"}) || len(msg.skipped) != 1 {
+		t.Errorf("expected the snapshot held since loading to be skipped, got %+v", msg)
+	}
+	if r.ran("destroy NIXROOT/root@held") {
+		t.Error("a held snapshot must never reach zfs destroy")
+	}
+}
+
+func TestCleanupScreenSelection(t *testing.T) {
+	now := time.Now()
+	orphan := func(name string, daysAgo int) orphanSnapshot {
+		dataset, tag, _ := splitSnapshot(name)
+		return orphanSnapshot{snapshotEntry: snapshotEntry{Name: name, Dataset: dataset, Tag: tag, Creation: now.AddDate(0, 0, -daysAgo)}}
+	}
+	m := model{
+		state:           stateCleanup,
+		cleanupSelected: map[string]bool{},
+		cleanupDecisions: []destroyDecision{
+			{Orphan: orphan("NIXROOT/root@old-Backup", 90), Safe: true},
+			{Orphan: orphan("NIXROOT/nix@held-Backup", 60), SkipReason: "snapshot has a hold"},
+			{Orphan: orphan("NIXROOT/root@mid-Backup", 30), Safe: true},
+			{Orphan: orphan("NIXROOT/nix@new-Backup", 2), Safe: true},
+		},
+	}
+	key := func(k string) {
+		msg := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+		if k == " " {
+			msg = tea.KeyMsg{Type: tea.KeySpace, Runes: []rune(k)}
+		}
+		m, _ = m.updateCleanupScreen(msg)
+	}
+	names := func() []string {
+		var got []string
+		for _, o := range m.selectedOrphans() {
+			got = append(got, o.Tag)
+		}
+		return got
+	}
+
+	m.cleanupIndex = 2
+	key("y")
+	if got := names(); !reflect.DeepEqual(got, []string{"mid-Backup", "new-Backup"}) {
+		t.Errorf("expected this one and newer, got %v", got)
+	}
+	key("n")
+	key("o")
+	if got := names(); !reflect.DeepEqual(got, []string{"old-Backup", "mid-Backup"}) {
+		t.Errorf("expected this one and older, skipping the held one, got %v", got)
+	}
+	m.cleanupIndex = 0
+	key(" ")
+	if got := names(); !reflect.DeepEqual(got, []string{"mid-Backup"}) {
+		t.Errorf("expected the oldest kept back, got %v", got)
+	}
+	m.cleanupIndex = 1
+	key(" ")
+	if m.cleanupSelected["NIXROOT/nix@held-Backup"] || m.cleanupMessage == "" {
+		t.Error("a snapshot that failed vetting should not be selectable")
+	}
+}
+
+func TestReloadDropsTheOldListsEstimate(t *testing.T) {
+	m := model{state: stateCleanup, cleanupSelected: map[string]bool{}, cleanupDecisions: []destroyDecision{
+		{Orphan: orphanSnapshot{snapshotEntry: snapshotEntry{Name: "NIXROOT/root@old-Backup"}}, Safe: true},
+	}}
+	m, _ = m.updateCleanupScreen(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")})
+	inFlight := m.cleanupSeq
+
+	updated, _ := m.Update(orphansLoadedMsg{pool: "NIXROOT"})
+	updated, _ = updated.(model).Update(reclaimEstimateMsg{seq: inFlight, bytes: 1 << 30})
+	if got := updated.(model).cleanupReclaim; got != 0 {
+		t.Errorf("an estimate for the list before the reload must be dropped, got %d", got)
+	}
+}
@@ -5,7 +5,9 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
 	"sort"
 	"strconv"
 	"strings"
@@ -25,6 +27,9 @@ const (
 	orphanOutOfScope orphanKind = "out-of-scope"
 	// orphanSyncoid is a syncoid sync-snapshot left behind by a failed send.
 	orphanSyncoid orphanKind = "syncoid leftover"
+	// orphanAbandoned is a snapshot of a retired host or abandoned dataset on
+	// the backup pool, removed with it by cleanup-orphans --retire.
+	orphanAbandoned orphanKind = "abandoned"
 )
 
 // orphanSnapshot is a snapshot that no part of zfs-backup will ever clean up.
@@ -212,8 +217,16 @@ type destroyDecision struct {
 	Orphan     orphanSnapshot
 	Safe       bool
 	SkipReason string
+	Release    []string // hold tags to release before destroying
 }
 
+// Reasons vetOrphans gives for keeping a snapshot.
+const (
+	skipProtected = "protected snapshot"
+	skipHeld      = "snapshot has a hold"
+	skipCloned    = "snapshot has dependent clones"
+)
+
 // vetOrphans applies the mandatory pre-flight checks from the cleanup
 // procedure: never touch protected snapshots, never touch held snapshots and
 // never touch snapshots with dependent clones.
@@ -222,11 +235,11 @@ func vetOrphans(ctx context.Context, r commandRunner, orphans []orphanSnapshot)
 	for _, o := range orphans {
 		switch {
 		case isProtectedSnapshotTag(o.Tag):
-			decisions = append(decisions, destroyDecision{Orphan: o, SkipReason: "protected snapshot"})
+			decisions = append(decisions, destroyDecision{Orphan: o, SkipReason: skipProtected})
 		case snapshotHasHolds(ctx, r, o.Name):
-			decisions = append(decisions, destroyDecision{Orphan: o, SkipReason: "snapshot has a hold"})
+			decisions = append(decisions, destroyDecision{Orphan: o, SkipReason: skipHeld})
 		case snapshotHasClones(ctx, r, o.Name):
-			decisions = append(decisions, destroyDecision{Orphan: o, SkipReason: "snapshot has dependent clones"})
+			decisions = append(decisions, destroyDecision{Orphan: o, SkipReason: skipCloned})
 		default:
 			decisions = append(decisions, destroyDecision{Orphan: o, Safe: true})
 		}
@@ -254,9 +267,25 @@ type orphanScan struct {
 	Pool     string
 	InScope  []string
 	Missing  []string
+	Entries  []snapshotEntry // every snapshot on the pool
 	Orphans  []orphanSnapshot
 	Usage    []datasetUsage
 	ScanTime time.Time
+
+	// Set by prepareDoctorScan for the checks that look beyond the pool.
+	BackupPool string         // imported backup pool, empty if none
+	Host       string         // namespace this machine backs up under
+	Config     *DoctorConfig  // nil means the defaults
+	States     []*BackupState // saved interrupted runs, nil if unreadable
+
+	// Set by prepareDestinationScan: Pool is a backup pool, and Orphans are
+	// the syncoid leftovers on it. LocalScope is what this machine backs up,
+	// nil when its source pool could not be read.
+	Destination bool
+	LocalScope  map[string]bool
+
+	backup *backupPoolView    // read on first use
+	layout *destinationLayout // sorted on first use
 }
 
 // collectOrphanScan performs the read-only inspection shared by the doctor and
@@ -282,6 +311,7 @@ func collectOrphanScan(ctx context.Context, r commandRunner, pool string) (*orph
 		Pool:     pool,
 		InScope:  inScope,
 		Missing:  missing,
+		Entries:  entries,
 		Orphans:  scanOrphans(entries, pool, inScope, now, minSyncoidOrphanAge),
 		Usage:    usage,
 		ScanTime: now,
@@ -292,110 +322,139 @@ func collectOrphanScan(ctx context.Context, r commandRunner, pool string) (*orph
 // doctor subcommand
 // =============================================================================
 
-// renderDoctorReport renders a scan as a human-readable report and returns how
-// many issue groups it found. Shared by the CLI subcommand and the TUI health
-// screen so both always say exactly the same thing.
-func renderDoctorReport(scan *orphanScan) (string, int) {
+// renderDoctorReport renders a doctor report for people to read. Shared by
+// the CLI subcommand and the TUI health screen so both always say exactly the
+// same thing.
+func renderDoctorReport(report *doctorReport) string {
 	var b strings.Builder
-	problems := 0
-
-	b.WriteString(describeScope(scan.Pool, scan.InScope, scan.Missing) + "\n")
-	if len(scan.Missing) > 0 {
-		b.WriteString("  These datasets are configured for backup but no longer exist.\n")
+	if report.Error != "" {
+		b.WriteString(fmt.Sprintf("[?] Could not check %s: %s\n", report.Pool, report.Error))
+		return b.String()
 	}
-	b.WriteString("\n")
 
-	datasets, grouped := groupOrphansByDataset(scan.Orphans)
-	if len(datasets) == 0 {
-		b.WriteString("[OK] No orphaned zfs-backup or syncoid snapshots found.\n")
+	if report.Destination {
+		b.WriteString(describeDestination(report.scan.destination()) + "\n\n")
 	} else {
-		problems++
-		b.WriteString(fmt.Sprintf("[!] %d orphaned snapshot(s) on %d dataset(s):\n\n",
-			len(scan.Orphans), len(datasets)))
-		for _, ds := range datasets {
-			var backupCount, syncoidCount int
-			var unique int64
-			var oldest, newest time.Time
-			for _, o := range grouped[ds] {
-				if o.Kind == orphanSyncoid {
-					syncoidCount++
-				} else {
-					backupCount++
-				}
-				if o.Used > 0 {
-					unique += o.Used
-				}
-				if oldest.IsZero() || o.Creation.Before(oldest) {
-					oldest = o.Creation
-				}
-				if o.Creation.After(newest) {
-					newest = o.Creation
-				}
-			}
-			b.WriteString(fmt.Sprintf("  %s\n", ds))
-			b.WriteString(fmt.Sprintf("    %d zfs-backup snapshot(s), %d syncoid leftover(s)\n",
-				backupCount, syncoidCount))
-			if !oldest.IsZero() {
-				b.WriteString(fmt.Sprintf("    spanning %s → %s\n",
-					oldest.Format("2006-01-02"), newest.Format("2006-01-02")))
-			}
-			b.WriteString(fmt.Sprintf("    %s uniquely referenced (shared blocks are not counted here)\n",
-				formatSize(unique)))
-		}
-		b.WriteString("\n  Reclaim them with: sudo zfs-backup cleanup-orphans --pool " + scan.Pool + "\n")
+		b.WriteString(describeScope(report.Pool, report.scan.InScope, report.scan.Missing) + "\n\n")
 	}
-	b.WriteString("\n")
 
-	flagged := flagQuotaPressure(scan.Usage, quotaPressureThreshold)
-	if len(flagged) == 0 {
-		b.WriteString("[OK] No dataset is dominated by snapshot usage.\n")
-	} else {
-		problems++
-		b.WriteString("[!] Snapshots dominate space usage on:\n\n")
-		for _, u := range flagged {
-			quota := "none"
-			if u.Quota > 0 {
-				quota = formatSize(u.Quota)
+	byCheck := map[string][]doctorFinding{}
+	for _, f := range report.Findings {
+		byCheck[f.ID] = append(byCheck[f.ID], f)
+	}
+	for _, id := range report.Checks {
+		check := findDoctorCheck(id)
+		findings := byCheck[check.ID]
+		if len(findings) == 0 {
+			b.WriteString("[OK] " + check.Passed + "\n\n")
+			continue
+		}
+		b.WriteString(fmt.Sprintf("[!] %s:\n\n", check.Title))
+		for _, f := range findings {
+			subject := f.Summary
+			if f.Dataset != "" {
+				subject = f.Dataset + ": " + f.Summary
+			}
+			b.WriteString(fmt.Sprintf("  %-10s %s\n", "["+f.Severity.String()+"]", subject))
+			for _, e := range f.Evidence {
+				b.WriteString("    " + e + "\n")
+			}
+			if f.Remediation != "" {
+				b.WriteString("    fix: " + f.Remediation + "\n")
+			}
+			if f.Fix != nil {
+				b.WriteString("    doctor --fix: " + strings.Join(f.Fix.Plan, "; ") + "\n")
 			}
-			b.WriteString(fmt.Sprintf("  %s\n", u.Name))
-			b.WriteString(fmt.Sprintf("    used %s, of which %s is snapshots (quota %s)\n",
-				formatSize(u.Used), formatSize(u.UsedBySnapshots), quota))
 		}
-		b.WriteString("\n  Note: `quota` counts snapshots against the limit, `refquota` does not.\n")
-		b.WriteString("  A dataset with a `quota` starts failing writes once snapshots fill it.\n")
+		b.WriteString("\n")
 	}
 
-	b.WriteString("\n")
-	if problems == 0 {
+	if len(report.Findings) == 0 {
 		b.WriteString("Verdict: healthy.\n")
 	} else {
-		b.WriteString(fmt.Sprintf("Verdict: %d issue group(s) need attention.\n", problems))
+		b.WriteString(fmt.Sprintf("Verdict: %d finding(s), the most serious %s.\n",
+			len(report.Findings), report.Severity))
 	}
+	return b.String()
+}
 
-	return b.String(), problems
+// doctorFindings lists a report's findings one line each, for summaries that
+// cannot show the full report.
+func doctorFindings(report *doctorReport) []string {
+	var findings []string
+	for _, f := range report.Findings {
+		line := f.Summary
+		if f.Dataset != "" {
+			line = f.Dataset + ": " + f.Summary
+		}
+		findings = append(findings, fmt.Sprintf("[%s] %s", f.Severity, line))
+	}
+	return findings
+}
+
+// doctorOptions controls the doctor subcommand.
+type doctorOptions struct {
+	Pool        string
+	BackupPool  string   // optional: defaults to the imported backup pool
+	Only        []string // check IDs to run; empty runs them all
+	Skip        []string // check IDs not to run
+	JSON        bool     // print the report as JSON instead of prose
+	Destination bool     // check the backup pool itself; Pool names it
+	Fix         bool     // --fix: plan the automatic fixes
+	Confirm     bool     // --yes: apply them (a dry run is the default)
+	Force       bool     // --force: skip the typed confirmation prompt
 }
 
 // runDoctor prints a read-only health report for a pool. It returns the
-// process exit code: 0 when the pool is clean, 1 when problems were found.
-func runDoctor(ctx context.Context, r commandRunner, pool string) int {
-	fmt.Println()
-	fmt.Println(titleStyle.Render("zfs-backup doctor"))
-	fmt.Println(interstitialStyle.Render(strings.Repeat("─", 60)))
-	fmt.Println()
+// process exit code from the most serious finding: 0 healthy, 1 warning,
+// 2 critical, 3 when the checks could not run.
+func runDoctor(ctx context.Context, r commandRunner, opts doctorOptions) int {
+	registry := doctorChecks
+	if opts.Destination {
+		registry = destinationDoctorChecks
+	}
+	checks, err := selectDoctorChecks(registry, opts.Only, opts.Skip)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+		return severityUnknown.exitCode()
+	}
 
-	scan, err := collectOrphanScan(ctx, r, pool)
+	var scan *orphanScan
+	if opts.Destination {
+		scan, err = prepareDestinationScan(ctx, r, opts.Pool)
+	} else {
+		scan, err = prepareDoctorScan(ctx, r, opts.Pool, opts.BackupPool)
+	}
+	var report *doctorReport
 	if err != nil {
-		fmt.Println(errorStyle.Render("Error: " + err.Error()))
-		return 1
+		report = failedDoctorReport(opts.Pool, err)
+	} else {
+		report = runDoctorChecks(ctx, r, scan, checks)
 	}
 
-	report, problems := renderDoctorReport(scan)
-	fmt.Println(report)
+	if opts.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+			return severityUnknown.exitCode()
+		}
+		return report.Severity.exitCode()
+	}
 
-	if problems == 0 {
-		return 0
+	fmt.Println()
+	fmt.Println(titleStyle.Render("zfs-backup doctor"))
+	fmt.Println(interstitialStyle.Render(strings.Repeat("─", 60)))
+	fmt.Println()
+	if report.Error != "" {
+		fmt.Println(errorStyle.Render("Error: " + report.Error))
+		return report.Severity.exitCode()
+	}
+	fmt.Println(renderDoctorReport(report))
+	if opts.Fix {
+		return runDoctorFix(ctx, r, report, opts, confirmFix)
 	}
-	return 1
+	return report.Severity.exitCode()
 }
 
 // =============================================================================
@@ -404,16 +463,22 @@ func runDoctor(ctx context.Context, r commandRunner, pool string) int {
 
 // cleanupOptions controls the cleanup-orphans subcommand.
 type cleanupOptions struct {
-	Pool    string
-	Dataset string // optional: restrict to a single dataset
-	Confirm bool   // --yes: actually destroy (dry run is the default)
-	Force   bool   // --force: skip the typed confirmation prompt
+	Pool        string
+	Dataset     string // optional: restrict to a single dataset
+	Confirm     bool   // --yes: actually destroy (dry run is the default)
+	Force       bool   // --force: skip the typed confirmation prompt
+	Destination bool   // --destination: clean the backup pool named by Pool
+	Retire      string // --retire: remove this flagged backup pool path
 }
 
 // runCleanupOrphans reports, and optionally destroys, orphaned snapshots. Dry
 // run is the default; destroying requires --yes plus a typed confirmation.
 // It returns the process exit code.
 func runCleanupOrphans(ctx context.Context, r commandRunner, opts cleanupOptions, confirmFn func(string) bool) int {
+	if opts.Destination {
+		return runCleanupDestination(ctx, r, opts, confirmFn)
+	}
+
 	fmt.Println()
 	fmt.Println(titleStyle.Render("zfs-backup cleanup-orphans"))
 	fmt.Println(interstitialStyle.Render(strings.Repeat("─", 60)))
@@ -446,11 +511,20 @@ func runCleanupOrphans(ctx context.Context, r commandRunner, opts cleanupOptions
 	fmt.Println(infoStyle.Render("Datasets in scope are never touched by this command."))
 	fmt.Println()
 
-	decisions := vetOrphans(ctx, r, orphans)
+	return destroyVetted(ctx, r, opts, scan.Pool, vetOrphans(ctx, r, orphans), nil, confirmFn)
+}
+
+// destroyVetted prints the cleanup plan and, with --yes and the typed
+// confirmation, destroys the snapshots vetOrphans cleared and then the given
+// datasets. It returns the process exit code.
+func destroyVetted(ctx context.Context, r commandRunner, opts cleanupOptions, pool string, decisions []destroyDecision, datasets []string, confirmFn func(string) bool) int {
 	printCleanupPlan(decisions)
+	if len(datasets) > 0 {
+		printRetirePlan(datasets)
+	}
 
 	targets := safeToDestroy(decisions)
-	if len(targets) == 0 {
+	if len(targets) == 0 && len(datasets) == 0 {
 		fmt.Println(warningStyle.Render("Every candidate was skipped by a safety check. Nothing to do."))
 		fmt.Println()
 		return 0
@@ -471,7 +545,7 @@ func runCleanupOrphans(ctx context.Context, r commandRunner, opts cleanupOptions
 		}
 		fmt.Println()
 		fmt.Println(infoStyle.Render(fmt.Sprintf(
-			"Re-run with --yes to destroy these %d snapshot(s).", len(targets))))
+			"Re-run with --yes to destroy these %s.", describeTargets(len(targets), len(datasets)))))
 		fmt.Println()
 		return 0
 	}
@@ -480,7 +554,7 @@ func runCleanupOrphans(ctx context.Context, r commandRunner, opts cleanupOptions
 		"  DESTROYING SNAPSHOTS IS IRREVERSIBLE  "))
 	fmt.Println()
 	fmt.Println(warningStyle.Render(fmt.Sprintf(
-		"About to destroy %d snapshot(s) on pool %s.", len(targets), scan.Pool)))
+		"About to destroy %s on pool %s.", describeTargets(len(targets), len(datasets)), pool)))
 	fmt.Println(infoStyle.Render(
 		"Space is only reclaimed once every snapshot pinning a block is gone, so\n" +
 			"usage may barely move until the last few are destroyed."))
@@ -494,7 +568,22 @@ func runCleanupOrphans(ctx context.Context, r commandRunner, opts cleanupOptions
 
 	destroyed := 0
 	var failures []string
-	for _, name := range targets {
+	for _, d := range decisions {
+		if !d.Safe {
+			continue
+		}
+		name := d.Orphan.Name
+		released := true
+		for _, tag := range d.Release {
+			if err := r.Run(ctx, "zfs", "release", tag, name); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+				released = false
+				break
+			}
+		}
+		if !released {
+			continue
+		}
 		// One snapshot at a time - never a range expression, which would
 		// happily take out snapshots that did not match the pattern.
 		if err := r.Run(ctx, "zfs", "destroy", name); err != nil {
@@ -504,6 +593,13 @@ func runCleanupOrphans(ctx context.Context, r commandRunner, opts cleanupOptions
 		destroyed++
 		fmt.Printf("  destroyed %s\n", name)
 	}
+	if len(datasets) > 0 {
+		if len(failures) == 0 {
+			failures = retireDatasets(ctx, r, datasets)
+		} else {
+			failures = append(failures, "datasets kept, since not every snapshot was destroyed")
+		}
+	}
 
 	fmt.Println()
 	fmt.Println(statusStyle.Render(fmt.Sprintf("Destroyed %d of %d snapshot(s).", destroyed, len(targets))))
@@ -511,7 +607,7 @@ func runCleanupOrphans(ctx context.Context, r commandRunner, opts cleanupOptions
 		fmt.Println(errorStyle.Render("  failed: " + f))
 	}
 
-	if usage, err := listDatasetUsage(ctx, r, scan.Pool); err == nil {
+	if usage, err := listDatasetUsage(ctx, r, pool); err == nil {
 		fmt.Println()
 		fmt.Println(labelStyle.Render("Space after cleanup:"))
 		for _, u := range usage {
@@ -527,6 +623,15 @@ func runCleanupOrphans(ctx context.Context, r commandRunner, opts cleanupOptions
 	return 0
 }
 
+// describeTargets counts what a cleanup destroys, e.g. "12 snapshot(s)" or
+// "12 snapshot(s) and 3 dataset(s)".
+func describeTargets(snapshots, datasets int) string {
+	if datasets == 0 {
+		return fmt.Sprintf("%d snapshot(s)", snapshots)
+	}
+	return fmt.Sprintf("%d snapshot(s) and %d dataset(s)", snapshots, datasets)
+}
+
 // printCleanupPlan renders the per-dataset summary of what cleanup would do.
 func printCleanupPlan(decisions []destroyDecision) {
 	byDataset := map[string][]destroyDecision{}
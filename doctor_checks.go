@@ -0,0 +1,1084 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// Doctor check registry
+// =============================================================================
+//
+// Each doctor check inspects the shared orphanScan and returns structured
+// findings: which check raised it, how serious it is, the dataset, the
+// evidence and what to do about it. The human report, `doctor --json` and the
+// exit code are all derived from the same findings.
+
+// doctorSeverity ranks findings. The highest severity decides doctor's exit
+// code, following the monitoring-plugin convention.
+type doctorSeverity int
+
+const (
+	severityOK       doctorSeverity = iota // nothing found
+	severityInfo                           // worth knowing, needs no action
+	severityWarning                        // needs attention soon
+	severityCritical                       // backups or writes are failing or about to
+	severityUnknown                        // the pool could not be inspected
+)
+
+// String names the severity as it appears in `doctor --json`.
+func (s doctorSeverity) String() string {
+	switch s {
+	case severityOK:
+		return "ok"
+	case severityInfo:
+		return "info"
+	case severityWarning:
+		return "warning"
+	case severityCritical:
+		return "critical"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalJSON writes the severity by name.
+func (s doctorSeverity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// exitCode is doctor's exit code for a highest severity: 0 when healthy or
+// informational only, 1 for warnings, 2 for critical findings and 3 when the
+// checks could not run.
+func (s doctorSeverity) exitCode() int {
+	switch s {
+	case severityOK, severityInfo:
+		return 0
+	case severityWarning:
+		return 1
+	case severityCritical:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// doctorFinding is one problem a check found.
+type doctorFinding struct {
+	ID          string         `json:"id"` // the check that raised it
+	Severity    doctorSeverity `json:"severity"`
+	Dataset     string         `json:"dataset,omitempty"`
+	Summary     string         `json:"summary"`
+	Evidence    []string       `json:"evidence,omitempty"`
+	Remediation string         `json:"remediation,omitempty"`
+	Fix         *doctorFix     `json:"fix,omitempty"` // what doctor --fix does about it
+}
+
+// doctorCheck is one registered health check.
+type doctorCheck struct {
+	ID     string // selects the check with --only and --skip
+	Title  string // heads the check's findings in the report
+	Passed string // shown when the check finds nothing
+	Run    func(ctx context.Context, r commandRunner, scan *orphanScan) []doctorFinding
+}
+
+// doctorChecks is every check, in report order.
+var doctorChecks = []doctorCheck{
+	{
+		ID:     "scope",
+		Title:  "Backup scope",
+		Passed: "Every dataset in the backup scope exists.",
+		Run:    checkMissingDatasets,
+	},
+	{
+		ID:     "orphans",
+		Title:  "Orphaned snapshots",
+		Passed: "No orphaned zfs-backup or syncoid snapshots found.",
+		Run:    checkOrphans,
+	},
+	{
+		ID:     "quota-pressure",
+		Title:  "Snapshots dominate space usage",
+		Passed: "No dataset is dominated by snapshot usage.",
+		Run:    checkQuotaPressure,
+	},
+	{
+		ID:     "stale-backups",
+		Title:  "Backups older than the RPO",
+		Passed: "Every dataset in scope has a backup within the RPO.",
+		Run:    checkStaleBackups,
+	},
+	{
+		ID:     "unscoped-backups",
+		Title:  "Backed-up datasets outside the scope",
+		Passed: "Every dataset with a backup is still in the backup scope.",
+		Run:    checkUnscopedBackups,
+	},
+	{
+		ID:     "broken-chains",
+		Title:  "Broken incremental chains",
+		Passed: "Every backed-up dataset shares a snapshot or bookmark with its backup.",
+		Run:    checkBrokenChains,
+	},
+	{
+		ID:     "excess-bookmarks",
+		Title:  "Excess bookmarks",
+		Passed: fmt.Sprintf("No dataset keeps more than %d zfs-backup bookmarks.", bookmarksKept),
+		Run:    checkExcessBookmarks,
+	},
+	{
+		ID:     "unheld-bases",
+		Title:  "Unprotected incremental bases",
+		Passed: "Every incremental base is held on both sides.",
+		Run:    checkUnheldBases,
+	},
+	{
+		ID:     "pool-health",
+		Title:  "Pool health",
+		Passed: "Every pool is ONLINE.",
+		Run:    checkPoolHealth,
+	},
+	{
+		ID:     "scrubs",
+		Title:  "Scrubs",
+		Passed: "Every pool has a recent, clean scrub.",
+		Run:    checkScrubs,
+	},
+	{
+		ID:     "resume-tokens",
+		Title:  "Interrupted receives",
+		Passed: "No interrupted receive is waiting to resume.",
+		Run:    checkResumeTokens,
+	},
+	{
+		ID:     "stale-holds",
+		Title:  "Stale holds",
+		Passed: "No syncoid or base hold is left on a snapshot a later sync has moved past.",
+		Run:    checkStaleHolds,
+	},
+	{
+		ID:     "backup-capacity",
+		Title:  "Backup pool capacity",
+		Passed: "The backup pool has room to grow.",
+		Run:    checkBackupCapacity,
+	},
+}
+
+// destinationDoctorChecks is every check `doctor --destination` runs against
+// a backup pool, in report order.
+var destinationDoctorChecks = append([]doctorCheck{
+	{
+		ID:     "retired-hosts",
+		Title:  "Retired hosts",
+		Passed: "Every host namespace still receives backups.",
+		Run:    checkRetiredHosts,
+	},
+	{
+		ID:     "abandoned-datasets",
+		Title:  "Abandoned datasets",
+		Passed: "Every backed-up dataset still receives backups.",
+		Run:    checkAbandonedDatasets,
+	},
+	{
+		ID:     "legacy-layout",
+		Title:  "Superseded flat-layout copies",
+		Passed: "No flat-layout copy has been superseded by a host namespace.",
+		Run:    checkLegacyLayout,
+	},
+	{
+		ID:     "destination-orphans",
+		Title:  "Orphaned syncoid snapshots",
+		Passed: "No syncoid leftovers on the backup pool.",
+		Run:    checkDestinationOrphans,
+	},
+}, pickDoctorChecks("pool-health", "scrubs", "resume-tokens", "stale-holds", "backup-capacity")...)
+
+// pickDoctorChecks returns the named checks from doctorChecks, to share them
+// with another registry.
+func pickDoctorChecks(ids ...string) []doctorCheck {
+	var picked []doctorCheck
+	for _, id := range ids {
+		for _, c := range doctorChecks {
+			if c.ID == id {
+				picked = append(picked, c)
+			}
+		}
+	}
+	return picked
+}
+
+// findDoctorCheck returns a registered check by ID, from either registry.
+func findDoctorCheck(id string) doctorCheck {
+	for _, c := range append(doctorChecks, destinationDoctorChecks...) {
+		if c.ID == id {
+			return c
+		}
+	}
+	return doctorCheck{ID: id, Title: id}
+}
+
+// doctorCheckIDs lists a registry's check IDs, for help and errors.
+func doctorCheckIDs(registry []doctorCheck) []string {
+	ids := make([]string, len(registry))
+	for i, c := range registry {
+		ids[i] = c.ID
+	}
+	return ids
+}
+
+// selectDoctorChecks returns the checks of a registry to run: only those
+// named in only, if any, less those named in skip. Unknown IDs are an error
+// rather than silently checking nothing.
+func selectDoctorChecks(registry []doctorCheck, only, skip []string) ([]doctorCheck, error) {
+	known := map[string]bool{}
+	for _, c := range registry {
+		known[c.ID] = true
+	}
+	for _, id := range append(append([]string{}, only...), skip...) {
+		if !known[id] {
+			return nil, fmt.Errorf("unknown check %q - choose from %s", id, strings.Join(doctorCheckIDs(registry), ", "))
+		}
+	}
+
+	contains := func(ids []string, id string) bool {
+		for _, candidate := range ids {
+			if candidate == id {
+				return true
+			}
+		}
+		return false
+	}
+	var selected []doctorCheck
+	for _, c := range registry {
+		if len(only) > 0 && !contains(only, c.ID) {
+			continue
+		}
+		if contains(skip, c.ID) {
+			continue
+		}
+		selected = append(selected, c)
+	}
+	return selected, nil
+}
+
+// splitCheckIDs splits a comma-separated --only or --skip value.
+func splitCheckIDs(value string) []string {
+	var ids []string
+	for _, id := range strings.Split(value, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// doctorReport is the outcome of running the checks on one pool.
+type doctorReport struct {
+	Pool        string          `json:"pool"`
+	Destination bool            `json:"destination,omitempty"` // Pool is a backup pool
+	CheckedAt   time.Time       `json:"checked_at"`
+	Scope       []string        `json:"scope"`
+	Checks      []string        `json:"checks"`   // IDs of the checks that ran
+	Severity    doctorSeverity  `json:"severity"` // highest among the findings
+	Findings    []doctorFinding `json:"findings"`
+	Error       string          `json:"error,omitempty"` // why the pool could not be inspected
+
+	scan *orphanScan
+}
+
+// runDoctorChecks runs the checks against a scan.
+func runDoctorChecks(ctx context.Context, r commandRunner, scan *orphanScan, checks []doctorCheck) *doctorReport {
+	report := &doctorReport{
+		Pool:        scan.Pool,
+		Destination: scan.Destination,
+		CheckedAt:   scan.ScanTime,
+		Scope:       scan.InScope,
+		Findings:    []doctorFinding{},
+		scan:        scan,
+	}
+	for _, check := range checks {
+		report.Checks = append(report.Checks, check.ID)
+		for _, f := range check.Run(ctx, r, scan) {
+			f.ID = check.ID
+			report.Severity = max(report.Severity, f.Severity)
+			report.Findings = append(report.Findings, f)
+		}
+	}
+	return report
+}
+
+// failedDoctorReport reports a pool that could not be inspected at all.
+func failedDoctorReport(pool string, err error) *doctorReport {
+	return &doctorReport{
+		Pool:      pool,
+		CheckedAt: time.Now(),
+		Findings:  []doctorFinding{},
+		Severity:  severityUnknown,
+		Error:     err.Error(),
+	}
+}
+
+// =============================================================================
+// Checks
+// =============================================================================
+
+// checkMissingDatasets flags datasets configured for backup that no longer
+// exist, since they are silently not being backed up.
+func checkMissingDatasets(_ context.Context, _ commandRunner, scan *orphanScan) []doctorFinding {
+	var findings []doctorFinding
+	for _, ds := range scan.Missing {
+		findings = append(findings, doctorFinding{
+			Severity:    severityWarning,
+			Dataset:     fmt.Sprintf("%s/%s", scan.Pool, ds),
+			Summary:     "configured for backup but no longer exists",
+			Remediation: fmt.Sprintf("re-create it, or set the scope again with sudo zfs-backup scope --pool %s --datasets ...", scan.Pool),
+		})
+	}
+	return findings
+}
+
+// checkOrphans reports orphaned snapshots, one finding per dataset.
+func checkOrphans(_ context.Context, _ commandRunner, scan *orphanScan) []doctorFinding {
+	var findings []doctorFinding
+	datasets, grouped := groupOrphansByDataset(scan.Orphans)
+	for _, ds := range datasets {
+		var backupCount, syncoidCount int
+		var unique int64
+		var oldest, newest time.Time
+		for _, o := range grouped[ds] {
+			if o.Kind == orphanSyncoid {
+				syncoidCount++
+			} else {
+				backupCount++
+			}
+			if o.Used > 0 {
+				unique += o.Used
+			}
+			if oldest.IsZero() || o.Creation.Before(oldest) {
+				oldest = o.Creation
+			}
+			if o.Creation.After(newest) {
+				newest = o.Creation
+			}
+		}
+
+		evidence := []string{fmt.Sprintf("%d zfs-backup snapshot(s), %d syncoid leftover(s)", backupCount, syncoidCount)}
+		if !oldest.IsZero() {
+			evidence = append(evidence, fmt.Sprintf("spanning %s → %s", oldest.Format("2006-01-02"), newest.Format("2006-01-02")))
+		}
+		evidence = append(evidence, fmt.Sprintf("%s uniquely referenced (shared blocks are not counted here)", formatSize(unique)))
+		findings = append(findings, doctorFinding{
+			Severity:    severityWarning,
+			Dataset:     ds,
+			Summary:     fmt.Sprintf("%d orphaned snapshot(s)", len(grouped[ds])),
+			Evidence:    evidence,
+			Remediation: fmt.Sprintf("sudo zfs-backup cleanup-orphans --pool %s --dataset %s", scan.Pool, ds),
+		})
+	}
+	return findings
+}
+
+// quotaCriticalFraction is how full a dataset's quota must be before quota
+// pressure is critical: writes fail once it is reached.
+const quotaCriticalFraction = 0.9
+
+// checkQuotaPressure flags datasets whose snapshots dominate their space.
+func checkQuotaPressure(_ context.Context, _ commandRunner, scan *orphanScan) []doctorFinding {
+	var findings []doctorFinding
+	for _, u := range flagQuotaPressure(scan.Usage, quotaPressureThreshold) {
+		quota := "none"
+		if u.Quota > 0 {
+			quota = formatSize(u.Quota)
+		}
+		finding := doctorFinding{
+			Severity: severityWarning,
+			Dataset:  u.Name,
+			Summary:  fmt.Sprintf("snapshots use %s of %s", formatSize(u.UsedBySnapshots), formatSize(u.Used)),
+			Evidence: []string{fmt.Sprintf("used %s, of which %s is snapshots (quota %s)",
+				formatSize(u.Used), formatSize(u.UsedBySnapshots), quota)},
+			Remediation: "prune old snapshots; `quota` counts snapshots against the limit, `refquota` does not",
+		}
+		if u.Quota > 0 {
+			finding.Fix = refquotaFix(u)
+		}
+		if u.Quota > 0 && float64(u.Used) >= quotaCriticalFraction*float64(u.Quota) {
+			finding.Severity = severityCritical
+			finding.Evidence = append(finding.Evidence,
+				fmt.Sprintf("%.0f%% of the quota is used - writes fail once it is full", 100*float64(u.Used)/float64(u.Quota)))
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+// =============================================================================
+// Configuration
+// =============================================================================
+
+// DoctorConfig holds the thresholds for the doctor's checks, from
+// doctor.json. Unset values take the defaults.
+type DoctorConfig struct {
+	// RPOHours is the most a dataset may go without a backup snapshot on the
+	// backup pool. Twice this is critical.
+	RPOHours int `json:"rpo_hours,omitempty"`
+	// ScrubMaxAgeDays is how long a pool may go without a completed scrub.
+	ScrubMaxAgeDays int `json:"scrub_max_age_days,omitempty"`
+	// CapacityWarningPercent and CapacityCriticalPercent bound how full the
+	// backup pool may get.
+	CapacityWarningPercent  int `json:"capacity_warning_percent,omitempty"`
+	CapacityCriticalPercent int `json:"capacity_critical_percent,omitempty"`
+	// AbandonedAfterDays is how long a dataset on the backup pool may go
+	// without a snapshot before `doctor --destination` calls it abandoned.
+	AbandonedAfterDays int `json:"abandoned_after_days,omitempty"`
+	// ResumeTokenMaxAgeDays is how old a resume token no saved run will
+	// resume may get before the doctor offers to abandon it.
+	ResumeTokenMaxAgeDays int `json:"resume_token_max_age_days,omitempty"`
+}
+
+// doctorFileName is the config file holding the doctor's thresholds.
+const doctorFileName = "doctor.json"
+
+// defaultDoctorConfig suits a nightly backup: a day and a half without one
+// is late, and ZFS slows down past 80% full.
+func defaultDoctorConfig() *DoctorConfig {
+	return &DoctorConfig{
+		RPOHours:                36,
+		ScrubMaxAgeDays:         35,
+		CapacityWarningPercent:  80,
+		CapacityCriticalPercent: 90,
+		AbandonedAfterDays:      30,
+		ResumeTokenMaxAgeDays:   7,
+	}
+}
+
+// getDoctorFilePath returns the path to the doctor config file.
+func getDoctorFilePath() (string, error) {
+	dir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, doctorFileName), nil
+}
+
+// LoadDoctorConfig reads the doctor's thresholds. A missing file, or a
+// missing value, means the default.
+func LoadDoctorConfig() (*DoctorConfig, error) {
+	config := defaultDoctorConfig()
+	doctorPath, err := getDoctorFilePath()
+	if err != nil {
+		return config, err
+	}
+
+	data, err := os.ReadFile(doctorPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return config, err
+	}
+
+	var loaded DoctorConfig
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return config, fmt.Errorf("%s: %w", doctorPath, err)
+	}
+	if loaded.RPOHours < 0 || loaded.ScrubMaxAgeDays < 0 || loaded.CapacityWarningPercent < 0 || loaded.CapacityCriticalPercent < 0 || loaded.AbandonedAfterDays < 0 || loaded.ResumeTokenMaxAgeDays < 0 {
+		return config, fmt.Errorf("%s: thresholds cannot be negative", doctorPath)
+	}
+	config.merge(loaded)
+	return config, nil
+}
+
+// merge takes every value set in other.
+func (c *DoctorConfig) merge(other DoctorConfig) {
+	if other.RPOHours > 0 {
+		c.RPOHours = other.RPOHours
+	}
+	if other.ScrubMaxAgeDays > 0 {
+		c.ScrubMaxAgeDays = other.ScrubMaxAgeDays
+	}
+	if other.CapacityWarningPercent > 0 {
+		c.CapacityWarningPercent = other.CapacityWarningPercent
+	}
+	if other.CapacityCriticalPercent > 0 {
+		c.CapacityCriticalPercent = other.CapacityCriticalPercent
+	}
+	if other.AbandonedAfterDays > 0 {
+		c.AbandonedAfterDays = other.AbandonedAfterDays
+	}
+	if other.ResumeTokenMaxAgeDays > 0 {
+		c.ResumeTokenMaxAgeDays = other.ResumeTokenMaxAgeDays
+	}
+}
+
+// config returns the scan's thresholds, or the defaults.
+func (s *orphanScan) config() *DoctorConfig {
+	if s.Config == nil {
+		return defaultDoctorConfig()
+	}
+	return s.Config
+}
+
+// prepareDoctorScan scans a pool and adds what the checks beyond it need:
+// the thresholds, this machine's name and the backup pool. With backupPool
+// empty, an imported pool with BACKUP in its name is used.
+func prepareDoctorScan(ctx context.Context, r commandRunner, pool, backupPool string) (*orphanScan, error) {
+	scan, err := collectOrphanScan(ctx, r, pool)
+	if err != nil {
+		return nil, err
+	}
+	if scan.Config, err = LoadDoctorConfig(); err != nil {
+		return nil, err
+	}
+	if backupPool == "" {
+		if _, detected := detectPools(getAvailablePools()); detected != pool {
+			backupPool = detected
+		}
+	}
+	scan.BackupPool = backupPool
+	scan.Host = getLocalHostname()
+	scan.States = readResumeStates()
+	return scan, nil
+}
+
+// readResumeStates returns the saved states of interrupted runs, empty but
+// not nil when there are none, and nil when they could not be read.
+func readResumeStates() []*BackupState {
+	states, err := ListBackupStates()
+	if err != nil {
+		return nil
+	}
+	if states == nil {
+		states = []*BackupState{}
+	}
+	return states
+}
+
+// =============================================================================
+// Backup pool checks
+// =============================================================================
+
+// backupPoolView is what the destination-side checks read from the backup
+// pool, once per doctor run.
+type backupPoolView struct {
+	Datasets  map[string]bool
+	Snapshots map[string][]snapshotEntry // by dataset, newest first
+	Err       error                      // the pool could not be read
+}
+
+// backupView reads the backup pool's datasets and snapshots on first use.
+func (s *orphanScan) backupView(ctx context.Context, r commandRunner) *backupPoolView {
+	if s.backup != nil {
+		return s.backup
+	}
+	view := &backupPoolView{Datasets: map[string]bool{}, Snapshots: map[string][]snapshotEntry{}}
+	s.backup = view
+	if s.BackupPool == "" {
+		view.Err = fmt.Errorf("no backup pool is imported")
+		return view
+	}
+
+	output, err := r.Output(ctx, "zfs", "list", "-H", "-o", "name", "-r", s.BackupPool)
+	if err != nil {
+		view.Err = fmt.Errorf("backup pool %s could not be read: %w", s.BackupPool, err)
+		return view
+	}
+	for _, name := range strings.Split(strings.TrimSpace(output), "\n") {
+		if name = strings.TrimSpace(name); name != "" {
+			view.Datasets[name] = true
+		}
+	}
+	entries, err := listSnapshotEntries(ctx, r, s.BackupPool, 0)
+	if err != nil {
+		view.Err = fmt.Errorf("snapshots on %s could not be listed: %w", s.BackupPool, err)
+		return view
+	}
+	sortSnapshotsNewestFirst(entries)
+	for _, e := range entries {
+		view.Snapshots[e.Dataset] = append(view.Snapshots[e.Dataset], e)
+	}
+	return view
+}
+
+// destinationFor returns where a source dataset is backed up on the backup
+// pool, preferring the host namespace over the legacy flat layout as
+// resolveBackupDestination does. Empty when it has never been backed up.
+func (v *backupPoolView) destinationFor(backupPool, host, dataset string) string {
+	for _, candidate := range []string{
+		getHostnameDatasetPath(backupPool, host, dataset),
+		fmt.Sprintf("%s/%s", backupPool, dataset),
+	} {
+		if v.Datasets[candidate] {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// backupPoolSkipped is the finding for a backup pool check that could not
+// run. It is only informational: a backup drive is usually unplugged.
+func backupPoolSkipped(err error) []doctorFinding {
+	return []doctorFinding{{
+		Severity:    severityInfo,
+		Summary:     "skipped: " + err.Error(),
+		Remediation: "connect and unlock the backup pool, or pass --backup-pool POOL",
+	}}
+}
+
+// checkStaleBackups flags datasets in scope whose newest backup snapshot on
+// the backup pool is older than the RPO.
+func checkStaleBackups(ctx context.Context, r commandRunner, scan *orphanScan) []doctorFinding {
+	view := scan.backupView(ctx, r)
+	if view.Err != nil {
+		return backupPoolSkipped(view.Err)
+	}
+	rpo := time.Duration(scan.config().RPOHours) * time.Hour
+
+	var findings []doctorFinding
+	for _, ds := range scan.InScope {
+		source := fmt.Sprintf("%s/%s", scan.Pool, ds)
+		dest := view.destinationFor(scan.BackupPool, scan.Host, ds)
+		var newest *snapshotEntry
+		for _, e := range view.Snapshots[dest] {
+			if isBackupSnapshotTag(e.Tag) {
+				newest = &e
+				break
+			}
+		}
+
+		if newest == nil {
+			where := dest
+			if where == "" {
+				where = getHostnameDatasetPath(scan.BackupPool, scan.Host, ds)
+			}
+			findings = append(findings, doctorFinding{
+				Severity:    severityCritical,
+				Dataset:     source,
+				Summary:     "has never been backed up to " + scan.BackupPool,
+				Evidence:    []string{fmt.Sprintf("no backup snapshot on %s", where)},
+				Remediation: "sudo zfs-backup --backup",
+			})
+			continue
+		}
+		age := scan.ScanTime.Sub(newest.Creation)
+		if age <= rpo {
+			continue
+		}
+		finding := doctorFinding{
+			Severity:    severityWarning,
+			Dataset:     source,
+			Summary:     fmt.Sprintf("last backed up %s ago, over the %dh RPO", ageLabel(age), scan.config().RPOHours),
+			Evidence:    []string{fmt.Sprintf("newest backup snapshot is %s from %s", newest.Name, newest.Creation.Local().Format("2006-01-02 15:04"))},
+			Remediation: "sudo zfs-backup --backup",
+		}
+		if age > 2*rpo {
+			finding.Severity = severityCritical
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+// ageLabel renders an age in hours, or in days once it passes two.
+func ageLabel(d time.Duration) string {
+	if d >= 48*time.Hour {
+		return fmt.Sprintf("%d days", int(d.Hours()/24))
+	}
+	return fmt.Sprintf("%dh", int(d.Hours()))
+}
+
+// listBookmarkNames lists every bookmark under a pool, e.g. POOL/home#tag.
+func listBookmarkNames(ctx context.Context, r commandRunner, pool string) ([]string, error) {
+	output, err := r.Output(ctx, "zfs", "list", "-H", "-o", "name", "-t", "bookmark", "-r", pool)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range strings.Split(strings.TrimSpace(output), "\n") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// checkBrokenChains flags datasets that share no snapshot or bookmark with
+// their copy on the backup pool, so the next incremental send has no base
+// and will fail.
+func checkBrokenChains(ctx context.Context, r commandRunner, scan *orphanScan) []doctorFinding {
+	view := scan.backupView(ctx, r)
+	if view.Err != nil {
+		return backupPoolSkipped(view.Err)
+	}
+	bookmarks, err := listBookmarkNames(ctx, r, scan.Pool)
+	if err != nil {
+		return []doctorFinding{{
+			Severity: severityWarning,
+			Summary:  fmt.Sprintf("could not list bookmarks on %s: %v", scan.Pool, err),
+		}}
+	}
+
+	// Names the source can send incrementally from, per dataset.
+	bases := map[string]map[string]bool{}
+	addBase := func(dataset, tag string) {
+		if bases[dataset] == nil {
+			bases[dataset] = map[string]bool{}
+		}
+		bases[dataset][tag] = true
+	}
+	for _, e := range scan.Entries {
+		addBase(e.Dataset, e.Tag)
+	}
+	for _, name := range bookmarks {
+		if dataset, tag, ok := strings.Cut(name, "#"); ok {
+			addBase(dataset, tag)
+		}
+	}
+
+	var findings []doctorFinding
+	for _, ds := range scan.InScope {
+		source := fmt.Sprintf("%s/%s", scan.Pool, ds)
+		dest := view.destinationFor(scan.BackupPool, scan.Host, ds)
+		snapshots := view.Snapshots[dest]
+		if len(snapshots) == 0 {
+			continue // never backed up: the stale-backups check says so
+		}
+		common := false
+		for _, e := range snapshots {
+			if bases[source][e.Tag] {
+				common = true
+				break
+			}
+		}
+		if common {
+			continue
+		}
+		findings = append(findings, doctorFinding{
+			Severity: severityCritical,
+			Dataset:  source,
+			Summary:  "shares no snapshot or bookmark with " + dest + ", so the next incremental will fail",
+			Evidence: []string{
+				fmt.Sprintf("newest on the backup pool is %s", snapshots[0].Name),
+				fmt.Sprintf("%d snapshot(s) and bookmark(s) on the source, none matching", len(bases[source])),
+			},
+			Remediation: "run Force Backup (sudo zfs-backup --force-backup) to send it in full again",
+		})
+	}
+	return findings
+}
+
+// checkExcessBookmarks flags datasets holding more of zfs-backup's bookmarks
+// than the retention rule keeps - usually bookmarks left by runs from before
+// the rule, which the next backup run will prune.
+func checkExcessBookmarks(ctx context.Context, r commandRunner, scan *orphanScan) []doctorFinding {
+	bookmarks, err := listBookmarkEntries(ctx, r, scan.Pool, 0)
+	if err != nil {
+		return []doctorFinding{{
+			Severity: severityWarning,
+			Summary:  fmt.Sprintf("could not list bookmarks on %s: %v", scan.Pool, err),
+		}}
+	}
+	byDataset := map[string][]snapshotEntry{}
+	for _, b := range bookmarks {
+		byDataset[b.Dataset] = append(byDataset[b.Dataset], b)
+	}
+	view := scan.backupView(ctx, r)
+
+	var findings []doctorFinding
+	for _, ds := range scan.InScope {
+		source := fmt.Sprintf("%s/%s", scan.Pool, ds)
+		if len(filterBackupSnapshots(byDataset[source])) <= bookmarksKept {
+			continue
+		}
+
+		// As in the backup run, the latest common base is only known when
+		// the backup pool can be read, and only then can the excess go.
+		base, known := "", false
+		if view.Err == nil {
+			if dest := view.destinationFor(scan.BackupPool, scan.Host, ds); len(view.Snapshots[dest]) > 0 {
+				candidates := append([]snapshotEntry(nil), byDataset[source]...)
+				for _, e := range scan.Entries {
+					if e.Dataset == source {
+						candidates = append(candidates, e)
+					}
+				}
+				base, known = newestCommonSnapshot(candidates, view.Snapshots[dest]), true
+			}
+		}
+		verdicts := explainBookmarkPrune(byDataset[source], bookmarksKept, base)
+		excess := prunedEntries(verdicts)
+		if len(excess) == 0 {
+			continue
+		}
+
+		oldest := excess[len(excess)-1]
+		finding := doctorFinding{
+			Severity: severityWarning,
+			Dataset:  source,
+			Summary:  fmt.Sprintf("%d zfs-backup bookmarks, %d beyond the newest %d", len(verdicts), len(excess), bookmarksKept),
+			Evidence: []string{fmt.Sprintf("oldest is %s from %s ago", oldest.Name, ageLabel(scan.ScanTime.Sub(oldest.Creation)))},
+			Remediation: fmt.Sprintf("the next backup run prunes them, or run sudo zfs-backup bookmarks --pool %s --dataset %s --yes",
+				scan.Pool, ds),
+		}
+		if base != "" {
+			finding.Evidence = append(finding.Evidence, fmt.Sprintf("the latest common base @%s is kept", base))
+		}
+		if known {
+			commands := make([][]string, 0, len(excess))
+			for _, e := range excess {
+				commands = append(commands, []string{"destroy", e.Name})
+			}
+			finding.Fix = zfsFix(commands...)
+		} else {
+			finding.Evidence = append(finding.Evidence, "the backup pool could not be read, so the common base is unknown")
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+// checkBackupCapacity flags a backup pool filling up.
+func checkBackupCapacity(ctx context.Context, r commandRunner, scan *orphanScan) []doctorFinding {
+	if scan.BackupPool == "" {
+		return backupPoolSkipped(fmt.Errorf("no backup pool is imported"))
+	}
+	output, err := r.Output(ctx, "zpool", "list", "-Hp", "-o", "name,size,allocated,free", scan.BackupPool)
+	capacity := parsePoolCapacity(output)
+	if err != nil || capacity == nil || capacity.Size == 0 {
+		return backupPoolSkipped(fmt.Errorf("the capacity of %s could not be read", scan.BackupPool))
+	}
+
+	config := scan.config()
+	percent := 100 * float64(capacity.Allocated) / float64(capacity.Size)
+	if percent < float64(config.CapacityWarningPercent) {
+		return nil
+	}
+	finding := doctorFinding{
+		Severity: severityWarning,
+		Dataset:  scan.BackupPool,
+		Summary:  fmt.Sprintf("backup pool is %.0f%% full", percent),
+		Evidence: []string{fmt.Sprintf("%s of %s used, %s free",
+			formatSize(capacity.Allocated), formatSize(capacity.Size), formatSize(capacity.Free))},
+		Remediation: "prune old backup snapshots, drop datasets from the scope, or move to a larger drive",
+	}
+	if percent >= float64(config.CapacityCriticalPercent) {
+		finding.Severity = severityCritical
+	}
+	return []doctorFinding{finding}
+}
+
+// =============================================================================
+// Pool checks
+// =============================================================================
+
+// doctorPools is the source pool and, when imported, the backup pool.
+func doctorPools(scan *orphanScan) []string {
+	pools := []string{scan.Pool}
+	if scan.BackupPool != "" && scan.BackupPool != scan.Pool {
+		pools = append(pools, scan.BackupPool)
+	}
+	return pools
+}
+
+// checkPoolHealth flags pools that are not ONLINE.
+func checkPoolHealth(ctx context.Context, r commandRunner, scan *orphanScan) []doctorFinding {
+	var findings []doctorFinding
+	for _, pool := range doctorPools(scan) {
+		output, err := r.Output(ctx, "zpool", "list", "-H", "-o", "health", pool)
+		health := strings.TrimSpace(output)
+		if err != nil || health == "" {
+			health = "unreadable"
+		}
+		if health == "ONLINE" {
+			continue
+		}
+		finding := doctorFinding{
+			Severity:    severityCritical,
+			Dataset:     pool,
+			Summary:     "pool health is " + health,
+			Remediation: "sudo zpool status -v " + pool,
+		}
+		if health == "DEGRADED" {
+			// Still serving data, but with no redundancy left to lose.
+			finding.Severity = severityWarning
+			finding.Summary += " - a device has failed"
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+// scrubErrors matches the error count of a finished scrub.
+var scrubErrors = regexp.MustCompile(`with (\d+) errors`)
+
+// parseScrubLine reads a `zpool status` scan line: whether it is a finished
+// scrub, when it finished and how many errors it found.
+func parseScrubLine(line string, loc *time.Location) (finished time.Time, errors int, ok bool) {
+	if !strings.HasPrefix(line, "scrub repaired") {
+		return time.Time{}, 0, false
+	}
+	idx := strings.LastIndex(line, " on ")
+	if idx < 0 {
+		return time.Time{}, 0, false
+	}
+	finished, err := time.ParseInLocation("Mon Jan _2 15:04:05 2006", strings.TrimSpace(line[idx+4:]), loc)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	if m := scrubErrors.FindStringSubmatch(line); m != nil {
+		errors, _ = strconv.Atoi(m[1])
+	}
+	return finished, errors, true
+}
+
+// checkScrubs flags pools whose last completed scrub is too old or found
+// errors.
+func checkScrubs(ctx context.Context, r commandRunner, scan *orphanScan) []doctorFinding {
+	maxAge := time.Duration(scan.config().ScrubMaxAgeDays) * 24 * time.Hour
+
+	var findings []doctorFinding
+	for _, pool := range doctorPools(scan) {
+		status, err := r.Output(ctx, "zpool", "status", pool)
+		if err != nil {
+			findings = append(findings, doctorFinding{
+				Severity: severityWarning,
+				Dataset:  pool,
+				Summary:  "scrub status could not be read",
+			})
+			continue
+		}
+		line := scrubStatusLine(status)
+		if strings.HasPrefix(line, "scrub in progress") {
+			continue
+		}
+
+		finished, errors, ok := parseScrubLine(line, scan.ScanTime.Location())
+		switch {
+		case !ok:
+			evidence := "zpool status shows no scan"
+			if line != "" {
+				evidence = "last scan: " + line
+			}
+			findings = append(findings, doctorFinding{
+				Severity:    severityWarning,
+				Dataset:     pool,
+				Summary:     "has no completed scrub on record",
+				Evidence:    []string{evidence},
+				Remediation: "sudo zpool scrub " + pool,
+			})
+		case errors > 0:
+			findings = append(findings, doctorFinding{
+				Severity:    severityCritical,
+				Dataset:     pool,
+				Summary:     fmt.Sprintf("last scrub found %d error(s)", errors),
+				Evidence:    []string{line},
+				Remediation: "sudo zpool status -v " + pool + " to see the affected files",
+			})
+		case scan.ScanTime.Sub(finished) > maxAge:
+			findings = append(findings, doctorFinding{
+				Severity:    severityWarning,
+				Dataset:     pool,
+				Summary:     fmt.Sprintf("last scrubbed %s ago", ageLabel(scan.ScanTime.Sub(finished))),
+				Evidence:    []string{line},
+				Remediation: "sudo zpool scrub " + pool,
+			})
+		}
+	}
+	return findings
+}
+
+// checkResumeTokens flags datasets holding the resume token of an
+// interrupted receive, which pins the partial stream's space until it is
+// resumed or aborted. Abandoning it is only offered as a fix when no saved
+// run will resume it and it is older than resume_token_max_age_days;
+// otherwise the finding is report-only, since the fix would throw away a
+// partial stream the next run could pick up.
+func checkResumeTokens(ctx context.Context, r commandRunner, scan *orphanScan) []doctorFinding {
+	maxAge := time.Duration(scan.config().ResumeTokenMaxAgeDays) * 24 * time.Hour
+	var findings []doctorFinding
+	for _, pool := range doctorPools(scan) {
+		output, err := r.Output(ctx, "zfs", "get", "-H", "-o", "name,value", "-r",
+			"-t", "filesystem,volume", "receive_resume_token", pool)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+			name, token, ok := strings.Cut(strings.TrimSpace(line), "\t")
+			if !ok || token == "" || token == "-" {
+				continue
+			}
+			if len(token) > 24 {
+				token = token[:24] + "…"
+			}
+			finding := doctorFinding{
+				Severity:    severityWarning,
+				Dataset:     name,
+				Summary:     "an interrupted receive left a resume token",
+				Evidence:    []string{"receive_resume_token " + token},
+				Remediation: "the next backup resumes it; to abandon it instead, sudo zfs receive -A " + name,
+			}
+			started, known := resumeTokenStarted(ctx, r, name)
+			if known {
+				finding.Evidence = append(finding.Evidence, "receive started "+ageLabel(scan.ScanTime.Sub(started))+" ago")
+			}
+			switch state := scan.resumeStateFor(name); {
+			case state != nil:
+				finding.Evidence = append(finding.Evidence, "saved state "+state.ID)
+				finding.Remediation = "sudo zfs-backup resume picks up the interrupted " + state.Operation + " run"
+			case scan.States != nil && known && scan.ScanTime.Sub(started) > maxAge:
+				finding.Remediation = "no saved run will resume it; sudo zfs receive -A " + name + " abandons it"
+				finding.Fix = zfsFix([]string{"receive", "-A", name})
+			}
+			findings = append(findings, finding)
+		}
+	}
+	return findings
+}
+
+// resumeTokenStarted returns when the interrupted receive into dataset
+// started: the creation of the hidden %recv clone an incremental receive
+// writes into, or of the dataset itself for a full one.
+func resumeTokenStarted(ctx context.Context, r commandRunner, dataset string) (time.Time, bool) {
+	for _, name := range []string{dataset + "/%recv", dataset} {
+		output, err := r.Output(ctx, "zfs", "get", "-H", "-p", "-o", "value", "creation", name)
+		if err != nil {
+			continue
+		}
+		if secs, err := strconv.ParseInt(strings.TrimSpace(output), 10, 64); err == nil {
+			return time.Unix(secs, 0), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// resumeStateFor returns the saved state of an interrupted run receiving
+// into dataset, or nil. A state that does not list its datasets, as a pull's
+// does not, covers its whole destination pool.
+func (s *orphanScan) resumeStateFor(dataset string) *BackupState {
+	pool, rel, _ := strings.Cut(dataset, "/")
+	for _, state := range s.States {
+		if state.Destination != pool {
+			continue
+		}
+		if len(state.Datasets) == 0 {
+			return state
+		}
+		for _, ds := range state.Datasets {
+			for _, dest := range []string{ds, s.Host + "/" + ds} {
+				if rel == dest || strings.HasPrefix(rel, dest+"/") {
+					return state
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,605 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// Backup pool layout
+// =============================================================================
+//
+// A backup pool holds one DESTPOOL/<hostname> namespace per machine backed up
+// to it, with that machine's datasets beneath, plus any datasets still in the
+// legacy flat DESTPOOL/<dataset> layout. Nothing on the backup pool is ever
+// pruned once its host stops sending, so retired hosts and dropped datasets
+// keep their space until somebody removes them.
+//
+// Age alone cannot tell a retired host from a disk that spent a month
+// offsite, so this machine's own namespace is never retired, and its backups
+// - and flat copies - of datasets still in its scope are never abandoned.
+
+// destinationDataset is one backed-up dataset on the backup pool.
+type destinationDataset struct {
+	Name            string // e.g. NIXBACKUPS/abyss/home
+	Host            string // host namespace; empty in the legacy flat layout
+	Dataset         string // the source dataset name, e.g. home
+	Used            int64  // including its descendants and snapshots
+	UsedBySnapshots int64
+	Snapshots       int       // snapshots on the dataset itself
+	Newest          time.Time // newest snapshot; zero when it has none
+}
+
+// destinationHost is one host namespace on the backup pool.
+type destinationHost struct {
+	Name     string
+	Path     string // e.g. NIXBACKUPS/abyss
+	Used     int64
+	Datasets []destinationDataset
+}
+
+// newest is the host's most recent snapshot across its datasets.
+func (h destinationHost) newest() time.Time {
+	var newest time.Time
+	for _, ds := range h.Datasets {
+		if ds.Newest.After(newest) {
+			newest = ds.Newest
+		}
+	}
+	return newest
+}
+
+// destinationLayout is the backup pool sorted into hosts and flat datasets,
+// with the ages that decide which of them are still in use.
+type destinationLayout struct {
+	Pool  string
+	Hosts []destinationHost
+	Flat  []destinationDataset // legacy flat-layout datasets
+
+	Now            time.Time
+	AbandonedAfter time.Duration // no snapshot for this long: abandoned
+	RPO            time.Duration // no snapshot for this long: not being written
+
+	Host  string          // this machine's namespace
+	Scope map[string]bool // datasets this machine backs up; nil when unknown
+}
+
+// analyseDestination sorts a backup pool's datasets into host namespaces and
+// legacy flat datasets. A namespace is a direct child of the pool holding
+// datasets but no snapshots of its own - zfs-backup creates it empty - and
+// anything else directly under the pool is a flat-layout backup. Datasets
+// nested deeper than a backup are counted in its space, not listed.
+func analyseDestination(pool string, usage []datasetUsage, entries []snapshotEntry) *destinationLayout {
+	counts := map[string]int{}
+	newest := map[string]time.Time{}
+	for _, e := range entries {
+		counts[e.Dataset]++
+		if e.Creation.After(newest[e.Dataset]) {
+			newest[e.Dataset] = e.Creation
+		}
+	}
+	hasChildren := map[string]bool{}
+	for _, u := range usage {
+		if idx := strings.LastIndex(u.Name, "/"); idx > 0 {
+			hasChildren[u.Name[:idx]] = true
+		}
+	}
+
+	layout := &destinationLayout{Pool: pool}
+	hosts := map[string]*destinationHost{}
+	var order []string
+	for _, u := range usage {
+		rel, ok := strings.CutPrefix(u.Name, pool+"/")
+		if !ok || rel == "" || strings.Contains(rel, "/") {
+			continue
+		}
+		if hasChildren[u.Name] && counts[u.Name] == 0 {
+			hosts[u.Name] = &destinationHost{Name: rel, Path: u.Name, Used: u.Used}
+			order = append(order, u.Name)
+			continue
+		}
+		layout.Flat = append(layout.Flat, destinationDataset{
+			Name: u.Name, Dataset: rel, Used: u.Used, UsedBySnapshots: u.UsedBySnapshots,
+			Snapshots: counts[u.Name], Newest: newest[u.Name],
+		})
+	}
+	for _, u := range usage {
+		parent, dataset, ok := strings.Cut(strings.TrimPrefix(u.Name, pool+"/"), "/")
+		host := hosts[pool+"/"+parent]
+		if !ok || host == nil || strings.Contains(dataset, "/") {
+			continue
+		}
+		host.Datasets = append(host.Datasets, destinationDataset{
+			Name: u.Name, Host: host.Name, Dataset: dataset, Used: u.Used, UsedBySnapshots: u.UsedBySnapshots,
+			Snapshots: counts[u.Name], Newest: newest[u.Name],
+		})
+	}
+
+	sort.Strings(order)
+	for _, path := range order {
+		layout.Hosts = append(layout.Hosts, *hosts[path])
+	}
+	sort.Slice(layout.Flat, func(i, j int) bool { return layout.Flat[i].Name < layout.Flat[j].Name })
+	return layout
+}
+
+// describeDestination summarises a backup pool's layout in one line.
+func describeDestination(layout *destinationLayout) string {
+	names := make([]string, len(layout.Hosts))
+	for i, h := range layout.Hosts {
+		names[i] = h.Name
+	}
+	line := fmt.Sprintf("Backup pool %s: %d host namespace(s)", layout.Pool, len(layout.Hosts))
+	if len(names) > 0 {
+		line += " (" + strings.Join(names, ", ") + ")"
+	}
+	if len(layout.Flat) > 0 {
+		line += fmt.Sprintf(", %d legacy flat-layout dataset(s)", len(layout.Flat))
+	}
+	return line + "."
+}
+
+// abandoned reports whether a backup has had no snapshot for longer than
+// maxAge, or has none at all.
+func (ds destinationDataset) abandoned(now time.Time, maxAge time.Duration) bool {
+	return ds.Newest.IsZero() || now.Sub(ds.Newest) > maxAge
+}
+
+// lastBackup renders when a backup last received a snapshot.
+func lastBackup(newest, now time.Time) string {
+	if newest.IsZero() {
+		return "holds no snapshots"
+	}
+	return fmt.Sprintf("last snapshot %s (%s ago)", newest.Local().Format("2006-01-02"), ageLabel(now.Sub(newest)))
+}
+
+// inScope reports whether a backup is one this machine still makes: a
+// dataset in its scope, in its own namespace or the flat layout. With the
+// scope unknown, every one of them is.
+func (l *destinationLayout) inScope(ds destinationDataset) bool {
+	if ds.Host != "" && ds.Host != l.Host {
+		return false
+	}
+	if l.Scope == nil {
+		return true
+	}
+	for scoped := range l.Scope {
+		if scoped == ds.Dataset || strings.HasPrefix(scoped, ds.Dataset+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// retiredHosts returns the host namespaces whose every dataset is abandoned,
+// never this machine's own.
+func (l *destinationLayout) retiredHosts() []destinationHost {
+	var retired []destinationHost
+	for _, h := range l.Hosts {
+		if h.Name == l.Host {
+			continue
+		}
+		active := false
+		for _, ds := range h.Datasets {
+			if !ds.abandoned(l.Now, l.AbandonedAfter) {
+				active = true
+				break
+			}
+		}
+		if !active {
+			retired = append(retired, h)
+		}
+	}
+	return retired
+}
+
+// supersededBy returns the namespaced copies of a flat-layout dataset that is
+// no longer written: once a host backs up into its namespace, the flat copy
+// is left behind. A flat copy still receiving backups belongs to a host that
+// has not moved yet, so it is never superseded. A flat copy of a dataset in
+// this machine's scope is only superseded by its own namespace.
+func (l *destinationLayout) supersededBy(flat destinationDataset) []string {
+	if !flat.abandoned(l.Now, l.RPO) {
+		return nil
+	}
+	ours := l.inScope(flat)
+	var copies []string
+	for _, h := range l.Hosts {
+		if ours && h.Name != l.Host {
+			continue
+		}
+		for _, ds := range h.Datasets {
+			if ds.Dataset == flat.Dataset {
+				copies = append(copies, ds.Name)
+			}
+		}
+	}
+	return copies
+}
+
+// abandonedDatasets returns the backups with no recent snapshot that this
+// machine no longer makes, leaving out those under a retired host and
+// superseded flat copies, which their own checks report.
+func (l *destinationLayout) abandonedDatasets() []destinationDataset {
+	retired := map[string]bool{}
+	for _, h := range l.retiredHosts() {
+		retired[h.Name] = true
+	}
+	var abandoned []destinationDataset
+	for _, h := range l.Hosts {
+		if retired[h.Name] {
+			continue
+		}
+		for _, ds := range h.Datasets {
+			if !l.inScope(ds) && ds.abandoned(l.Now, l.AbandonedAfter) {
+				abandoned = append(abandoned, ds)
+			}
+		}
+	}
+	for _, ds := range l.Flat {
+		if len(l.supersededBy(ds)) == 0 && !l.inScope(ds) && ds.abandoned(l.Now, l.AbandonedAfter) {
+			abandoned = append(abandoned, ds)
+		}
+	}
+	return abandoned
+}
+
+// removable lists every path the destination checks suggest removing: retired
+// host namespaces, abandoned datasets and superseded flat copies.
+func (l *destinationLayout) removable() map[string]bool {
+	paths := map[string]bool{}
+	for _, h := range l.retiredHosts() {
+		paths[h.Path] = true
+	}
+	for _, ds := range l.abandonedDatasets() {
+		paths[ds.Name] = true
+	}
+	for _, ds := range l.Flat {
+		if len(l.supersededBy(ds)) > 0 {
+			paths[ds.Name] = true
+		}
+	}
+	return paths
+}
+
+// scanDestinationOrphans finds syncoid sync-snapshots on the backup pool that
+// a failed or interrupted send left behind. The newest snapshot of a dataset
+// is never one of them, since the next incremental may send from it.
+func scanDestinationOrphans(entries []snapshotEntry, now time.Time, minSyncoidAge time.Duration) []orphanSnapshot {
+	byDataset := map[string][]snapshotEntry{}
+	for _, e := range entries {
+		byDataset[e.Dataset] = append(byDataset[e.Dataset], e)
+	}
+
+	var orphans []orphanSnapshot
+	for _, snapshots := range byDataset {
+		sorted := append([]snapshotEntry(nil), snapshots...)
+		sortSnapshotsNewestFirst(sorted)
+		for _, e := range sorted[1:] {
+			if !isSyncoidSnapshotTag(e.Tag) || isProtectedSnapshotTag(e.Tag) {
+				continue
+			}
+			if !e.Creation.IsZero() && now.Sub(e.Creation) < minSyncoidAge {
+				continue
+			}
+			orphans = append(orphans, orphanSnapshot{
+				snapshotEntry: e,
+				Kind:          orphanSyncoid,
+				Reason:        "syncoid sync-snapshot received but never pruned",
+			})
+		}
+	}
+	return orphans
+}
+
+// =============================================================================
+// Destination scan
+// =============================================================================
+
+// prepareDestinationScan reads a backup pool for `doctor --destination`. The
+// scan's Pool and BackupPool are both the backup pool, so the pool-wide
+// checks inspect it alone. This machine's scope is read from its source pool
+// so its own backups are never flagged; without one, none of them are.
+func prepareDestinationScan(ctx context.Context, r commandRunner, backupPool string) (*orphanScan, error) {
+	entries, err := listSnapshotEntries(ctx, r, backupPool, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots on %s: %w", backupPool, err)
+	}
+	usage, err := listDatasetUsage(ctx, r, backupPool)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read space usage for %s: %w", backupPool, err)
+	}
+	config, err := LoadDoctorConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var scope map[string]bool
+	if source, _ := detectPools(getAvailablePools()); source != "" {
+		if inScope, missing, err := resolveBackupDatasets(source); err == nil {
+			scope = map[string]bool{}
+			for _, ds := range append(inScope, missing...) {
+				scope[ds] = true
+			}
+		}
+	}
+
+	now := time.Now()
+	return &orphanScan{
+		Pool:        backupPool,
+		Entries:     entries,
+		Usage:       usage,
+		ScanTime:    now,
+		BackupPool:  backupPool,
+		Host:        getLocalHostname(),
+		Config:      config,
+		Destination: true,
+		LocalScope:  scope,
+		States:      readResumeStates(),
+		Orphans:     scanDestinationOrphans(entries, now, minSyncoidOrphanAge),
+	}, nil
+}
+
+// destination sorts the scanned backup pool into hosts and datasets on first
+// use.
+func (s *orphanScan) destination() *destinationLayout {
+	if s.layout == nil {
+		s.layout = analyseDestination(s.Pool, s.Usage, s.Entries)
+		s.layout.Now = s.ScanTime
+		s.layout.AbandonedAfter = time.Duration(s.config().AbandonedAfterDays) * 24 * time.Hour
+		s.layout.RPO = time.Duration(s.config().RPOHours) * time.Hour
+		s.layout.Host = s.Host
+		s.layout.Scope = s.LocalScope
+	}
+	return s.layout
+}
+
+// retireCommand is the cleanup command that removes a flagged path.
+func retireCommand(pool, path string) string {
+	return fmt.Sprintf("sudo zfs-backup cleanup-orphans --destination --pool %s --retire %s", pool, path)
+}
+
+// =============================================================================
+// Destination checks
+// =============================================================================
+
+// checkRetiredHosts flags host namespaces that no longer receive backups.
+func checkRetiredHosts(_ context.Context, _ commandRunner, scan *orphanScan) []doctorFinding {
+	var findings []doctorFinding
+	for _, h := range scan.destination().retiredHosts() {
+		findings = append(findings, doctorFinding{
+			Severity: severityWarning,
+			Dataset:  h.Path,
+			Summary:  fmt.Sprintf("host %s has had no backup for over %d days", h.Name, scan.config().AbandonedAfterDays),
+			Evidence: []string{
+				fmt.Sprintf("%d dataset(s) using %s", len(h.Datasets), formatSize(h.Used)),
+				lastBackup(h.newest(), scan.ScanTime),
+			},
+			Remediation: retireCommand(scan.Pool, h.Path),
+		})
+	}
+	return findings
+}
+
+// checkAbandonedDatasets flags backups of active hosts, and flat-layout
+// backups, that no longer receive snapshots.
+func checkAbandonedDatasets(_ context.Context, _ commandRunner, scan *orphanScan) []doctorFinding {
+	var findings []doctorFinding
+	for _, ds := range scan.destination().abandonedDatasets() {
+		summary := fmt.Sprintf("no backup for over %d days", scan.config().AbandonedAfterDays)
+		if ds.Host == "" {
+			summary += " (legacy flat layout)"
+		}
+		findings = append(findings, doctorFinding{
+			Severity: severityWarning,
+			Dataset:  ds.Name,
+			Summary:  summary,
+			Evidence: []string{
+				lastBackup(ds.Newest, scan.ScanTime),
+				fmt.Sprintf("uses %s, %s of it in %d snapshot(s)", formatSize(ds.Used), formatSize(ds.UsedBySnapshots), ds.Snapshots),
+			},
+			Remediation: retireCommand(scan.Pool, ds.Name),
+		})
+	}
+	return findings
+}
+
+// checkLegacyLayout flags flat-layout backups that a host namespace has
+// taken over, so they are never written again.
+func checkLegacyLayout(_ context.Context, _ commandRunner, scan *orphanScan) []doctorFinding {
+	layout := scan.destination()
+	var findings []doctorFinding
+	for _, ds := range layout.Flat {
+		copies := layout.supersededBy(ds)
+		if len(copies) == 0 {
+			continue
+		}
+		findings = append(findings, doctorFinding{
+			Severity: severityWarning,
+			Dataset:  ds.Name,
+			Summary:  "legacy flat-layout copy, superseded by " + strings.Join(copies, ", "),
+			Evidence: []string{
+				lastBackup(ds.Newest, scan.ScanTime),
+				fmt.Sprintf("uses %s", formatSize(ds.Used)),
+			},
+			Remediation: retireCommand(scan.Pool, ds.Name),
+		})
+	}
+	return findings
+}
+
+// checkDestinationOrphans reports syncoid leftovers on the backup pool, one
+// finding per dataset. Datasets flagged for removal are left to that finding.
+func checkDestinationOrphans(_ context.Context, _ commandRunner, scan *orphanScan) []doctorFinding {
+	removable := scan.destination().removable()
+	var findings []doctorFinding
+	datasets, grouped := groupOrphansByDataset(scan.Orphans)
+	for _, ds := range datasets {
+		if underAny(ds, removable) {
+			continue
+		}
+		var unique int64
+		for _, o := range grouped[ds] {
+			if o.Used > 0 {
+				unique += o.Used
+			}
+		}
+		findings = append(findings, doctorFinding{
+			Severity: severityWarning,
+			Dataset:  ds,
+			Summary:  fmt.Sprintf("%d syncoid leftover(s)", len(grouped[ds])),
+			Evidence: []string{
+				fmt.Sprintf("oldest %s, newest %s", grouped[ds][0].Tag, grouped[ds][len(grouped[ds])-1].Tag),
+				fmt.Sprintf("%s uniquely referenced", formatSize(unique)),
+			},
+			Remediation: fmt.Sprintf("sudo zfs-backup cleanup-orphans --destination --pool %s --dataset %s", scan.Pool, ds),
+		})
+	}
+	return findings
+}
+
+// underAny reports whether a dataset is one of paths or beneath one.
+func underAny(dataset string, paths map[string]bool) bool {
+	for path := range paths {
+		if dataset == path || strings.HasPrefix(dataset, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// =============================================================================
+// cleanup-orphans --destination
+// =============================================================================
+
+// runCleanupDestination removes debris from a backup pool with the same
+// safety rules as runCleanupOrphans. Without --retire it destroys syncoid
+// leftovers; with --retire PATH it removes a host namespace or dataset the
+// destination checks flagged - every snapshot one at a time, then the
+// datasets deepest first - and refuses anything they did not flag.
+func runCleanupDestination(ctx context.Context, r commandRunner, opts cleanupOptions, confirmFn func(string) bool) int {
+	fmt.Println()
+	fmt.Println(titleStyle.Render("zfs-backup cleanup-orphans --destination"))
+	fmt.Println(interstitialStyle.Render(strings.Repeat("─", 60)))
+	fmt.Println()
+
+	scan, err := prepareDestinationScan(ctx, r, opts.Pool)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return 1
+	}
+	fmt.Println(infoStyle.Render(describeDestination(scan.destination())))
+	fmt.Println()
+
+	if opts.Retire == "" {
+		orphans := scan.Orphans
+		if opts.Dataset != "" {
+			var filtered []orphanSnapshot
+			for _, o := range orphans {
+				if o.Dataset == opts.Dataset {
+					filtered = append(filtered, o)
+				}
+			}
+			orphans = filtered
+		}
+		if len(orphans) == 0 {
+			fmt.Println(statusStyle.Render("[OK] Nothing to clean up."))
+			fmt.Println()
+			return 0
+		}
+		return destroyVetted(ctx, r, opts, scan.Pool, vetOrphans(ctx, r, orphans), nil, confirmFn)
+	}
+
+	if !scan.destination().removable()[opts.Retire] {
+		fmt.Println(errorStyle.Render(fmt.Sprintf(
+			"Error: %s is not a retired host, abandoned dataset or superseded flat copy - see doctor --destination --pool %s",
+			opts.Retire, scan.Pool)))
+		return 1
+	}
+
+	var snapshots []orphanSnapshot
+	for _, e := range scan.Entries {
+		if e.Dataset == opts.Retire || strings.HasPrefix(e.Dataset, opts.Retire+"/") {
+			snapshots = append(snapshots, orphanSnapshot{
+				snapshotEntry: e,
+				Kind:          orphanAbandoned,
+				Reason:        opts.Retire + " no longer receives backups",
+			})
+		}
+	}
+	var datasets []string
+	for _, u := range scan.Usage {
+		if u.Name == opts.Retire || strings.HasPrefix(u.Name, opts.Retire+"/") {
+			datasets = append(datasets, u.Name)
+		}
+	}
+	// Children before parents, so no destroy ever needs -r.
+	sort.Slice(datasets, func(i, j int) bool {
+		if di, dj := strings.Count(datasets[i], "/"), strings.Count(datasets[j], "/"); di != dj {
+			return di > dj
+		}
+		return datasets[i] < datasets[j]
+	})
+
+	retention, err := LoadRetentionConfig()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return 1
+	}
+	decisions := vetOrphans(ctx, r, snapshots)
+	allowRetiredHolds(ctx, r, decisions, retention.window(), scan.ScanTime)
+	if len(safeToDestroy(decisions)) < len(decisions) {
+		printCleanupPlan(decisions)
+		fmt.Println(warningStyle.Render(fmt.Sprintf(
+			"%s is kept whole: a snapshot in it is protected, held or cloned.", opts.Retire)))
+		fmt.Println(infoStyle.Render(fmt.Sprintf(
+			"Snapshots inside the retention window are released with: sudo zfs-backup release-retention --dataset %s", opts.Retire)))
+		fmt.Println()
+		return 1
+	}
+	return destroyVetted(ctx, r, opts, scan.Pool, decisions, datasets, confirmFn)
+}
+
+// printRetirePlan lists the datasets a --retire removes after its snapshots.
+func printRetirePlan(datasets []string) {
+	fmt.Printf("  %s\n", labelStyle.Render("then the datasets, deepest first"))
+	for _, ds := range datasets {
+		fmt.Printf("    %s\n", ds)
+	}
+	fmt.Println()
+}
+
+// confirmRetire re-reads a dataset before it is destroyed: it must still hold
+// no snapshots, since destroying one with snapshots would need -r.
+func confirmRetire(ctx context.Context, r commandRunner, dataset string) error {
+	output, err := r.Output(ctx, "zfs", "list", "-H", "-o", "name", "-t", "snapshot", "-d", "1", dataset)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(output) != "" {
+		return fmt.Errorf("still has snapshots")
+	}
+	return nil
+}
+
+// retireDatasets destroys the datasets of a --retire one at a time, stopping
+// at the first failure so no parent is attempted before its children are
+// gone.
+func retireDatasets(ctx context.Context, r commandRunner, datasets []string) []string {
+	for _, ds := range datasets {
+		if err := confirmRetire(ctx, r, ds); err != nil {
+			return []string{fmt.Sprintf("%s: %v", ds, err)}
+		}
+		if err := r.Run(ctx, "zfs", "destroy", ds); err != nil {
+			return []string{fmt.Sprintf("%s: %v", ds, err)}
+		}
+		fmt.Printf("  destroyed %s\n", ds)
+	}
+	return nil
+}
@@ -0,0 +1,355 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// doctor --fix
+// =============================================================================
+//
+// Checks whose remediation is mechanical attach a doctorFix to the finding.
+// `doctor --fix` prints every fix's plan; `--fix --yes` applies them after a
+// typed confirmation and records each one in the run history.
+
+// doctorFix is the change `doctor --fix` makes for one finding.
+type doctorFix struct {
+	Plan  []string                                         `json:"plan"` // what it does, one step per line
+	Apply func(ctx context.Context, r commandRunner) error `json:"-"`
+}
+
+// zfsFix is a fix that runs zfs commands in order, stopping at the first that
+// fails.
+func zfsFix(commands ...[]string) *doctorFix {
+	plan := make([]string, len(commands))
+	for i, args := range commands {
+		plan[i] = "zfs " + strings.Join(args, " ")
+	}
+	return &doctorFix{
+		Plan: plan,
+		Apply: func(ctx context.Context, r commandRunner) error {
+			for _, args := range commands {
+				if err := r.Run(ctx, "zfs", args...); err != nil {
+					return fmt.Errorf("zfs %s: %w", strings.Join(args, " "), err)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// refquotaFix moves a dataset's quota to refquota at the same value, so
+// snapshots stop counting against the limit.
+func refquotaFix(u datasetUsage) *doctorFix {
+	commands := [][]string{{"set", "quota=none", u.Name}}
+	if u.RefQuota == 0 || u.RefQuota > u.Quota {
+		commands = append([][]string{{"set", fmt.Sprintf("refquota=%d", u.Quota), u.Name}}, commands...)
+	}
+	return zfsFix(commands...)
+}
+
+// scopeFix adds a dataset back to a pool's backup scope. The scope is read
+// when the fix is applied, so several fixes in one run all take effect.
+func scopeFix(pool, dataset string) *doctorFix {
+	return &doctorFix{
+		Plan: []string{fmt.Sprintf("add %s to the backup scope of %s", dataset, pool)},
+		Apply: func(context.Context, commandRunner) error {
+			scope, err := LoadBackupScope()
+			if err != nil {
+				return err
+			}
+			current, configured := scope.Pools[pool]
+			if !configured {
+				return nil // every dataset is already in scope
+			}
+			return SetPoolScope(pool, append(current.Datasets, dataset))
+		},
+	}
+}
+
+// fixableFindings returns the findings doctor --fix can act on.
+func fixableFindings(report *doctorReport) []doctorFinding {
+	var fixable []doctorFinding
+	for _, f := range report.Findings {
+		if f.Fix != nil {
+			fixable = append(fixable, f)
+		}
+	}
+	return fixable
+}
+
+// printFixPlan lists what doctor --fix would change.
+func printFixPlan(fixable []doctorFinding) {
+	for _, f := range fixable {
+		subject := f.Summary
+		if f.Dataset != "" {
+			subject = f.Dataset + ": " + f.Summary
+		}
+		fmt.Printf("  %s %s\n", labelStyle.Render("["+f.ID+"]"), subject)
+		for _, step := range f.Fix.Plan {
+			fmt.Printf("    %s\n", step)
+		}
+	}
+	fmt.Println()
+}
+
+// applyDoctorFixes applies each fix in turn and returns them as a history
+// record, one dataset entry per fix.
+func applyDoctorFixes(ctx context.Context, r commandRunner, report *doctorReport, fixable []doctorFinding) historyRecord {
+	record := historyRecord{
+		Version:     historyVersion,
+		Operation:   "doctor-fix",
+		Host:        getLocalHostname(),
+		Source:      report.Pool,
+		Destination: report.scan.BackupPool,
+		StartTime:   time.Now(),
+		Outcome:     notifySuccess,
+	}
+	failed := 0
+	for _, f := range fixable {
+		entry := historyDataset{Name: f.Dataset, Status: "done"}
+		if entry.Name == "" {
+			entry.Name = f.ID
+		}
+		start := time.Now()
+		if err := f.Fix.Apply(ctx, r); err != nil {
+			entry.Status = "error"
+			entry.Error = err.Error()
+			failed++
+			fmt.Println(errorStyle.Render(fmt.Sprintf("  failed %s: %v", entry.Name, err)))
+		} else {
+			fmt.Printf("  fixed %s (%s)\n", entry.Name, f.ID)
+		}
+		entry.DurationSeconds = time.Since(start).Seconds()
+		record.Datasets = append(record.Datasets, entry)
+	}
+	record.EndTime = time.Now()
+	record.DurationSeconds = record.EndTime.Sub(record.StartTime).Seconds()
+	switch {
+	case failed == len(fixable):
+		record.Outcome = notifyFailure
+	case failed > 0:
+		record.Outcome = notifyPartial
+	}
+	return record
+}
+
+// runDoctorFix prints the plan for every fixable finding and, with --yes and
+// the typed confirmation, applies it. It returns the exit code for what is
+// left: the most serious finding without a fix, or whose fix failed.
+func runDoctorFix(ctx context.Context, r commandRunner, report *doctorReport, opts doctorOptions, confirmFn func(string) bool) int {
+	fixable := fixableFindings(report)
+	if len(fixable) == 0 {
+		fmt.Println(infoStyle.Render("None of these findings has an automatic fix."))
+		fmt.Println()
+		return report.Severity.exitCode()
+	}
+
+	fmt.Println(labelStyle.Render("Fixes:"))
+	printFixPlan(fixable)
+	if !opts.Confirm {
+		fmt.Println(infoStyle.Render(fmt.Sprintf(
+			"Dry run - nothing has changed. Re-run with --fix --yes to apply these %d fix(es).", len(fixable))))
+		fmt.Println()
+		return report.Severity.exitCode()
+	}
+	if !opts.Force && !confirmFn("Type FIX to continue: ") {
+		fmt.Println(statusStyle.Render("Aborted. Nothing was changed."))
+		fmt.Println()
+		return report.Severity.exitCode()
+	}
+
+	record := applyDoctorFixes(ctx, r, report, fixable)
+	if err := appendHistoryRecord(record); err != nil {
+		fmt.Println(warningStyle.Render("Warning: " + err.Error()))
+	}
+
+	fixed := map[*doctorFix]bool{}
+	for i, f := range fixable {
+		if record.Datasets[i].Status == "done" {
+			fixed[f.Fix] = true
+		}
+	}
+	remaining := severityOK
+	for _, f := range report.Findings {
+		if f.Fix == nil || !fixed[f.Fix] {
+			remaining = max(remaining, f.Severity)
+		}
+	}
+	fmt.Println()
+	fmt.Println(statusStyle.Render(fmt.Sprintf("Applied %d of %d fix(es).", len(fixed), len(fixable))))
+	fmt.Println()
+	return remaining.exitCode()
+}
+
+// =============================================================================
+// Checks with fixes
+// =============================================================================
+
+// snapshotHold is one user hold on a snapshot.
+type snapshotHold struct {
+	Snapshot string
+	Tag      string
+}
+
+// listHolds lists every user hold under a pool.
+func listHolds(ctx context.Context, r commandRunner, pool string) ([]snapshotHold, error) {
+	return listHoldsUnder(ctx, r, pool, 0)
+}
+
+// listHoldsUnder lists the user holds on snapshots at or below target, with
+// depth as for listSnapshotEntries. Snapshots are first narrowed to those
+// with userrefs, so `zfs holds` only runs where there is a hold.
+func listHoldsUnder(ctx context.Context, r commandRunner, target string, depth int) ([]snapshotHold, error) {
+	args := []string{"get", "-H", "-p", "-o", "name,value", "-t", "snapshot"}
+	if depth > 0 {
+		args = append(args, "-d", strconv.Itoa(depth))
+	} else {
+		args = append(args, "-r")
+	}
+	output, err := r.Output(ctx, "zfs", append(args, "userrefs", target)...)
+	if err != nil {
+		return nil, err
+	}
+	var holds []snapshotHold
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		name, value, ok := strings.Cut(strings.TrimSpace(line), "\t")
+		if refs, err := strconv.Atoi(value); !ok || err != nil || refs == 0 {
+			continue
+		}
+		held, err := r.Output(ctx, "zfs", "holds", "-H", name)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range strings.Split(strings.TrimSpace(held), "\n") {
+			fields := strings.Split(row, "\t")
+			if len(fields) >= 2 {
+				holds = append(holds, snapshotHold{Snapshot: fields[0], Tag: fields[1]})
+			}
+		}
+	}
+	return holds, nil
+}
+
+// isMovingHoldTag reports whether a hold tag belongs to a tool that moves it
+// forward on every replication: syncoid --use-hold, or zfs-backup's own base
+// hold.
+func isMovingHoldTag(tag string) bool {
+	return strings.HasPrefix(tag, "syncoid") || tag == baseHoldTag
+}
+
+// staleMovingHolds returns the moving holds a later replication should have
+// released: each is moved to the newest replicated snapshot, so the same tag
+// on an older snapshot of the dataset is stale.
+func staleMovingHolds(holds []snapshotHold, created map[string]time.Time) []snapshotHold {
+	newest := map[string]string{} // dataset and tag -> newest held snapshot
+	key := func(h snapshotHold) string {
+		dataset, _, _ := splitSnapshot(h.Snapshot)
+		return dataset + "\t" + h.Tag
+	}
+	for _, h := range holds {
+		if !isMovingHoldTag(h.Tag) {
+			continue
+		}
+		if current, ok := newest[key(h)]; !ok || created[h.Snapshot].After(created[current]) {
+			newest[key(h)] = h.Snapshot
+		}
+	}
+
+	var stale []snapshotHold
+	for _, h := range holds {
+		if isMovingHoldTag(h.Tag) && newest[key(h)] != h.Snapshot {
+			stale = append(stale, h)
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool { return stale[i].Snapshot < stale[j].Snapshot })
+	return stale
+}
+
+// checkStaleHolds flags syncoid and base holds left on snapshots a later
+// replication has moved past, which keep them from ever being pruned.
+func checkStaleHolds(ctx context.Context, r commandRunner, scan *orphanScan) []doctorFinding {
+	var findings []doctorFinding
+	for _, pool := range doctorPools(scan) {
+		holds, err := listHolds(ctx, r, pool)
+		if err != nil {
+			continue
+		}
+		created := map[string]time.Time{}
+		if pool == scan.Pool {
+			for _, e := range scan.Entries {
+				created[e.Name] = e.Creation
+			}
+		} else {
+			for _, snapshots := range scan.backupView(ctx, r).Snapshots {
+				for _, e := range snapshots {
+					created[e.Name] = e.Creation
+				}
+			}
+		}
+		for _, h := range staleMovingHolds(holds, created) {
+			summary := fmt.Sprintf("stale syncoid hold %q on a snapshot syncoid has moved past", h.Tag)
+			if h.Tag == baseHoldTag {
+				summary = "stale " + baseHoldTag + " hold on a snapshot that is no longer the incremental base"
+			}
+			findings = append(findings, doctorFinding{
+				Severity:    severityWarning,
+				Dataset:     h.Snapshot,
+				Summary:     summary,
+				Evidence:    []string{"a newer snapshot of the dataset carries the same hold"},
+				Remediation: fmt.Sprintf("sudo zfs release %s %s", h.Tag, h.Snapshot),
+				Fix:         zfsFix([]string{"release", h.Tag, h.Snapshot}),
+			})
+		}
+	}
+	return findings
+}
+
+// checkUnscopedBackups flags datasets outside a restricted backup scope that
+// still have a backup on the backup pool: they were backed up until they
+// dropped out of the scope, usually by accident.
+func checkUnscopedBackups(ctx context.Context, r commandRunner, scan *orphanScan) []doctorFinding {
+	view := scan.backupView(ctx, r)
+	if view.Err != nil {
+		return backupPoolSkipped(view.Err)
+	}
+	scoped := map[string]bool{}
+	for _, ds := range scan.InScope {
+		scoped[ds] = true
+	}
+
+	var findings []doctorFinding
+	for _, u := range scan.Usage {
+		ds, ok := strings.CutPrefix(u.Name, scan.Pool+"/")
+		if !ok || strings.Contains(ds, "/") || scoped[ds] {
+			continue
+		}
+		dest := view.destinationFor(scan.BackupPool, scan.Host, ds)
+		if len(view.Snapshots[dest]) == 0 {
+			continue
+		}
+		findings = append(findings, doctorFinding{
+			Severity: severityWarning,
+			Dataset:  u.Name,
+			Summary:  "has a backup on " + scan.BackupPool + " but is no longer in the backup scope",
+			Evidence: []string{fmt.Sprintf("last backup %s, never updated again", view.Snapshots[dest][0].Name)},
+			Remediation: fmt.Sprintf("add it back with sudo zfs-backup scope --pool %s --datasets %s",
+				scan.Pool, strings.Join(append(append([]string{}, scan.InScope...), ds), ",")),
+			Fix: scopeFix(scan.Pool, ds),
+		})
+	}
+	return findings
+}
+
+// confirmFix asks the operator to type FIX before doctor changes anything.
+func confirmFix(prompt string) bool {
+	return confirmTyped(prompt, "FIX")
+}
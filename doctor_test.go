@@ -5,7 +5,10 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -206,3 +209,463 @@ func TestGroupOrphansByDataset(t *testing.T) {
 		t.Errorf("expected 2 orphans on NIXROOT/root, got %d", len(grouped["NIXROOT/root"]))
 	}
 }
+
+func TestSelectDoctorChecks(t *testing.T) {
+	ids := func(checks []doctorCheck) []string {
+		var selected []string
+		for _, c := range checks {
+			selected = append(selected, c.ID)
+		}
+		return selected
+	}
+
+	checks, err := selectDoctorChecks(doctorChecks, []string{"orphans", "quota-pressure"}, []string{"quota-pressure"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(checks); !reflect.DeepEqual(got, []string{"orphans"}) {
+		t.Errorf("expected --only less --skip, got %v", got)
+	}
+	if checks, _ := selectDoctorChecks(doctorChecks, nil, nil); len(checks) != len(doctorChecks) {
+		t.Errorf("with no selection every check runs, got %v", ids(checks))
+	}
+	if _, err := selectDoctorChecks(doctorChecks, []string{"orphan"}, nil); err == nil {
+		t.Error("an unknown check should be an error, not an empty run")
+	}
+}
+
+func TestRunDoctorChecksRanksFindings(t *testing.T) {
+	now := time.Date(2026, 8, 14, 12, 0, 0, 0, time.UTC)
+	scan := &orphanScan{
+		Pool:    "NIXROOT",
+		InScope: []string{"home"},
+		Missing: []string{"srv"},
+		Orphans: scanOrphans(abyssFixture(now), "NIXROOT", []string{"home"}, now, minSyncoidOrphanAge),
+		Usage: []datasetUsage{
+			// 29G of a 30G quota, nearly all snapshots: writes are about to fail.
+			{Name: "NIXROOT/root", Used: 29 << 30, UsedBySnapshots: 28 << 30, Quota: 30 << 30},
+		},
+		ScanTime: now,
+	}
+
+	report := runDoctorChecks(context.Background(), &fakeRunner{}, scan, doctorChecks)
+	if report.Severity != severityCritical || report.Severity.exitCode() != 2 {
+		t.Errorf("a nearly full quota should be critical, got %s", report.Severity)
+	}
+	var orphans []string
+	for _, f := range report.Findings {
+		if f.ID == "orphans" {
+			orphans = append(orphans, f.Dataset)
+			if f.Severity != severityWarning || !strings.Contains(f.Remediation, "--dataset "+f.Dataset) {
+				t.Errorf("unexpected orphan finding %+v", f)
+			}
+		}
+	}
+	if len(orphans) != 4 {
+		t.Errorf("expected one finding per dataset with orphans, got %v", orphans)
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"severity":"critical"`) || !strings.Contains(string(data), `"id":"scope"`) {
+		t.Errorf("expected severities and check IDs by name in the JSON, got %s", data)
+	}
+
+	text := renderDoctorReport(runDoctorChecks(context.Background(), &fakeRunner{}, scan, doctorChecks[:1]))
+	if !strings.Contains(text, "NIXROOT/srv: configured for backup but no longer exists") || strings.Contains(text, "orphaned") {
+		t.Errorf("the report should show only the checks that ran, got:\n%s", text)
+	}
+}
+
+func TestDoctorSeverityExitCodes(t *testing.T) {
+	for severity, want := range map[doctorSeverity]int{
+		severityOK: 0, severityInfo: 0, severityWarning: 1, severityCritical: 2, severityUnknown: 3,
+	} {
+		if got := severity.exitCode(); got != want {
+			t.Errorf("%s should exit %d, got %d", severity, want, got)
+		}
+	}
+}
+
+// backupPoolFixture answers the backup pool reads for NIXROOT backed up to
+// NIXBACKUPS as host abyss: home is current, atuin is five days old and
+// nix, in the legacy flat layout, shares nothing with the source.
+func backupPoolFixture(now time.Time) *fakeRunner {
+	snap := func(name string, age time.Duration) string {
+		return fmt.Sprintf("%s\t%d\t1024", name, now.Add(-age).Unix())
+	}
+	return &fakeRunner{respond: func(name string, args []string) (string, error) {
+		joined := strings.Join(args, " ")
+		switch {
+		case strings.Contains(joined, "-t bookmark"):
+			return "NIXROOT/atuin#2026-10-13.02h-00-Backup\n", nil
+		case strings.Contains(joined, "-t snapshot"):
+			return strings.Join([]string{
+				snap("NIXBACKUPS/abyss/home@2026-10-18.02h-00-Backup", 10*time.Hour),
+				snap("NIXBACKUPS/abyss/atuin@2026-10-13.02h-00-Backup", 5*24*time.Hour),
+				snap("NIXBACKUPS/nix@2026-10-18.02h-00-Backup", 10*time.Hour),
+			}, "\n"), nil
+		case strings.HasPrefix(joined, "list -H -o name -r NIXBACKUPS"):
+			return "NIXBACKUPS\nNIXBACKUPS/abyss\nNIXBACKUPS/abyss/home\nNIXBACKUPS/abyss/atuin\nNIXBACKUPS/nix\n", nil
+		}
+		return "", fmt.Errorf("unexpected %s %s", name, joined)
+	}}
+}
+
+func TestBackupPoolChecks(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	scan := &orphanScan{
+		Pool:       "NIXROOT",
+		InScope:    []string{"home", "atuin", "nix", "srv"},
+		Entries:    []snapshotEntry{{Dataset: "NIXROOT/home", Tag: "2026-10-18.02h-00-Backup"}},
+		ScanTime:   now,
+		BackupPool: "NIXBACKUPS",
+		Host:       "abyss",
+	}
+	r := backupPoolFixture(now)
+
+	stale := map[string]doctorSeverity{}
+	for _, f := range checkStaleBackups(context.Background(), r, scan) {
+		stale[f.Dataset] = f.Severity
+	}
+	// atuin is over twice the 36h default RPO; srv was never backed up.
+	want := map[string]doctorSeverity{"NIXROOT/atuin": severityCritical, "NIXROOT/srv": severityCritical}
+	if !reflect.DeepEqual(stale, want) {
+		t.Errorf("expected atuin stale and srv never backed up, got %v", stale)
+	}
+
+	var broken []string
+	for _, f := range checkBrokenChains(context.Background(), r, scan) {
+		broken = append(broken, f.Dataset)
+	}
+	// home shares a snapshot and atuin a bookmark; nix shares nothing.
+	if !reflect.DeepEqual(broken, []string{"NIXROOT/nix"}) {
+		t.Errorf("expected only nix's chain to be broken, got %v", broken)
+	}
+
+	calls := len(r.calls)
+	checkStaleBackups(context.Background(), r, scan)
+	if len(r.calls) != calls {
+		t.Error("the backup pool should be read once per doctor run")
+	}
+
+	unplugged := &orphanScan{Pool: "NIXROOT", InScope: []string{"home"}, ScanTime: now}
+	findings := checkStaleBackups(context.Background(), &fakeRunner{}, unplugged)
+	if len(findings) != 1 || findings[0].Severity != severityInfo {
+		t.Errorf("an unplugged backup drive should only be noted, got %+v", findings)
+	}
+}
+
+func TestPoolChecks(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	scan := &orphanScan{Pool: "NIXROOT", BackupPool: "NIXBACKUPS", ScanTime: now}
+	r := &fakeRunner{respond: func(name string, args []string) (string, error) {
+		pool := args[len(args)-1]
+		joined := strings.Join(args, " ")
+		switch {
+		case strings.Contains(joined, "-o health"):
+			if pool == "NIXBACKUPS" {
+				return "DEGRADED\n", nil
+			}
+			return "ONLINE\n", nil
+		case args[0] == "status" && pool == "NIXROOT":
+			return "  scan: scrub repaired 0B in 00:10:00 with 0 errors on Sun Aug 30 03:00:00 2026\n", nil
+		case args[0] == "status":
+			return "  scan: scrub repaired 0B in 01:00:00 with 3 errors on Sun Oct 11 03:00:00 2026\n", nil
+		case strings.Contains(joined, "receive_resume_token") && pool == "NIXBACKUPS":
+			return "NIXBACKUPS\t-\nNIXBACKUPS/abyss/home\t1-e604ea4bf-e0-789c63a2\n", nil
+		case strings.Contains(joined, "receive_resume_token"):
+			return "NIXROOT\t-\n", nil
+		case strings.Contains(joined, "name,size,allocated,free"):
+			return "NIXBACKUPS\t1000\t850\t150\n", nil
+		}
+		return "", fmt.Errorf("unexpected %s %s", name, joined)
+	}}
+
+	summaries := func(check func(context.Context, commandRunner, *orphanScan) []doctorFinding) []string {
+		var got []string
+		for _, f := range check(context.Background(), r, scan) {
+			got = append(got, fmt.Sprintf("%s %s: %s", f.Severity, f.Dataset, f.Summary))
+		}
+		return got
+	}
+
+	if got := summaries(checkPoolHealth); !reflect.DeepEqual(got, []string{"warning NIXBACKUPS: pool health is DEGRADED - a device has failed"}) {
+		t.Errorf("unexpected pool health findings %v", got)
+	}
+	if got := summaries(checkScrubs); !reflect.DeepEqual(got, []string{
+		"warning NIXROOT: last scrubbed 49 days ago",
+		"critical NIXBACKUPS: last scrub found 3 error(s)",
+	}) {
+		t.Errorf("unexpected scrub findings %v", got)
+	}
+	if got := summaries(checkResumeTokens); !reflect.DeepEqual(got, []string{"warning NIXBACKUPS/abyss/home: an interrupted receive left a resume token"}) {
+		t.Errorf("unexpected resume token findings %v", got)
+	}
+	if got := summaries(checkBackupCapacity); !reflect.DeepEqual(got, []string{"warning NIXBACKUPS: backup pool is 85% full"}) {
+		t.Errorf("unexpected capacity findings %v", got)
+	}
+}
+
+func TestLoadDoctorConfigFillsDefaults(t *testing.T) {
+	useTempHome(t)
+	path, err := getDoctorFilePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`{"rpo_hours": 12}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadDoctorConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.RPOHours != 12 || config.ScrubMaxAgeDays != 35 || config.CapacityCriticalPercent != 90 {
+		t.Errorf("expected the RPO set and the rest defaulted, got %+v", config)
+	}
+}
+
+// destinationFixture answers the reads of a backup pool holding host abyss,
+// with home current and atuin dropped two months ago; host oldbox, retired;
+// and two legacy flat copies: home, superseded by abyss/home, and srv, which
+// a host not yet moved to a namespace still writes.
+func destinationFixture(now time.Time) *fakeRunner {
+	snap := func(name string, age time.Duration) string {
+		return fmt.Sprintf("%s\t%d\t1024", name, now.Add(-age).Unix())
+	}
+	day := 24 * time.Hour
+	return &fakeRunner{respond: func(name string, args []string) (string, error) {
+		joined := strings.Join(args, " ")
+		switch {
+		case strings.Contains(joined, "-t snapshot -d 1"):
+			return "", nil
+		case strings.Contains(joined, "-t snapshot"):
+			return strings.Join([]string{
+				snap("NIXBACKUPS/abyss/home@2026-10-18.02h-00-Backup", 10*time.Hour),
+				snap("NIXBACKUPS/abyss/home@syncoid_abyss_2026-10-15:02:00:00-GMT00:00", 3*day),
+				snap("NIXBACKUPS/abyss/atuin@2026-08-18.02h-00-Backup", 60*day),
+				snap("NIXBACKUPS/oldbox/home@2026-07-10.02h-00-Backup", 100*day),
+				snap("NIXBACKUPS/oldbox/home/nested@2026-07-10.02h-00-Backup", 100*day),
+				snap("NIXBACKUPS/home@2026-04-01.02h-00-Backup", 200*day),
+				snap("NIXBACKUPS/srv@2026-10-18.02h-00-Backup", 10*time.Hour),
+			}, "\n"), nil
+		case strings.Contains(joined, "name,used,usedbysnapshots"):
+			return strings.Join([]string{
+				"NIXBACKUPS\t900\t0\t-\t-",
+				"NIXBACKUPS/abyss\t400\t0\t-\t-",
+				"NIXBACKUPS/abyss/home\t300\t50\t-\t-",
+				"NIXBACKUPS/abyss/atuin\t100\t10\t-\t-",
+				"NIXBACKUPS/oldbox\t200\t0\t-\t-",
+				"NIXBACKUPS/oldbox/home\t200\t20\t-\t-",
+				"NIXBACKUPS/oldbox/home/nested\t50\t5\t-\t-",
+				"NIXBACKUPS/home\t250\t0\t-\t-",
+				"NIXBACKUPS/srv\t50\t0\t-\t-",
+			}, "\n"), nil
+		case args[0] == "holds":
+			return "", nil
+		case strings.Contains(joined, "clones"):
+			return "-\n", nil
+		case args[0] == "destroy":
+			return "", nil
+		}
+		return "", fmt.Errorf("unexpected %s %s", name, joined)
+	}}
+}
+
+func TestDestinationChecks(t *testing.T) {
+	useTempHome(t)
+	scan, err := prepareDestinationScan(context.Background(), destinationFixture(time.Now()), "NIXBACKUPS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scan.Host, scan.LocalScope = "abyss", map[string]bool{"home": true}
+
+	if got := describeDestination(scan.destination()); got != "Backup pool NIXBACKUPS: 2 host namespace(s) (abyss, oldbox), 2 legacy flat-layout dataset(s)." {
+		t.Errorf("unexpected layout %q", got)
+	}
+	report := runDoctorChecks(context.Background(), &fakeRunner{}, scan, destinationDoctorChecks[:4])
+	var got []string
+	for _, f := range report.Findings {
+		got = append(got, f.ID+" "+f.Dataset)
+	}
+	want := []string{
+		"retired-hosts NIXBACKUPS/oldbox",
+		"abandoned-datasets NIXBACKUPS/abyss/atuin",
+		"legacy-layout NIXBACKUPS/home",
+		"destination-orphans NIXBACKUPS/abyss/home",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if !report.Destination || !strings.Contains(renderDoctorReport(report), "--retire NIXBACKUPS/oldbox") {
+		t.Errorf("expected a destination report suggesting oldbox's removal, got\n%s", renderDoctorReport(report))
+	}
+}
+
+func TestDestinationChecksNeverRetireThisMachine(t *testing.T) {
+	useTempHome(t)
+	scan, err := prepareDestinationScan(context.Background(), destinationFixture(time.Now()), "NIXBACKUPS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The disk spent three months offsite: every backup on it is stale.
+	scan.ScanTime = time.Now().AddDate(0, 3, 0)
+	scan.Host, scan.LocalScope = "abyss", map[string]bool{"home": true}
+
+	removable := scan.destination().removable()
+	for _, path := range []string{"NIXBACKUPS/abyss", "NIXBACKUPS/abyss/home"} {
+		if removable[path] {
+			t.Errorf("this machine's in-scope backup %s must never be retirable, got %v", path, removable)
+		}
+	}
+	if !removable["NIXBACKUPS/abyss/atuin"] || !removable["NIXBACKUPS/oldbox"] {
+		t.Errorf("expected the dropped dataset and the other host still flagged, got %v", removable)
+	}
+
+	scan.layout, scan.LocalScope = nil, nil // source pool unreadable: keep all of ours
+	if removable := scan.destination().removable(); removable["NIXBACKUPS/abyss/atuin"] || removable["NIXBACKUPS/srv"] {
+		t.Errorf("with the scope unknown none of this machine's backups may go, got %v", removable)
+	}
+}
+
+func TestCleanupDestinationRetiresOnlyFlaggedPaths(t *testing.T) {
+	useTempHome(t)
+	r := destinationFixture(time.Now())
+	opts := cleanupOptions{Pool: "NIXBACKUPS", Destination: true, Retire: "NIXBACKUPS/srv", Confirm: true, Force: true}
+	if code := runCleanupOrphans(context.Background(), r, opts, nil); code != 1 || r.ran("destroy") {
+		t.Errorf("a flat copy still being written must be refused, got exit %d and %v", code, r.commandLines())
+	}
+
+	r = destinationFixture(time.Now())
+	opts.Retire = "NIXBACKUPS/oldbox"
+	if code := runCleanupOrphans(context.Background(), r, opts, nil); code != 0 {
+		t.Fatalf("expected the retired host removed, got exit %d", code)
+	}
+	var destroyed []string
+	for _, line := range r.commandLines() {
+		if strings.HasPrefix(line, "zfs destroy") {
+			destroyed = append(destroyed, strings.TrimPrefix(line, "zfs destroy "))
+		}
+	}
+	want := []string{
+		"NIXBACKUPS/oldbox/home@2026-07-10.02h-00-Backup",
+		"NIXBACKUPS/oldbox/home/nested@2026-07-10.02h-00-Backup",
+		"NIXBACKUPS/oldbox/home/nested",
+		"NIXBACKUPS/oldbox/home",
+		"NIXBACKUPS/oldbox",
+	}
+	if !reflect.DeepEqual(destroyed, want) {
+		t.Errorf("expected each snapshot, then the datasets deepest first, got %v", destroyed)
+	}
+}
+
+func TestStaleMovingHolds(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	created := map[string]time.Time{
+		"NIXBACKUPS/abyss/home@syncoid_a": now.Add(-48 * time.Hour),
+		"NIXBACKUPS/abyss/home@syncoid_b": now.Add(-24 * time.Hour),
+		"NIXBACKUPS/abyss/home@syncoid_c": now,
+	}
+	holds := []snapshotHold{
+		{Snapshot: "NIXBACKUPS/abyss/home@syncoid_c", Tag: "syncoid_abyss"},
+		{Snapshot: "NIXBACKUPS/abyss/home@syncoid_a", Tag: "syncoid_abyss"},
+		{Snapshot: "NIXBACKUPS/abyss/home@syncoid_b", Tag: "keep"},
+		{Snapshot: "NIXBACKUPS/abyss/home@syncoid_b", Tag: "syncoid_server"},
+	}
+
+	stale := staleMovingHolds(holds, created)
+	if !reflect.DeepEqual(stale, []snapshotHold{holds[1]}) {
+		t.Errorf("expected only the hold syncoid moved past, got %+v", stale)
+	}
+}
+
+func TestUnscopedBackupsFixPutsDatasetBackInScope(t *testing.T) {
+	useTempHome(t)
+	if err := SetPoolScope("NIXROOT", []string{"home"}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	scan := &orphanScan{
+		Pool:       "NIXROOT",
+		InScope:    []string{"home"},
+		Usage:      []datasetUsage{{Name: "NIXROOT"}, {Name: "NIXROOT/home"}, {Name: "NIXROOT/atuin"}, {Name: "NIXROOT/srv"}},
+		ScanTime:   now,
+		BackupPool: "NIXBACKUPS",
+		Host:       "abyss",
+	}
+
+	findings := checkUnscopedBackups(context.Background(), backupPoolFixture(now), scan)
+	if len(findings) != 1 || findings[0].Dataset != "NIXROOT/atuin" || findings[0].Fix == nil {
+		t.Fatalf("expected atuin, backed up but out of scope, with a fix, got %+v", findings)
+	}
+	report := &doctorReport{Pool: "NIXROOT", Findings: findings, scan: scan}
+	failing := doctorFinding{ID: "resume-tokens", Dataset: "NIXBACKUPS/abyss/home", Fix: zfsFix([]string{"receive", "-A", "NIXBACKUPS/abyss/home"})}
+	r := &fakeRunner{respond: func(string, []string) (string, error) { return "", fmt.Errorf("permission denied") }}
+
+	record := applyDoctorFixes(context.Background(), r, report, append(findings, failing))
+	if record.Operation != "doctor-fix" || record.Outcome != notifyPartial || record.Datasets[1].Status != "error" {
+		t.Errorf("expected a partial doctor-fix run with the receive abort failed, got %+v", record)
+	}
+	scope, err := LoadBackupScope()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := scope.Pools["NIXROOT"].Datasets; !reflect.DeepEqual(got, []string{"atuin", "home"}) {
+		t.Errorf("expected atuin back in scope, got %v", got)
+	}
+}
+
+func TestRefquotaFixKeepsTheLimit(t *testing.T) {
+	fix := refquotaFix(datasetUsage{Name: "NIXROOT/root", Quota: 30 << 30})
+	want := []string{"zfs set refquota=32212254720 NIXROOT/root", "zfs set quota=none NIXROOT/root"}
+	if !reflect.DeepEqual(fix.Plan, want) {
+		t.Errorf("expected refquota set before quota is cleared, got %v", fix.Plan)
+	}
+}
+
+func TestResumeTokenFixOnlyWhenNothingWillResumeIt(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	state := NewBackupState("backup", "NIXROOT", "NIXBACKUPS")
+	state.Datasets = []string{"home"}
+	scan := &orphanScan{Pool: "NIXBACKUPS", Host: "abyss", ScanTime: now, States: []*BackupState{state}}
+	started := map[string]time.Time{
+		"NIXBACKUPS/abyss/home/%recv": now.Add(-30 * 24 * time.Hour), // a saved run resumes it
+		"NIXBACKUPS/abyss/nix/%recv":  now.Add(-10 * 24 * time.Hour), // nothing resumes it
+		"NIXBACKUPS/abyss/var":        now.Add(-24 * time.Hour),      // too recent to give up on
+	}
+	r := &fakeRunner{respond: func(_ string, args []string) (string, error) {
+		target := args[len(args)-1]
+		if strings.Contains(strings.Join(args, " "), "receive_resume_token") {
+			return "NIXBACKUPS/abyss/home\t1-aaa\nNIXBACKUPS/abyss/nix\t1-bbb\nNIXBACKUPS/abyss/var\t1-ccc\n", nil
+		}
+		if at, ok := started[target]; ok {
+			return fmt.Sprintf("%d\n", at.Unix()), nil
+		}
+		return "", fmt.Errorf("dataset %s does not exist", target)
+	}}
+
+	fixed := map[string]bool{}
+	for _, f := range checkResumeTokens(context.Background(), r, scan) {
+		fixed[f.Dataset] = f.Fix != nil
+	}
+	if !reflect.DeepEqual(fixed, map[string]bool{
+		"NIXBACKUPS/abyss/home": false,
+		"NIXBACKUPS/abyss/nix":  true,
+		"NIXBACKUPS/abyss/var":  false,
+	}) {
+		t.Errorf("expected only the old token no saved run covers to get the fix, got %v", fixed)
+	}
+
+	scan.States = nil
+	for _, f := range checkResumeTokens(context.Background(), r, scan) {
+		if f.Fix != nil {
+			t.Errorf("with the saved states unreadable nothing may be abandoned, got a fix for %s", f.Dataset)
+		}
+	}
+}
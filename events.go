@@ -0,0 +1,325 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// JSON Event Stream
+// =============================================================================
+//
+// With --json, every run emits one JSON object per line describing what it is
+// doing, so orchestration tooling can follow a backup without scraping the
+// human log. The schema is documented in docs/admin-guide/json-events.md.
+// Adding a field or an event type is backwards compatible; renaming or
+// removing one, or changing a field's meaning, bumps eventSchemaVersion.
+
+// eventSchemaVersion is carried on every event as "schema".
+const eventSchemaVersion = 1
+
+// Event types.
+const (
+	eventRunStart        = "run_start"
+	eventStageStart      = "stage_start"
+	eventStageEnd        = "stage_end"
+	eventDatasetStatus   = "dataset_status"
+	eventSnapshotCreated = "snapshot_created"
+	eventSnapshotPruned  = "snapshot_pruned"
+	eventWarning         = "warning"
+	eventResult          = "result"
+)
+
+// runEvent is one line of the event stream. Fields not relevant to an event
+// type are omitted.
+type runEvent struct {
+	Schema    int       `json:"schema"`
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation,omitempty"`
+
+	// run_start
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination,omitempty"`
+
+	// stage_start, stage_end, warning
+	Stage       string `json:"stage,omitempty"`
+	StageNum    int    `json:"stage_num,omitempty"`
+	TotalStages int    `json:"total_stages,omitempty"`
+
+	// dataset_status
+	Dataset string `json:"dataset,omitempty"`
+
+	// snapshot_created, snapshot_pruned
+	Snapshot string `json:"snapshot,omitempty"`
+
+	// stage_end ("ok", "failed", "skipped") and dataset_status
+	// ("pending", "syncing", "done", "error", "skipped")
+	Status string `json:"status,omitempty"`
+
+	// stage_end, result
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+
+	// result
+	Success        *bool    `json:"success,omitempty"`
+	FailedDatasets []string `json:"failed_datasets,omitempty"`
+
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// eventStream writes runEvents as JSON lines. The zero value, and a nil
+// stream, discard everything, so call sites never check whether --json is on.
+type eventStream struct {
+	mu        sync.Mutex
+	enc       *json.Encoder
+	operation string
+	// lastStatus suppresses repeated dataset_status events: progress is
+	// re-sent many times per dataset while its snapshots transfer.
+	lastStatus map[string]string
+}
+
+// runEvents is the stream the perform* functions emit to. It discards events
+// unless the CLI was started with --json.
+var runEvents = &eventStream{}
+
+// cliOut is where CLI runs print their human-readable output. When the event
+// stream goes to stdout it moves to stderr, so stdout stays pure JSON lines.
+var cliOut io.Writer = os.Stdout
+
+// jsonStreamCommands are the commands whose --json streams the run's events.
+// Every other subcommand keeps its --json for its own output format.
+var jsonStreamCommands = map[string]bool{
+	"--backup": true, "-b": true,
+	"--force-backup": true, "-f": true,
+	"--unmount": true, "-u": true,
+	"resume": true,
+}
+
+// isJSONFlag reports whether an argument is --json or --json=PATH.
+func isJSONFlag(arg string) bool {
+	return arg == "--json" || strings.HasPrefix(arg, "--json=")
+}
+
+// extractJSONFlag returns the arguments with the command first, and the
+// requested event stream target ("" when absent). For the commands in
+// jsonStreamCommands, --json / --json=PATH is removed and becomes the target;
+// any other command gets its --json passed through untouched.
+func extractJSONFlag(args []string) ([]string, string) {
+	command := -1
+	for i, arg := range args {
+		if !isJSONFlag(arg) {
+			command = i
+			break
+		}
+	}
+	if command >= 0 && !jsonStreamCommands[args[command]] {
+		rest := append([]string{args[command]}, args[:command]...)
+		return append(rest, args[command+1:]...), ""
+	}
+
+	var rest []string
+	target := ""
+	for _, arg := range args {
+		switch {
+		case arg == "--json":
+			target = "true"
+		case strings.HasPrefix(arg, "--json="):
+			target = strings.TrimPrefix(arg, "--json=")
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, target
+}
+
+// newEventStream writes events to w.
+func newEventStream(w io.Writer) *eventStream {
+	return &eventStream{enc: json.NewEncoder(w), lastStatus: map[string]string{}}
+}
+
+// openEventStream resolves the --json target: "true" (a bare --json) means
+// stdout, anything else is a file path, appended to so one file can collect
+// many runs.
+func openEventStream(target string) (*eventStream, error) {
+	if target == "" || target == "true" || target == "-" {
+		return newEventStream(os.Stdout), nil
+	}
+	// Each event is a single unbuffered write, so the file needs no
+	// explicit close before the CLI exits.
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	chownToRealUser(target)
+	return newEventStream(f), nil
+}
+
+func (s *eventStream) emit(ev runEvent) {
+	if s == nil || s.enc == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ev.Schema = eventSchemaVersion
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	if ev.Operation == "" {
+		ev.Operation = s.operation
+	}
+	_ = s.enc.Encode(ev)
+}
+
+// runStart opens a run. Later events carry its operation.
+func (s *eventStream) runStart(operation, source, destination string) {
+	if s == nil || s.enc == nil {
+		return
+	}
+	s.mu.Lock()
+	s.operation = operation
+	s.lastStatus = map[string]string{}
+	s.mu.Unlock()
+	s.emit(runEvent{Type: eventRunStart, Source: source, Destination: destination})
+}
+
+func (s *eventStream) stageStart(stage BackupStage, name string, num, total int) {
+	s.emit(runEvent{Type: eventStageStart, Stage: string(stage), StageNum: num, TotalStages: total, Message: stageLabel(name)})
+}
+
+func (s *eventStream) stageSkipped(stage BackupStage, name string) {
+	s.emit(runEvent{Type: eventStageEnd, Stage: string(stage), Status: "skipped", Message: stageLabel(name)})
+}
+
+// stageEnd closes a stage. log is the part of the run log the stage wrote;
+// each warning in it becomes its own event ahead of the stage_end.
+func (s *eventStream) stageEnd(stage BackupStage, name string, duration time.Duration, log string, err error) {
+	s.warnings(stage, log)
+	ev := runEvent{
+		Type:            eventStageEnd,
+		Stage:           string(stage),
+		Status:          "ok",
+		DurationSeconds: duration.Seconds(),
+		Message:         stageLabel(name),
+	}
+	if err != nil {
+		ev.Status = "failed"
+		ev.Error = err.Error()
+	}
+	s.emit(ev)
+}
+
+// warnings emits a warning event for every "Warning" line of a log excerpt.
+func (s *eventStream) warnings(stage BackupStage, log string) {
+	for _, msg := range logWarnings(log) {
+		s.emit(runEvent{Type: eventWarning, Stage: string(stage), Message: msg})
+	}
+}
+
+func (s *eventStream) datasetStatus(dataset string, status DatasetSyncStatus, errMsg string) {
+	if s == nil || s.enc == nil {
+		return
+	}
+	label := datasetStatusName(status)
+	s.mu.Lock()
+	if s.lastStatus == nil {
+		s.lastStatus = map[string]string{}
+	}
+	unchanged := s.lastStatus[dataset] == label
+	s.lastStatus[dataset] = label
+	s.mu.Unlock()
+	if unchanged {
+		return
+	}
+	s.emit(runEvent{Type: eventDatasetStatus, Dataset: dataset, Status: label, Error: errMsg})
+}
+
+func (s *eventStream) snapshotCreated(name string) {
+	s.emit(runEvent{Type: eventSnapshotCreated, Snapshot: name})
+}
+
+func (s *eventStream) snapshotPruned(name string) {
+	s.emit(runEvent{Type: eventSnapshotPruned, Snapshot: name})
+}
+
+// result closes the run with its outcome. Failed datasets are those whose
+// last reported status was error or skipped.
+func (s *eventStream) result(started time.Time, err error) {
+	if s == nil || s.enc == nil {
+		return
+	}
+	var failed []string
+	s.mu.Lock()
+	for dataset, status := range s.lastStatus {
+		if status == "error" || status == "skipped" {
+			failed = append(failed, dataset)
+		}
+	}
+	s.mu.Unlock()
+	sort.Strings(failed)
+
+	success := err == nil
+	ev := runEvent{
+		Type:            eventResult,
+		Success:         &success,
+		DurationSeconds: time.Since(started).Seconds(),
+		FailedDatasets:  failed,
+	}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	s.emit(ev)
+}
+
+// datasetStatusName is the stable, machine-readable name of a dataset status.
+func datasetStatusName(status DatasetSyncStatus) string {
+	switch status {
+	case DatasetSyncing:
+		return "syncing"
+	case DatasetDone:
+		return "done"
+	case DatasetError:
+		return "error"
+	case DatasetSkipped:
+		return "skipped"
+	default:
+		return "pending"
+	}
+}
+
+// stageMarker matches the [POOL]-style markers the run log uses for icons.
+var stageMarker = regexp.MustCompile(`^\[[A-Z]+\]\s*`)
+
+// stageLabel strips log markers from a stage name.
+func stageLabel(name string) string {
+	return strings.TrimSpace(stageMarker.ReplaceAllString(name, ""))
+}
+
+// logWarnings pulls the warning lines out of a run log excerpt. The log marks
+// them with a "Warning:" prefix, sometimes doubled and sometimes indented.
+func logWarnings(log string) []string {
+	var warnings []string
+	for _, line := range strings.Split(log, "\n") {
+		msg := strings.TrimSpace(line)
+		if !strings.HasPrefix(msg, "Warning") {
+			continue
+		}
+		for strings.HasPrefix(msg, "Warning") {
+			msg = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(msg, "Warning"), ":"))
+		}
+		if msg != "" {
+			warnings = append(warnings, msg)
+		}
+	}
+	return warnings
+}
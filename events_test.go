@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeEvents parses a captured event stream back into events.
+func decodeEvents(t *testing.T, buf *bytes.Buffer) []runEvent {
+	t.Helper()
+	var events []runEvent
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var ev runEvent
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("every line must be a JSON object, got %q: %v", line, err)
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+func eventTypes(events []runEvent) []string {
+	types := make([]string, 0, len(events))
+	for _, ev := range events {
+		types = append(types, ev.Type)
+	}
+	return types
+}
+
+func TestEventStreamCarriesSchemaAndOperation(t *testing.T) {
+	var buf bytes.Buffer
+	s := newEventStream(&buf)
+
+	s.runStart("backup", "NIXROOT", "NIXBACKUPS")
+	s.stageStart(StageImportPool, "[POOL]Importing NIXBACKUPS pool", 1, 7)
+	s.stageEnd(StageImportPool, "[POOL]Importing NIXBACKUPS pool", time.Second, "", nil)
+
+	events := decodeEvents(t, &buf)
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+	for _, ev := range events {
+		if ev.Schema != eventSchemaVersion {
+			t.Errorf("every event must carry the schema version, got %d", ev.Schema)
+		}
+		if ev.Operation != "backup" {
+			t.Errorf("every event must carry the run's operation, got %q", ev.Operation)
+		}
+	}
+	if events[1].Message != "Importing NIXBACKUPS pool" {
+		t.Errorf("log markers should be stripped from stage names, got %q", events[1].Message)
+	}
+}
+
+func TestEventStreamTurnsLogWarningsIntoEvents(t *testing.T) {
+	var buf bytes.Buffer
+	s := newEventStream(&buf)
+
+	log := "Exporting the backup zpool\n" +
+		"Warning:Warning: failed to power off device: exit status 1\n" +
+		"   Warning:Using --force-delete to remove old snapshots on backup.\n"
+	s.stageEnd(StageExportPool, "Exporting", time.Second, log, errors.New("export failed"))
+
+	events := decodeEvents(t, &buf)
+	if want := []string{eventWarning, eventWarning, eventStageEnd}; !reflect.DeepEqual(eventTypes(events), want) {
+		t.Fatalf("expected %v, got %v", want, eventTypes(events))
+	}
+	if events[0].Message != "failed to power off device: exit status 1" {
+		t.Errorf("the doubled Warning: prefix should be stripped, got %q", events[0].Message)
+	}
+	if events[2].Status != "failed" || events[2].Error != "export failed" {
+		t.Errorf("a failed stage should say so, got %+v", events[2])
+	}
+}
+
+func TestEventStreamReportsEachDatasetStatusChangeOnce(t *testing.T) {
+	var buf bytes.Buffer
+	s := newEventStream(&buf)
+
+	s.datasetStatus("home", DatasetPending, "")
+	s.datasetStatus("home", DatasetSyncing, "")
+	s.datasetStatus("home", DatasetSyncing, "")
+	s.datasetStatus("home", DatasetSyncing, "")
+	s.datasetStatus("home", DatasetDone, "")
+
+	var statuses []string
+	for _, ev := range decodeEvents(t, &buf) {
+		statuses = append(statuses, ev.Status)
+	}
+	if want := []string{"pending", "syncing", "done"}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("repeated progress for the same status must not repeat the event, got %v", statuses)
+	}
+}
+
+func TestEventStreamResultNamesFailedDatasets(t *testing.T) {
+	var buf bytes.Buffer
+	s := newEventStream(&buf)
+
+	s.runStart("backup", "NIXROOT", "NIXBACKUPS")
+	s.datasetStatus("root", DatasetError, "syncoid failed")
+	s.datasetStatus("home", DatasetDone, "")
+	s.datasetStatus("atuin", DatasetSkipped, "create failed")
+	s.result(time.Now(), errors.New("backup incomplete"))
+
+	events := decodeEvents(t, &buf)
+	result := events[len(events)-1]
+	if result.Type != eventResult || result.Success == nil || *result.Success {
+		t.Fatalf("expected a failed result event, got %+v", result)
+	}
+	if want := []string{"atuin", "root"}; !reflect.DeepEqual(result.FailedDatasets, want) {
+		t.Errorf("expected failed datasets %v, got %v", want, result.FailedDatasets)
+	}
+}
+
+func TestDisabledEventStreamIsSilent(t *testing.T) {
+	s := &eventStream{}
+	// None of these may panic or write anywhere.
+	s.runStart("backup", "NIXROOT", "NIXBACKUPS")
+	s.datasetStatus("home", DatasetDone, "")
+	s.result(time.Now(), nil)
+}
+
+func TestExtractJSONFlag(t *testing.T) {
+	rest, target := extractJSONFlag([]string{"--backup", "--json"})
+	if !reflect.DeepEqual(rest, []string{"--backup"}) || target != "true" {
+		t.Errorf("bare --json should select stdout, got %v %q", rest, target)
+	}
+
+	rest, target = extractJSONFlag([]string{"--json=/var/log/zfs-backup.jsonl", "resume", "backup_NIXROOT_NIXBACKUPS"})
+	if !reflect.DeepEqual(rest, []string{"resume", "backup_NIXROOT_NIXBACKUPS"}) || target != "/var/log/zfs-backup.jsonl" {
+		t.Errorf("--json=PATH should select a file, got %v %q", rest, target)
+	}
+
+	for _, args := range [][]string{{"--json", "doctor"}, {"doctor", "--json"}} {
+		rest, target = extractJSONFlag(args)
+		if !reflect.DeepEqual(rest, []string{"doctor", "--json"}) || target != "" {
+			t.Errorf("doctor keeps its own --json, got %v %q from %v", rest, target, args)
+		}
+	}
+	rest, _ = extractJSONFlag([]string{"--json", "history", "--since", "7d"})
+	if !reflect.DeepEqual(rest, []string{"history", "--json", "--since", "7d"}) {
+		t.Errorf("history keeps its own --json, got %v", rest)
+	}
+}
@@ -0,0 +1,327 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// Run history - one structured record per finished run
+// =============================================================================
+//
+// Reports are prose for people to read. The history is the same runs as data:
+// every run's ReportInfo is appended as one JSON line to
+// ~/.local/share/zfs-backup/history.jsonl, so questions like "when did home
+// last replicate?" can be answered without parsing markdown.
+
+// historyVersion is bumped when a record field changes meaning. Fields are
+// only ever added, so readers can ignore the version for now.
+const historyVersion = 1
+
+// historyRecord is one run in the history.
+type historyRecord struct {
+	Version            int              `json:"version"`
+	Operation          string           `json:"operation"`
+	Host               string           `json:"host"` // machine whose data was backed up
+	Source             string           `json:"source"`
+	Destination        string           `json:"destination"`
+	RemoteHost         string           `json:"remote_host,omitempty"`
+	StartTime          time.Time        `json:"start_time"`
+	EndTime            time.Time        `json:"end_time"`
+	DurationSeconds    float64          `json:"duration_seconds"`
+	Outcome            string           `json:"outcome"` // success, failure or partial
+	Error              string           `json:"error,omitempty"`
+	Datasets           []historyDataset `json:"datasets,omitempty"`
+	SnapshotsPruned    int              `json:"snapshots_pruned,omitempty"`
+	PoolSizeBytes      int64            `json:"pool_size_bytes,omitempty"` // backup pool when the run ended
+	PoolAllocatedBytes int64            `json:"pool_allocated_bytes,omitempty"`
+	ReportPath         string           `json:"report_path,omitempty"`
+}
+
+// historyDataset is one dataset's part of a recorded run.
+type historyDataset struct {
+	Name            string  `json:"name"`
+	Status          string  `json:"status"`
+	Error           string  `json:"error,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+	Size            string  `json:"size,omitempty"`
+	BytesSent       int64   `json:"bytes_sent,omitempty"`      // sizes of the snapshots synced
+	WrittenBytes    int64   `json:"written_bytes,omitempty"`   // written since the previous backup snapshot
+	WrittenSeconds  float64 `json:"written_seconds,omitempty"` // time between the two snapshots
+}
+
+// failedDatasets names the datasets that did not replicate.
+func (r historyRecord) failedDatasets() []string {
+	var failed []string
+	for _, ds := range r.Datasets {
+		if ds.Status == "error" || ds.Status == "skipped" {
+			failed = append(failed, ds.Name)
+		}
+	}
+	return failed
+}
+
+// getHistoryFilePath returns ~/.local/share/zfs-backup/history.jsonl.
+// Uses the real user's home directory even when running under sudo.
+func getHistoryFilePath() (string, error) {
+	home, err := getRealUserHome()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "zfs-backup", "history.jsonl"), nil
+}
+
+// newHistoryRecord turns a finished run's report info into a history record.
+func newHistoryRecord(info ReportInfo, reportPath string) historyRecord {
+	host := getLocalHostname()
+	if info.Operation == "remote-backup" && info.RemoteHost != "" {
+		// A pull backs up the remote machine.
+		host = getRemoteHostname(info.RemoteHost)
+	}
+
+	record := historyRecord{
+		Version:         historyVersion,
+		Operation:       info.Operation,
+		Host:            host,
+		Source:          info.SourcePool,
+		Destination:     info.DestPool,
+		RemoteHost:      info.RemoteHost,
+		StartTime:       info.StartTime,
+		EndTime:         info.EndTime,
+		DurationSeconds: info.EndTime.Sub(info.StartTime).Seconds(),
+		Outcome:         runOutcome(info),
+		Error:           info.ErrorMessage,
+		SnapshotsPruned: info.SnapshotsPruned,
+		ReportPath:      reportPath,
+	}
+	if info.DestStats != nil && info.DestStats.Capacity != nil {
+		record.PoolSizeBytes = info.DestStats.Capacity.Size
+		record.PoolAllocatedBytes = info.DestStats.Capacity.Allocated
+	}
+	rates := map[string]changeRate{}
+	for _, c := range info.ChangeRates {
+		rates[c.Dataset] = c
+	}
+	for _, ds := range info.DatasetProgress {
+		record.Datasets = append(record.Datasets, historyDataset{
+			Name:            ds.Name,
+			Status:          datasetStatusName(ds.Status),
+			Error:           ds.ErrorMsg,
+			DurationSeconds: ds.Duration.Seconds(),
+			Size:            ds.Size,
+			BytesSent:       syncedSnapshotBytes(ds),
+			WrittenBytes:    rates[ds.Name].Written,
+			WrittenSeconds:  rates[ds.Name].Interval.Seconds(),
+		})
+	}
+	return record
+}
+
+// appendRunHistory records a finished run. The record is written with a
+// single append so a TUI and a CLI run finishing together cannot interleave.
+func appendRunHistory(info ReportInfo, reportPath string) error {
+	return appendHistoryRecord(newHistoryRecord(info, reportPath))
+}
+
+// appendHistoryRecord appends one record to the history.
+func appendHistoryRecord(record historyRecord) error {
+	historyPath, err := getHistoryFilePath()
+	if err != nil {
+		return fmt.Errorf("failed to record run history: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(historyPath), 0755); err != nil {
+		return fmt.Errorf("failed to record run history: %w", err)
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to record run history: %w", err)
+	}
+	f, err := os.OpenFile(historyPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to record run history: %w", err)
+	}
+	_, err = f.Write(append(line, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record run history: %w", err)
+	}
+	chownToRealUser(historyPath)
+	return nil
+}
+
+// loadRunHistory reads every recorded run, oldest first. A missing history is
+// empty; lines that cannot be parsed, such as one cut short by a full disk,
+// are skipped rather than hiding every other run.
+func loadRunHistory() ([]historyRecord, error) {
+	historyPath, err := getHistoryFilePath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(historyPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []historyRecord
+	scanner := bufio.NewScanner(f)
+	// A run's log is not recorded, but error messages can still be long.
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var record historyRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return records, fmt.Errorf("%s: %w", historyPath, err)
+	}
+	return records, nil
+}
+
+// =============================================================================
+// Filtering
+// =============================================================================
+
+// historyFilter selects records for the history command. Zero values match
+// everything.
+type historyFilter struct {
+	Host   string
+	Pool   string
+	Since  time.Time
+	Failed bool // only runs that failed or partially failed
+}
+
+// matches reports whether a record passes the filter.
+func (f historyFilter) matches(r historyRecord) bool {
+	if f.Host != "" && !strings.EqualFold(r.Host, f.Host) {
+		return false
+	}
+	if f.Pool != "" && endpointPool(r.Source) != f.Pool && endpointPool(r.Destination) != f.Pool {
+		return false
+	}
+	if !f.Since.IsZero() && r.StartTime.Before(f.Since) {
+		return false
+	}
+	if f.Failed && r.Outcome == notifySuccess {
+		return false
+	}
+	return true
+}
+
+// filterHistory returns the matching records, newest first.
+func filterHistory(records []historyRecord, f historyFilter) []historyRecord {
+	var matched []historyRecord
+	for _, r := range records {
+		if f.matches(r) {
+			matched = append(matched, r)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].StartTime.After(matched[j].StartTime)
+	})
+	return matched
+}
+
+// endpointPool returns the pool an endpoint lives on: the first path
+// component, after any host: prefix.
+func endpointPool(endpoint string) string {
+	if idx := strings.Index(endpoint, ":"); idx >= 0 {
+		endpoint = endpoint[idx+1:]
+	}
+	if idx := strings.Index(endpoint, "/"); idx >= 0 {
+		endpoint = endpoint[:idx]
+	}
+	return endpoint
+}
+
+// parseSince parses a --since value: a duration back from now such as 36h or
+// 7d, or a date (2026-10-01) or RFC 3339 time.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, now.Location()); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q - use a duration like 36h or 7d, or a date like 2026-10-01", value)
+}
+
+// =============================================================================
+// CLI
+// =============================================================================
+
+// historyDurationLabel renders a run's duration compactly, e.g. 1h02m.
+func historyDurationLabel(seconds float64) string {
+	d := time.Duration(seconds * float64(time.Second)).Round(time.Second)
+	switch {
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	case d >= time.Minute:
+		return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+	default:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	}
+}
+
+// printHistory prints records as a table, newest first.
+func printHistory(records []historyRecord) {
+	fmt.Println()
+	fmt.Println(titleStyle.Render("Run history"))
+	fmt.Println(interstitialStyle.Render(strings.Repeat("─", 50)))
+	fmt.Println()
+	if len(records) == 0 {
+		fmt.Println(infoStyle.Render("  No runs recorded."))
+		fmt.Println()
+		return
+	}
+
+	fmt.Println(subtitleStyle.Render(fmt.Sprintf("  %-17s %-13s %-12s %-28s %8s  %s",
+		"STARTED", "OPERATION", "HOST", "SOURCE -> DESTINATION", "DURATION", "OUTCOME")))
+	for _, r := range records {
+		line := fmt.Sprintf("  %-17s %-13s %-12s %-28s %8s  %s",
+			r.StartTime.Local().Format("2006-01-02 15:04"),
+			r.Operation,
+			r.Host,
+			r.Source+" -> "+r.Destination,
+			historyDurationLabel(r.DurationSeconds),
+			r.Outcome)
+		switch r.Outcome {
+		case notifySuccess:
+			fmt.Println(statusStyle.Render(line))
+		case notifyPartial:
+			fmt.Println(warningStyle.Render(line))
+		default:
+			fmt.Println(errorStyle.Render(line))
+		}
+		if failed := r.failedDatasets(); len(failed) > 0 {
+			fmt.Println(infoStyle.Render("      failed: " + strings.Join(failed, ", ")))
+		}
+	}
+	fmt.Println()
+}
@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistoryRecordComesFromReportInfo(t *testing.T) {
+	info := sampleReportInfo()
+	info.DatasetProgress[0].Duration = 90 * time.Second
+	info.DatasetProgress[0].Size = "12G"
+
+	r := newHistoryRecord(info, "/reports/r.md")
+
+	if r.Operation != "backup" || r.Source != "NIXROOT" || r.Destination != "NIXBACKUPS" || r.Host != getLocalHostname() {
+		t.Errorf("endpoints should come from the report info, got %+v", r)
+	}
+	if r.Outcome != notifyPartial || r.DurationSeconds != 360 {
+		t.Errorf("expected a 6 minute partial run, got %s in %vs", r.Outcome, r.DurationSeconds)
+	}
+	want := []historyDataset{
+		{Name: "home", Status: "done", DurationSeconds: 90, Size: "12G"},
+		{Name: "atuin", Status: "error", Error: "syncoid failed"},
+	}
+	if !reflect.DeepEqual(r.Datasets, want) {
+		t.Errorf("expected per-dataset outcomes %+v, got %+v", want, r.Datasets)
+	}
+
+	info.Operation = "remote-backup"
+	info.RemoteHost = "admin@server"
+	if got := newHistoryRecord(info, "").Host; got != "server" {
+		t.Errorf("a pull backs up the remote host, got %q", got)
+	}
+}
+
+func TestRunHistoryAppendsAndSkipsDamagedLines(t *testing.T) {
+	useTempHome(t)
+	first := sampleReportInfo()
+	if err := appendRunHistory(first, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// A record cut short, e.g. by a full disk, must not hide the others.
+	path, _ := getHistoryFilePath()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"version":1,"operation":"bac` + "\n")
+	f.Close()
+
+	second := sampleReportInfo()
+	second.Success = true
+	if err := appendRunHistory(second, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := loadRunHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Outcome != notifyPartial || records[1].Outcome != notifySuccess {
+		t.Errorf("expected both runs in order, got %+v", records)
+	}
+}
+
+func TestLoadRunHistoryWithoutFileIsEmpty(t *testing.T) {
+	useTempHome(t)
+	records, err := loadRunHistory()
+	if err != nil || len(records) != 0 {
+		t.Errorf("no history yet is not an error, got %v (%v)", records, err)
+	}
+}
+
+func TestFilterHistory(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 2, 0, 0, 0, time.UTC) }
+	records := []historyRecord{
+		{Operation: "backup", Host: "laptop", Source: "NIXROOT", Destination: "NIXBACKUPS", StartTime: day(1), Outcome: notifySuccess},
+		{Operation: "remote-backup", Host: "server", Source: "admin@server:tank/data", Destination: "NIXBACKUPS", StartTime: day(10), Outcome: notifyFailure},
+		{Operation: "backup", Host: "laptop", Source: "NIXROOT", Destination: "NIXBACKUPS", StartTime: day(17), Outcome: notifyPartial},
+	}
+	started := func(rs []historyRecord) []int {
+		var days []int
+		for _, r := range rs {
+			days = append(days, r.StartTime.Day())
+		}
+		return days
+	}
+
+	if got := started(filterHistory(records, historyFilter{})); !reflect.DeepEqual(got, []int{17, 10, 1}) {
+		t.Errorf("expected every run, newest first, got %v", got)
+	}
+	if got := started(filterHistory(records, historyFilter{Host: "laptop"})); !reflect.DeepEqual(got, []int{17, 1}) {
+		t.Errorf("--host should keep that host's runs, got %v", got)
+	}
+	if got := started(filterHistory(records, historyFilter{Pool: "tank"})); !reflect.DeepEqual(got, []int{10}) {
+		t.Errorf("--pool should match a remote source's pool, got %v", got)
+	}
+	if got := started(filterHistory(records, historyFilter{Failed: true, Since: day(5)})); !reflect.DeepEqual(got, []int{17, 10}) {
+		t.Errorf("--failed --since should keep recent failed and partial runs, got %v", got)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	cases := map[string]time.Time{
+		"7d":                   time.Date(2026, 10, 11, 12, 0, 0, 0, time.UTC),
+		"36h":                  time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC),
+		"2026-10-01":           time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+		"2026-10-01T08:00:00Z": time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC),
+	}
+	for value, want := range cases {
+		got, err := parseSince(value, now)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("parseSince(%q) = %v (%v), want %v", value, got, err, want)
+		}
+	}
+	if _, err := parseSince("last tuesday", now); err == nil {
+		t.Error("an unparseable --since should be an error")
+	}
+}
+
+func TestHistoryTableSortsByChosenColumn(t *testing.T) {
+	m := model{historyRecords: []historyRecord{
+		{Host: "b", DurationSeconds: 10, StartTime: time.Unix(1, 0)},
+		{Host: "a", DurationSeconds: 30, StartTime: time.Unix(2, 0)},
+		{Host: "c", DurationSeconds: 20, StartTime: time.Unix(3, 0)},
+	}}
+	hosts := func() []string {
+		var got []string
+		for _, r := range m.visibleHistory() {
+			got = append(got, r.Host)
+		}
+		return got
+	}
+
+	if got := hosts(); !reflect.DeepEqual(got, []string{"c", "a", "b"}) {
+		t.Errorf("the table opens newest first, got %v", got)
+	}
+	m.historySort = 5 // Duration
+	m.historyAscending = true
+	if got := hosts(); !reflect.DeepEqual(got, []string{"b", "c", "a"}) {
+		t.Errorf("expected shortest run first, got %v", got)
+	}
+}
@@ -0,0 +1,259 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// stateHistory is the run history table.
+const stateHistory sessionState = 103
+
+// =============================================================================
+// Run history screen
+// =============================================================================
+
+// historyColumn is one sortable column of the history table.
+type historyColumn struct {
+	title string
+	width int
+	value func(r historyRecord) string
+	less  func(a, b historyRecord) bool
+}
+
+// historyColumns are the table's columns, in display order. Started is the
+// default sort.
+var historyColumns = []historyColumn{
+	{
+		title: "Started", width: 17,
+		value: func(r historyRecord) string { return r.StartTime.Local().Format("2006-01-02 15:04") },
+		less:  func(a, b historyRecord) bool { return a.StartTime.Before(b.StartTime) },
+	},
+	{
+		title: "Operation", width: 13,
+		value: func(r historyRecord) string { return r.Operation },
+		less:  func(a, b historyRecord) bool { return a.Operation < b.Operation },
+	},
+	{
+		title: "Host", width: 12,
+		value: func(r historyRecord) string { return r.Host },
+		less:  func(a, b historyRecord) bool { return a.Host < b.Host },
+	},
+	{
+		title: "Source", width: 16,
+		value: func(r historyRecord) string { return r.Source },
+		less:  func(a, b historyRecord) bool { return a.Source < b.Source },
+	},
+	{
+		title: "Destination", width: 16,
+		value: func(r historyRecord) string { return r.Destination },
+		less:  func(a, b historyRecord) bool { return a.Destination < b.Destination },
+	},
+	{
+		title: "Duration", width: 9,
+		value: func(r historyRecord) string { return historyDurationLabel(r.DurationSeconds) },
+		less:  func(a, b historyRecord) bool { return a.DurationSeconds < b.DurationSeconds },
+	},
+	{
+		title: "Outcome", width: 8,
+		value: func(r historyRecord) string { return r.Outcome },
+		less:  func(a, b historyRecord) bool { return a.Outcome < b.Outcome },
+	},
+	{
+		title: "Failed", width: 6,
+		value: func(r historyRecord) string { return fmt.Sprintf("%d/%d", len(r.failedDatasets()), len(r.Datasets)) },
+		less:  func(a, b historyRecord) bool { return len(a.failedDatasets()) < len(b.failedDatasets()) },
+	},
+}
+
+// historyLoadedMsg carries the recorded runs.
+type historyLoadedMsg struct {
+	records []historyRecord
+	err     error
+}
+
+// loadHistory reads the run history.
+func loadHistory() tea.Cmd {
+	return func() tea.Msg {
+		records, err := loadRunHistory()
+		return historyLoadedMsg{records: records, err: err}
+	}
+}
+
+// visibleHistory returns the records the table shows, in its current order.
+func (m model) visibleHistory() []historyRecord {
+	records := filterHistory(m.historyRecords, historyFilter{Failed: m.historyFailedOnly})
+	column := historyColumns[m.historySort]
+	sort.SliceStable(records, func(i, j int) bool {
+		if m.historyAscending {
+			return column.less(records[i], records[j])
+		}
+		return column.less(records[j], records[i])
+	})
+	return records
+}
+
+// historyPageSize is how many table rows fit on screen.
+func (m model) historyPageSize() int {
+	rows := m.height - 18
+	if rows < 5 {
+		rows = 5
+	}
+	return rows
+}
+
+// updateHistoryScreen handles keys for the run history table.
+func (m model) updateHistoryScreen(msg tea.KeyMsg) (model, tea.Cmd) {
+	count := len(m.visibleHistory())
+	switch msg.String() {
+	case "ctrl+c":
+		m.quitting = true
+		return m, tea.Quit
+	case "esc", "q":
+		m.state = stateMenu
+		return m, nil
+	case "up", "k":
+		if m.historyIndex > 0 {
+			m.historyIndex--
+		}
+	case "down", "j":
+		if m.historyIndex < count-1 {
+			m.historyIndex++
+		}
+	case "pgup":
+		m.historyIndex = max(m.historyIndex-m.historyPageSize(), 0)
+	case "pgdown":
+		m.historyIndex = max(min(m.historyIndex+m.historyPageSize(), count-1), 0)
+	case "s", "tab":
+		m.historySort = (m.historySort + 1) % len(historyColumns)
+		m.historyIndex = 0
+	case "S", "shift+tab":
+		m.historySort = (m.historySort + len(historyColumns) - 1) % len(historyColumns)
+		m.historyIndex = 0
+	case "r":
+		m.historyAscending = !m.historyAscending
+		m.historyIndex = 0
+	case "f":
+		m.historyFailedOnly = !m.historyFailedOnly
+		m.historyIndex = 0
+	case "p":
+		if records := m.visibleHistory(); m.historyIndex < len(records) {
+			if path := records[m.historyIndex].ReportPath; path != "" {
+				pdf := strings.TrimSuffix(path, ".md") + ".pdf"
+				if err := openFileForUser(pdf); err != nil {
+					_ = openFileForUser(path)
+				}
+			}
+		}
+	}
+	return m, nil
+}
+
+// renderHistoryRow lays out one row of the table.
+func renderHistoryRow(cells []string) string {
+	var b strings.Builder
+	for i, column := range historyColumns {
+		cell := cells[i]
+		if len(cell) > column.width {
+			cell = cell[:column.width-1] + "~"
+		}
+		b.WriteString(fmt.Sprintf("%-*s ", column.width, cell))
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+// renderHistoryContent draws the run history table.
+func (m model) renderHistoryContent(width int) string {
+	var b strings.Builder
+
+	title := selectedItemStyle.Render("Run History")
+	b.WriteString(lipgloss.NewStyle().Width(width).Align(lipgloss.Center).Render(title))
+	b.WriteString("\n\n")
+
+	records := m.visibleHistory()
+	if len(m.historyRecords) == 0 {
+		b.WriteString(lipgloss.NewStyle().Width(width).Align(lipgloss.Center).Render(
+			infoStyle.Render("No runs recorded yet. Every backup, pull and push run is added here when it ends.")))
+		b.WriteString("\n")
+		return b.String()
+	}
+
+	summary := fmt.Sprintf("%d run(s)", len(records))
+	if m.historyFailedOnly {
+		summary += " - failed and partial only"
+	}
+	b.WriteString(lipgloss.NewStyle().Width(width).Align(lipgloss.Center).Render(infoStyle.Render(summary)))
+	b.WriteString("\n\n")
+
+	headers := make([]string, len(historyColumns))
+	for i, column := range historyColumns {
+		headers[i] = column.title
+		if i == m.historySort {
+			if m.historyAscending {
+				headers[i] += " ^"
+			} else {
+				headers[i] += " v"
+			}
+		}
+	}
+	b.WriteString(subtitleStyle.Render("  " + renderHistoryRow(headers)))
+	b.WriteString("\n")
+
+	// Scroll so the cursor is always on screen.
+	rows := m.historyPageSize()
+	start := 0
+	if m.historyIndex >= rows {
+		start = m.historyIndex - rows + 1
+	}
+	end := min(start+rows, len(records))
+
+	for i := start; i < end; i++ {
+		r := records[i]
+		cells := make([]string, len(historyColumns))
+		for c, column := range historyColumns {
+			cells[c] = column.value(r)
+		}
+		cursor := "  "
+		if i == m.historyIndex {
+			cursor = "> "
+		}
+		line := cursor + renderHistoryRow(cells)
+		switch {
+		case i == m.historyIndex:
+			b.WriteString(selectedItemStyle.Render(line))
+		case r.Outcome == notifySuccess:
+			b.WriteString(statusStyle.Render(line))
+		case r.Outcome == notifyPartial:
+			b.WriteString(warningStyle.Render(line))
+		default:
+			b.WriteString(errorStyle.Render(line))
+		}
+		b.WriteString("\n")
+	}
+
+	// Details of the selected run.
+	if m.historyIndex < len(records) {
+		r := records[m.historyIndex]
+		b.WriteString("\n")
+		if failed := r.failedDatasets(); len(failed) > 0 {
+			b.WriteString(warningStyle.Render("  Failed: " + strings.Join(failed, ", ")))
+			b.WriteString("\n")
+		}
+		if r.Error != "" {
+			b.WriteString(infoStyle.Render("  " + r.Error))
+			b.WriteString("\n")
+		}
+		if r.ReportPath != "" {
+			b.WriteString(subtitleStyle.Render("  Report: " + r.ReportPath))
+			b.WriteString("\n")
+		}
+	}
+
+	return b.String()
+}
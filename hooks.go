@@ -0,0 +1,293 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// Hooks - user executables run at fixed points of a backup
+// =============================================================================
+//
+// Hooks are configured per pool in ~/.config/zfs-backup/hooks.json:
+//
+//	{
+//	  "pools": {
+//	    "NIXROOT": {
+//	      "pre_snapshot":  ["/usr/local/bin/stop-postgres"],
+//	      "post_snapshot": ["/usr/local/bin/start-postgres"],
+//	      "on_failure":    ["/usr/local/bin/notify-chat"]
+//	    }
+//	  }
+//	}
+//
+// A run fires the hooks of its source pool and then those of its destination
+// pool. Each entry is the path of an executable, run without a shell; what it
+// needs to know arrives in ZFS_BACKUP_* environment variables.
+//
+// Only a pre-hook can stop a run: a non-zero exit aborts before anything is
+// snapshotted. Every other hook is best effort - a failure is logged as a
+// warning and the run carries on.
+
+// HookPoint names a point in a run where hooks fire.
+type HookPoint string
+
+const (
+	HookPreSnapshot     HookPoint = "pre_snapshot"
+	HookPostSnapshot    HookPoint = "post_snapshot"
+	HookPostDatasetSync HookPoint = "post_dataset_sync"
+	HookOnFailure       HookPoint = "on_failure"
+	HookPostExport      HookPoint = "post_export"
+)
+
+// hookPoints lists every valid hook point, in the order they fire.
+var hookPoints = []HookPoint{HookPreSnapshot, HookPostSnapshot, HookPostDatasetSync, HookOnFailure, HookPostExport}
+
+// hookTimeout bounds a single hook, so a hung script cannot stall a backup.
+const hookTimeout = 10 * time.Minute
+
+// PoolHooks maps each hook point to the executables run there.
+type PoolHooks map[HookPoint][]string
+
+// HookConfig is the on-disk hook configuration, keyed by pool name.
+type HookConfig struct {
+	Pools map[string]PoolHooks `json:"pools"`
+}
+
+// hooksFileName is the config file holding the hook configuration.
+const hooksFileName = "hooks.json"
+
+// getHooksFilePath returns the path to the hook config file.
+func getHooksFilePath() (string, error) {
+	dir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, hooksFileName), nil
+}
+
+// LoadHookConfig reads the hook configuration. A missing file means no hooks.
+// Unlike the scope, a file that cannot be parsed is an error the run must not
+// ignore: silently skipping a pre-snapshot hook would snapshot a database
+// that was never quiesced.
+func LoadHookConfig() (*HookConfig, error) {
+	hooksPath, err := getHooksFilePath()
+	if err != nil {
+		return &HookConfig{Pools: map[string]PoolHooks{}}, err
+	}
+
+	data, err := os.ReadFile(hooksPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &HookConfig{Pools: map[string]PoolHooks{}}, nil
+		}
+		return &HookConfig{Pools: map[string]PoolHooks{}}, err
+	}
+
+	var config HookConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return &HookConfig{Pools: map[string]PoolHooks{}}, fmt.Errorf("%s: %w", hooksPath, err)
+	}
+	if config.Pools == nil {
+		config.Pools = map[string]PoolHooks{}
+	}
+	if err := config.validate(); err != nil {
+		return &HookConfig{Pools: map[string]PoolHooks{}}, fmt.Errorf("%s: %w", hooksPath, err)
+	}
+
+	return &config, nil
+}
+
+// validate rejects unknown hook points and relative paths, so a typo fails
+// loudly instead of quietly never running.
+func (c *HookConfig) validate() error {
+	known := map[HookPoint]bool{}
+	for _, p := range hookPoints {
+		known[p] = true
+	}
+	for pool, hooks := range c.Pools {
+		for point, paths := range hooks {
+			if !known[point] {
+				return fmt.Errorf("pool %s: unknown hook point %q", pool, point)
+			}
+			for _, path := range paths {
+				if !filepath.IsAbs(path) {
+					return fmt.Errorf("pool %s: hook %q must be an absolute path", pool, path)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// hooksFor returns the executables for a hook point across the given pools,
+// in pool order.
+func (c *HookConfig) hooksFor(pools []string, point HookPoint) []hookCommand {
+	var cmds []hookCommand
+	for _, pool := range pools {
+		for _, path := range c.Pools[pool][point] {
+			cmds = append(cmds, hookCommand{Pool: pool, Path: path})
+		}
+	}
+	return cmds
+}
+
+// hookCommand is one executable to run, and the pool it was configured on.
+type hookCommand struct {
+	Pool string
+	Path string
+}
+
+// hookContext is what a hook is told about the moment it fires.
+type hookContext struct {
+	Stage    BackupStage
+	Dataset  string
+	Snapshot string
+	Result   string // "success", "failure" or "aborted"
+	Error    string
+}
+
+// hookResult names the outcome of the step a post-hook follows.
+func hookResult(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// runHooks fires the hooks of one run. A nil *runHooks fires nothing, so the
+// perform* functions can call it unconditionally.
+type runHooks struct {
+	config      *HookConfig
+	operation   string
+	source      string
+	destination string
+	pools       []string
+	output      *strings.Builder
+}
+
+// newRunHooks loads the hook configuration for a run between two endpoints.
+// pools lists the local pools whose hooks apply, source first.
+func newRunHooks(operation, source, destination string, pools []string, output *strings.Builder) (*runHooks, error) {
+	config, err := LoadHookConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load hooks: %w", err)
+	}
+	return &runHooks{
+		config:      config,
+		operation:   operation,
+		source:      source,
+		destination: destination,
+		pools:       pools,
+		output:      output,
+	}, nil
+}
+
+// hookEnv builds the environment a hook runs with: the caller's environment
+// plus the ZFS_BACKUP_* variables describing the run.
+func (h *runHooks) hookEnv(point HookPoint, pool string, hc hookContext) []string {
+	env := append(os.Environ(),
+		"ZFS_BACKUP_HOOK="+string(point),
+		"ZFS_BACKUP_OPERATION="+h.operation,
+		"ZFS_BACKUP_POOL="+pool,
+		"ZFS_BACKUP_SOURCE="+h.source,
+		"ZFS_BACKUP_DESTINATION="+h.destination,
+		"ZFS_BACKUP_STAGE="+string(hc.Stage),
+	)
+	if hc.Dataset != "" {
+		env = append(env, "ZFS_BACKUP_DATASET="+hc.Dataset)
+	}
+	if hc.Snapshot != "" {
+		env = append(env, "ZFS_BACKUP_SNAPSHOT="+hc.Snapshot)
+	}
+	if hc.Result != "" {
+		env = append(env, "ZFS_BACKUP_RESULT="+hc.Result)
+	}
+	if hc.Error != "" {
+		env = append(env, "ZFS_BACKUP_ERROR="+hc.Error)
+	}
+	return env
+}
+
+// preSnapshot runs the pre_snapshot hooks. The first to fail stops the rest
+// and its error is returned, so the caller can abort before snapshotting.
+// They honour the run's cancellation like any other stage work.
+func (h *runHooks) preSnapshot(ctx context.Context, hc hookContext) error {
+	return h.run(ctx, HookPreSnapshot, hc, true)
+}
+
+// fire runs the hooks for any point other than pre_snapshot. They are best
+// effort: failures are logged as warnings. They ignore cancellation, bounded
+// only by hookTimeout, because on_failure and post_snapshot matter most
+// exactly when the run is being torn down.
+func (h *runHooks) fire(ctx context.Context, point HookPoint, hc hookContext) {
+	_ = h.run(context.WithoutCancel(ctx), point, hc, false)
+}
+
+func (h *runHooks) run(ctx context.Context, point HookPoint, hc hookContext, stopOnError bool) error {
+	if h == nil {
+		return nil
+	}
+	for _, c := range h.config.hooksFor(h.pools, point) {
+		h.output.WriteString(fmt.Sprintf("Running %s hook %s\n", point, c.Path))
+		out, err := runHookCommand(ctx, c.Path, h.hookEnv(point, c.Pool, hc))
+		if trimmed := strings.TrimSpace(out); trimmed != "" {
+			for _, line := range strings.Split(trimmed, "\n") {
+				h.output.WriteString("   " + line + "\n")
+			}
+		}
+		if err == nil {
+			continue
+		}
+		if stopOnError {
+			return fmt.Errorf("%s hook %s failed: %w", point, c.Path, err)
+		}
+		h.output.WriteString(fmt.Sprintf("Warning:%s hook %s failed: %v\n", point, c.Path, err))
+	}
+	return nil
+}
+
+// snapshotTagOf returns the part of a snapshot name after the "@", which is
+// what hooks receive as ZFS_BACKUP_SNAPSHOT.
+func snapshotTagOf(name string) string {
+	_, tag, _ := strings.Cut(name, "@")
+	return tag
+}
+
+// runHookCommand executes one hook with a timeout. The executable must not be
+// writable by anyone but its owner: hooks run as root under sudo.
+func runHookCommand(ctx context.Context, path string, env []string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() || info.Mode().Perm()&0111 == 0 {
+		return "", fmt.Errorf("%s is not executable", path)
+	}
+	if info.Mode().Perm()&0022 != 0 {
+		return "", fmt.Errorf("%s is group- or world-writable; refusing to run it", path)
+	}
+
+	hookCtx, cancel := context.WithTimeout(ctx, hookTimeout)
+	defer cancel()
+
+	cmd := commandContext(hookCtx, path)
+	cmd.Env = env
+	out, err := cmd.CombinedOutput()
+	if err != nil && hookCtx.Err() == context.DeadlineExceeded {
+		return string(out), fmt.Errorf("timed out after %v", hookTimeout)
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return string(out), fmt.Errorf("exit status %d", exitErr.ExitCode())
+	}
+	return string(out), err
+}
@@ -0,0 +1,257 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeHookScript writes an executable shell script into a temp dir.
+func writeHookScript(t *testing.T, name, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeHookConfig writes hooks.json into the temp home's config dir.
+func writeHookConfig(t *testing.T, content string) {
+	t.Helper()
+	path, err := getHooksFilePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testRunHooks(pools []string, hooks map[string]PoolHooks, output *strings.Builder) *runHooks {
+	return &runHooks{
+		config:      &HookConfig{Pools: hooks},
+		operation:   "backup",
+		source:      "NIXROOT",
+		destination: "NIXBACKUPS",
+		pools:       pools,
+		output:      output,
+	}
+}
+
+func TestLoadHookConfigWithoutFileHasNoHooks(t *testing.T) {
+	useTempHome(t)
+	config, err := LoadHookConfig()
+	if err != nil {
+		t.Fatalf("a missing hooks file is not an error: %v", err)
+	}
+	if len(config.hooksFor([]string{"NIXROOT"}, HookPreSnapshot)) != 0 {
+		t.Error("without a hooks file no hooks should run")
+	}
+}
+
+func TestLoadHookConfigRejectsMistakes(t *testing.T) {
+	useTempHome(t)
+	for name, content := range map[string]string{
+		"unparseable":   `{"pools": `,
+		"unknown point": `{"pools": {"NIXROOT": {"pre-snapshot": ["/bin/true"]}}}`,
+		"relative path": `{"pools": {"NIXROOT": {"pre_snapshot": ["stop-db"]}}}`,
+	} {
+		writeHookConfig(t, content)
+		if _, err := LoadHookConfig(); err == nil {
+			t.Errorf("%s: a hooks file that cannot be trusted must fail the run, not be ignored", name)
+		}
+	}
+}
+
+func TestHooksForRunsSourcePoolHooksFirst(t *testing.T) {
+	config := &HookConfig{Pools: map[string]PoolHooks{
+		"NIXBACKUPS": {HookOnFailure: {"/usr/local/bin/beep"}},
+		"NIXROOT":    {HookOnFailure: {"/usr/local/bin/notify", "/usr/local/bin/log"}},
+		"OTHER":      {HookOnFailure: {"/usr/local/bin/unrelated"}},
+	}}
+
+	got := config.hooksFor([]string{"NIXROOT", "NIXBACKUPS"}, HookOnFailure)
+	want := []hookCommand{
+		{Pool: "NIXROOT", Path: "/usr/local/bin/notify"},
+		{Pool: "NIXROOT", Path: "/usr/local/bin/log"},
+		{Pool: "NIXBACKUPS", Path: "/usr/local/bin/beep"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestHookReceivesRunContextInEnvironment(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "env")
+	script := writeHookScript(t, "record", "env | grep ^ZFS_BACKUP_ | sort > "+out)
+
+	var output strings.Builder
+	hooks := testRunHooks([]string{"NIXROOT"}, map[string]PoolHooks{
+		"NIXROOT": {HookPostDatasetSync: {script}},
+	}, &output)
+	hooks.fire(context.Background(), HookPostDatasetSync, hookContext{
+		Stage:    StageSyncData,
+		Dataset:  "NIXROOT/home",
+		Snapshot: "2026-10-18.02h-00-Backup",
+		Result:   "success",
+	})
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("hook did not run: %v\n%s", err, output.String())
+	}
+	for _, want := range []string{
+		"ZFS_BACKUP_HOOK=post_dataset_sync",
+		"ZFS_BACKUP_OPERATION=backup",
+		"ZFS_BACKUP_POOL=NIXROOT",
+		"ZFS_BACKUP_DESTINATION=NIXBACKUPS",
+		"ZFS_BACKUP_STAGE=sync_data",
+		"ZFS_BACKUP_DATASET=NIXROOT/home",
+		"ZFS_BACKUP_SNAPSHOT=2026-10-18.02h-00-Backup",
+		"ZFS_BACKUP_RESULT=success",
+	} {
+		if !strings.Contains(string(data), want+"\n") {
+			t.Errorf("expected %s in the hook environment, got:\n%s", want, data)
+		}
+	}
+}
+
+func TestFailingPreSnapshotHookAborts(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "second-ran")
+	failing := writeHookScript(t, "stop-db", "echo database refused to checkpoint; exit 3")
+	second := writeHookScript(t, "second", "touch "+marker)
+
+	var output strings.Builder
+	hooks := testRunHooks([]string{"NIXROOT"}, map[string]PoolHooks{
+		"NIXROOT": {HookPreSnapshot: {failing, second}},
+	}, &output)
+	err := hooks.preSnapshot(context.Background(), hookContext{Stage: StageCreateSnapshot})
+
+	if err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Fatalf("a non-zero pre-hook exit must abort the run, got %v", err)
+	}
+	if _, statErr := os.Stat(marker); statErr == nil {
+		t.Error("hooks after a failed pre-hook must not run")
+	}
+	if !strings.Contains(output.String(), "database refused to checkpoint") {
+		t.Errorf("hook output belongs in the run log, got:\n%s", output.String())
+	}
+}
+
+func TestFailingPostHookOnlyWarns(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "second-ran")
+	failing := writeHookScript(t, "notify", "exit 1")
+	second := writeHookScript(t, "second", "touch "+marker)
+
+	var output strings.Builder
+	hooks := testRunHooks([]string{"NIXROOT"}, map[string]PoolHooks{
+		"NIXROOT": {HookOnFailure: {failing, second}},
+	}, &output)
+	hooks.fire(cancelledContext(), HookOnFailure, hookContext{Result: "failure"})
+
+	if _, err := os.Stat(marker); err != nil {
+		t.Error("a failing post-hook must not stop the next one, even in a cancelled run")
+	}
+	if len(logWarnings(output.String())) != 1 {
+		t.Errorf("the failed hook should be logged as a warning, got:\n%s", output.String())
+	}
+}
+
+func TestHookMustNotBeWritableByOthers(t *testing.T) {
+	script := writeHookScript(t, "stop-db", "exit 0")
+	if err := os.Chmod(script, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runHookCommand(context.Background(), script, nil); err == nil {
+		t.Error("a world-writable hook would let anyone run code as root and must be refused")
+	}
+}
+
+func TestNilRunHooksFiresNothing(t *testing.T) {
+	var hooks *runHooks
+	if err := hooks.preSnapshot(context.Background(), hookContext{}); err != nil {
+		t.Errorf("no hooks configured means nothing can abort, got %v", err)
+	}
+	hooks.fire(context.Background(), HookOnFailure, hookContext{})
+}
+
+// fakeZFSTools puts stand-ins for zfs, zpool and syncoid first on PATH. Each
+// logs its arguments; zfs lists NIXROOT/home and has no flat-layout copy of
+// it, syncoid fails, and everything else succeeds with no output.
+func fakeZFSTools(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	scripts := map[string]string{
+		"zfs": `case "$*" in
+"list -H -o name -r NIXROOT") printf 'NIXROOT\nNIXROOT/home\n' ;;
+"list -H NIXBACKUPS/home") exit 1 ;;
+esac`,
+		"zpool":   "",
+		"syncoid": "exit 1",
+	}
+	for name, body := range scripts {
+		script := "#!/bin/sh\necho \"" + name + " $*\" >> " + calls + "\n" + body + "\n"
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return calls
+}
+
+func TestForceBackupFiresHooks(t *testing.T) {
+	useTempHome(t)
+	fakeZFSTools(t)
+	fired := filepath.Join(t.TempDir(), "fired")
+	record := writeHookScript(t, "record",
+		`echo "$ZFS_BACKUP_HOOK $ZFS_BACKUP_OPERATION $ZFS_BACKUP_DATASET $ZFS_BACKUP_RESULT" >> `+fired)
+	writeHookConfig(t, `{"pools": {"NIXROOT": {
+		"pre_snapshot": ["`+record+`"],
+		"post_snapshot": ["`+record+`"],
+		"post_dataset_sync": ["`+record+`"],
+		"on_failure": ["`+record+`"]
+	}}}`)
+
+	output, _, err := performForceBackup(context.Background(), "secret", "NIXROOT", "NIXBACKUPS", nil, nil)
+	if err == nil {
+		t.Fatalf("a dataset that failed to sync must fail the run:\n%s", output)
+	}
+	data, readErr := os.ReadFile(fired)
+	if readErr != nil {
+		t.Fatalf("no hook ran: %v\n%s", readErr, output)
+	}
+	want := []string{
+		"pre_snapshot force-backup  ",
+		"post_snapshot force-backup  success",
+		"post_dataset_sync force-backup NIXROOT/home failure",
+		"on_failure force-backup  failure",
+	}
+	if got := strings.Split(strings.TrimSpace(string(data)), "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the hooks fired as in a backup run, got %q", got)
+	}
+}
+
+func TestFailingPreSnapshotHookStopsForceBackup(t *testing.T) {
+	useTempHome(t)
+	calls := fakeZFSTools(t)
+	writeHookConfig(t, `{"pools": {"NIXROOT": {"pre_snapshot": ["`+writeHookScript(t, "stop-db", "exit 3")+`"]}}}`)
+
+	if _, _, err := performForceBackup(context.Background(), "secret", "NIXROOT", "NIXBACKUPS", nil, nil); err == nil {
+		t.Fatal("a failing pre-hook must abort the force backup")
+	}
+	data, _ := os.ReadFile(calls)
+	if strings.Contains(string(data), "zfs snapshot") || strings.Contains(string(data), "syncoid") {
+		t.Errorf("nothing may be snapshotted or sent after the pre-hook failed, ran:\n%s", data)
+	}
+}
@@ -0,0 +1,363 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// =============================================================================
+// Labelled and pinned snapshots
+// =============================================================================
+//
+// `zfs-backup snapshot --label TEXT` takes an on-demand snapshot of every
+// dataset in scope, say before an OS upgrade. It is named like any other
+// zfs-backup snapshot, so the next run replicates it, but it carries two user
+// properties: its label, and a pin that keeps both prune passes off it until
+// `zfs-backup snapshot --unpin` takes the pin away. Each run copies both
+// properties to the backup pool's copy, so the pin holds there too.
+
+// The user properties a labelled snapshot carries.
+const (
+	labelProperty  = "zfs-backup:label"
+	pinnedProperty = "zfs-backup:pinned"
+)
+
+// snapshotLabel is what a snapshot's user properties say about it.
+type snapshotLabel struct {
+	Label  string
+	Pinned bool
+}
+
+// String describes the label for the run log and reports.
+func (l snapshotLabel) String() string {
+	if l.Pinned {
+		return strconv.Quote(l.Label) + " (pinned)"
+	}
+	return strconv.Quote(l.Label)
+}
+
+// pinnedReason is the prune verdict's reason for keeping a pinned snapshot.
+func pinnedReason(label string) string {
+	if label == "" {
+		return "pinned"
+	}
+	return "pinned: " + label
+}
+
+// listSnapshotLabels reads the label and pin of every snapshot at or below
+// target that has either, by snapshot name, with the same depth rules as
+// listSnapshotEntries.
+func listSnapshotLabels(ctx context.Context, r commandRunner, target string, depth int) (map[string]snapshotLabel, error) {
+	args := []string{"get", "-H", "-o", "name,property,value", "-s", "local,received", "-t", "snapshot"}
+	if depth > 0 {
+		args = append(args, "-d", strconv.Itoa(depth))
+	} else {
+		args = append(args, "-r")
+	}
+	args = append(args, labelProperty+","+pinnedProperty, target)
+
+	output, err := r.Output(ctx, "zfs", args...)
+	if err != nil {
+		return nil, err
+	}
+	labels := map[string]snapshotLabel{}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) < 3 {
+			continue
+		}
+		l := labels[fields[0]]
+		switch fields[1] {
+		case labelProperty:
+			l.Label = fields[2]
+		case pinnedProperty:
+			l.Pinned = fields[2] == "on"
+		}
+		labels[fields[0]] = l
+	}
+	return labels, nil
+}
+
+// labelSnapshotEntries fills in the label and pin of one dataset's snapshots.
+// A listing that fails leaves them unlabelled: the pins are then missed for
+// one run, which only matters if the snapshot was also due to be pruned.
+func labelSnapshotEntries(ctx context.Context, r commandRunner, dataset string, entries []snapshotEntry) {
+	labels, err := listSnapshotLabels(ctx, r, dataset, 1)
+	if err != nil {
+		return
+	}
+	for i, e := range entries {
+		if l, ok := labels[e.Name]; ok {
+			entries[i].Label, entries[i].Pinned = l.Label, l.Pinned
+		}
+	}
+}
+
+// createLabelledSnapshots snapshots every dataset given, then labels and pins
+// each snapshot. If any step fails, the snapshots already taken are destroyed
+// again.
+func createLabelledSnapshots(ctx context.Context, r commandRunner, pool string, datasets []string, label string, now time.Time) ([]string, error) {
+	created, err := createDatasetSnapshots(ctx, r, pool, datasets, snapshotTagForTime(now))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range created {
+		if err := r.Run(ctx, "zfs", "set", labelProperty+"="+label, pinnedProperty+"=on", name); err != nil {
+			destroySnapshots(ctx, r, created)
+			return nil, fmt.Errorf("failed to label %s: %w", name, err)
+		}
+	}
+	return created, nil
+}
+
+// copySnapshotLabels gives each labelled snapshot's copy on the destination
+// the same label and pin, so the destination prune pass honours the pin and a
+// pin taken away on the source is taken away there too. Each side is read
+// through its own runner, so either may be on a remote host. It returns the
+// destination snapshots it changed, described for the run log.
+func copySnapshotLabels(ctx context.Context, src commandRunner, source string, dst commandRunner, dest string) ([]string, error) {
+	labels, err := listSnapshotLabels(ctx, src, source, 1)
+	if err != nil || len(labels) == 0 {
+		return nil, err
+	}
+	destLabels, err := listSnapshotLabels(ctx, dst, dest, 1)
+	if err != nil {
+		return nil, err
+	}
+	destEntries, err := listSnapshotEntries(ctx, dst, dest, 1)
+	if err != nil {
+		return nil, err
+	}
+	onDest := map[string]bool{}
+	for _, e := range destEntries {
+		onDest[e.Tag] = true
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var copied []string
+	for _, name := range names {
+		l := labels[name]
+		_, tag, ok := splitSnapshot(name)
+		target := dest + "@" + tag
+		if !ok || !onDest[tag] || destLabels[target] == l {
+			continue
+		}
+		if err := dst.Run(ctx, "zfs", "set", labelProperty+"="+l.Label, target); err != nil {
+			return copied, fmt.Errorf("failed to label %s: %w", target, err)
+		}
+		pin := []string{"inherit", pinnedProperty, target}
+		if l.Pinned {
+			pin = []string{"set", pinnedProperty + "=on", target}
+		}
+		if err := dst.Run(ctx, "zfs", pin...); err != nil {
+			return copied, fmt.Errorf("failed to pin %s: %w", target, err)
+		}
+		copied = append(copied, fmt.Sprintf("%s %s", target, l))
+	}
+	return copied, nil
+}
+
+// writeSnapshotLabels reports the outcome of copySnapshotLabels in a run's
+// output and records the labelled snapshots in its findings. A label that could not be copied is only a warning: the snapshot is
+// replicated, it is just not pinned on the backup pool until the next run.
+func writeSnapshotLabels(output *strings.Builder, dataset string, copied []string, err error, findings *runFindings) {
+	for _, c := range copied {
+		output.WriteString(fmt.Sprintf("LABELLED SNAPSHOT: %s\n", c))
+	}
+	findings.Labelled = append(findings.Labelled, copied...)
+	if err != nil {
+		output.WriteString(fmt.Sprintf("Warning: could not copy the snapshot labels of %s: %v\n", dataset, err))
+	}
+}
+
+// unpinSnapshots takes the pin away from dataset@tag on each dataset given,
+// leaving the label. It returns the snapshots unpinned.
+func unpinSnapshots(ctx context.Context, r commandRunner, datasets []string, tag string) ([]string, error) {
+	var unpinned []string
+	for _, ds := range datasets {
+		labels, err := listSnapshotLabels(ctx, r, ds, 1)
+		if err != nil {
+			continue // a destination not backed up yet has nothing to unpin
+		}
+		name := ds + "@" + tag
+		if !labels[name].Pinned {
+			continue
+		}
+		if err := r.Run(ctx, "zfs", "inherit", pinnedProperty, name); err != nil {
+			return unpinned, fmt.Errorf("failed to unpin %s: %w", name, err)
+		}
+		unpinned = append(unpinned, name)
+	}
+	return unpinned, nil
+}
+
+// =============================================================================
+// Reporting
+// =============================================================================
+
+// labelledSnapshotNote is the explanation every report format gives with the
+// labelled snapshots.
+const labelledSnapshotNote = "These on-demand snapshots were replicated, or had their pin changed, this run. " +
+	"Pinned snapshots are never pruned until `zfs-backup snapshot --unpin TAG` is run."
+
+// renderLabelledSnapshots renders the labelled snapshots for the TUI's result
+// screen.
+func renderLabelledSnapshots(labelled []string) string {
+	var b strings.Builder
+	b.WriteString(infoStyle.Render("📌 LABELLED SNAPSHOTS") + "\n")
+	for _, l := range labelled {
+		b.WriteString(statusStyle.Render("  "+l) + "\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// writeMarkdownLabelledSnapshots renders the labelled snapshot section of the
+// markdown report.
+func writeMarkdownLabelledSnapshots(b *strings.Builder, labelled []string) {
+	if len(labelled) == 0 {
+		return
+	}
+	b.WriteString("## Labelled Snapshots\n\n")
+	b.WriteString(labelledSnapshotNote + "\n\n")
+	for _, l := range labelled {
+		b.WriteString(fmt.Sprintf("- %s\n", l))
+	}
+	b.WriteString("\n")
+}
+
+// writeHTMLLabelledSnapshots renders the labelled snapshot section of the
+// HTML report.
+func writeHTMLLabelledSnapshots(b *strings.Builder, labelled []string) {
+	if len(labelled) == 0 {
+		return
+	}
+	b.WriteString("<h2>Labelled Snapshots</h2>\n")
+	b.WriteString("<p>" + html.EscapeString(labelledSnapshotNote) + "</p>\n<ul>\n")
+	for _, l := range labelled {
+		b.WriteString("<li>" + html.EscapeString(l) + "</li>\n")
+	}
+	b.WriteString("</ul>\n")
+}
+
+// pdfLabelledSnapshotSection renders the labelled snapshot section of the PDF
+// report.
+func pdfLabelledSnapshotSection(pdf *fpdf.Fpdf, labelled []string, dark, gray [3]int) {
+	if len(labelled) == 0 {
+		return
+	}
+	pdfSectionHeader(pdf, dark, gray, "Labelled Snapshots")
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.SetTextColor(dark[0], dark[1], dark[2])
+	pdf.MultiCell(0, 4.5, labelledSnapshotNote, "", "L", false)
+	pdf.Ln(2)
+	for _, l := range labelled {
+		pdf.MultiCell(0, 4.5, l, "", "L", false)
+	}
+	pdf.Ln(3)
+}
+
+// =============================================================================
+// snapshot
+// =============================================================================
+
+// snapshotOptions are the command-line options for snapshot.
+type snapshotOptions struct {
+	Pool       string
+	BackupPool string // empty when no backup pool is imported
+	Label      string // take a labelled snapshot
+	List       bool   // list labelled snapshots instead
+	Unpin      string // take the pin away from this tag instead
+}
+
+// runSnapshotCommand takes a labelled, pinned snapshot of a pool's scope,
+// lists the labelled snapshots on both sides, or unpins one. destinations maps
+// the scope to its copies on the backup pool. It returns the process exit
+// code.
+func runSnapshotCommand(ctx context.Context, r commandRunner, opts snapshotOptions, destinations func([]string) []string) int {
+	datasets, _, err := resolveBackupDatasets(opts.Pool)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: failed to resolve backup scope: " + err.Error()))
+		return 1
+	}
+	sources := qualifyDatasets(opts.Pool, datasets)
+	var dests []string
+	if opts.BackupPool != "" {
+		dests = destinations(datasets)
+	}
+
+	switch {
+	case opts.List:
+		fmt.Println(titleStyle.Render("Labelled snapshots: " + opts.Pool))
+		fmt.Println()
+		found := 0
+		for _, ds := range append(sources, dests...) {
+			labels, err := listSnapshotLabels(ctx, r, ds, 1)
+			if err != nil {
+				continue
+			}
+			names := make([]string, 0, len(labels))
+			for name := range labels {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Printf("  %-60s %s\n", name, labels[name])
+				found++
+			}
+		}
+		if found == 0 {
+			fmt.Println(statusStyle.Render("No labelled snapshots."))
+		}
+		fmt.Println()
+		return 0
+
+	case opts.Unpin != "":
+		unpinned, err := unpinSnapshots(ctx, r, append(sources, dests...), opts.Unpin)
+		for _, name := range unpinned {
+			fmt.Printf("  unpinned %s\n", name)
+		}
+		if err != nil {
+			fmt.Println(errorStyle.Render("Error: " + err.Error()))
+			return 1
+		}
+		if len(unpinned) == 0 {
+			fmt.Println(statusStyle.Render("No snapshot tagged @" + opts.Unpin + " is pinned."))
+		} else {
+			fmt.Println(statusStyle.Render(fmt.Sprintf("Unpinned %d snapshot(s). The next backup run prunes them as usual.", len(unpinned))))
+		}
+		if opts.BackupPool == "" {
+			fmt.Println(infoStyle.Render("No backup pool is imported - the next backup run unpins its copies."))
+		}
+		fmt.Println()
+		return 0
+	}
+
+	created, err := createLabelledSnapshots(ctx, r, opts.Pool, datasets, opts.Label, time.Now())
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return 1
+	}
+	for _, name := range created {
+		fmt.Printf("  %s\n", name)
+	}
+	_, tag, _ := splitSnapshot(created[0])
+	fmt.Println(statusStyle.Render(fmt.Sprintf("Took %d snapshot(s) labelled %q and pinned them.", len(created), opts.Label)))
+	fmt.Println(infoStyle.Render("The next backup run replicates them; pruning leaves them alone until: zfs-backup snapshot --unpin " + tag))
+	fmt.Println()
+	return 0
+}
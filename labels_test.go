@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPinnedSnapshotsAreNeverPruned(t *testing.T) {
+	entries := []snapshotEntry{
+		snapshotFixture("NIXROOT/home", "2026-08-14.10h-00-Backup", 0),
+		snapshotFixture("NIXROOT/home", "2026-08-13.10h-00-Backup", 1),
+		snapshotFixture("NIXROOT/home", "2026-02-04.10h-00-Backup", 191),
+		snapshotFixture("NIXROOT/home", "2026-01-04.10h-00-Backup", 222),
+	}
+	entries[2].Label, entries[2].Pinned = "before nixos upgrade", true
+
+	keptTags := func(pruned []snapshotEntry) []string {
+		var tags []string
+		for _, e := range pruned {
+			tags = append(tags, e.Tag)
+		}
+		return tags
+	}
+	if got := keptTags(selectSnapshotsToPrune(entries, 2)); !reflect.DeepEqual(got, []string{"2026-01-04.10h-00-Backup"}) {
+		t.Errorf("the pinned snapshot must survive the local prune, pruned %v", got)
+	}
+	months := recentMonths(time.Date(2026, 8, 14, 12, 0, 0, 0, time.UTC), 3)
+	if got := keptTags(selectDestinationSnapshotsToPrune(entries, months)); !reflect.DeepEqual(got, []string{"2026-01-04.10h-00-Backup"}) {
+		t.Errorf("the pinned snapshot must survive the destination prune, pruned %v", got)
+	}
+	if v := explainLocalPrune(entries, 2)[2]; v.Prune || v.Reason != "pinned: before nixos upgrade" {
+		t.Errorf("expected the pin given as the reason, got %+v", v)
+	}
+
+	entries[2].Pinned = false // unpinned: pruned as usual, label or not
+	if got := keptTags(selectSnapshotsToPrune(entries, 2)); len(got) != 2 {
+		t.Errorf("an unpinned snapshot is pruned as usual, pruned %v", got)
+	}
+}
+
+func TestPruneReadsPinsFromZFS(t *testing.T) {
+	r := &fakeRunner{respond: func(_ string, args []string) (string, error) {
+		switch args[0] {
+		case "list":
+			if strings.Contains(strings.Join(args, " "), "-t bookmark") {
+				return "NIXROOT/home#2026-10-01.02h-00-Backup\n", nil
+			}
+			return "NIXROOT/home@2026-10-02.02h-00-Backup\t1791000000\t0\n" +
+				"NIXROOT/home@2026-10-01.02h-00-Backup\t1790900000\t0\n", nil
+		case "get":
+			return "NIXROOT/home@2026-10-01.02h-00-Backup\tzfs-backup:label\tbefore upgrade\n" +
+				"NIXROOT/home@2026-10-01.02h-00-Backup\tzfs-backup:pinned\ton\n", nil
+		}
+		return "", nil
+	}}
+
+	result := pruneLocalSnapshots(context.Background(), r, "NIXROOT", []string{"home"}, 1)
+	if len(result.Pruned) != 0 || r.ran("destroy NIXROOT/home@2026-10-01.02h-00-Backup") {
+		t.Errorf("the pinned snapshot must not be pruned, ran %v", r.commandLines())
+	}
+	if !r.ran("get -H -o name,property,value -s local,received -t snapshot -d 1 zfs-backup:label,zfs-backup:pinned NIXROOT/home") {
+		t.Errorf("expected the pins read before pruning, ran %v", r.commandLines())
+	}
+}
+
+func TestLabelledSnapshotIsCopiedAndReported(t *testing.T) {
+	destPinned := false
+	r := &fakeRunner{respond: func(_ string, args []string) (string, error) {
+		joined := strings.Join(args, " ")
+		switch {
+		case strings.HasSuffix(joined, "NIXROOT/home") && args[0] == "get":
+			return "NIXROOT/home@2026-10-18.09h-30-Backup\tzfs-backup:label\tbefore nixos upgrade\n" +
+				"NIXROOT/home@2026-10-18.09h-30-Backup\tzfs-backup:pinned\ton\n", nil
+		case strings.HasSuffix(joined, "NIXBACKUPS/abyss/home") && args[0] == "get":
+			if destPinned {
+				return "NIXBACKUPS/abyss/home@2026-10-18.09h-30-Backup\tzfs-backup:label\tbefore nixos upgrade\n" +
+					"NIXBACKUPS/abyss/home@2026-10-18.09h-30-Backup\tzfs-backup:pinned\ton\n", nil
+			}
+			return "", nil
+		case args[0] == "list":
+			return "NIXBACKUPS/abyss/home@2026-10-18.09h-30-Backup\t1792315800\t0\n", nil
+		}
+		return "", nil
+	}}
+	ctx := context.Background()
+
+	created, err := createLabelledSnapshots(ctx, r, "NIXROOT", []string{"home"}, "before nixos upgrade",
+		time.Date(2026, 10, 18, 9, 30, 0, 0, time.Local))
+	if err != nil || len(created) != 1 {
+		t.Fatalf("expected one snapshot taken, got %v, %v", created, err)
+	}
+	if !r.ran("set zfs-backup:label=before nixos upgrade zfs-backup:pinned=on NIXROOT/home@2026-10-18.09h-30-Backup") {
+		t.Errorf("expected the snapshot labelled and pinned, ran %v", r.commandLines())
+	}
+
+	copied, err := copySnapshotLabels(ctx, r, "NIXROOT/home", r, "NIXBACKUPS/abyss/home")
+	if err != nil || !reflect.DeepEqual(copied, []string{`NIXBACKUPS/abyss/home@2026-10-18.09h-30-Backup "before nixos upgrade" (pinned)`}) {
+		t.Fatalf("expected the label and pin copied to the backup pool, got %v, %v", copied, err)
+	}
+	if !r.ran("set zfs-backup:pinned=on NIXBACKUPS/abyss/home@2026-10-18.09h-30-Backup") {
+		t.Errorf("expected the copy pinned, ran %v", r.commandLines())
+	}
+	destPinned = true
+	if again, _ := copySnapshotLabels(ctx, r, "NIXROOT/home", r, "NIXBACKUPS/abyss/home"); len(again) != 0 {
+		t.Errorf("a copy already labelled is left alone, changed %v", again)
+	}
+
+	var log strings.Builder
+	info := sampleReportInfo()
+	writeSnapshotLabels(&log, "NIXROOT/home", copied, nil, &info.runFindings)
+	report := generateMarkdownReport(info)
+	if !strings.Contains(report, "## Labelled Snapshots") || !strings.Contains(report, `"before nixos upgrade" (pinned)`) {
+		t.Errorf("expected the labelled snapshot in the report:\n%s", report)
+	}
+}
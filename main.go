@@ -3,10 +3,14 @@ package main
 import (
 	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -341,19 +345,30 @@ func (m model) getStatusText() string {
 	case stateHelp:
 		return "Help"
 	case stateResume:
-		return "Resume Available"
+		return "Resume Interrupted Run"
 	case stateZpoolInfo:
 		return "Pool Information"
 	case stateScope:
 		return "Backup Scope"
 	case stateDoctor:
 		return "Backup Health"
+	case stateCleanup:
+		return "Orphan Cleanup"
+	case statePrunePreview:
+		return "Prune Preview"
+	case stateBookmarks:
+		return "Bookmarks"
+	case stateHistory:
+		return "Run History"
 	case stateMaintenance:
 		return "Pool Maintenance"
 	case stateQuotaManage:
 		return "Dataset Manager"
 	case stateReports:
 		if m.reportViewing {
+			if m.reportTitle == "Comparing Reports" {
+				return "Comparing Reports"
+			}
 			return "Viewing Report"
 		}
 		return "Browse Reports"
@@ -390,7 +405,18 @@ func (m model) getHotkeys() string {
 	case stateScope:
 		return "↑/k up • ↓/j down • space toggle • a all • n none • enter save • esc return"
 	case stateDoctor:
+		return "scroll up/down • c select orphans to clean up • r refresh • esc return"
+	case stateCleanup:
+		if m.cleanupConfirming {
+			return "type DESTROY • enter confirm • esc cancel"
+		}
+		return "space toggle • d dataset • o this & older • y this & newer • a all • n none • x destroy • esc return"
+	case statePrunePreview:
 		return "scroll up/down • r refresh • esc return"
+	case stateBookmarks:
+		return "scroll up/down • r refresh • esc return"
+	case stateHistory:
+		return "↑/k up • ↓/j down • s sort column • r reverse • f failed only • p open report • esc return"
 	case stateMaintenance:
 		return "s start scrub • x stop scrub • r refresh • esc return"
 	case stateQuotaManage:
@@ -399,9 +425,12 @@ func (m model) getHotkeys() string {
 		if m.reportViewing {
 			return "scroll up/down • esc back to list"
 		}
-		return "↑/k up • ↓/j down • enter view • p open report • d delete • esc return"
+		if m.reportPrompt != "" {
+			return "enter apply • esc cancel"
+		}
+		return "↑/k up • ↓/j down • enter view • p open • d delete • space mark • c compare • / search • o operation • f status • h host • t dates • x clear • esc return"
 	case stateResume:
-		return "y resume • n start fresh • esc back"
+		return "↑/k up • ↓/j down • enter/y resume • d discard • n/esc menu"
 	default:
 		return "q quit"
 	}
@@ -446,8 +475,12 @@ var mainMenuItems = []menuItem{
 	{title: "Manage Datasets", description: "View/edit quotas, create and delete ZFS datasets", icon: ""},
 	{title: "Backup Scope", description: "Choose which datasets are backed up - anything else is never touched", icon: ""},
 	{title: "Backup Health Check", description: "Find orphaned snapshots and datasets whose quota is filling with snapshots", icon: ""},
+	{title: "Prune Preview", description: "See which snapshots the next run keeps or prunes, why, and the space it frees", icon: ""},
+	{title: "Bookmarks", description: "List each dataset's bookmarks and which ones the retention rule prunes", icon: ""},
 	{title: "Browse Reports", description: "View previous backup reports with timings, sizes, and error details", icon: ""},
+	{title: "Run History", description: "Sort and filter every finished run by host, pool, duration and outcome", icon: ""},
 	{title: "Recover Failed Backup", description: "Fix broken sync state when backup was interrupted or snapshot was deleted", icon: ""},
+	{title: "Resume Interrupted Run", description: "Pick up a cancelled or interrupted backup, pull or push where it left off", icon: ""},
 	{title: "Unmount Backup Disk", description: "Safely export the backup pool and power off the USB drive", icon: ""},
 	{title: "Help", description: "Show detailed help information about all operations", icon: ""},
 	{title: "Exit", description: "Exit the application", icon: ""},
@@ -478,6 +511,8 @@ type model struct {
 	currentStage     string
 	cancelFunc       context.CancelFunc
 	resumeState      *BackupState
+	resumeStates     []*BackupState // Every interrupted run, newest first
+	resumeIndex      int            // Cursor position in the resume picker
 	totalStages      int
 	eta              time.Duration
 	// Pool selection (shown after backup option selected)
@@ -510,7 +545,31 @@ type model struct {
 	doctorPool       string         // Pool being checked
 	doctorViewport   viewport.Model // Scrollable viewport for the report
 	doctorReady      bool           // Is the report ready?
-	doctorProblems   int            // Number of issue groups found
+	doctorProblems   int            // Number of findings
+	// Orphan selection
+	cleanupPool        string            // Pool whose orphans are listed
+	cleanupDecisions   []destroyDecision // Every orphan with its vetting, oldest first
+	cleanupSelected    map[string]bool   // Orphans selected for destruction, by name
+	cleanupIndex       int               // Selection cursor
+	cleanupReclaim     int64             // Estimated space freed by the selection; -1 while estimating
+	cleanupEstimateErr string            // Why the last estimate failed
+	cleanupSeq         int               // Selection generation, to drop stale estimates
+	cleanupConfirming  bool              // Is the DESTROY prompt open?
+	cleanupDestroying  bool              // Is a destroy running?
+	cleanupInput       textinput.Model   // Input for the DESTROY prompt
+	cleanupMessage     string            // Outcome of the last action
+	// Prune preview
+	prunePool          string         // Source pool being previewed
+	pruneBackupPool    string         // Backup pool previewed with it, if imported
+	pruneViewport      viewport.Model // Scrollable viewport for the plan
+	pruneReady         bool           // Is the plan ready?
+	prunePruned        int            // Snapshots the next run would prune
+	// Bookmarks
+	bookmarksPool       string         // Source pool being listed
+	bookmarksBackupPool string         // Backup pool listed with it, if imported
+	bookmarksViewport   viewport.Model // Scrollable viewport for the listing
+	bookmarksReady      bool           // Is the listing ready?
+	bookmarksExcess     int            // Bookmarks beyond the retention rule
 	// Maintenance
 	maintenancePool    string         // Selected pool for maintenance
 	maintenanceAction  string         // Current maintenance action
@@ -519,6 +578,7 @@ type model struct {
 	// Result viewport
 	resultViewport     viewport.Model // Scrollable viewport for result content
 	resultReady        bool           // Is result viewport ready?
+	resultContent      string         // Text shown in the result viewport
 	// Prepare operation phases
 	preparePhase       int            // 0 = device path input, 1 = pool name input
 	// Remote backup
@@ -545,13 +605,27 @@ type model struct {
 	// Dataset deletion
 	datasetDeleting    bool           // Are we confirming a delete?
 	// Report browser
-	reportFiles        []reportEntry  // List of report files
-	reportIndex        int            // Selection cursor in report list
-	reportViewport     viewport.Model // Viewport for viewing a report
-	reportViewing      bool           // Are we viewing a report (vs listing)?
+	reportFiles        []reportEntry   // List of report files
+	reportIndex        int             // Selection cursor in report list
+	reportViewport     viewport.Model  // Viewport for viewing a report
+	reportViewing      bool            // Are we viewing a report (vs listing)?
+	reportTitle        string          // Title over the viewport: a report or a comparison
+	reportFilter       reportFilter    // Filters narrowing the report list
+	reportFound        map[string]bool // Reports whose markdown contains the search
+	reportMarks        []string        // Reports marked for comparison, at most two
+	reportPrompt       string          // Open prompt: "search", "range" or ""
+	reportPromptErr    string          // Why the last prompt value was rejected
+	reportInput        textinput.Model // Input for the open prompt
+	// Run history
+	historyRecords     []historyRecord // Every recorded run
+	historyIndex       int             // Selection cursor in the table
+	historySort        int             // Index into historyColumns
+	historyAscending   bool            // Sort direction (newest first by default)
+	historyFailedOnly  bool            // Hide successful runs
 	// Last generated report (for opening from result screen)
 	lastReportMd       string         // Path to last generated markdown report
 	lastReportPdf      string         // Path to last generated PDF report
+	lastReportHTML     string         // Path to last generated HTML report
 }
 
 // =============================================================================
@@ -559,12 +633,49 @@ type model struct {
 // =============================================================================
 
 // quotaEntry holds quota information for a single dataset
-// reportEntry represents a report file in the report browser
+// reportEntry represents one run's report in the report browser, in every
+// format it was written in
 type reportEntry struct {
-	Name    string    // Filename (without path)
-	Path    string    // Full path to the .md file
-	PdfPath string    // Full path to the .pdf file (may not exist)
-	ModTime time.Time // Last modified time
+	Name     string    // Base filename (without extension)
+	Path     string    // Full path to the .md file (may not exist)
+	PdfPath  string    // Full path to the .pdf file (may not exist)
+	HTMLPath string    // Full path to the .html file (may not exist)
+	JSONPath string    // Full path to the .json file (may not exist)
+	ModTime  time.Time // Last modified time
+	Archive  string    // Monthly archive holding the report, if it was rotated
+	Status   string    // Run outcome read from the report, empty if unreadable
+	Host     string    // Remote host the run involved, or this machine
+}
+
+// viewPath is the file the in-app viewer shows: the markdown, or failing that
+// the JSON.
+func (r reportEntry) viewPath() string {
+	if r.Path != "" {
+		return r.Path
+	}
+	return r.JSONPath
+}
+
+// openPath is the file opened in the desktop viewer: the PDF, then HTML, then
+// markdown.
+func (r reportEntry) openPath() string {
+	for _, path := range []string{r.PdfPath, r.HTMLPath, r.Path} {
+		if path != "" {
+			return path
+		}
+	}
+	return r.JSONPath
+}
+
+// files lists every file belonging to the report.
+func (r reportEntry) files() []string {
+	var files []string
+	for _, path := range []string{r.Path, r.PdfPath, r.HTMLPath, r.JSONPath} {
+		if path != "" {
+			files = append(files, path)
+		}
+	}
+	return files
 }
 
 // reportsLoadedMsg is sent when report files are loaded
@@ -575,10 +686,84 @@ type reportsLoadedMsg struct {
 
 // reportContentMsg is sent when a report's content is loaded
 type reportContentMsg struct {
+	title   string // Defaults to "Backup Report"
 	content string
 	err     error
 }
 
+// listReportEntries groups the reports in dir by run, newest first, including
+// those rotated into monthly archives.
+func listReportEntries(dir string) ([]reportEntry, error) {
+	reports, err := listLooseReportEntries(dir)
+	if err != nil {
+		return nil, err
+	}
+	archived, err := listArchivedReportEntries(filepath.Join(dir, reportArchiveDirName))
+	if err != nil {
+		return nil, err
+	}
+	reports = append(reports, archived...)
+	sort.SliceStable(reports, func(i, j int) bool {
+		return reports[i].ModTime.After(reports[j].ModTime)
+	})
+	return reports, nil
+}
+
+// listLooseReportEntries groups the report files directly in dir by run,
+// newest first.
+func listLooseReportEntries(dir string) ([]reportEntry, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*reportEntry)
+	var reports []*reportEntry
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name := e.Name()
+		ext := filepath.Ext(name)
+		baseName := strings.TrimSuffix(name, ext)
+		path := filepath.Join(dir, name)
+
+		entry := byName[baseName]
+		if entry == nil {
+			entry = &reportEntry{Name: baseName}
+		}
+		switch ext {
+		case ".md":
+			entry.Path = path
+		case ".pdf":
+			entry.PdfPath = path
+		case ".html":
+			entry.HTMLPath = path
+		case ".json":
+			entry.JSONPath = path
+		default:
+			continue
+		}
+		if byName[baseName] == nil {
+			byName[baseName] = entry
+			reports = append(reports, entry)
+		}
+
+		if info, err := e.Info(); err == nil && info.ModTime().After(entry.ModTime) {
+			entry.ModTime = info.ModTime()
+		}
+	}
+
+	sort.SliceStable(reports, func(i, j int) bool {
+		return reports[i].ModTime.After(reports[j].ModTime)
+	})
+	result := make([]reportEntry, 0, len(reports))
+	for _, r := range reports {
+		result = append(result, *r)
+	}
+	return result, nil
+}
+
 // loadReportFiles scans the reports directory and returns entries
 func loadReportFiles() tea.Cmd {
 	return func() tea.Msg {
@@ -587,48 +772,11 @@ func loadReportFiles() tea.Cmd {
 			return reportsLoadedMsg{err: err}
 		}
 
-		entries, err := os.ReadDir(dir)
+		reports, err := listReportEntries(dir)
 		if err != nil {
 			return reportsLoadedMsg{err: err}
 		}
-
-		var reports []reportEntry
-		seen := make(map[string]bool)
-		// Walk in reverse so newest files are first
-		for i := len(entries) - 1; i >= 0; i-- {
-			e := entries[i]
-			if e.IsDir() {
-				continue
-			}
-			name := e.Name()
-			if !strings.HasSuffix(name, ".md") {
-				continue
-			}
-			baseName := strings.TrimSuffix(name, ".md")
-			if seen[baseName] {
-				continue
-			}
-			seen[baseName] = true
-
-			info, _ := e.Info()
-			modTime := time.Time{}
-			if info != nil {
-				modTime = info.ModTime()
-			}
-
-			pdfPath := filepath.Join(dir, baseName+".pdf")
-			if _, err := os.Stat(pdfPath); err != nil {
-				pdfPath = ""
-			}
-
-			reports = append(reports, reportEntry{
-				Name:    baseName,
-				Path:    filepath.Join(dir, name),
-				PdfPath: pdfPath,
-				ModTime: modTime,
-			})
-		}
-
+		summariseReports(reports, getLocalHostname())
 		return reportsLoadedMsg{reports: reports}
 	}
 }
@@ -636,7 +784,7 @@ func loadReportFiles() tea.Cmd {
 // loadReportContent reads a report file for display
 func loadReportContent(path string) tea.Cmd {
 	return func() tea.Msg {
-		data, err := os.ReadFile(path)
+		data, err := readReportFile(path)
 		if err != nil {
 			return reportContentMsg{err: err}
 		}
@@ -969,6 +1117,40 @@ func getAllPools() []string {
 	return pools
 }
 
+// beginResume restores a saved run's endpoints and goes through the same pool
+// access the original run did, so a locked pool still prompts for its key.
+func (m model) beginResume(st *BackupState) (model, tea.Cmd) {
+	m.resumeState = st
+	m.operation = st.Operation
+	m.isRemote = st.RemoteHost != ""
+
+	switch st.Operation {
+	case "remote-backup":
+		m.remoteHost = st.RemoteHost
+		m.remoteDataset = strings.TrimPrefix(st.Source, remoteEndpoint(st.RemoteHost, ""))
+		m.destPool = st.Destination
+	case "push-backup":
+		m.remoteHost = st.RemoteHost
+		m.sourcePool = st.Source
+		m.remoteDataset = strings.TrimPrefix(st.Destination, remoteEndpoint(st.RemoteHost, ""))
+	default:
+		m.sourcePool = st.Source
+		m.destPool = st.Destination
+	}
+
+	// States saved before runs were keyed record no pools - ask for them.
+	if st.Source == "" || st.Destination == "" {
+		m.state = stateMenu
+		m.startPoolSelection(st.Operation != "remote-backup")
+		return m, nil
+	}
+
+	if st.Operation == "push-backup" {
+		return m, m.preparePoolAccess(m.sourcePool)
+	}
+	return m, m.preparePoolAccess(m.destPool)
+}
+
 // statePoolSelect is a new state for pool selection
 const statePoolSelect sessionState = 100
 
@@ -1156,10 +1338,12 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 						// Backup scope and the health check act on the source
 						// pool alone, so there is no destination to pick.
-						if m.operation == "scope" || m.operation == "doctor" {
+						if m.operation == "scope" || m.operation == "doctor" || m.operation == "prune-preview" || m.operation == "bookmarks" {
 							m.selectingPool = false
 							m.scopePool = selectedPool
 							m.doctorPool = selectedPool
+							m.prunePool = selectedPool
+							m.bookmarksPool = selectedPool
 							return m, m.preparePoolAccess(selectedPool)
 						}
 
@@ -1360,15 +1544,36 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.operation = "doctor"
 					m.startPoolSelection(true)
 					return m, nil
+				case "Prune Preview":
+					m.operation = "prune-preview"
+					m.startPoolSelection(true)
+					return m, nil
+				case "Bookmarks":
+					m.operation = "bookmarks"
+					m.startPoolSelection(true)
+					return m, nil
 				case "Browse Reports":
 					m.state = stateReports
 					m.reportViewing = false
 					m.reportIndex = 0
+					m.reportFilter = reportFilter{}
+					m.reportFound = nil
+					m.reportMarks = nil
+					m.reportPrompt = ""
 					return m, loadReportFiles()
+				case "Run History":
+					m.state = stateHistory
+					m.historyIndex = 0
+					return m, loadHistory()
 				case "Recover Failed Backup":
 					m.operation = "recover"
 					m.startPoolSelection(true)
 					return m, nil
+				case "Resume Interrupted Run":
+					m.resumeStates, _ = ListBackupStates()
+					m.resumeIndex = 0
+					m.state = stateResume
+					return m, nil
 				case "Unmount Backup Disk":
 					m.operation = "unmount"
 					m.startPoolSelection(false)
@@ -1510,13 +1715,37 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		} else if m.state == stateResume {
 			switch msg.String() {
-			case "y", "Y":
-				// Resume the backup - check if pool still needs unlock
-				m.operation = m.resumeState.Operation
-				return m, m.preparePoolAccess(m.destPool)
+			case "up", "k":
+				if m.resumeIndex > 0 {
+					m.resumeIndex--
+				}
+				return m, nil
+			case "down", "j":
+				if m.resumeIndex < len(m.resumeStates)-1 {
+					m.resumeIndex++
+				}
+				return m, nil
+			case "y", "Y", "enter":
+				if m.resumeIndex < len(m.resumeStates) {
+					return m.beginResume(m.resumeStates[m.resumeIndex])
+				}
+				return m, nil
+			case "d", "D":
+				// Discard the selected state; a fresh run starts from scratch
+				if m.resumeIndex < len(m.resumeStates) {
+					_ = ClearBackupState(m.resumeStates[m.resumeIndex].ID)
+					m.resumeStates, _ = ListBackupStates()
+					if m.resumeIndex >= len(m.resumeStates) && m.resumeIndex > 0 {
+						m.resumeIndex--
+					}
+					if len(m.resumeStates) == 0 {
+						m.state = stateMenu
+					}
+				}
+				return m, nil
 			case "n", "N", "esc":
-				// Start fresh, clear state
-				_ = ClearBackupState()
+				// Start fresh - the state stays on disk until a run with the
+				// same operation and pools replaces it, or it is discarded
 				m.resumeState = nil
 				m.state = stateMenu
 				return m, nil
@@ -1534,6 +1763,8 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				// Open report (PDF or markdown fallback)
 				if m.lastReportPdf != "" {
 					_ = openFileForUser(m.lastReportPdf)
+				} else if m.lastReportHTML != "" {
+					_ = openFileForUser(m.lastReportHTML)
 				} else if m.lastReportMd != "" {
 					_ = openFileForUser(m.lastReportMd)
 				}
@@ -1553,6 +1784,14 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m.updateScopeScreen(msg)
 		} else if m.state == stateDoctor {
 			return m.updateDoctorScreen(msg)
+		} else if m.state == stateCleanup {
+			return m.updateCleanupScreen(msg)
+		} else if m.state == statePrunePreview {
+			return m.updatePrunePreviewScreen(msg)
+		} else if m.state == stateBookmarks {
+			return m.updateBookmarksScreen(msg)
+		} else if m.state == stateHistory {
+			return m.updateHistoryScreen(msg)
 		} else if m.state == stateZpoolInfo {
 			switch msg.String() {
 			case "esc", "q":
@@ -1583,58 +1822,8 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.reportViewport, cmd = m.reportViewport.Update(msg)
 					return m, cmd
 				}
-			} else {
-				// Browsing report list
-				switch msg.String() {
-				case "up", "k":
-					if m.reportIndex > 0 {
-						m.reportIndex--
-					}
-					return m, nil
-				case "down", "j":
-					if m.reportIndex < len(m.reportFiles)-1 {
-						m.reportIndex++
-					}
-					return m, nil
-				case "enter":
-					if len(m.reportFiles) > 0 {
-						return m, loadReportContent(m.reportFiles[m.reportIndex].Path)
-					}
-					return m, nil
-				case "p":
-					// Open report (PDF or markdown fallback)
-					if len(m.reportFiles) > 0 {
-						entry := m.reportFiles[m.reportIndex]
-						if entry.PdfPath != "" {
-							_ = openFileForUser(entry.PdfPath)
-						} else {
-							_ = openFileForUser(entry.Path)
-						}
-					}
-					return m, nil
-				case "d":
-					// Delete selected report
-					if len(m.reportFiles) > 0 {
-						entry := m.reportFiles[m.reportIndex]
-						_ = os.Remove(entry.Path)
-						if entry.PdfPath != "" {
-							_ = os.Remove(entry.PdfPath)
-						}
-						if m.reportIndex >= len(m.reportFiles)-1 && m.reportIndex > 0 {
-							m.reportIndex--
-						}
-						return m, loadReportFiles()
-					}
-					return m, nil
-				case "esc", "q":
-					m.state = stateMenu
-					return m, nil
-				case "ctrl+c":
-					m.quitting = true
-					return m, tea.Quit
-				}
-				return m, nil
 			}
+			return m.updateReportsList(msg)
 		} else if m.state == stateMaintenance {
 			switch msg.String() {
 			case "esc", "q":
@@ -1865,6 +2054,14 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.state = stateDoctor
 			m.doctorReady = false
 			return m, tea.Batch(m.spinner.Tick, loadDoctorReport(m.doctorPool))
+		case "prune-preview":
+			m.state = statePrunePreview
+			m.pruneReady = false
+			return m, tea.Batch(m.spinner.Tick, loadPrunePreview(m.prunePool))
+		case "bookmarks":
+			m.state = stateBookmarks
+			m.bookmarksReady = false
+			return m, tea.Batch(m.spinner.Tick, loadBookmarks(m.bookmarksPool))
 		case "maintenance":
 			return m, m.loadMaintenanceStatus()
 		case "backup", "force-backup", "recover", "remote-backup", "push-backup":
@@ -1907,6 +2104,16 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.scopeMessage = "Saved. Datasets outside the scope will not be snapshotted again."
 		return m, nil
 
+	case historyLoadedMsg:
+		if msg.err != nil {
+			m.state = stateResult
+			m.err = msg.err
+			m.message = ""
+			return m, nil
+		}
+		m.historyRecords = msg.records
+		return m, nil
+
 	case doctorLoadedMsg:
 		if msg.err != nil {
 			m.state = stateResult
@@ -1921,6 +2128,74 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.doctorReady = true
 		return m, nil
 
+	case prunePreviewLoadedMsg:
+		if msg.err != nil {
+			m.state = stateResult
+			m.err = msg.err
+			m.message = ""
+			return m, nil
+		}
+		m.state = statePrunePreview
+		m.prunePool = msg.pool
+		m.pruneBackupPool = msg.backupPool
+		m.prunePruned = msg.pruned
+		m.pruneViewport = newReportViewport(m.width, m.height, msg.content)
+		m.pruneReady = true
+		return m, nil
+
+	case bookmarksLoadedMsg:
+		if msg.err != nil {
+			m.state = stateResult
+			m.err = msg.err
+			m.message = ""
+			return m, nil
+		}
+		m.state = stateBookmarks
+		m.bookmarksPool = msg.pool
+		m.bookmarksBackupPool = msg.backupPool
+		m.bookmarksExcess = msg.excess
+		m.bookmarksViewport = newReportViewport(m.width, m.height, msg.content)
+		m.bookmarksReady = true
+		return m, nil
+
+	case orphansLoadedMsg:
+		if msg.err != nil {
+			m.state = stateResult
+			m.err = msg.err
+			m.message = ""
+			return m, nil
+		}
+		m.state = stateCleanup
+		m.cleanupPool = msg.pool
+		m.cleanupDecisions = msg.decisions
+		m.cleanupSelected = map[string]bool{}
+		m.cleanupIndex = min(m.cleanupIndex, max(len(msg.decisions)-1, 0))
+		m.cleanupSeq++ // an estimate still running is for the old list
+		m.cleanupReclaim = 0
+		m.cleanupEstimateErr = ""
+		return m, nil
+
+	case reclaimEstimateMsg:
+		if msg.seq != m.cleanupSeq {
+			return m, nil // the selection has changed since
+		}
+		m.cleanupReclaim = msg.bytes
+		if msg.err != nil {
+			m.cleanupEstimateErr = msg.err.Error()
+		}
+		return m, nil
+
+	case orphansDestroyedMsg:
+		m.cleanupDestroying = false
+		m.cleanupMessage = fmt.Sprintf("Destroyed %d snapshot(s).", len(msg.destroyed))
+		if len(msg.skipped) > 0 {
+			m.cleanupMessage += fmt.Sprintf(" Skipped %d that failed the safety checks since loading.", len(msg.skipped))
+		}
+		if len(msg.failures) > 0 {
+			m.cleanupMessage += " Failed: " + strings.Join(msg.failures, "; ")
+		}
+		return m, loadOrphanSelection(m.cleanupPool)
+
 	case maintenanceStatusMsg:
 		if msg.err != nil {
 			m.state = stateResult
@@ -2011,10 +2286,18 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 		m.reportFiles = msg.reports
-		m.reportIndex = 0
+		m.reportIndex = max(min(m.reportIndex, len(m.visibleReports())-1), 0)
 		m.reportViewing = false
 		return m, nil
 
+	case reportSearchMsg:
+		// Ignore a search overtaken by a newer one
+		if msg.query == m.reportFilter.Query {
+			m.reportFound = msg.found
+			m.reportIndex = 0
+		}
+		return m, nil
+
 	case reportContentMsg:
 		if msg.err != nil {
 			m.state = stateResult
@@ -2032,6 +2315,10 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		m.reportViewport = viewport.New(viewportWidth, viewportHeight)
 		m.reportViewport.SetContent(msg.content)
+		m.reportTitle = msg.title
+		if m.reportTitle == "" {
+			m.reportTitle = "Backup Report"
+		}
 		m.reportViewport.Style = lipgloss.NewStyle().
 			Border(lipgloss.RoundedBorder()).
 			BorderForeground(colorHighlight4).
@@ -2081,11 +2368,19 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		// Build result content with dataset dashboard appended
 		resultContent := msg.message
+		if len(msg.findings.Anomalies) > 0 {
+			resultContent += "\n" + renderChangeRateAnomalies(msg.findings.Anomalies) + "\n"
+		}
+		if labelled := msg.findings.Labelled; len(labelled) > 0 {
+			resultContent += "\n" + renderLabelledSnapshots(labelled) + "\n"
+		}
 		if len(m.datasetProgress) > 0 {
 			resultContent += "\n" + m.renderDatasetReport(viewportWidth)
 		}
 
-		// Write report to markdown and PDF for all operations
+		// Writing the report, the history and the rotation all touch the
+		// disk, so they run in the background and fill in the result screen
+		// when done.
 		reportInfo := ReportInfo{
 			Operation:       m.operation,
 			SourcePool:      m.sourcePool,
@@ -2096,26 +2391,15 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			DatasetProgress: m.datasetProgress,
 			Success:         msg.err == nil,
 			OperationLog:    msg.message,
-			SourceInventory: collectPoolInventory(m.sourcePool),
-			DestInventory:   collectPoolInventory(m.destPool),
+			runFindings:     msg.findings,
 		}
 		if msg.err != nil {
 			reportInfo.ErrorMessage = msg.err.Error()
+			var incomplete *incompleteError
+			reportInfo.Partial = errors.As(msg.err, &incomplete)
 		}
-		mdPath, pdfPath, reportErr := writeBackupReport(reportInfo)
-		m.lastReportMd = ""
-		m.lastReportPdf = ""
-		if reportErr == nil {
-			m.lastReportMd = mdPath
-			m.lastReportPdf = pdfPath
-			resultContent += "\n\nReport saved: " + mdPath
-			if pdfPath != "" {
-				resultContent += "\nPDF report:   " + pdfPath
-				resultContent += "\n\nPress 'p' to open the report"
-			}
-		} else {
-			resultContent += "\n\nWarning: could not write report: " + reportErr.Error()
-		}
+		m.lastReportMd, m.lastReportPdf, m.lastReportHTML = "", "", ""
+		resultContent += "\n\nWriting report..."
 
 		m.resultViewport = viewport.New(viewportWidth, viewportHeight)
 		m.resultViewport.SetContent(resultContent)
@@ -2123,14 +2407,35 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			Border(lipgloss.RoundedBorder()).
 			BorderForeground(colorHighlight4).
 			Padding(0, 1)
+		m.resultContent = resultContent
 		m.resultReady = true
 		m.backupState = nil
+		return m, writeRunReportCmd(reportInfo)
 
-		// Clear state file if successful
-		if msg.err == nil {
-			_ = ClearBackupState()
+	case runReportMsg:
+		m.lastReportMd = msg.files.Markdown
+		m.lastReportPdf = msg.files.PDF
+		m.lastReportHTML = msg.files.HTML
+		if m.state == stateResult && m.resultReady {
+			m.resultContent = strings.TrimSuffix(m.resultContent, "\n\nWriting report...") + msg.summary
+			m.resultViewport.SetContent(m.resultContent)
 		}
 
+		// Only replication runs notify or export metrics; unmounting or
+		// preparing a disk is something the user is watching.
+		switch msg.info.Operation {
+		case "backup", "force-backup", "remote-backup", "push-backup":
+			return m, tea.Batch(sendRunNotifications(msg.info, msg.files.Markdown), writeRunMetricsCmd(msg.info))
+		}
+		return m, nil
+
+	case postRunMsg:
+		if len(msg.errs) > 0 && m.resultReady {
+			for _, err := range msg.errs {
+				m.resultContent += "\nWarning: " + err.Error()
+			}
+			m.resultViewport.SetContent(m.resultContent)
+		}
 		return m, nil
 	}
 
@@ -2144,6 +2449,14 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if m.quotaEditing || m.datasetCreating {
 			m.quotaInput, cmd = m.quotaInput.Update(msg)
 		}
+	case stateReports:
+		if m.reportPrompt != "" {
+			m.reportInput, cmd = m.reportInput.Update(msg)
+		}
+	case stateCleanup:
+		if m.cleanupConfirming {
+			m.cleanupInput, cmd = m.cleanupInput.Update(msg)
+		}
 	}
 
 	return m, cmd
@@ -2243,6 +2556,14 @@ func (m model) renderContentNopad(width int) string {
 		content.WriteString(m.renderScopeContent(width))
 	case stateDoctor:
 		content.WriteString(m.renderDoctorContent(width))
+	case stateCleanup:
+		content.WriteString(m.renderCleanupContent(width))
+	case statePrunePreview:
+		content.WriteString(m.renderPrunePreviewContent(width))
+	case stateBookmarks:
+		content.WriteString(m.renderBookmarksContent(width))
+	case stateHistory:
+		content.WriteString(m.renderHistoryContent(width))
 	case stateMaintenance:
 		content.WriteString(m.renderMaintenanceContent(width))
 	case stateQuotaManage:
@@ -2970,7 +3291,7 @@ func (m model) renderReportsContent(width int) string {
 		contentTitle := lipgloss.NewStyle().
 			Width(width).
 			Align(lipgloss.Center).
-			Render(selectedItemStyle.Render("Backup Report"))
+			Render(selectedItemStyle.Render(m.reportTitle))
 		b.WriteString(contentTitle + "\n\n")
 		b.WriteString(m.reportViewport.View())
 		return b.String()
@@ -2998,33 +3319,45 @@ func (m model) renderReportsContent(width int) string {
 		return b.String()
 	}
 
+	visible := m.visibleReports()
+	count := fmt.Sprintf("%d report(s) found", len(m.reportFiles))
+	if m.reportFilter.active() {
+		count = fmt.Sprintf("%d of %d report(s) • %s", len(visible), len(m.reportFiles), m.reportFilter.describe())
+	}
+	if len(m.reportMarks) > 0 {
+		count += fmt.Sprintf(" • %d marked", len(m.reportMarks))
+	}
 	countMsg := lipgloss.NewStyle().
 		Width(width).
 		Align(lipgloss.Center).
-		Render(infoStyle.Render(fmt.Sprintf("%d report(s) found", len(m.reportFiles))))
+		Render(infoStyle.Render(count))
 	b.WriteString(countMsg + "\n\n")
 
-	// Show report list
-	for i, r := range m.reportFiles {
-		cursor := "  "
-		style := subtitleStyle
-		if i == m.reportIndex {
-			cursor = "> "
-			style = selectedItemStyle
+	if m.reportPrompt != "" {
+		label := "Search reports: "
+		if m.reportPrompt == "range" {
+			label = "Date range: "
 		}
-
-		// Format: name + date + PDF indicator
-		line := cursor + r.Name
-		if !r.ModTime.IsZero() {
-			line += "  " + r.ModTime.Format("02 Jan 15:04")
-		}
-		if r.PdfPath != "" {
-			line += "  [PDF]"
+		b.WriteString("  " + subtitleStyle.Render(label) + m.reportInput.View() + "\n")
+		if m.reportPromptErr != "" {
+			b.WriteString("  " + errorStyle.Render(m.reportPromptErr) + "\n")
 		}
+		b.WriteString("\n")
+	}
 
+	if len(visible) == 0 {
+		b.WriteString(lipgloss.NewStyle().
+			Width(width).
+			Align(lipgloss.Center).
+			Render(subtitleStyle.Render("No reports match the filters. Press x to clear them.")) + "\n")
+		return b.String()
+	}
+
+	// Show report list
+	for i, r := range visible {
 		row := lipgloss.NewStyle().
 			Width(width).
-			Render(style.Render(line))
+			Render(renderReportRow(r, i == m.reportIndex, m.reportMarked(r.Name)))
 		b.WriteString(row + "\n")
 	}
 
@@ -3037,46 +3370,68 @@ func (m model) renderResumeContent(width int) string {
 	contentTitle := lipgloss.NewStyle().
 		Width(width).
 		Align(lipgloss.Center).
-		Render(selectedItemStyle.Render("Resume Previous Backup"))
+		Render(selectedItemStyle.Render("Resume Interrupted Run"))
 	b.WriteString(contentTitle + "\n\n")
 
-	if m.resumeState != nil {
-		info1 := lipgloss.NewStyle().
+	if len(m.resumeStates) == 0 {
+		emptyMsg := lipgloss.NewStyle().
 			Width(width).
 			Align(lipgloss.Center).
-			Render(infoStyle.Render(fmt.Sprintf("Found incomplete %s operation from:", m.resumeState.Operation)))
-		b.WriteString(info1 + "\n")
+			Render(infoStyle.Render("No interrupted runs. Nothing to resume."))
+		b.WriteString(emptyMsg + "\n")
+		return b.String()
+	}
 
-		info2 := lipgloss.NewStyle().
-			Width(width).
-			Align(lipgloss.Center).
-			Render(infoStyle.Render(fmt.Sprintf("Started: %s", m.resumeState.StartTime.Format("2006-01-02 15:04:05"))))
-		b.WriteString(info2 + "\n")
+	countMsg := lipgloss.NewStyle().
+		Width(width).
+		Align(lipgloss.Center).
+		Render(infoStyle.Render(fmt.Sprintf("Found %d incomplete operation(s)", len(m.resumeStates))))
+	b.WriteString(countMsg + "\n\n")
+
+	for i, st := range m.resumeStates {
+		cursor := "  "
+		style := subtitleStyle
+		if i == m.resumeIndex {
+			cursor = "> "
+			style = selectedItemStyle
+		}
 
-		info3 := lipgloss.NewStyle().
+		line := fmt.Sprintf("%s%-14s %s  %s  %d stage(s) done",
+			cursor, st.Operation, describeStateEndpoints(st),
+			st.StartTime.Format("02 Jan 15:04"), len(st.CompletedStages))
+		if st.Cancelled {
+			line += "  [cancelled]"
+		}
+
+		row := lipgloss.NewStyle().
 			Width(width).
-			Align(lipgloss.Center).
-			Render(infoStyle.Render(fmt.Sprintf("Completed stages: %d", len(m.resumeState.CompletedStages))))
-		b.WriteString(info3 + "\n\n")
+			Render(style.Render(line))
+		b.WriteString(row + "\n")
+	}
 
+	if m.resumeIndex < len(m.resumeStates) {
+		st := m.resumeStates[m.resumeIndex]
 		var warningText string
-		if m.resumeState.Cancelled {
-			warningText = "This backup was cancelled."
+		if st.Cancelled {
+			warningText = "This run was cancelled."
 		} else {
-			warningText = "This backup was interrupted."
+			warningText = "This run was interrupted."
+		}
+		if st.CurrentStage != "" {
+			warningText += fmt.Sprintf(" Last stage: %s.", st.CurrentStage)
 		}
 		warning := lipgloss.NewStyle().
 			Width(width).
 			Align(lipgloss.Center).
 			Render(warningStyle.Render(warningText))
-		b.WriteString(warning + "\n\n")
-	}
+		b.WriteString("\n" + warning + "\n")
 
-	question := lipgloss.NewStyle().
-		Width(width).
-		Align(lipgloss.Center).
-		Render(infoStyle.Render("Would you like to resume from where it left off?"))
-	b.WriteString(question + "\n")
+		id := lipgloss.NewStyle().
+			Width(width).
+			Align(lipgloss.Center).
+			Render(subtitleStyle.Render("ID: " + st.ID + "  (zfs-backup resume " + st.ID + ")"))
+		b.WriteString(id + "\n")
+	}
 
 	return b.String()
 }
@@ -3862,8 +4217,64 @@ func openURL(url string) tea.Cmd {
 }
 
 type operationResultMsg struct {
-	message string
-	err     error
+	message  string
+	findings runFindings // set by the backup runs
+	err      error
+}
+
+// runReportMsg carries a finished TUI run's report: the run as reported,
+// with its comparison with the previous run, the files written and the
+// lines the result screen shows about them.
+type runReportMsg struct {
+	info    ReportInfo
+	files   reportFiles
+	summary string
+}
+
+// writeRunReportCmd writes a TUI run's report in the background, records the
+// run in the history and rotates old reports, so a large reports directory or
+// history never freezes the result screen.
+func writeRunReportCmd(info ReportInfo) tea.Cmd {
+	return func() tea.Msg {
+		info.SourceInventory = collectPoolInventory(info.SourcePool)
+		info.DestInventory = collectPoolInventory(info.DestPool)
+		info.Comparison = compareWithPreviousRun(info)
+		info.DestStats = peekDestinationStats(info.DestPool)
+		info.PoolHistory = loadPoolUsageHistory(info)
+
+		var summary strings.Builder
+		files, err := writeBackupReport(info)
+		if err == nil {
+			summary.WriteString("\n\nReport saved: " + files.Markdown)
+			if files.PDF != "" {
+				summary.WriteString("\nPDF report:   " + files.PDF)
+			}
+			if files.HTML != "" {
+				summary.WriteString("\nHTML report:  " + files.HTML)
+			}
+			if files.JSON != "" {
+				summary.WriteString("\nJSON report:  " + files.JSON)
+			}
+			if files.PDF != "" || files.HTML != "" {
+				summary.WriteString("\n\nPress 'p' to open the report")
+			}
+		} else {
+			summary.WriteString("\n\nWarning: could not write report: " + err.Error())
+		}
+		if err := appendRunHistory(info, files.Markdown); err != nil {
+			summary.WriteString("\nWarning: " + err.Error())
+		}
+		if _, err := rotateReports(time.Now()); err != nil {
+			summary.WriteString("\nWarning: could not rotate reports: " + err.Error())
+		}
+		return runReportMsg{info: info, files: files, summary: summary.String()}
+	}
+}
+
+// postRunMsg reports what failed of a finished run's notifications and
+// metrics.
+type postRunMsg struct {
+	errs []error
 }
 
 type progressMsg struct {
@@ -4041,9 +4452,9 @@ func main() {
 
 	// Check for incomplete backup
 	m := initialModel()
-	if state, err := LoadBackupState(); err == nil && state != nil {
-		// Found incomplete backup
-		m.resumeState = state
+	if states, err := ListBackupStates(); err == nil && len(states) > 0 {
+		// Found incomplete runs - offer them before the menu
+		m.resumeStates = states
 		m.state = stateResume
 	}
 
@@ -4055,24 +4466,55 @@ func main() {
 }
 
 func handleCLI() {
-	arg := os.Args[1]
-	rest := os.Args[2:]
+	args, jsonTarget := extractJSONFlag(os.Args[1:])
+	if jsonTarget != "" {
+		stream, err := openEventStream(jsonTarget)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+			os.Exit(1)
+		}
+		runEvents = stream
+		if jsonTarget == "true" || jsonTarget == "-" {
+			cliOut = os.Stderr
+		}
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: --json needs a command to run"))
+		os.Exit(1)
+	}
+
+	arg := args[0]
+	rest := args[1:]
 	switch arg {
 	case "--backup", "-b":
-		fmt.Println(statusStyle.Render("Running incremental backup..."))
+		fmt.Fprintln(cliOut, statusStyle.Render("Running incremental backup..."))
 		runBackupSync()
 	case "--force-backup", "-f":
-		fmt.Println(warningStyle.Render("Running force backup..."))
+		fmt.Fprintln(cliOut, warningStyle.Render("Running force backup..."))
 		runForceBackupSync()
 	case "--unmount", "-u":
-		fmt.Println(infoStyle.Render("Unmounting backup disk..."))
+		fmt.Fprintln(cliOut, infoStyle.Render("Unmounting backup disk..."))
 		runUnmountSync()
+	case "history":
+		os.Exit(handleHistoryCLI(rest))
 	case "doctor":
 		os.Exit(handleDoctorCLI(rest))
 	case "cleanup-orphans":
 		os.Exit(handleCleanupCLI(rest))
+	case "release-retention":
+		os.Exit(handleReleaseRetentionCLI(rest))
+	case "prune":
+		os.Exit(handlePruneCLI(rest))
+	case "bookmarks":
+		os.Exit(handleBookmarksCLI(rest))
+	case "snapshot":
+		os.Exit(handleSnapshotCLI(rest))
 	case "scope":
 		os.Exit(handleScopeCLI(rest))
+	case "resume":
+		os.Exit(handleResumeCLI(rest))
+	case "attest":
+		os.Exit(handleAttestCLI(rest))
 	case "--version", "-v":
 		fmt.Println(appVersion)
 	case "--help", "-h":
@@ -4124,52 +4566,350 @@ func resolveCLIPool(flags map[string]string) (string, error) {
 	return source, nil
 }
 
-// handleDoctorCLI runs the read-only health check.
-func handleDoctorCLI(args []string) int {
-	flags, err := parseFlags(args, map[string]bool{"pool": true})
+// resolveCLIBackupPool returns --pool, or --backup-pool, or the auto-detected
+// backup pool, for the subcommands that work on the backup pool itself.
+func resolveCLIBackupPool(flags map[string]string) (string, error) {
+	for _, name := range []string{"pool", "backup-pool"} {
+		if pool := flags[name]; pool != "" && pool != "true" {
+			return pool, nil
+		}
+	}
+	_, dest := detectPools(getAvailablePools())
+	if dest == "" {
+		return "", fmt.Errorf("could not detect a backup pool - pass --pool POOL")
+	}
+	return dest, nil
+}
+
+// handleHistoryCLI lists recorded runs. --json prints one record per line
+// instead of the table, for jq.
+func handleHistoryCLI(args []string) int {
+	flags, err := parseFlags(args, map[string]bool{"host": true, "pool": true, "since": true})
 	if err != nil {
 		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
 		return 1
 	}
-	pool, err := resolveCLIPool(flags)
+
+	filter := historyFilter{
+		Host:   flags["host"],
+		Pool:   flags["pool"],
+		Failed: flags["failed"] == "true",
+	}
+	if since, ok := flags["since"]; ok {
+		if filter.Since, err = parseSince(since, time.Now()); err != nil {
+			fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+			return 1
+		}
+	}
+
+	records, err := loadRunHistory()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+		return 1
+	}
+	records = filterHistory(records, filter)
+
+	if flags["json"] == "true" {
+		enc := json.NewEncoder(os.Stdout)
+		for _, r := range records {
+			if err := enc.Encode(r); err != nil {
+				fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+				return 1
+			}
+		}
+		return 0
+	}
+	printHistory(records)
+	return 0
+}
+
+// handleAttestCLI writes the attestation for one month.
+func handleAttestCLI(args []string) int {
+	flags, err := parseFlags(args, map[string]bool{"month": true, "host": true, "pool": true, "source": true})
 	if err != nil {
 		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
 		return 1
 	}
-	return runDoctor(context.Background(), defaultRunner, pool)
+	if flags["month"] == "" {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: --month YYYY-MM is required"))
+		return 1
+	}
+
+	source, dest := detectPools(getAvailablePools())
+	opts := attestOptions{
+		Month:      flags["month"],
+		Host:       flags["host"],
+		Pool:       flags["pool"],
+		SourcePool: flags["source"],
+	}
+	if opts.Host == "" {
+		opts.Host = getLocalHostname()
+	}
+	if opts.Pool == "" {
+		opts.Pool = dest
+	}
+	if opts.SourcePool == "" {
+		opts.SourcePool = source
+	}
+	if opts.Pool == "" {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: could not detect a backup pool - pass --pool POOL"))
+		return 1
+	}
+
+	records, err := loadRunHistory()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+		return 1
+	}
+	ctx, stop := cliContext()
+	defer stop()
+	a, err := buildAttestation(ctx, defaultRunner, opts, records, time.Now())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+		return 1
+	}
+
+	pdfPath, jsonPath, err := writeAttestation(a)
+	if jsonPath != "" {
+		fmt.Println(statusStyle.Render("JSON attestation: " + jsonPath))
+	}
+	if pdfPath != "" {
+		fmt.Println(statusStyle.Render("PDF attestation:  " + pdfPath))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+		return 1
+	}
+	return 0
+}
+
+// handleDoctorCLI runs the read-only health check. Errors exit 3, like a
+// check that could not run, so monitoring never mistakes them for a warning.
+func handleDoctorCLI(args []string) int {
+	flags, err := parseFlags(args, map[string]bool{"pool": true, "backup-pool": true, "only": true, "skip": true})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+		return severityUnknown.exitCode()
+	}
+	destination := flags["destination"] == "true"
+	fix := flags["fix"] == "true"
+	if fix && flags["json"] == "true" {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: --fix cannot be combined with --json"))
+		return severityUnknown.exitCode()
+	}
+	resolve := resolveCLIPool
+	if destination {
+		resolve = resolveCLIBackupPool
+	}
+	pool, err := resolve(flags)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+		return severityUnknown.exitCode()
+	}
+	return runDoctor(context.Background(), defaultRunner, doctorOptions{
+		Pool:        pool,
+		BackupPool:  flags["backup-pool"],
+		Only:        splitCheckIDs(flags["only"]),
+		Skip:        splitCheckIDs(flags["skip"]),
+		JSON:        flags["json"] == "true",
+		Destination: destination,
+		Fix:         fix,
+		Confirm:     flags["yes"] == "true",
+		Force:       flags["force"] == "true",
+	})
 }
 
 // handleCleanupCLI runs the orphan cleanup. Dry run is the default.
 func handleCleanupCLI(args []string) int {
-	flags, err := parseFlags(args, map[string]bool{"pool": true, "dataset": true})
+	flags, err := parseFlags(args, map[string]bool{"pool": true, "dataset": true, "retire": true})
 	if err != nil {
 		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
 		return 1
 	}
-	pool, err := resolveCLIPool(flags)
+	destination := flags["destination"] == "true"
+	if flags["retire"] != "" && !destination {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: --retire only applies with --destination"))
+		return 1
+	}
+	resolve := resolveCLIPool
+	if destination {
+		resolve = resolveCLIBackupPool
+	}
+	pool, err := resolve(flags)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
 		return 1
 	}
 
 	opts := cleanupOptions{
+		Pool:        pool,
+		Dataset:     flags["dataset"],
+		Confirm:     flags["yes"] == "true",
+		Force:       flags["force"] == "true",
+		Destination: destination,
+		Retire:      flags["retire"],
+	}
+	ctx, stop := cliContext()
+	defer stop()
+	return runCleanupOrphans(ctx, defaultRunner, opts, confirmDestroy)
+}
+
+// handleReleaseRetentionCLI releases retention holds on the backup pool ahead
+// of the window. Dry run is the default.
+func handleReleaseRetentionCLI(args []string) int {
+	flags, err := parseFlags(args, map[string]bool{"pool": true, "dataset": true})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+		return 1
+	}
+	pool, err := resolveCLIBackupPool(flags)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+		return 1
+	}
+
+	opts := releaseOptions{
 		Pool:    pool,
 		Dataset: flags["dataset"],
 		Confirm: flags["yes"] == "true",
 		Force:   flags["force"] == "true",
 	}
-	return runCleanupOrphans(context.Background(), defaultRunner, opts, confirmDestroy)
+	ctx, stop := cliContext()
+	defer stop()
+	return runReleaseRetention(ctx, defaultRunner, opts, confirmRelease)
+}
+
+// handlePruneCLI shows what the next run's prune stages would keep and
+// remove, and why. Pruning itself only happens as part of a backup run.
+func handlePruneCLI(args []string) int {
+	flags, err := parseFlags(args, map[string]bool{"pool": true, "dest": true})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+		return 1
+	}
+	if flags["dry-run"] != "true" {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: prune only supports --dry-run - each backup run prunes as part of the run"))
+		return 1
+	}
+	pool, err := resolveCLIPool(flags)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+		return 1
+	}
+	dest := flags["dest"]
+	if dest == "" {
+		if _, detected := detectPools(getAvailablePools()); detected != pool {
+			dest = detected
+		}
+	}
+
+	ctx, stop := cliContext()
+	defer stop()
+	return runPruneDryRun(ctx, defaultRunner, pruneOptions{Pool: pool, BackupPool: dest}, func(datasets []string) []string {
+		return backupDestinations(dest, getLocalHostname(), datasets)
+	})
+}
+
+// handleBookmarksCLI lists each dataset's bookmarks with the retention
+// decision for each. Dry run is the default.
+func handleBookmarksCLI(args []string) int {
+	flags, err := parseFlags(args, map[string]bool{"pool": true, "dest": true, "dataset": true, "keep": true})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+		return 1
+	}
+	keep := bookmarksKept
+	if value, ok := flags["keep"]; ok {
+		if keep, err = strconv.Atoi(value); err != nil || keep < 1 {
+			fmt.Fprintln(os.Stderr, errorStyle.Render("Error: --keep must be a whole number of at least 1"))
+			return 1
+		}
+	}
+	pool, err := resolveCLIPool(flags)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+		return 1
+	}
+	dest := flags["dest"]
+	if dest == "" {
+		if _, detected := detectPools(getAvailablePools()); detected != pool {
+			dest = detected
+		}
+	}
+
+	opts := bookmarkOptions{
+		Pool:       pool,
+		BackupPool: dest,
+		Dataset:    flags["dataset"],
+		Keep:       keep,
+		Confirm:    flags["yes"] == "true",
+		Force:      flags["force"] == "true",
+	}
+	ctx, stop := cliContext()
+	defer stop()
+	return runBookmarks(ctx, defaultRunner, opts, func(datasets []string) []string {
+		return backupDestinations(dest, getLocalHostname(), datasets)
+	}, func(prompt string) bool {
+		return confirmTyped(prompt, "PRUNE")
+	})
+}
+
+// handleSnapshotCLI takes a labelled, pinned snapshot of the backup scope, or
+// lists or unpins labelled snapshots.
+func handleSnapshotCLI(args []string) int {
+	flags, err := parseFlags(args, map[string]bool{"pool": true, "dest": true, "label": true, "unpin": true})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+		return 1
+	}
+	opts := snapshotOptions{
+		Label: strings.TrimSpace(flags["label"]),
+		List:  flags["list"] == "true",
+		Unpin: strings.TrimPrefix(flags["unpin"], "@"),
+	}
+	modes := 0
+	for _, set := range []bool{opts.Label != "", opts.List, opts.Unpin != ""} {
+		if set {
+			modes++
+		}
+	}
+	if modes != 1 {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: give exactly one of --label TEXT, --list or --unpin TAG"))
+		return 1
+	}
+	if opts.Pool, err = resolveCLIPool(flags); err != nil {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+		return 1
+	}
+	dest := flags["dest"]
+	if dest == "" {
+		if _, detected := detectPools(getAvailablePools()); detected != opts.Pool {
+			dest = detected
+		}
+	}
+	opts.BackupPool = dest
+
+	ctx, stop := cliContext()
+	defer stop()
+	return runSnapshotCommand(ctx, defaultRunner, opts, func(datasets []string) []string {
+		return backupDestinations(dest, getLocalHostname(), datasets)
+	})
 }
 
 // confirmDestroy asks the operator to type DESTROY before anything is removed.
 func confirmDestroy(prompt string) bool {
+	return confirmTyped(prompt, "DESTROY")
+}
+
+// confirmTyped asks the operator to type word to go ahead.
+func confirmTyped(prompt, word string) bool {
 	fmt.Print(prompt)
 	reader := bufio.NewReader(os.Stdin)
 	answer, err := reader.ReadString('\n')
 	if err != nil {
 		return false
 	}
-	return strings.TrimSpace(answer) == "DESTROY"
+	return strings.TrimSpace(answer) == word
 }
 
 // handleScopeCLI shows or sets which datasets of a pool are backed up.
@@ -4246,6 +4986,116 @@ func handleScopeCLI(args []string) int {
 	return 0
 }
 
+// handleResumeCLI lists interrupted runs, or resumes (or discards) the one
+// named by ID.
+func handleResumeCLI(args []string) int {
+	var id string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "--") {
+		id, args = args[0], args[1:]
+	}
+	flags, err := parseFlags(args, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+		return 1
+	}
+
+	if id == "" {
+		states, err := ListBackupStates()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+			return 1
+		}
+		fmt.Println()
+		fmt.Println(titleStyle.Render("Interrupted runs"))
+		fmt.Println(interstitialStyle.Render(strings.Repeat("─", 50)))
+		fmt.Println()
+		if len(states) == 0 {
+			fmt.Println(statusStyle.Render("Nothing to resume."))
+			fmt.Println()
+			return 0
+		}
+		for _, st := range states {
+			line := fmt.Sprintf("  %s\n      %s %s, started %s, %d stage(s) done",
+				labelStyle.Render(st.ID), st.Operation, describeStateEndpoints(st),
+				st.StartTime.Format("2006-01-02 15:04"), len(st.CompletedStages))
+			if st.Cancelled {
+				line += ", cancelled"
+			}
+			fmt.Println(line)
+		}
+		fmt.Println()
+		fmt.Println(infoStyle.Render("Resume one with: sudo zfs-backup resume ID"))
+		fmt.Println(infoStyle.Render("Forget one with: sudo zfs-backup resume ID --discard"))
+		fmt.Println()
+		return 0
+	}
+
+	state, err := LoadBackupState(id)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+		return 1
+	}
+	if state == nil {
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: no interrupted run with ID "+id))
+		return 1
+	}
+
+	if flags["discard"] == "true" {
+		if err := ClearBackupState(id); err != nil {
+			fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+			return 1
+		}
+		fmt.Println(statusStyle.Render("Discarded " + id))
+		return 0
+	}
+
+	if state.Source == "" || state.Destination == "" {
+		fmt.Fprintln(os.Stderr, errorStyle.Render(
+			"Error: this state predates per-run resume and records no pools - resume it from the TUI"))
+		return 1
+	}
+
+	// A push only touches the local source pool, which is already unlocked.
+	var password string
+	if state.Operation != "push-backup" {
+		fmt.Fprintf(cliOut, "Enter encryption password for %s: ", state.Destination)
+		fmt.Scanln(&password)
+	}
+
+	fmt.Fprintln(cliOut, statusStyle.Render(fmt.Sprintf("Resuming %s %s...", state.Operation, describeStateEndpoints(state))))
+
+	ctx, stop := cliContext()
+	defer stop()
+	runEvents.runStart(state.Operation, state.Source, state.Destination)
+	started := time.Now()
+	var msg string
+	var findings runFindings
+	switch state.Operation {
+	case "backup":
+		msg, findings, err = performBackup(ctx, password, state.Source, state.Destination, state, nil)
+	case "force-backup":
+		msg, findings, err = performForceBackup(ctx, password, state.Source, state.Destination, state, nil)
+	case "remote-backup":
+		remoteDataset := strings.TrimPrefix(state.Source, remoteEndpoint(state.RemoteHost, ""))
+		msg, findings, err = performRemoteBackup(ctx, password, state.RemoteHost, remoteDataset, state.Destination, state, nil)
+	case "push-backup":
+		remoteDestPool := strings.TrimPrefix(state.Destination, remoteEndpoint(state.RemoteHost, ""))
+		msg, findings, err = performPushBackup(ctx, password, state.Source, state.RemoteHost, remoteDestPool, state, nil)
+	default:
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: cannot resume a "+state.Operation+" operation"))
+		return 1
+	}
+	runEvents.result(started, err)
+	finishCLIRun(state.Operation, state.Source, state.Destination, state.RemoteHost, started, msg, findings, err)
+	if err != nil {
+		fmt.Fprintln(cliOut, msg)
+		fmt.Fprintln(os.Stderr, errorStyle.Render("Error: "+err.Error()))
+		return 1
+	}
+	fmt.Fprintln(cliOut, statusStyle.Render(msg))
+	return 0
+}
+
 func showCLIHelp() {
 	// Header
 	fmt.Println()
@@ -4264,6 +5114,9 @@ Options:
   -u, --unmount         Unmount and power off backup disk
   -v, --version         Show the version
   -h, --help            Show this help message
+  --json[=PATH]         With -b, -f, -u or resume: emit JSON event lines
+                        for the run, to stdout (human output moves to
+                        stderr) or appended to PATH
 
 Commands:
   scope                 Show or set which datasets are backed up
@@ -4271,15 +5124,80 @@ Commands:
     --datasets a,b      Restrict the backup to these datasets
     --all               Back up every top-level dataset again
 
-  doctor                Read-only health check: orphaned snapshots and
-                        datasets whose quota is being eaten by snapshots
+  doctor                Health check: orphaned snapshots, quota pressure,
+                        stale backups, broken chains, pool health, scrubs,
+                        interrupted receives, stale holds and backup pool
+                        capacity. Read-only unless --fix --yes is given.
+                        Exits 0 healthy, 1 warning, 2 critical, 3 unknown
     --pool POOL         Pool to check (default: auto-detected source pool)
+    --backup-pool POOL  Backup pool (default: the imported backup pool)
+    --only a,b          Run only these checks (see docs for the IDs)
+    --skip a,b          Skip these checks
+    --json              Print the findings as JSON for monitoring
+    --destination       Check the backup pool instead: retired hosts,
+                        abandoned datasets, superseded flat-layout copies
+                        and syncoid leftovers (--pool names the backup pool)
+    --fix               Plan the automatic fixes: quota to refquota, clear
+                        resume tokens, release stale syncoid holds, put
+                        backed-up datasets back in scope
+    --yes               With --fix: apply them, after typing FIX
+    --force             Skip the typed confirmation prompt
 
   cleanup-orphans       Remove snapshots left behind by older versions
     --pool POOL         Pool to clean (default: auto-detected source pool)
     --dataset DATASET   Restrict cleanup to one dataset
     --yes               Actually destroy (dry run is the default)
     --force             Skip the typed confirmation prompt
+    --destination       Clean syncoid leftovers on the backup pool instead
+    --retire PATH       With --destination: remove a host namespace or
+                        dataset that doctor --destination flagged
+
+  release-retention     Release retention holds on the backup pool before
+                        their window ends, so the snapshots can be destroyed
+    --pool POOL         Backup pool (default: auto-detected backup pool)
+    --dataset DATASET   Only this dataset and its children
+    --yes               Actually release (dry run is the default)
+    --force             Skip the typed confirmation prompt
+
+  prune --dry-run       Show every zfs-backup snapshot the prune stages look
+                        at, whether it is kept or pruned and why, and the
+                        space pruning would free
+    --pool POOL         Source pool (default: auto-detected source pool)
+    --dest POOL         Backup pool (default: the imported backup pool)
+
+  bookmarks             List each dataset's bookmarks and which ones the
+                        retention rule prunes (dry run is the default)
+    --pool POOL         Source pool (default: auto-detected source pool)
+    --dest POOL         Backup pool (default: the imported backup pool)
+    --dataset NAME      Limit to one dataset of the scope
+    --keep N            Bookmarks to keep per dataset (default: 30)
+    --yes               Actually destroy the excess bookmarks
+    --force             Skip the typed confirmation prompt
+
+  snapshot              Take an on-demand snapshot of every dataset in scope,
+                        labelled and pinned so pruning leaves it alone; the
+                        next backup run replicates it
+    --label TEXT        Label to store on the snapshot
+    --list              List labelled snapshots on both pools instead
+    --unpin TAG         Unpin the snapshots tagged TAG on both pools instead
+    --pool POOL         Source pool (default: auto-detected source pool)
+    --dest POOL         Backup pool (default: the imported backup pool)
+
+  resume [ID]           List interrupted runs, or resume the one named by ID
+    --discard           Forget the run instead of resuming it
+
+  history               List finished runs, newest first
+    --host HOST         Only runs that backed up HOST
+    --pool POOL         Only runs from or to POOL
+    --since WHEN        Only runs since a duration ago (36h, 7d) or a date
+    --failed            Only failed and partially failed runs
+    --json              One JSON record per line instead of the table
+
+  attest                Write a month's compliance attestation (PDF and JSON)
+    --month YYYY-MM     The month to attest (required)
+    --host HOST         Host whose backups to attest (default: this host)
+    --pool POOL         Backup pool (default: auto-detected backup pool)
+    --source POOL       Source pool for health findings (default: auto-detected)
 
 If no options are provided, an interactive TUI menu will be displayed.
 
@@ -4290,6 +5208,15 @@ Examples:
   sudo zfs-backup doctor                            # Check for orphans
   sudo zfs-backup cleanup-orphans                   # Dry run the cleanup
   sudo zfs-backup cleanup-orphans --yes             # Destroy, after confirming
+  sudo zfs-backup doctor --destination              # Check the backup pool
+  sudo zfs-backup doctor --fix                      # Plan the automatic fixes
+  sudo zfs-backup prune --dry-run                   # Why each snapshot stays or goes
+  sudo zfs-backup bookmarks --yes                   # Prune bookmarks beyond the rule
+  sudo zfs-backup snapshot --label "before upgrade" # Pinned safety snapshot
+  sudo zfs-backup resume                            # List interrupted runs
+  sudo zfs-backup history --failed --since 7d       # This week's failures
+  sudo zfs-backup attest --month 2026-09            # September's attestation
+  sudo zfs-backup --backup --json | jq .type        # Follow a run as JSON
 
 Snapshot scope: zfs-backup only ever snapshots the datasets it also
 replicates and prunes. Datasets outside the scope are never touched.
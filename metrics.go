@@ -0,0 +1,521 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// =============================================================================
+// Prometheus metrics - node_exporter textfile collector
+// =============================================================================
+//
+// With a textfile directory configured in ~/.config/zfs-backup/metrics.json,
+//
+//	{"textfile_directory": "/var/lib/prometheus-node-exporter"}
+//
+// every backup, pull and push run rewrites one .prom file for its source and
+// destination pair, for node_exporter's textfile collector to pick up. The
+// file is replaced atomically so the collector never reads half of it.
+//
+// Last-success timestamps survive failed runs: a failed run carries them over
+// from the file the previous run wrote, so "no success for 26 hours" can be
+// alerted on however many runs have failed since.
+
+// MetricsConfig is the on-disk metrics configuration.
+type MetricsConfig struct {
+	// TextfileDirectory is node_exporter's --collector.textfile.directory.
+	// Empty disables metrics.
+	TextfileDirectory string `json:"textfile_directory"`
+}
+
+// metricsFileName is the config file holding the metrics configuration.
+const metricsFileName = "metrics.json"
+
+// getMetricsFilePath returns the path to the metrics config file.
+func getMetricsFilePath() (string, error) {
+	dir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, metricsFileName), nil
+}
+
+// LoadMetricsConfig reads the metrics configuration. A missing file disables
+// metrics.
+func LoadMetricsConfig() (*MetricsConfig, error) {
+	metricsPath, err := getMetricsFilePath()
+	if err != nil {
+		return &MetricsConfig{}, err
+	}
+
+	data, err := os.ReadFile(metricsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &MetricsConfig{}, nil
+		}
+		return &MetricsConfig{}, err
+	}
+
+	var config MetricsConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return &MetricsConfig{}, fmt.Errorf("%s: %w", metricsPath, err)
+	}
+	return &config, nil
+}
+
+// =============================================================================
+// Destination figures captured before export
+// =============================================================================
+
+// poolCapacity is a pool's size as reported by `zpool list -Hp`.
+type poolCapacity struct {
+	Pool      string
+	Size      int64
+	Allocated int64
+	Free      int64
+}
+
+// destinationStats is what a run learns about the backup pool just before it
+// exports it - once exported, nothing on it can be read.
+type destinationStats struct {
+	Capacity *poolCapacity
+	// Snapshots counts snapshots per destination dataset, keyed by the
+	// dataset's last path component, which is the suffix the run reports.
+	Snapshots map[string]int
+}
+
+var (
+	destinationStatsMu sync.Mutex
+	capturedDestStats  = map[string]*destinationStats{}
+)
+
+// captureDestinationStats records the backup pool's capacity and per-dataset
+// snapshot counts for the metrics written at the end of the run. Failures are
+// ignored: metrics must never fail a backup.
+func captureDestinationStats(ctx context.Context, r commandRunner, pool string, destinations []string) {
+	stats := &destinationStats{Snapshots: map[string]int{}}
+	if out, err := r.Output(ctx, "zpool", "list", "-Hp", "-o", "name,size,allocated,free", pool); err == nil {
+		stats.Capacity = parsePoolCapacity(out)
+	}
+	for _, dest := range destinations {
+		entries, err := listSnapshotEntries(ctx, r, dest, 1)
+		if err != nil {
+			continue
+		}
+		stats.Snapshots[path.Base(dest)] = len(entries)
+	}
+
+	destinationStatsMu.Lock()
+	capturedDestStats[pool] = stats
+	destinationStatsMu.Unlock()
+}
+
+// takeDestinationStats returns and forgets the figures captured for a pool.
+func takeDestinationStats(pool string) *destinationStats {
+	destinationStatsMu.Lock()
+	defer destinationStatsMu.Unlock()
+	stats := capturedDestStats[pool]
+	delete(capturedDestStats, pool)
+	return stats
+}
+
+// peekDestinationStats returns the figures captured for a pool, leaving them
+// for the metrics.
+func peekDestinationStats(pool string) *destinationStats {
+	destinationStatsMu.Lock()
+	defer destinationStatsMu.Unlock()
+	return capturedDestStats[pool]
+}
+
+// parsePoolCapacity parses `zpool list -Hp -o name,size,allocated,free`.
+func parsePoolCapacity(output string) *poolCapacity {
+	fields := strings.Fields(strings.TrimSpace(output))
+	if len(fields) < 4 {
+		return nil
+	}
+	c := &poolCapacity{Pool: fields[0]}
+	var err error
+	if c.Size, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+		return nil
+	}
+	if c.Allocated, err = strconv.ParseInt(fields[2], 10, 64); err != nil {
+		return nil
+	}
+	if c.Free, err = strconv.ParseInt(fields[3], 10, 64); err != nil {
+		return nil
+	}
+	return c
+}
+
+// =============================================================================
+// Collecting a run's metrics
+// =============================================================================
+
+// runMetrics is everything one .prom file reports.
+type runMetrics struct {
+	Operation   string
+	Source      string
+	Destination string
+	Time        time.Time
+	Duration    time.Duration
+	Success     bool
+	LastSuccess time.Time // zero until a run has succeeded
+	Datasets    []datasetMetrics
+	// OrphanPool and Orphans are the source pool's orphan count, when it
+	// could be scanned.
+	OrphanPool string
+	Orphans    int
+	Capacity   *poolCapacity
+}
+
+// datasetMetrics is one dataset's part of a run. Negative counts are unknown.
+type datasetMetrics struct {
+	Name                 string
+	Success              bool
+	LastSuccess          time.Time
+	Duration             time.Duration
+	TransferredBytes     int64
+	SourceSnapshots      int
+	DestinationSnapshots int
+}
+
+// collectRunMetrics assembles a run's metrics from its report and from the
+// source pool as it is now. A pulled run's source is remote, so it has no
+// source-side figures.
+func collectRunMetrics(ctx context.Context, r commandRunner, info ReportInfo) runMetrics {
+	m := runMetrics{
+		Operation:   info.Operation,
+		Source:      info.SourcePool,
+		Destination: info.DestPool,
+		Time:        info.EndTime,
+		Duration:    info.EndTime.Sub(info.StartTime),
+		Success:     info.Success,
+	}
+	if info.Success {
+		m.LastSuccess = info.EndTime
+	}
+
+	localSource := info.Operation != "remote-backup"
+	sourceSnapshots := map[string]int{}
+	newestBackup := map[string]string{}
+	if localSource {
+		if entries, err := listSnapshotEntries(ctx, r, info.SourcePool, 0); err == nil {
+			for _, e := range entries {
+				sourceSnapshots[e.Dataset]++
+			}
+			own := filterBackupSnapshots(entries)
+			sortSnapshotsNewestFirst(own)
+			for _, e := range own {
+				if _, seen := newestBackup[e.Dataset]; !seen {
+					newestBackup[e.Dataset] = e.Name
+				}
+			}
+		}
+		if scan, err := collectOrphanScan(ctx, r, info.SourcePool); err == nil {
+			m.OrphanPool = info.SourcePool
+			m.Orphans = len(scan.Orphans)
+		}
+	}
+	written := snapshotWrittenBytes(ctx, r, newestBackup)
+
+	dest := takeDestinationStats(info.DestPool)
+	if dest != nil {
+		m.Capacity = dest.Capacity
+	}
+
+	for _, ds := range info.DatasetProgress {
+		dm := datasetMetrics{
+			Name:                 ds.Name,
+			Success:              ds.Status == DatasetDone,
+			Duration:             ds.Duration,
+			TransferredBytes:     -1,
+			SourceSnapshots:      -1,
+			DestinationSnapshots: -1,
+		}
+		if dm.Success {
+			dm.LastSuccess = info.EndTime
+		}
+		if localSource {
+			full := fmt.Sprintf("%s/%s", info.SourcePool, ds.Name)
+			dm.SourceSnapshots = sourceSnapshots[full]
+			// The newest backup snapshot's `written` is what this run's
+			// incremental send carried, as long as the dataset replicated.
+			if bytes, ok := written[full]; ok && dm.Success {
+				dm.TransferredBytes = bytes
+			}
+		}
+		if dest != nil {
+			if count, ok := dest.Snapshots[path.Base(ds.Name)]; ok {
+				dm.DestinationSnapshots = count
+			}
+		}
+		m.Datasets = append(m.Datasets, dm)
+	}
+	return m
+}
+
+// snapshotWrittenBytes reads the `written` property of the given snapshots,
+// keyed by dataset.
+func snapshotWrittenBytes(ctx context.Context, r commandRunner, snapshots map[string]string) map[string]int64 {
+	result := map[string]int64{}
+	if len(snapshots) == 0 {
+		return result
+	}
+	args := []string{"get", "-Hp", "-o", "name,value", "written"}
+	for _, name := range snapshots {
+		args = append(args, name)
+	}
+	out, err := r.Output(ctx, "zfs", args...)
+	if err != nil {
+		return result
+	}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		dataset, _, ok := splitSnapshot(fields[0])
+		if !ok {
+			continue
+		}
+		if bytes, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			result[dataset] = bytes
+		}
+	}
+	return result
+}
+
+// =============================================================================
+// Rendering
+// =============================================================================
+
+type metricSample struct {
+	labels []string // alternating name, value
+	value  float64
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	samples []metricSample
+}
+
+// metricSeries renders a series identifier, e.g. name{a="b"}. It is also the
+// key parseMetricSamples returns, so a previous value can be looked up.
+func metricSeries(name string, labels []string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	parts := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		parts = append(parts, labels[i]+`="`+labelValueEscaper.Replace(labels[i+1])+`"`)
+	}
+	return name + "{" + strings.Join(parts, ",") + "}"
+}
+
+// labelValueEscaper escapes a label value for the text exposition format.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (m runMetrics) baseLabels() []string {
+	return []string{"operation", m.Operation, "source", m.Source, "destination", m.Destination}
+}
+
+func (m runMetrics) datasetLabels(ds string) []string {
+	return append(m.baseLabels(), "dataset", ds)
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
+
+// renderMetrics renders a run in the Prometheus text exposition format.
+// Unknown figures are left out rather than reported as zero.
+func renderMetrics(m runMetrics) string {
+	base := m.baseLabels()
+	families := []*metricFamily{
+		{name: "zfs_backup_last_run_timestamp_seconds", help: "When the last run ended."},
+		{name: "zfs_backup_last_run_success", help: "Whether the last run succeeded (1) or not (0)."},
+		{name: "zfs_backup_last_success_timestamp_seconds", help: "When a run last succeeded."},
+		{name: "zfs_backup_run_duration_seconds", help: "How long the last run took."},
+		{name: "zfs_backup_failed_datasets", help: "Datasets the last run failed to replicate."},
+		{name: "zfs_backup_dataset_success", help: "Whether the dataset replicated in the last run."},
+		{name: "zfs_backup_dataset_last_success_timestamp_seconds", help: "When the dataset last replicated."},
+		{name: "zfs_backup_dataset_sync_duration_seconds", help: "How long the dataset took to replicate in the last run."},
+		{name: "zfs_backup_dataset_transferred_bytes", help: "Bytes the last run sent for the dataset, from the written property of its newest backup snapshot."},
+		{name: "zfs_backup_dataset_source_snapshots", help: "Snapshots of the dataset on the source."},
+		{name: "zfs_backup_dataset_destination_snapshots", help: "Snapshots of the dataset on the backup pool."},
+		{name: "zfs_backup_orphan_snapshots", help: "Snapshots no phase of zfs-backup will clean up, as found by doctor."},
+		{name: "zfs_backup_pool_size_bytes", help: "Size of the backup pool."},
+		{name: "zfs_backup_pool_allocated_bytes", help: "Space allocated on the backup pool."},
+		{name: "zfs_backup_pool_free_bytes", help: "Free space on the backup pool."},
+	}
+	byName := map[string]*metricFamily{}
+	for _, f := range families {
+		byName[f.name] = f
+	}
+	add := func(name string, labels []string, value float64) {
+		byName[name].samples = append(byName[name].samples, metricSample{labels: labels, value: value})
+	}
+
+	add("zfs_backup_last_run_timestamp_seconds", base, unixSeconds(m.Time))
+	add("zfs_backup_last_run_success", base, boolGauge(m.Success))
+	if !m.LastSuccess.IsZero() {
+		add("zfs_backup_last_success_timestamp_seconds", base, unixSeconds(m.LastSuccess))
+	}
+	add("zfs_backup_run_duration_seconds", base, m.Duration.Seconds())
+
+	failed := 0
+	for _, ds := range m.Datasets {
+		labels := m.datasetLabels(ds.Name)
+		if !ds.Success {
+			failed++
+		}
+		add("zfs_backup_dataset_success", labels, boolGauge(ds.Success))
+		if !ds.LastSuccess.IsZero() {
+			add("zfs_backup_dataset_last_success_timestamp_seconds", labels, unixSeconds(ds.LastSuccess))
+		}
+		if ds.Duration > 0 {
+			add("zfs_backup_dataset_sync_duration_seconds", labels, ds.Duration.Seconds())
+		}
+		if ds.TransferredBytes >= 0 {
+			add("zfs_backup_dataset_transferred_bytes", labels, float64(ds.TransferredBytes))
+		}
+		if ds.SourceSnapshots >= 0 {
+			add("zfs_backup_dataset_source_snapshots", labels, float64(ds.SourceSnapshots))
+		}
+		if ds.DestinationSnapshots >= 0 {
+			add("zfs_backup_dataset_destination_snapshots", labels, float64(ds.DestinationSnapshots))
+		}
+	}
+	add("zfs_backup_failed_datasets", base, float64(failed))
+
+	if m.OrphanPool != "" {
+		add("zfs_backup_orphan_snapshots", []string{"pool", m.OrphanPool}, float64(m.Orphans))
+	}
+	if m.Capacity != nil {
+		pool := []string{"pool", m.Capacity.Pool}
+		add("zfs_backup_pool_size_bytes", pool, float64(m.Capacity.Size))
+		add("zfs_backup_pool_allocated_bytes", pool, float64(m.Capacity.Allocated))
+		add("zfs_backup_pool_free_bytes", pool, float64(m.Capacity.Free))
+	}
+
+	var b strings.Builder
+	for _, f := range families {
+		if len(f.samples) == 0 {
+			continue
+		}
+		b.WriteString(fmt.Sprintf("# HELP %s %s\n# TYPE %s gauge\n", f.name, f.help, f.name))
+		for _, s := range f.samples {
+			b.WriteString(metricSeries(f.name, s.labels) + " " + strconv.FormatFloat(s.value, 'f', -1, 64) + "\n")
+		}
+	}
+	return b.String()
+}
+
+// parseMetricSamples reads series and values back out of a .prom file,
+// keyed as metricSeries renders them. Comments and malformed lines are
+// skipped.
+func parseMetricSamples(text string) map[string]float64 {
+	samples := map[string]float64{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		idx := strings.LastIndex(line, " ")
+		if idx < 0 {
+			continue
+		}
+		value, err := strconv.ParseFloat(line[idx+1:], 64)
+		if err != nil {
+			continue
+		}
+		samples[line[:idx]] = value
+	}
+	return samples
+}
+
+// carryForward fills in last-success timestamps this run did not set from
+// the samples the previous run wrote.
+func (m *runMetrics) carryForward(previous map[string]float64) {
+	fromSeconds := func(v float64) time.Time {
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(frac*1e9))
+	}
+	if m.LastSuccess.IsZero() {
+		if v, ok := previous[metricSeries("zfs_backup_last_success_timestamp_seconds", m.baseLabels())]; ok {
+			m.LastSuccess = fromSeconds(v)
+		}
+	}
+	for i := range m.Datasets {
+		ds := &m.Datasets[i]
+		if !ds.LastSuccess.IsZero() {
+			continue
+		}
+		if v, ok := previous[metricSeries("zfs_backup_dataset_last_success_timestamp_seconds", m.datasetLabels(ds.Name))]; ok {
+			ds.LastSuccess = fromSeconds(v)
+		}
+	}
+}
+
+// metricsTextfileName names a run's .prom file after its operation and
+// endpoints, like its resume state.
+func metricsTextfileName(info ReportInfo) string {
+	return "zfs-backup_" + backupStateID(info.Operation, info.SourcePool, info.DestPool) + ".prom"
+}
+
+// writeRunMetrics writes a finished run's .prom file, when metrics are
+// configured.
+func writeRunMetrics(ctx context.Context, r commandRunner, info ReportInfo) error {
+	config, err := LoadMetricsConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load metrics config: %w", err)
+	}
+	if config.TextfileDirectory == "" {
+		return nil
+	}
+
+	m := collectRunMetrics(ctx, r, info)
+	promPath := filepath.Join(config.TextfileDirectory, metricsTextfileName(info))
+	if previous, err := os.ReadFile(promPath); err == nil {
+		m.carryForward(parseMetricSamples(string(previous)))
+	}
+	if err := writeFileAtomic(promPath, []byte(renderMetrics(m)), 0644); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	return nil
+}
+
+// writeRunMetricsCmd writes a TUI run's metrics in the background.
+func writeRunMetricsCmd(info ReportInfo) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+		defer cancel()
+		var errs []error
+		if err := writeRunMetrics(ctx, defaultRunner, info); err != nil {
+			errs = append(errs, err)
+		}
+		return postRunMsg{errs: errs}
+	}
+}
@@ -0,0 +1,162 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeMetricsConfig(t *testing.T, dir string) {
+	t.Helper()
+	path, err := getMetricsFilePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(MetricsConfig{TextfileDirectory: dir})
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sourcePoolRunner answers the source-side reads metrics make: the snapshot
+// listing and the written property of the newest backup snapshot.
+func sourcePoolRunner() *fakeRunner {
+	return &fakeRunner{respond: func(name string, args []string) (string, error) {
+		line := strings.Join(args, " ")
+		switch {
+		case strings.HasPrefix(line, "list -H -p -t snapshot") && strings.HasSuffix(line, "-r NIXROOT"):
+			return "NIXROOT/home@2026-10-17.02h-00-Backup\t1792202400\t100\n" +
+				"NIXROOT/home@2026-10-18.02h-00-Backup\t1792288800\t100\n" +
+				"NIXROOT/home@manual\t1792288900\t100\n" +
+				"NIXROOT/atuin@2026-10-18.02h-00-Backup\t1792288800\t100\n", nil
+		case strings.HasPrefix(line, "get -Hp -o name,value written"):
+			return "NIXROOT/home@2026-10-18.02h-00-Backup\t4096\n" +
+				"NIXROOT/atuin@2026-10-18.02h-00-Backup\t512\n", nil
+		}
+		return "", nil
+	}}
+}
+
+func TestCollectRunMetricsReadsSourceAndCapturedDestination(t *testing.T) {
+	dest := &fakeRunner{respond: func(name string, args []string) (string, error) {
+		if name == "zpool" {
+			return "NIXBACKUPS\t1000\t600\t400\n", nil
+		}
+		if args[len(args)-1] == "NIXBACKUPS/laptop/home" {
+			return "NIXBACKUPS/laptop/home@a\t1\t1\nNIXBACKUPS/laptop/home@b\t2\t1\n", nil
+		}
+		return "", nil
+	}}
+	captureDestinationStats(context.Background(), dest, "NIXBACKUPS", []string{"NIXBACKUPS/laptop/home"})
+
+	m := collectRunMetrics(context.Background(), sourcePoolRunner(), sampleReportInfo())
+
+	if m.Capacity == nil || m.Capacity.Size != 1000 || m.Capacity.Free != 400 {
+		t.Errorf("expected the capacity captured before export, got %+v", m.Capacity)
+	}
+	home, atuin := m.Datasets[0], m.Datasets[1]
+	if home.SourceSnapshots != 3 || home.DestinationSnapshots != 2 {
+		t.Errorf("expected 3 source and 2 destination snapshots of home, got %+v", home)
+	}
+	if home.TransferredBytes != 4096 {
+		t.Errorf("home's transfer is the newest backup snapshot's written, got %d", home.TransferredBytes)
+	}
+	if atuin.TransferredBytes != -1 || atuin.DestinationSnapshots != -1 {
+		t.Errorf("a failed dataset sent nothing and was not counted, got %+v", atuin)
+	}
+	if takeDestinationStats("NIXBACKUPS") != nil {
+		t.Error("captured figures belong to one run and must be used up")
+	}
+}
+
+func TestRenderMetricsSkipsUnknownFigures(t *testing.T) {
+	info := sampleReportInfo()
+	m := collectRunMetrics(context.Background(), &fakeRunner{}, info)
+	text := renderMetrics(m)
+
+	for _, want := range []string{
+		"# TYPE zfs_backup_last_run_success gauge\n",
+		`zfs_backup_last_run_success{operation="backup",source="NIXROOT",destination="NIXBACKUPS"} 0`,
+		`zfs_backup_failed_datasets{operation="backup",source="NIXROOT",destination="NIXBACKUPS"} 1`,
+		`zfs_backup_run_duration_seconds{operation="backup",source="NIXROOT",destination="NIXBACKUPS"} 360`,
+		`zfs_backup_dataset_success{operation="backup",source="NIXROOT",destination="NIXBACKUPS",dataset="atuin"} 0`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in\n%s", want, text)
+		}
+	}
+	for _, unwanted := range []string{"zfs_backup_last_success_timestamp_seconds", "zfs_backup_pool_size_bytes", "zfs_backup_dataset_transferred_bytes"} {
+		if strings.Contains(text, unwanted) {
+			t.Errorf("%s is unknown for this run and should be left out, not reported as zero", unwanted)
+		}
+	}
+}
+
+func TestMetricSeriesEscapesLabelValues(t *testing.T) {
+	got := metricSeries("m", []string{"source", `host:"pool"\n`})
+	if want := `m{source="host:\"pool\"\\n"}`; got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestFailedRunKeepsPreviousLastSuccess(t *testing.T) {
+	useTempHome(t)
+	dir := t.TempDir()
+	writeMetricsConfig(t, dir)
+
+	good := sampleReportInfo()
+	good.Success = true
+	good.DatasetProgress = []DatasetProgress{{Name: "home", Status: DatasetDone}, {Name: "atuin", Status: DatasetDone}}
+	if err := writeRunMetrics(context.Background(), &fakeRunner{}, good); err != nil {
+		t.Fatal(err)
+	}
+
+	bad := sampleReportInfo()
+	bad.StartTime = bad.StartTime.Add(24 * time.Hour)
+	bad.EndTime = bad.EndTime.Add(24 * time.Hour)
+	if err := writeRunMetrics(context.Background(), &fakeRunner{}, bad); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, metricsTextfileName(bad)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := parseMetricSamples(string(data))
+	m := runMetrics{Operation: "backup", Source: "NIXROOT", Destination: "NIXBACKUPS"}
+	lastGood := float64(good.EndTime.Unix())
+
+	if got := samples[metricSeries("zfs_backup_last_success_timestamp_seconds", m.baseLabels())]; got != lastGood {
+		t.Errorf("a failed run must keep the last success time, got %v want %v", got, lastGood)
+	}
+	if got := samples[metricSeries("zfs_backup_dataset_last_success_timestamp_seconds", m.datasetLabels("atuin"))]; got != lastGood {
+		t.Errorf("atuin failed, so its last success is the previous run's, got %v", got)
+	}
+	if got := samples[metricSeries("zfs_backup_dataset_last_success_timestamp_seconds", m.datasetLabels("home"))]; got != float64(bad.EndTime.Unix()) {
+		t.Errorf("home replicated in the failed run, so its last success moves on, got %v", got)
+	}
+	if got := samples[metricSeries("zfs_backup_last_run_success", m.baseLabels())]; got != 0 {
+		t.Errorf("the last run failed, got %v", got)
+	}
+}
+
+func TestMetricsDisabledWithoutTextfileDirectory(t *testing.T) {
+	useTempHome(t)
+	runner := &fakeRunner{}
+	if err := writeRunMetrics(context.Background(), runner, sampleReportInfo()); err != nil {
+		t.Fatal(err)
+	}
+	if len(runner.calls) != 0 {
+		t.Errorf("unconfigured metrics should not touch any pool, ran %v", runner.commandLines())
+	}
+}
@@ -0,0 +1,605 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// =============================================================================
+// Notifications - tell someone how a run went
+// =============================================================================
+//
+// Notifiers are configured in ~/.config/zfs-backup/notify.json:
+//
+//	{
+//	  "notifiers": [
+//	    {"type": "email", "on": ["failure", "partial"], "smtp_host": "smtp.example.org",
+//	     "username": "backup", "password_file": "/root/.smtp-password",
+//	     "from": "backup@example.org", "to": ["ops@example.org"]},
+//	    {"type": "ntfy", "url": "https://ntfy.sh/my-backups"},
+//	    {"type": "healthchecks", "url": "https://hc-ping.com/UUID"},
+//	    {"type": "desktop"}
+//	  ]
+//	}
+//
+// Every notifier fires when a run ends, with the outcome - success, failure
+// or partial - built from the run's ReportInfo. A notifier that fails is
+// reported but never changes the outcome of the run it describes.
+
+// Run outcomes a notifier can be subscribed to.
+const (
+	notifySuccess = "success"
+	notifyFailure = "failure"
+	notifyPartial = "partial" // the run finished but some datasets failed
+	// notifyAnomaly is not an outcome but can be subscribed to like one: it
+	// fires a notifier for a run that flagged a change-rate anomaly,
+	// whatever the run's outcome.
+	notifyAnomaly = "anomaly"
+)
+
+// Notifier types.
+const (
+	notifierEmail        = "email"
+	notifierWebhook      = "webhook"
+	notifierNtfy         = "ntfy"
+	notifierGotify       = "gotify"
+	notifierHealthchecks = "healthchecks"
+	notifierDesktop      = "desktop"
+)
+
+// notifyTimeout bounds each network notifier - an HTTP request, or a whole
+// SMTP exchange - so an unreachable or stalled server cannot hold up the end
+// of a run.
+var notifyTimeout = 30 * time.Second
+
+// notifyHTTPClient sends every HTTP notification.
+var notifyHTTPClient = &http.Client{Timeout: notifyTimeout}
+
+// NotifierConfig is one notification sink. Only the fields its type uses
+// need to be set.
+type NotifierConfig struct {
+	Type string `json:"type"`
+	// On lists the outcomes that fire this notifier; empty means all of them.
+	On []string `json:"on,omitempty"`
+
+	// webhook, ntfy, gotify, healthchecks
+	URL string `json:"url,omitempty"`
+	// TokenFile holds an access token for ntfy or gotify.
+	TokenFile string `json:"token_file,omitempty"`
+
+	// email
+	SMTPHost     string   `json:"smtp_host,omitempty"`
+	SMTPPort     int      `json:"smtp_port,omitempty"` // default 587; 465 means implicit TLS
+	Username     string   `json:"username,omitempty"`
+	PasswordFile string   `json:"password_file,omitempty"`
+	From         string   `json:"from,omitempty"`
+	To           []string `json:"to,omitempty"`
+
+	// desktop: whose session to notify when not running under sudo.
+	User string `json:"user,omitempty"`
+}
+
+// NotifyConfig is the on-disk notification configuration.
+type NotifyConfig struct {
+	Notifiers []NotifierConfig `json:"notifiers"`
+}
+
+// notifyFileName is the config file holding the notifiers.
+const notifyFileName = "notify.json"
+
+// getNotifyFilePath returns the path to the notification config file.
+func getNotifyFilePath() (string, error) {
+	dir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, notifyFileName), nil
+}
+
+// LoadNotifyConfig reads the notification configuration. A missing file means
+// no notifiers.
+func LoadNotifyConfig() (*NotifyConfig, error) {
+	notifyPath, err := getNotifyFilePath()
+	if err != nil {
+		return &NotifyConfig{}, err
+	}
+
+	data, err := os.ReadFile(notifyPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &NotifyConfig{}, nil
+		}
+		return &NotifyConfig{}, err
+	}
+
+	var config NotifyConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return &NotifyConfig{}, fmt.Errorf("%s: %w", notifyPath, err)
+	}
+	return &config, nil
+}
+
+// wants reports whether a notifier is subscribed to an outcome.
+func (n NotifierConfig) wants(outcome string) bool {
+	if len(n.On) == 0 {
+		return true
+	}
+	for _, o := range n.On {
+		if o == outcome {
+			return true
+		}
+	}
+	return false
+}
+
+// =============================================================================
+// Payload
+// =============================================================================
+
+// notification is what every sink is sent, and exactly what the webhook
+// posts as JSON.
+type notification struct {
+	Outcome         string                `json:"outcome"`
+	Host            string                `json:"host"`
+	Operation       string                `json:"operation"`
+	Source          string                `json:"source"`
+	Destination     string                `json:"destination"`
+	RemoteHost      string                `json:"remote_host,omitempty"`
+	StartTime       time.Time             `json:"start_time"`
+	EndTime         time.Time             `json:"end_time"`
+	DurationSeconds float64               `json:"duration_seconds"`
+	Error           string                `json:"error,omitempty"`
+	Datasets        []notificationDataset `json:"datasets,omitempty"`
+	FailedDatasets  []string              `json:"failed_datasets,omitempty"`
+	Anomalies       []string              `json:"change_rate_anomalies,omitempty"`
+	ReportPath      string                `json:"report_path,omitempty"`
+	Title           string                `json:"title"`
+	Message         string                `json:"message"`
+
+	// report is the markdown report, attached to email.
+	report string
+}
+
+type notificationDataset struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// runOutcome classifies a finished run. A run that got to the end with some
+// datasets replicated and some not is partial, not a plain failure.
+func runOutcome(info ReportInfo) string {
+	if info.Success {
+		return notifySuccess
+	}
+	failed, done := 0, 0
+	for _, ds := range info.DatasetProgress {
+		switch ds.Status {
+		case DatasetDone:
+			done++
+		case DatasetError, DatasetSkipped:
+			failed++
+		}
+	}
+	if info.Partial || (done > 0 && failed > 0) {
+		return notifyPartial
+	}
+	return notifyFailure
+}
+
+// buildNotification turns a run's report into the notification payload.
+func buildNotification(info ReportInfo, reportPath string) notification {
+	n := notification{
+		Outcome:         runOutcome(info),
+		Host:            getLocalHostname(),
+		Operation:       info.Operation,
+		Source:          info.SourcePool,
+		Destination:     info.DestPool,
+		RemoteHost:      info.RemoteHost,
+		StartTime:       info.StartTime,
+		EndTime:         info.EndTime,
+		DurationSeconds: info.EndTime.Sub(info.StartTime).Seconds(),
+		Error:           info.ErrorMessage,
+		ReportPath:      reportPath,
+		Anomalies:       info.Anomalies,
+		report:          generateMarkdownReport(info),
+	}
+	for _, ds := range info.DatasetProgress {
+		status := datasetStatusName(ds.Status)
+		n.Datasets = append(n.Datasets, notificationDataset{Name: ds.Name, Status: status, Error: ds.ErrorMsg})
+		if ds.Status == DatasetError || ds.Status == DatasetSkipped {
+			n.FailedDatasets = append(n.FailedDatasets, ds.Name)
+		}
+	}
+
+	verb := map[string]string{
+		notifySuccess: "succeeded",
+		notifyFailure: "FAILED",
+		notifyPartial: "partially failed",
+	}[n.Outcome]
+	n.Title = fmt.Sprintf("zfs-backup on %s: %s %s", n.Host, operationLabel(info.Operation), verb)
+	if len(n.Anomalies) > 0 {
+		n.Title += " - CHANGE-RATE ANOMALY"
+	}
+
+	var msg strings.Builder
+	msg.WriteString(fmt.Sprintf("%s -> %s in %s\n", info.SourcePool, info.DestPool, info.EndTime.Sub(info.StartTime).Round(time.Second)))
+	if len(n.FailedDatasets) > 0 {
+		msg.WriteString(fmt.Sprintf("Failed datasets: %s\n", strings.Join(n.FailedDatasets, ", ")))
+	}
+	if info.ErrorMessage != "" {
+		msg.WriteString(fmt.Sprintf("Error: %s\n", info.ErrorMessage))
+	}
+	for _, a := range n.Anomalies {
+		msg.WriteString(fmt.Sprintf("Change-rate anomaly: %s\n", a))
+	}
+	if reportPath != "" {
+		msg.WriteString(fmt.Sprintf("Report: %s\n", reportPath))
+	}
+	n.Message = strings.TrimSpace(msg.String())
+	return n
+}
+
+// =============================================================================
+// Sending
+// =============================================================================
+
+// notifyRun sends a finished run's notification to every notifier subscribed
+// to its outcome. It returns one error per notifier that failed, for the
+// caller to show as warnings.
+func notifyRun(info ReportInfo, reportPath string) []error {
+	config, err := LoadNotifyConfig()
+	if err != nil {
+		return []error{fmt.Errorf("failed to load notifiers: %w", err)}
+	}
+	if len(config.Notifiers) == 0 {
+		return nil
+	}
+
+	n := buildNotification(info, reportPath)
+	var errs []error
+	for _, notifier := range config.Notifiers {
+		if !notifier.wants(n.Outcome) && !(len(n.Anomalies) > 0 && notifier.wants(notifyAnomaly)) {
+			continue
+		}
+		if err := sendNotification(notifier, n); err != nil {
+			errs = append(errs, fmt.Errorf("%s notification failed: %w", notifier.Type, err))
+		}
+	}
+	return errs
+}
+
+func sendNotification(notifier NotifierConfig, n notification) error {
+	switch notifier.Type {
+	case notifierEmail:
+		return sendEmailNotification(notifier, n)
+	case notifierWebhook:
+		return sendWebhookNotification(notifier, n)
+	case notifierNtfy:
+		return sendNtfyNotification(notifier, n)
+	case notifierGotify:
+		return sendGotifyNotification(notifier, n)
+	case notifierHealthchecks:
+		return sendHealthchecksPing(notifier, n)
+	case notifierDesktop:
+		return sendDesktopNotification(notifier, n)
+	default:
+		return fmt.Errorf("unknown notifier type %q", notifier.Type)
+	}
+}
+
+// readSecretFile reads a token or password kept in its own file, so secrets
+// stay out of notify.json.
+func readSecretFile(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// postNotification sends an HTTP request and treats any non-2xx reply as an
+// error.
+func postNotification(req *http.Request) error {
+	req.Header.Set("User-Agent", "zfs-backup/"+appVersion)
+	resp, err := notifyHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// sendWebhookNotification posts the notification as JSON.
+func sendWebhookNotification(notifier NotifierConfig, n notification) error {
+	if notifier.URL == "" {
+		return fmt.Errorf("webhook has no url")
+	}
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, notifier.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return postNotification(req)
+}
+
+// sendNtfyNotification publishes to an ntfy topic URL.
+func sendNtfyNotification(notifier NotifierConfig, n notification) error {
+	if notifier.URL == "" {
+		return fmt.Errorf("ntfy has no topic url")
+	}
+	req, err := http.NewRequest(http.MethodPost, notifier.URL, strings.NewReader(n.Message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", n.Title)
+	if n.Outcome == notifySuccess {
+		req.Header.Set("Tags", "white_check_mark")
+	} else {
+		req.Header.Set("Priority", "high")
+		req.Header.Set("Tags", "warning")
+	}
+	token, err := readSecretFile(notifier.TokenFile)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return postNotification(req)
+}
+
+// sendGotifyNotification posts a message to a Gotify server.
+func sendGotifyNotification(notifier NotifierConfig, n notification) error {
+	if notifier.URL == "" {
+		return fmt.Errorf("gotify has no server url")
+	}
+	token, err := readSecretFile(notifier.TokenFile)
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return fmt.Errorf("gotify needs an application token in token_file")
+	}
+	priority := 5
+	if n.Outcome != notifySuccess {
+		priority = 8
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"title":    n.Title,
+		"message":  n.Message,
+		"priority": priority,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(notifier.URL, "/")+"/message", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", token)
+	return postNotification(req)
+}
+
+// sendHealthchecksPing pings a healthchecks-style URL: the URL itself on
+// success, URL/fail otherwise. The summary goes in the body, which such
+// services keep as the ping's log.
+func sendHealthchecksPing(notifier NotifierConfig, n notification) error {
+	if notifier.URL == "" {
+		return fmt.Errorf("healthchecks has no ping url")
+	}
+	url := strings.TrimRight(notifier.URL, "/")
+	if n.Outcome != notifySuccess {
+		url += "/fail"
+	}
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(n.Title+"\n"+n.Message))
+	if err != nil {
+		return err
+	}
+	return postNotification(req)
+}
+
+// sendEmailNotification mails the summary with the markdown report attached.
+// Port 465 uses implicit TLS; any other port upgrades with STARTTLS when the
+// server offers it, which net/smtp requires before it will send a password.
+// The whole exchange shares one notifyTimeout deadline, so a server that
+// accepts the connection and then stalls cannot hang the run.
+func sendEmailNotification(notifier NotifierConfig, n notification) error {
+	if notifier.SMTPHost == "" || notifier.From == "" || len(notifier.To) == 0 {
+		return fmt.Errorf("email needs smtp_host, from and to")
+	}
+	port := notifier.SMTPPort
+	if port == 0 {
+		port = 587
+	}
+	password, err := readSecretFile(notifier.PasswordFile)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if notifier.Username != "" {
+		auth = smtp.PlainAuth("", notifier.Username, password, notifier.SMTPHost)
+	}
+
+	message, err := buildEmailMessage(notifier, n, time.Now())
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(notifier.SMTPHost, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: notifier.SMTPHost}
+	conn, err := (&net.Dialer{Timeout: notifyTimeout}).Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	if err := conn.SetDeadline(time.Now().Add(notifyTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	if port == 465 {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	client, err := smtp.NewClient(conn, notifier.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if port != 465 {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		}
+	}
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(notifier.From); err != nil {
+		return err
+	}
+	for _, to := range notifier.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// buildEmailMessage renders the mail: a plain-text summary and the markdown
+// report as an attachment.
+func buildEmailMessage(notifier NotifierConfig, n notification, now time.Time) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	textPart, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"text/plain; charset=utf-8"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	textPart.Write([]byte(n.Message + "\n"))
+
+	attachmentName := "zfs-backup-report.md"
+	if n.ReportPath != "" {
+		attachmentName = filepath.Base(n.ReportPath)
+	}
+	attachment, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/markdown; charset=utf-8"},
+		"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", attachmentName)},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString([]byte(n.report))
+	for len(encoded) > 76 {
+		attachment.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	attachment.Write([]byte(encoded + "\r\n"))
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	msg.WriteString("From: " + notifier.From + "\r\n")
+	msg.WriteString("To: " + strings.Join(notifier.To, ", ") + "\r\n")
+	msg.WriteString("Subject: " + n.Title + "\r\n")
+	msg.WriteString("Date: " + now.Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: multipart/mixed; boundary=" + mw.Boundary() + "\r\n\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// sendDesktopNotification shows the outcome with notify-send in the desktop
+// session of the user who ran sudo, or of the configured user when running as
+// a service. zfs-backup itself runs as root, which has no session, so the
+// command runs as that user with their session bus.
+func sendDesktopNotification(notifier NotifierConfig, n notification) error {
+	urgency := "normal"
+	if n.Outcome != notifySuccess {
+		urgency = "critical"
+	}
+	args := []string{"--app-name=zfs-backup", "--urgency=" + urgency, n.Title, n.Message}
+
+	target := os.Getenv("SUDO_USER")
+	if target == "" {
+		target = notifier.User
+	}
+	if target == "" || os.Geteuid() != 0 {
+		return exec.Command("notify-send", args...).Run()
+	}
+
+	u, err := user.Lookup(target)
+	if err != nil {
+		return err
+	}
+	runtimeDir := "/run/user/" + u.Uid
+	sudoArgs := append([]string{
+		"-u", target, "env",
+		"XDG_RUNTIME_DIR=" + runtimeDir,
+		"DBUS_SESSION_BUS_ADDRESS=unix:path=" + runtimeDir + "/bus",
+		"notify-send",
+	}, args...)
+	out, err := exec.Command("sudo", sudoArgs...).CombinedOutput()
+	if err != nil && len(out) > 0 {
+		return errors.New(strings.TrimSpace(string(out)))
+	}
+	return err
+}
+
+// sendRunNotifications sends a TUI run's notifications in the background, so
+// a slow server never freezes the result screen.
+func sendRunNotifications(info ReportInfo, reportPath string) tea.Cmd {
+	return func() tea.Msg {
+		return postRunMsg{errs: notifyRun(info, reportPath)}
+	}
+}
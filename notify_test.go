@@ -0,0 +1,288 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sampleReportInfo() ReportInfo {
+	start := time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC)
+	return ReportInfo{
+		Operation:  "backup",
+		SourcePool: "NIXROOT",
+		DestPool:   "NIXBACKUPS",
+		StartTime:  start,
+		EndTime:    start.Add(6 * time.Minute),
+		DatasetProgress: []DatasetProgress{
+			{Name: "home", Status: DatasetDone},
+			{Name: "atuin", Status: DatasetError, ErrorMsg: "syncoid failed"},
+		},
+		ErrorMessage: "backup incomplete: atuin failed to replicate",
+	}
+}
+
+// captureRequests starts a server recording every request it receives.
+func captureRequests(t *testing.T, status int) (*httptest.Server, *[]*http.Request, *[]string) {
+	t.Helper()
+	var requests []*http.Request
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests, &bodies
+}
+
+func writeNotifyConfig(t *testing.T, config NotifyConfig) {
+	t.Helper()
+	path, err := getNotifyFilePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(config)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunOutcome(t *testing.T) {
+	info := sampleReportInfo()
+	if got := runOutcome(info); got != notifyPartial {
+		t.Errorf("some datasets done and some failed is a partial failure, got %s", got)
+	}
+
+	info.DatasetProgress = []DatasetProgress{{Name: "home", Status: DatasetError}}
+	if got := runOutcome(info); got != notifyFailure {
+		t.Errorf("nothing replicated is a failure, got %s", got)
+	}
+
+	info.DatasetProgress = nil
+	info.Partial = true
+	if got := runOutcome(info); got != notifyPartial {
+		t.Errorf("a run flagged partial is partial even without per-dataset progress, got %s", got)
+	}
+
+	info.Success = true
+	if got := runOutcome(info); got != notifySuccess {
+		t.Errorf("expected success, got %s", got)
+	}
+}
+
+func TestBuildNotificationComesFromReportInfo(t *testing.T) {
+	n := buildNotification(sampleReportInfo(), "/home/tim/.local/share/zfs-backup/reports/r.md")
+
+	if n.Operation != "backup" || n.Source != "NIXROOT" || n.Destination != "NIXBACKUPS" {
+		t.Errorf("endpoints should come from the report info, got %+v", n)
+	}
+	if n.DurationSeconds != 360 {
+		t.Errorf("expected a 6 minute run, got %v seconds", n.DurationSeconds)
+	}
+	if !reflect.DeepEqual(n.FailedDatasets, []string{"atuin"}) {
+		t.Errorf("expected atuin to be listed as failed, got %v", n.FailedDatasets)
+	}
+	if !strings.Contains(n.Title, "partially failed") {
+		t.Errorf("the title should say how the run went, got %q", n.Title)
+	}
+	if !strings.Contains(n.Message, "Report: /home/tim/") {
+		t.Errorf("the message should point at the report, got %q", n.Message)
+	}
+	if !strings.Contains(n.report, "# ") {
+		t.Error("the markdown report should be built for attaching")
+	}
+}
+
+func TestWebhookPostsNotificationJSON(t *testing.T) {
+	server, requests, bodies := captureRequests(t, http.StatusOK)
+
+	n := buildNotification(sampleReportInfo(), "")
+	if err := sendNotification(NotifierConfig{Type: notifierWebhook, URL: server.URL}, n); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*requests) != 1 || (*requests)[0].Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("expected one JSON POST, got %v", *requests)
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal([]byte((*bodies)[0]), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload["outcome"] != "partial" || payload["source"] != "NIXROOT" {
+		t.Errorf("unexpected payload %v", payload)
+	}
+}
+
+func TestHealthchecksPingsFailEndpointOnFailure(t *testing.T) {
+	server, requests, _ := captureRequests(t, http.StatusOK)
+	notifier := NotifierConfig{Type: notifierHealthchecks, URL: server.URL + "/ping/uuid"}
+
+	info := sampleReportInfo()
+	if err := sendNotification(notifier, buildNotification(info, "")); err != nil {
+		t.Fatal(err)
+	}
+	info.Success = true
+	if err := sendNotification(notifier, buildNotification(info, "")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := []string{(*requests)[0].URL.Path, (*requests)[1].URL.Path}; !reflect.DeepEqual(got, []string{"/ping/uuid/fail", "/ping/uuid"}) {
+		t.Errorf("failures ping /fail and successes the URL itself, got %v", got)
+	}
+}
+
+func TestNtfySendsTitleAndToken(t *testing.T) {
+	server, requests, _ := captureRequests(t, http.StatusOK)
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("tk_secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	n := buildNotification(sampleReportInfo(), "")
+	if err := sendNotification(NotifierConfig{Type: notifierNtfy, URL: server.URL + "/backups", TokenFile: tokenFile}, n); err != nil {
+		t.Fatal(err)
+	}
+
+	req := (*requests)[0]
+	if req.Header.Get("Title") != n.Title || req.Header.Get("Priority") != "high" {
+		t.Errorf("a failed run should be a high-priority ntfy message titled %q, got headers %v", n.Title, req.Header)
+	}
+	if req.Header.Get("Authorization") != "Bearer tk_secret" {
+		t.Errorf("the token file should be sent as a bearer token, got %q", req.Header.Get("Authorization"))
+	}
+}
+
+func TestHTTPErrorStatusIsReported(t *testing.T) {
+	server, _, _ := captureRequests(t, http.StatusUnauthorized)
+	if err := sendNotification(NotifierConfig{Type: notifierWebhook, URL: server.URL}, buildNotification(sampleReportInfo(), "")); err == nil {
+		t.Error("a rejected notification should be an error")
+	}
+}
+
+func TestEmailAttachesMarkdownReport(t *testing.T) {
+	n := buildNotification(sampleReportInfo(), "/reports/Backup-NIXROOT-Report.md")
+	raw, err := buildEmailMessage(NotifierConfig{From: "backup@example.org", To: []string{"ops@example.org"}}, n, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.Get("Subject") != n.Title {
+		t.Errorf("expected subject %q, got %q", n.Title, msg.Header.Get("Subject"))
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	if _, err := reader.NextPart(); err != nil {
+		t.Fatal("expected a text part first")
+	}
+	attachment, err := reader.NextPart()
+	if err != nil {
+		t.Fatal("expected the report attached")
+	}
+	if attachment.FileName() != "Backup-NIXROOT-Report.md" {
+		t.Errorf("the attachment should be named after the report, got %q", attachment.FileName())
+	}
+	encoded, _ := io.ReadAll(attachment)
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+	if err != nil || string(decoded) != n.report {
+		t.Errorf("the attachment should be the markdown report (%v)", err)
+	}
+}
+
+func TestNotifyRunHonoursOutcomeSubscriptions(t *testing.T) {
+	useTempHome(t)
+	failures, failureRequests, _ := captureRequests(t, http.StatusOK)
+	everything, everythingRequests, _ := captureRequests(t, http.StatusOK)
+	writeNotifyConfig(t, NotifyConfig{Notifiers: []NotifierConfig{
+		{Type: notifierWebhook, URL: failures.URL, On: []string{notifyFailure, notifyPartial}},
+		{Type: notifierWebhook, URL: everything.URL},
+	}})
+
+	info := sampleReportInfo()
+	info.Success = true
+	if errs := notifyRun(info, ""); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	if len(*failureRequests) != 0 {
+		t.Error("a notifier subscribed to failures must stay quiet on success")
+	}
+	if len(*everythingRequests) != 1 {
+		t.Error("a notifier without \"on\" hears every outcome")
+	}
+}
+
+func TestCLIReportInfoTreatsIncompleteRunAsPartial(t *testing.T) {
+	useTempHome(t)
+	server, _, bodies := captureRequests(t, http.StatusOK)
+	writeNotifyConfig(t, NotifyConfig{Notifiers: []NotifierConfig{{Type: notifierWebhook, URL: server.URL}}})
+
+	notifyRun(cliReportInfo("backup", "NIXROOT", "NIXBACKUPS", "", time.Now(), "log", runFindings{}, &incompleteError{run: "backup", failed: []string{"atuin"}}), "")
+
+	var payload notification
+	if err := json.Unmarshal([]byte((*bodies)[0]), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Outcome != notifyPartial || !reflect.DeepEqual(payload.FailedDatasets, []string{"atuin"}) {
+		t.Errorf("an incomplete CLI run is a partial failure naming its datasets, got %+v", payload)
+	}
+}
+
+func TestStalledSMTPServerTimesOut(t *testing.T) {
+	// Accepts the connection and never sends a greeting.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			<-done
+			conn.Close()
+		}
+	}()
+
+	saved := notifyTimeout
+	notifyTimeout = 200 * time.Millisecond
+	defer func() { notifyTimeout = saved }()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	notifier := NotifierConfig{Type: notifierEmail, SMTPHost: host, SMTPPort: portNum, From: "backup@example.org", To: []string{"ops@example.org"}}
+	start := time.Now()
+	if err := sendNotification(notifier, buildNotification(sampleReportInfo(), "")); err == nil {
+		t.Error("a server that never answers should be an error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("a stalled SMTP server held the run for %v", elapsed)
+	}
+}
@@ -0,0 +1,290 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// Prune plans - what pruning keeps, what it removes, and why
+// =============================================================================
+//
+// Both prune passes decide through the explain functions below, so the
+// reasons `zfs-backup prune --dry-run` and the Prune Preview screen give are
+// the ones the next run will act on, not a re-implementation of them.
+
+// pruneVerdict is one zfs-backup snapshot with the prune decision for it.
+type pruneVerdict struct {
+	snapshotEntry
+	Prune  bool
+	Reason string
+}
+
+// Reasons shared by both sides.
+const (
+	reasonNewest   = "newest (incremental base)"
+	reasonBaseHeld = "held as the incremental base"
+	reasonRetained = "inside the immutable retention window"
+)
+
+// explainLocalPrune decides every zfs-backup snapshot of one source dataset,
+// newest first: the newest `keep` stay, as do pinned ones, and the rest become
+// bookmarks. Only zfs-backup's own snapshots are listed - nothing else is ever
+// pruned.
+func explainLocalPrune(entries []snapshotEntry, keep int) []pruneVerdict {
+	own := filterBackupSnapshots(entries)
+	sortSnapshotsNewestFirst(own)
+
+	if keep < 1 {
+		keep = 1 // never prune the newest: it is the incremental base
+	}
+	verdicts := make([]pruneVerdict, 0, len(own))
+	for i, e := range own {
+		v := pruneVerdict{snapshotEntry: e}
+		switch {
+		case i == 0:
+			v.Reason = reasonNewest
+		case e.Pinned:
+			v.Reason = pinnedReason(e.Label)
+		case i < keep:
+			v.Reason = fmt.Sprintf("within keep=%d", keep)
+		default:
+			v.Prune, v.Reason = true, fmt.Sprintf("beyond keep=%d", keep)
+		}
+		verdicts = append(verdicts, v)
+	}
+	return verdicts
+}
+
+// explainDestinationPrune decides every zfs-backup snapshot of one backup
+// dataset, newest first: the newest stays as the incremental base, every
+// snapshot from one of keepMonths stays as a monthly archive, pinned ones
+// stay, and the rest are pruned.
+func explainDestinationPrune(entries []snapshotEntry, keepMonths []string) []pruneVerdict {
+	own := filterBackupSnapshots(entries)
+	sortSnapshotsNewestFirst(own)
+
+	verdicts := make([]pruneVerdict, 0, len(own))
+	for i, e := range own {
+		v := pruneVerdict{snapshotEntry: e, Prune: true}
+		if len(keepMonths) > 0 {
+			v.Reason = fmt.Sprintf("before %s, the oldest monthly archive", keepMonths[len(keepMonths)-1])
+		} else {
+			v.Reason = "no monthly archives kept"
+		}
+		if i == 0 {
+			v.Prune, v.Reason = false, reasonNewest
+		}
+		for _, month := range keepMonths {
+			if v.Prune && strings.HasPrefix(e.Tag, month) {
+				v.Prune, v.Reason = false, "monthly archive "+month
+			}
+		}
+		if v.Prune && e.Pinned {
+			v.Prune, v.Reason = false, pinnedReason(e.Label)
+		}
+		verdicts = append(verdicts, v)
+	}
+	return verdicts
+}
+
+// prunedEntries returns the snapshots the verdicts prune, in order.
+func prunedEntries(verdicts []pruneVerdict) []snapshotEntry {
+	var prune []snapshotEntry
+	for _, v := range verdicts {
+		if v.Prune {
+			prune = append(prune, v.snapshotEntry)
+		}
+	}
+	return prune
+}
+
+// datasetPrunePlan is one dataset's prune decisions.
+type datasetPrunePlan struct {
+	Dataset  string
+	Backup   bool // on the backup pool rather than the source
+	Verdicts []pruneVerdict
+	Freed    int64 // space pruning would free; -1 if ZFS could not estimate it
+	Err      error // the dataset could not be read
+}
+
+// pruneCount is how many snapshots the plan prunes.
+func (p datasetPrunePlan) pruneCount() int {
+	return len(prunedEntries(p.Verdicts))
+}
+
+// explainHolds turns prune verdicts into keeps for the snapshots
+// bookmarkAndDestroy would refuse: the held incremental base and anything
+// inside the retention window.
+func explainHolds(verdicts []pruneVerdict, holds []snapshotHold) {
+	tags := map[string][]string{}
+	for _, h := range holds {
+		tags[h.Snapshot] = append(tags[h.Snapshot], h.Tag)
+	}
+	for i, v := range verdicts {
+		if !v.Prune {
+			continue
+		}
+		switch {
+		case hasHold(tags[v.Name], baseHoldTag):
+			verdicts[i].Prune, verdicts[i].Reason = false, reasonBaseHeld
+		case hasHold(tags[v.Name], retentionHoldTag):
+			verdicts[i].Prune, verdicts[i].Reason = false, reasonRetained
+		}
+	}
+}
+
+// planDatasetPrune lists one dataset and decides its snapshots with explain,
+// then asks ZFS what the prune would free.
+func planDatasetPrune(ctx context.Context, r commandRunner, dataset string, backup bool, explain func([]snapshotEntry) []pruneVerdict) datasetPrunePlan {
+	plan := datasetPrunePlan{Dataset: dataset, Backup: backup}
+	entries, err := listSnapshotEntries(ctx, r, dataset, 1)
+	if err != nil {
+		plan.Err = err
+		return plan
+	}
+	labelSnapshotEntries(ctx, r, dataset, entries)
+	plan.Verdicts = explain(entries)
+	if holds, err := listHoldsUnder(ctx, r, dataset, 1); err == nil {
+		explainHolds(plan.Verdicts, holds)
+	}
+
+	var names []string
+	for _, e := range prunedEntries(plan.Verdicts) {
+		names = append(names, e.Name)
+	}
+	if len(names) > 0 {
+		if plan.Freed, err = estimateReclaim(ctx, r, names); err != nil {
+			plan.Freed = -1
+		}
+	}
+	return plan
+}
+
+// planPrune decides every zfs-backup snapshot the next run's prune stages
+// would look at: sources are the source datasets, destinations their copies
+// on the backup pool, both fully qualified. Nothing is changed.
+func planPrune(ctx context.Context, r commandRunner, sources []string, keep int, destinations []string, now time.Time) []datasetPrunePlan {
+	var plans []datasetPrunePlan
+	for _, ds := range sources {
+		plans = append(plans, planDatasetPrune(ctx, r, ds, false, func(entries []snapshotEntry) []pruneVerdict {
+			return explainLocalPrune(entries, keep)
+		}))
+	}
+	keepMonths := recentMonths(now, 3)
+	for _, dest := range destinations {
+		plan := planDatasetPrune(ctx, r, dest, true, func(entries []snapshotEntry) []pruneVerdict {
+			return explainDestinationPrune(entries, keepMonths)
+		})
+		if plan.Err != nil {
+			// As in pruneDestinationSnapshots: a destination that does not
+			// exist yet simply has nothing to prune.
+			continue
+		}
+		plans = append(plans, plan)
+	}
+	return plans
+}
+
+// renderPrunePlan renders prune plans for people to read. Shared by the CLI
+// dry run and the TUI's Prune Preview screen.
+func renderPrunePlan(plans []datasetPrunePlan, now time.Time) string {
+	var b strings.Builder
+	pruned, unknown := 0, false
+	var freed int64
+	for _, p := range plans {
+		side := "source"
+		if p.Backup {
+			side = "backup pool"
+		}
+		b.WriteString(fmt.Sprintf("%s (%s)\n", p.Dataset, side))
+		if p.Err != nil {
+			b.WriteString(fmt.Sprintf("  could not list snapshots: %v\n\n", p.Err))
+			continue
+		}
+		if len(p.Verdicts) == 0 {
+			b.WriteString("  no zfs-backup snapshots\n\n")
+			continue
+		}
+		for _, v := range p.Verdicts {
+			action := "keep "
+			if v.Prune {
+				action = "PRUNE"
+			}
+			used := "?"
+			if v.Used >= 0 {
+				used = formatSize(v.Used)
+			}
+			b.WriteString(fmt.Sprintf("  %s  %-28s %9s %9s  %s\n",
+				action, v.Tag, ageLabel(now.Sub(v.Creation)), used, v.Reason))
+		}
+		if n := p.pruneCount(); n > 0 {
+			pruned += n
+			if p.Freed < 0 {
+				unknown = true
+				b.WriteString(fmt.Sprintf("  %d to prune, freeing an unknown amount\n", n))
+			} else {
+				freed += p.Freed
+				b.WriteString(fmt.Sprintf("  %d to prune, freeing %s\n", n, formatSize(p.Freed)))
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	switch {
+	case pruned == 0:
+		b.WriteString("Nothing would be pruned.\n")
+	case unknown:
+		b.WriteString(fmt.Sprintf("%d snapshot(s) would be pruned, freeing at least %s.\n", pruned, formatSize(freed)))
+	default:
+		b.WriteString(fmt.Sprintf("%d snapshot(s) would be pruned, freeing %s.\n", pruned, formatSize(freed)))
+	}
+	b.WriteString("Pruned snapshots are bookmarked first, so incremental sends from them keep working.\n")
+	return b.String()
+}
+
+// =============================================================================
+// prune --dry-run
+// =============================================================================
+
+// pruneOptions are the command-line options for prune.
+type pruneOptions struct {
+	Pool       string
+	BackupPool string // empty when no backup pool is imported
+}
+
+// runPruneDryRun prints the prune plan for a pool's scope and, when a backup
+// pool is given, for its copies there. It returns the process exit code.
+func runPruneDryRun(ctx context.Context, r commandRunner, opts pruneOptions, destinations func([]string) []string) int {
+	datasets, _, err := resolveBackupDatasets(opts.Pool)
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: failed to resolve backup scope: " + err.Error()))
+		return 1
+	}
+
+	title := "Prune dry run: " + opts.Pool
+	var dests []string
+	if opts.BackupPool != "" {
+		title += " → " + opts.BackupPool
+		dests = destinations(datasets)
+	}
+	fmt.Println(titleStyle.Render(title))
+	fmt.Println()
+	if opts.BackupPool == "" {
+		fmt.Println(infoStyle.Render("No backup pool is imported - showing the source side only. Pass --dest POOL for both."))
+		fmt.Println()
+	}
+
+	now := time.Now()
+	plans := planPrune(ctx, r, qualifyDatasets(opts.Pool, datasets), localBackupSnapshotsKept, dests, now)
+	fmt.Print(renderPrunePlan(plans, now))
+	fmt.Println()
+	fmt.Println(statusStyle.Render("Dry run - nothing has been pruned. Each backup run prunes as shown."))
+	fmt.Println()
+	return 0
+}
@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExplainPruneGivesEverySnapshotAReason(t *testing.T) {
+	entries := []snapshotEntry{
+		snapshotFixture("NIXROOT/home", "2026-08-14.10h-00-Backup", 0),
+		snapshotFixture("NIXROOT/home", "2026-08-13.10h-00-Backup", 1),
+		snapshotFixture("NIXROOT/home", "2026-07-04.10h-00-Backup", 41),
+		snapshotFixture("NIXROOT/home", "2026-02-04.10h-00-Backup", 191),
+		snapshotFixture("NIXROOT/home", "autosnap_2026-08-11_22:00:00_hourly", 3),
+	}
+	reasons := func(verdicts []pruneVerdict) []string {
+		var out []string
+		for _, v := range verdicts {
+			out = append(out, fmt.Sprintf("%s %v %s", v.Tag, v.Prune, v.Reason))
+		}
+		return out
+	}
+
+	local := reasons(explainLocalPrune(entries, 2))
+	want := []string{
+		"2026-08-14.10h-00-Backup false newest (incremental base)",
+		"2026-08-13.10h-00-Backup false within keep=2",
+		"2026-07-04.10h-00-Backup true beyond keep=2",
+		"2026-02-04.10h-00-Backup true beyond keep=2",
+	}
+	if !reflect.DeepEqual(local, want) {
+		t.Errorf("local verdicts %v, want %v", local, want)
+	}
+
+	dest := reasons(explainDestinationPrune(entries, recentMonths(time.Date(2026, 8, 14, 12, 0, 0, 0, time.UTC), 3)))
+	want = []string{
+		"2026-08-14.10h-00-Backup false newest (incremental base)",
+		"2026-08-13.10h-00-Backup false monthly archive 2026-08",
+		"2026-07-04.10h-00-Backup false monthly archive 2026-07",
+		"2026-02-04.10h-00-Backup true before 2026-06, the oldest monthly archive",
+	}
+	if !reflect.DeepEqual(dest, want) {
+		t.Errorf("destination verdicts %v, want %v", dest, want)
+	}
+}
+
+func TestPlanPruneChangesNothingAndEstimatesTheSpace(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	var listing strings.Builder
+	for d := 10; d <= 18; d++ {
+		fmt.Fprintf(&listing, "NIXROOT/home@2026-10-%02d.02h-00-Backup\t%d\t1048576\n",
+			d, time.Date(2026, 10, d, 2, 0, 0, 0, time.UTC).Unix())
+	}
+	r := pruneFixtureRunner(map[string]string{"NIXROOT/home": listing.String()},
+		map[string][]string{"NIXROOT/home@2026-10-11.02h-00-Backup": {baseHoldTag}})
+	holds := r.respond
+	r.respond = func(name string, args []string) (string, error) {
+		switch {
+		case args[0] == "destroy":
+			return "destroy\tNIXROOT/home@2026-10-10.02h-00-Backup\nreclaim\t3145728\n", nil
+		case args[len(args)-1] == "NIXBACKUPS/abyss/home":
+			return "", fmt.Errorf("dataset does not exist")
+		}
+		return holds(name, args)
+	}
+
+	plans := planPrune(context.Background(), r, []string{"NIXROOT/home"}, 7, []string{"NIXBACKUPS/abyss/home"}, now)
+	if len(plans) != 1 {
+		t.Fatalf("expected the missing destination skipped, got %d plan(s)", len(plans))
+	}
+	plan := plans[0]
+	if plan.pruneCount() != 1 || plan.Freed != 3145728 {
+		t.Errorf("expected one snapshot pruned freeing 3 MiB, got %d and %d", plan.pruneCount(), plan.Freed)
+	}
+	if v := plan.Verdicts[len(plan.Verdicts)-2]; v.Prune || v.Reason != reasonBaseHeld {
+		t.Errorf("expected the held base kept and explained, got %+v", v)
+	}
+	if !r.ran("destroy -nvp NIXROOT/home@2026-10-10.02h-00-Backup") {
+		t.Errorf("expected the reclaim estimated with a dry-run destroy, ran %v", r.commandLines())
+	}
+	for _, line := range r.commandLines() {
+		if strings.Contains(line, " bookmark ") || (strings.Contains(line, " destroy ") && !strings.Contains(line, "-nvp")) {
+			t.Errorf("a prune plan must change nothing, ran %q", line)
+		}
+	}
+
+	rendered := renderPrunePlan(plans, now)
+	for _, want := range []string{"PRUNE  2026-10-10.02h-00-Backup", "beyond keep=7", "1 snapshot(s) would be pruned, freeing 3.0 MB"} {
+		if !strings.Contains(rendered, want) {
+			t.Errorf("expected %q in the rendered plan:\n%s", want, rendered)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// statePrunePreview is the Prune Preview screen.
+const statePrunePreview sessionState = 105
+
+// =============================================================================
+// Prune Preview
+// =============================================================================
+
+// prunePreviewLoadedMsg carries a pool's rendered prune plan.
+type prunePreviewLoadedMsg struct {
+	pool       string
+	backupPool string
+	content    string
+	pruned     int
+	err        error
+}
+
+// loadPrunePreview plans the next run's prune stages for a pool's scope and,
+// if a backup pool is imported, for its copies there.
+func loadPrunePreview(pool string) tea.Cmd {
+	return func() tea.Msg {
+		datasets, _, err := resolveBackupDatasets(pool)
+		if err != nil {
+			return prunePreviewLoadedMsg{pool: pool, err: fmt.Errorf("failed to resolve backup scope: %w", err)}
+		}
+		var backupPool string
+		var destinations []string
+		if _, detected := detectPools(getAvailablePools()); detected != pool {
+			backupPool = detected
+		}
+		if backupPool != "" {
+			destinations = backupDestinations(backupPool, getLocalHostname(), datasets)
+		}
+
+		now := time.Now()
+		plans := planPrune(context.Background(), defaultRunner, qualifyDatasets(pool, datasets), localBackupSnapshotsKept, destinations, now)
+		pruned := 0
+		for _, p := range plans {
+			pruned += p.pruneCount()
+		}
+		return prunePreviewLoadedMsg{pool: pool, backupPool: backupPool, content: renderPrunePlan(plans, now), pruned: pruned}
+	}
+}
+
+// updatePrunePreviewScreen handles keys for the Prune Preview screen.
+func (m model) updatePrunePreviewScreen(msg tea.KeyMsg) (model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		m.quitting = true
+		return m, tea.Quit
+	case "esc", "q":
+		m.state = stateMenu
+		m.pruneReady = false
+		return m, nil
+	case "r":
+		m.pruneReady = false
+		return m, tea.Batch(m.spinner.Tick, loadPrunePreview(m.prunePool))
+	default:
+		var cmd tea.Cmd
+		m.pruneViewport, cmd = m.pruneViewport.Update(msg)
+		return m, cmd
+	}
+}
+
+// renderPrunePreviewContent draws the Prune Preview screen.
+func (m model) renderPrunePreviewContent(width int) string {
+	if !m.pruneReady {
+		return lipgloss.NewStyle().
+			Width(width).
+			Align(lipgloss.Center).
+			Render(m.spinner.View() + " Working out what pruning would do...")
+	}
+
+	var b strings.Builder
+
+	heading := "Prune Preview: " + m.prunePool
+	if m.pruneBackupPool != "" {
+		heading += " → " + m.pruneBackupPool
+	}
+	title := selectedItemStyle.Render(heading)
+	b.WriteString(lipgloss.NewStyle().Width(width).Align(lipgloss.Center).Render(title))
+	b.WriteString("\n\n")
+
+	b.WriteString(m.pruneViewport.View())
+	b.WriteString("\n")
+
+	verdict := statusStyle.Render("The next run would prune nothing")
+	if m.prunePruned > 0 {
+		verdict = infoStyle.Render(fmt.Sprintf("The next run would prune %d snapshot(s) - nothing has been changed", m.prunePruned))
+	}
+	if m.pruneBackupPool == "" {
+		verdict += "\n" + warningStyle.Render("No backup pool is imported - source side only")
+	}
+	b.WriteString(lipgloss.NewStyle().Width(width).Align(lipgloss.Center).Render(verdict))
+	b.WriteString("\n")
+
+	scrollInfo := subtitleStyle.Render(fmt.Sprintf(
+		"Scroll: j/k or arrows | %d%% | r refresh | esc/q to return",
+		int(m.pruneViewport.ScrollPercent()*100)))
+	b.WriteString(lipgloss.NewStyle().Width(width).Align(lipgloss.Center).Render(scrollInfo))
+
+	return b.String()
+}
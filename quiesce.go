@@ -0,0 +1,556 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// Database quiesce - application-consistent snapshots
+// =============================================================================
+//
+// A ZFS snapshot of a running database is only crash-consistent: restoring it
+// is like recovering from a power cut. Quiesce integrations put the database
+// into a consistent state for the instant the snapshot is taken:
+//
+//	postgresql, mode "checkpoint"  CHECKPOINT just before the snapshot
+//	postgresql, mode "backup"      pg_backup_start ... pg_backup_stop around it
+//	mysql                          FLUSH TABLES WITH READ LOCK held across it
+//
+// They are configured per pool in ~/.config/zfs-backup/quiesce.json, each
+// attached to a dataset in scope:
+//
+//	{
+//	  "pools": {
+//	    "NIXROOT": [
+//	      {"dataset": "postgres", "engine": "postgresql", "user": "postgres"},
+//	      {"dataset": "mysql", "engine": "mysql", "defaults_file": "/root/.my.cnf"}
+//	    ]
+//	  }
+//	}
+//
+// Integrations talk to the database through its own command-line client, so
+// connections use the client's usual credentials (~/.pgpass, a MySQL defaults
+// file) and no password is stored here. A lock is held by a client session
+// kept open across the snapshot. If unlocking fails or times out the client
+// is killed; the server drops the session and with it the lock, so the
+// database is never left locked.
+
+// Supported quiesce engines and PostgreSQL modes.
+const (
+	quiescePostgreSQL = "postgresql"
+	quiesceMySQL      = "mysql"
+
+	quiesceModeCheckpoint = "checkpoint"
+	quiesceModeBackup     = "backup"
+)
+
+// defaultQuiesceTimeout bounds each step of a quiesce - connecting and
+// locking, and unlocking - unless the integration sets its own.
+const defaultQuiesceTimeout = 60 * time.Second
+
+// quiesceConnectTimeout bounds the MySQL client's connection attempt, so an
+// unreachable server fails fast rather than using up the whole step.
+const quiesceConnectTimeout = 10 * time.Second
+
+// QuiesceConfig attaches one database to a dataset in scope.
+type QuiesceConfig struct {
+	// Dataset is the direct-child suffix holding the database, e.g. "postgres".
+	Dataset string `json:"dataset"`
+	// Engine is "postgresql" or "mysql".
+	Engine string `json:"engine"`
+	// Mode selects the PostgreSQL method: "checkpoint" (default) or "backup".
+	Mode string `json:"mode,omitempty"`
+
+	// Connection. Host may be a socket directory for PostgreSQL.
+	Host         string `json:"host,omitempty"`
+	Port         int    `json:"port,omitempty"`
+	User         string `json:"user,omitempty"`
+	Database     string `json:"database,omitempty"`
+	Socket       string `json:"socket,omitempty"`        // MySQL only
+	DefaultsFile string `json:"defaults_file,omitempty"` // MySQL only
+
+	// Client overrides the psql / mysql executable.
+	Client string `json:"client,omitempty"`
+	// TimeoutSeconds overrides defaultQuiesceTimeout.
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+}
+
+// QuiesceSettings is the on-disk quiesce configuration, keyed by pool name.
+type QuiesceSettings struct {
+	Pools map[string][]QuiesceConfig `json:"pools"`
+}
+
+// quiesceFileName is the config file holding the quiesce integrations.
+const quiesceFileName = "quiesce.json"
+
+// getQuiesceFilePath returns the path to the quiesce config file.
+func getQuiesceFilePath() (string, error) {
+	dir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, quiesceFileName), nil
+}
+
+// LoadQuiesceSettings reads the quiesce configuration. A missing file means
+// no integrations; a broken one is an error, for the same reason as a broken
+// hooks file - a database must not be snapshotted unquiesced by accident.
+func LoadQuiesceSettings() (*QuiesceSettings, error) {
+	quiescePath, err := getQuiesceFilePath()
+	if err != nil {
+		return &QuiesceSettings{Pools: map[string][]QuiesceConfig{}}, err
+	}
+
+	data, err := os.ReadFile(quiescePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &QuiesceSettings{Pools: map[string][]QuiesceConfig{}}, nil
+		}
+		return &QuiesceSettings{Pools: map[string][]QuiesceConfig{}}, err
+	}
+
+	var settings QuiesceSettings
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return &QuiesceSettings{Pools: map[string][]QuiesceConfig{}}, fmt.Errorf("%s: %w", quiescePath, err)
+	}
+	if settings.Pools == nil {
+		settings.Pools = map[string][]QuiesceConfig{}
+	}
+	for pool, configs := range settings.Pools {
+		for _, cfg := range configs {
+			if err := cfg.validate(); err != nil {
+				return &QuiesceSettings{Pools: map[string][]QuiesceConfig{}}, fmt.Errorf("%s: pool %s: %w", quiescePath, pool, err)
+			}
+		}
+	}
+
+	return &settings, nil
+}
+
+func (c QuiesceConfig) validate() error {
+	if strings.Trim(c.Dataset, "/") == "" {
+		return fmt.Errorf("quiesce entry has no dataset")
+	}
+	switch c.Engine {
+	case quiescePostgreSQL:
+		if c.Mode != "" && c.Mode != quiesceModeCheckpoint && c.Mode != quiesceModeBackup {
+			return fmt.Errorf("%s: unknown postgresql mode %q", c.Dataset, c.Mode)
+		}
+	case quiesceMySQL:
+		if c.Mode != "" {
+			return fmt.Errorf("%s: mysql has no modes, got %q", c.Dataset, c.Mode)
+		}
+	default:
+		return fmt.Errorf("%s: unknown engine %q", c.Dataset, c.Engine)
+	}
+	return nil
+}
+
+// quiesceForScope returns the integrations whose dataset is in this run's
+// scope. An integration on a dataset outside the scope is reported but
+// skipped: that dataset is not snapshotted, so there is nothing to quiesce.
+func quiesceForScope(configs []QuiesceConfig, datasets []string) (inScope []QuiesceConfig, skipped []string) {
+	scoped := map[string]bool{}
+	for _, ds := range datasets {
+		scoped[ds] = true
+	}
+	for _, cfg := range configs {
+		if scoped[strings.Trim(cfg.Dataset, "/")] {
+			inScope = append(inScope, cfg)
+		} else {
+			skipped = append(skipped, cfg.Dataset)
+		}
+	}
+	return inScope, skipped
+}
+
+// loadQuiesceForRun loads the integrations that apply to one run's scope.
+func loadQuiesceForRun(pool string, datasets []string, output *strings.Builder) ([]QuiesceConfig, error) {
+	settings, err := LoadQuiesceSettings()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load database quiesce settings: %w", err)
+	}
+	configs, skipped := quiesceForScope(settings.Pools[pool], datasets)
+	for _, ds := range skipped {
+		output.WriteString(fmt.Sprintf("Warning:Database quiesce for %s/%s skipped - the dataset is not in scope\n", pool, ds))
+	}
+	return configs, nil
+}
+
+func (c QuiesceConfig) timeout() time.Duration {
+	if c.TimeoutSeconds > 0 {
+		return time.Duration(c.TimeoutSeconds) * time.Second
+	}
+	return defaultQuiesceTimeout
+}
+
+// clientCommand returns the client executable and arguments for a session
+// that reads SQL on stdin and prints bare result rows, one per line.
+func (c QuiesceConfig) clientCommand() (string, []string) {
+	switch c.Engine {
+	case quiesceMySQL:
+		client := c.Client
+		if client == "" {
+			client = "mysql"
+		}
+		var args []string
+		// The defaults file must be the first option or mysql ignores it.
+		if c.DefaultsFile != "" {
+			args = append(args, "--defaults-extra-file="+c.DefaultsFile)
+		}
+		connectTimeout := min(quiesceConnectTimeout, c.timeout())
+		args = append(args, "--batch", "--skip-column-names", "--unbuffered",
+			"--connect-timeout="+strconv.Itoa(max(int(connectTimeout.Seconds()), 1)))
+		if c.Host != "" {
+			args = append(args, "--host="+c.Host)
+		}
+		if c.Port != 0 {
+			args = append(args, "--port="+strconv.Itoa(c.Port))
+		}
+		if c.Socket != "" {
+			args = append(args, "--socket="+c.Socket)
+		}
+		if c.User != "" {
+			args = append(args, "--user="+c.User)
+		}
+		if c.Database != "" {
+			args = append(args, c.Database)
+		}
+		return client, args
+	default:
+		client := c.Client
+		if client == "" {
+			client = "psql"
+		}
+		// -w: with missing or wrong credentials psql must fail, not prompt
+		// for a password on the terminal the TUI is drawn on.
+		args := []string{"-X", "-q", "-w", "-A", "-t", "-v", "ON_ERROR_STOP=1"}
+		if c.Host != "" {
+			args = append(args, "-h", c.Host)
+		}
+		if c.Port != 0 {
+			args = append(args, "-p", strconv.Itoa(c.Port))
+		}
+		if c.User != "" {
+			args = append(args, "-U", c.User)
+		}
+		if c.Database != "" {
+			args = append(args, "-d", c.Database)
+		}
+		return client, args
+	}
+}
+
+// describe names an integration for the run log.
+func (c QuiesceConfig) describe(pool string) string {
+	method := "FLUSH TABLES WITH READ LOCK"
+	if c.Engine == quiescePostgreSQL {
+		method = "CHECKPOINT"
+		if c.Mode == quiesceModeBackup {
+			method = "pg_backup_start/pg_backup_stop"
+		}
+	}
+	return fmt.Sprintf("%s on %s/%s (%s)", c.Engine, pool, strings.Trim(c.Dataset, "/"), method)
+}
+
+// =============================================================================
+// SQL sessions
+// =============================================================================
+
+// lineBuffer collects a client's output as lines, signalling each write so a
+// reader can wait for more without a goroutine of its own.
+type lineBuffer struct {
+	mu      sync.Mutex
+	partial string
+	lines   []string
+	notify  chan struct{}
+}
+
+func newLineBuffer() *lineBuffer {
+	return &lineBuffer{notify: make(chan struct{}, 1)}
+}
+
+func (b *lineBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	text := b.partial + string(p)
+	parts := strings.Split(text, "\n")
+	b.partial = parts[len(parts)-1]
+	for _, line := range parts[:len(parts)-1] {
+		b.lines = append(b.lines, strings.TrimRight(line, "\r"))
+	}
+	b.mu.Unlock()
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+	return len(p), nil
+}
+
+// from returns the complete lines from index i onwards.
+func (b *lineBuffer) from(i int) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if i >= len(b.lines) {
+		return nil
+	}
+	return append([]string(nil), b.lines[i:]...)
+}
+
+func (b *lineBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.TrimSpace(strings.Join(append(append([]string(nil), b.lines...), b.partial), "\n"))
+}
+
+// sqlSession is a database client kept running so a lock taken by one query
+// is still held when the next query runs.
+type sqlSession struct {
+	client string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *lineBuffer
+	stderr *lineBuffer
+	done   chan struct{}
+	err    error // the client's exit status, valid once done is closed
+	seq    int
+	read   int
+}
+
+func startSQLSession(client string, args []string) (*sqlSession, error) {
+	s := &sqlSession{
+		client: client,
+		cmd:    exec.Command(client, args...),
+		stdout: newLineBuffer(),
+		stderr: newLineBuffer(),
+		done:   make(chan struct{}),
+	}
+	s.cmd.Stdout = s.stdout
+	s.cmd.Stderr = s.stderr
+	stdin, err := s.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	s.stdin = stdin
+	if err := s.cmd.Start(); err != nil {
+		return nil, err
+	}
+	go func() {
+		s.err = s.cmd.Wait()
+		close(s.done)
+	}()
+	return s, nil
+}
+
+// query runs SQL and returns the rows it printed. A marker row selected after
+// the SQL tells us the statements have finished; the client exiting first
+// means one of them failed.
+func (s *sqlSession) query(sql string, timeout time.Duration) ([]string, error) {
+	s.seq++
+	marker := fmt.Sprintf("zfs-backup-quiesce-%d", s.seq)
+	if _, err := fmt.Fprintf(s.stdin, "%s\nSELECT '%s';\n", sql, marker); err != nil {
+		return nil, s.exitError(err)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var rows []string
+	exited := false
+	for {
+		for _, line := range s.stdout.from(s.read) {
+			s.read++
+			if line == marker {
+				return rows, nil
+			}
+			rows = append(rows, line)
+		}
+		if exited {
+			return rows, s.exitError(s.err)
+		}
+		select {
+		case <-s.stdout.notify:
+		case <-s.done:
+			// Pick up anything written just before the exit, then give up.
+			exited = true
+		case <-timer.C:
+			return rows, fmt.Errorf("timed out after %v", timeout)
+		}
+	}
+}
+
+func (s *sqlSession) exitError(err error) error {
+	if msg := s.stderr.String(); msg != "" {
+		return fmt.Errorf("%s: %s", s.client, msg)
+	}
+	if err == nil {
+		err = fmt.Errorf("exited unexpectedly")
+	}
+	return fmt.Errorf("%s: %w", s.client, err)
+}
+
+// close ends the session, which releases anything it still holds. A client
+// that does not exit in time is killed - the server then drops the session
+// and its locks regardless.
+func (s *sqlSession) close(timeout time.Duration) error {
+	_ = s.stdin.Close()
+	select {
+	case <-s.done:
+		return nil
+	case <-time.After(timeout):
+		_ = s.cmd.Process.Kill()
+		<-s.done
+		return fmt.Errorf("%s did not exit within %v and was killed", s.client, timeout)
+	}
+}
+
+// =============================================================================
+// Quiescing around the snapshot
+// =============================================================================
+
+// dbQuiesce is one integration in progress.
+type dbQuiesce struct {
+	cfg     QuiesceConfig
+	pool    string
+	session *sqlSession
+}
+
+// start puts the database into a consistent state. On error nothing is held.
+func (q *dbQuiesce) start() error {
+	client, args := q.cfg.clientCommand()
+	session, err := startSQLSession(client, args)
+	if err != nil {
+		return err
+	}
+
+	var sql string
+	switch {
+	case q.cfg.Engine == quiesceMySQL:
+		sql = "FLUSH TABLES WITH READ LOCK;"
+	case q.cfg.Mode == quiesceModeBackup:
+		sql = "SELECT pg_backup_start('zfs-backup', true);"
+	default:
+		sql = "CHECKPOINT;"
+	}
+	if _, err := session.query(sql, q.cfg.timeout()); err != nil {
+		_ = session.close(q.cfg.timeout())
+		return err
+	}
+
+	// A checkpoint holds nothing, so its session can go straight away.
+	if q.cfg.Engine == quiescePostgreSQL && q.cfg.Mode != quiesceModeBackup {
+		return session.close(q.cfg.timeout())
+	}
+	q.session = session
+	return nil
+}
+
+// release undoes start. In backup mode the label pg_backup_stop returns is
+// saved next to the reports, because restoring the snapshot needs it as
+// backup_label. The session is closed whatever happens.
+func (q *dbQuiesce) release(snapshotTag string, output *strings.Builder) error {
+	if q.session == nil {
+		return nil
+	}
+	session := q.session
+	q.session = nil
+
+	var sql string
+	if q.cfg.Engine == quiesceMySQL {
+		sql = "UNLOCK TABLES;"
+	} else {
+		sql = "SELECT labelfile FROM pg_backup_stop(true);"
+	}
+	rows, err := session.query(sql, q.cfg.timeout())
+	closeErr := session.close(q.cfg.timeout())
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	if q.cfg.Engine == quiescePostgreSQL && len(rows) > 0 {
+		path, err := saveBackupLabel(q.pool, q.cfg.Dataset, snapshotTag, strings.Join(rows, "\n")+"\n")
+		if err != nil {
+			return fmt.Errorf("failed to save backup label: %w", err)
+		}
+		output.WriteString(fmt.Sprintf("   Saved backup label to %s\n", path))
+	}
+	return nil
+}
+
+// snapshotQuiesced takes the run's snapshots with every configured database
+// quiesced. Databases are quiesced in order and released in reverse; if one
+// cannot be quiesced, the ones already held are released and no snapshot is
+// taken. A failed release is a warning - the snapshot itself exists - except
+// that the database is always unlocked.
+func snapshotQuiesced(ctx context.Context, r commandRunner, pool string, datasets []string, tag string, configs []QuiesceConfig, output *strings.Builder) ([]string, error) {
+	var held []*dbQuiesce
+	defer func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			q := held[i]
+			if err := q.release(tag, output); err != nil {
+				output.WriteString(fmt.Sprintf("Warning:Releasing %s failed: %v\n", q.cfg.describe(pool), err))
+			} else {
+				output.WriteString(fmt.Sprintf("Released %s\n", q.cfg.describe(pool)))
+			}
+		}
+	}()
+
+	for _, cfg := range configs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		q := &dbQuiesce{cfg: cfg, pool: pool}
+		output.WriteString(fmt.Sprintf("Quiescing %s\n", cfg.describe(pool)))
+		if err := q.start(); err != nil {
+			return nil, fmt.Errorf("failed to quiesce %s: %w", cfg.describe(pool), err)
+		}
+		held = append(held, q)
+	}
+
+	return createDatasetSnapshots(ctx, r, pool, datasets, tag)
+}
+
+// getBackupLabelsDir returns the directory holding PostgreSQL backup labels,
+// creating it if needed.
+func getBackupLabelsDir() (string, error) {
+	home, err := getRealUserHome()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(home, ".local", "share", "zfs-backup", "backup-labels")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	chownToRealUser(dir)
+	return dir, nil
+}
+
+// saveBackupLabel stores a backup label as POOL-DATASET@TAG.backup_label.
+func saveBackupLabel(pool, dataset, tag, label string) (string, error) {
+	dir, err := getBackupLabelsDir()
+	if err != nil {
+		return "", err
+	}
+	name := strings.ReplaceAll(fmt.Sprintf("%s/%s", pool, strings.Trim(dataset, "/")), "/", "-") + "@" + tag + ".backup_label"
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(label), 0644); err != nil {
+		return "", err
+	}
+	chownToRealUser(path)
+	return path, nil
+}
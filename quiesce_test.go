@@ -0,0 +1,201 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSQLClient writes a stand-in for psql/mysql: it logs every statement it
+// reads, answers the session's marker selects, prints a label for
+// pg_backup_stop, and exits with an error on any statement containing "failOn".
+func fakeSQLClient(t *testing.T, failOn string) (client, logPath string) {
+	t.Helper()
+	dir := t.TempDir()
+	logPath = filepath.Join(dir, "statements")
+	script := `#!/bin/sh
+while IFS= read -r line; do
+  echo "$line" >> ` + logPath + `
+  case "$line" in
+    *"` + failOn + `"*) echo "ERROR: refused" >&2; exit 1 ;;
+    "SELECT 'zfs-backup-quiesce-"*) echo "$line" | sed "s/^SELECT '\(.*\)';$/\1/" ;;
+    "SELECT labelfile"*) echo "START WAL LOCATION: 0/2000028"; echo "LABEL: zfs-backup" ;;
+  esac
+done
+echo "closed" >> ` + logPath + `
+`
+	client = filepath.Join(dir, "client")
+	if err := os.WriteFile(client, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return client, logPath
+}
+
+func readStatements(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statements []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if !strings.HasPrefix(line, "SELECT 'zfs-backup-quiesce-") {
+			statements = append(statements, line)
+		}
+	}
+	return statements
+}
+
+func TestMySQLLockIsHeldAcrossSnapshot(t *testing.T) {
+	client, logPath := fakeSQLClient(t, "never-fails")
+	var atSnapshot []string
+	runner := &fakeRunner{respond: func(name string, args []string) (string, error) {
+		atSnapshot = readStatements(t, logPath)
+		return "", nil
+	}}
+
+	var output strings.Builder
+	configs := []QuiesceConfig{{Dataset: "mysql", Engine: quiesceMySQL, Client: client}}
+	created, err := snapshotQuiesced(context.Background(), runner, "NIXROOT", []string{"mysql"}, "tag", configs, &output)
+	if err != nil || len(created) != 1 {
+		t.Fatalf("expected one snapshot, got %v (%v)\n%s", created, err, output.String())
+	}
+
+	if want := []string{"FLUSH TABLES WITH READ LOCK;"}; !reflect.DeepEqual(atSnapshot, want) {
+		t.Errorf("the read lock must be held, and not yet released, while snapshotting: %v", atSnapshot)
+	}
+	if want := []string{"FLUSH TABLES WITH READ LOCK;", "UNLOCK TABLES;", "closed"}; !reflect.DeepEqual(readStatements(t, logPath), want) {
+		t.Errorf("expected the lock released and the session closed, got %v", readStatements(t, logPath))
+	}
+}
+
+func TestUnlockHappensEvenWhenSnapshotFails(t *testing.T) {
+	client, logPath := fakeSQLClient(t, "never-fails")
+	runner := &fakeRunner{respond: func(name string, args []string) (string, error) {
+		return "", errors.New("out of space")
+	}}
+
+	var output strings.Builder
+	configs := []QuiesceConfig{{Dataset: "mysql", Engine: quiesceMySQL, Client: client}}
+	if _, err := snapshotQuiesced(context.Background(), runner, "NIXROOT", []string{"mysql"}, "tag", configs, &output); err == nil {
+		t.Fatal("a failed snapshot must fail the stage")
+	}
+
+	if want := []string{"FLUSH TABLES WITH READ LOCK;", "UNLOCK TABLES;", "closed"}; !reflect.DeepEqual(readStatements(t, logPath), want) {
+		t.Errorf("the database must be unlocked after a failed snapshot, got %v", readStatements(t, logPath))
+	}
+}
+
+func TestFailedQuiesceReleasesEarlierLocksAndSkipsSnapshot(t *testing.T) {
+	okClient, okLog := fakeSQLClient(t, "never-fails")
+	badClient, _ := fakeSQLClient(t, "CHECKPOINT")
+	runner := &fakeRunner{}
+
+	var output strings.Builder
+	configs := []QuiesceConfig{
+		{Dataset: "mysql", Engine: quiesceMySQL, Client: okClient},
+		{Dataset: "postgres", Engine: quiescePostgreSQL, Client: badClient},
+	}
+	_, err := snapshotQuiesced(context.Background(), runner, "NIXROOT", []string{"mysql", "postgres"}, "tag", configs, &output)
+
+	if err == nil || !strings.Contains(err.Error(), "refused") {
+		t.Fatalf("a database that cannot be quiesced must abort with the client's error, got %v", err)
+	}
+	if runner.mentions("snapshot") {
+		t.Errorf("nothing may be snapshotted unquiesced, ran %v", runner.commandLines())
+	}
+	if want := []string{"FLUSH TABLES WITH READ LOCK;", "UNLOCK TABLES;", "closed"}; !reflect.DeepEqual(readStatements(t, okLog), want) {
+		t.Errorf("locks already taken must be released, got %v", readStatements(t, okLog))
+	}
+}
+
+func TestPostgreSQLBackupModeSavesLabel(t *testing.T) {
+	useTempHome(t)
+	client, logPath := fakeSQLClient(t, "never-fails")
+	runner := &fakeRunner{}
+
+	var output strings.Builder
+	configs := []QuiesceConfig{{Dataset: "postgres", Engine: quiescePostgreSQL, Mode: quiesceModeBackup, Client: client}}
+	if _, err := snapshotQuiesced(context.Background(), runner, "NIXROOT", []string{"postgres"}, "tag", configs, &output); err != nil {
+		t.Fatalf("unexpected error: %v\n%s", err, output.String())
+	}
+
+	statements := readStatements(t, logPath)
+	if len(statements) != 3 || !strings.Contains(statements[0], "pg_backup_start") || !strings.Contains(statements[1], "pg_backup_stop") {
+		t.Errorf("expected pg_backup_start then pg_backup_stop in one session, got %v", statements)
+	}
+	dir, _ := getBackupLabelsDir()
+	label, err := os.ReadFile(filepath.Join(dir, "NIXROOT-postgres@tag.backup_label"))
+	if err != nil || !strings.Contains(string(label), "LABEL: zfs-backup") {
+		t.Errorf("the backup label is needed to restore the snapshot and must be saved, got %q (%v)", label, err)
+	}
+}
+
+func TestQuiesceTimesOut(t *testing.T) {
+	dir := t.TempDir()
+	client := filepath.Join(dir, "hang")
+	if err := os.WriteFile(client, []byte("#!/bin/sh\nexec sleep 60\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	q := &dbQuiesce{cfg: QuiesceConfig{Dataset: "mysql", Engine: quiesceMySQL, Client: client, TimeoutSeconds: 1}, pool: "NIXROOT"}
+	start := time.Now()
+	if err := q.start(); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("a database that does not answer must time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("timing out took %v", elapsed)
+	}
+}
+
+func TestQuiesceForScopeSkipsDatasetsOutOfScope(t *testing.T) {
+	configs := []QuiesceConfig{
+		{Dataset: "postgres", Engine: quiescePostgreSQL},
+		{Dataset: "/mysql/", Engine: quiesceMySQL},
+	}
+	inScope, skipped := quiesceForScope(configs, []string{"home", "mysql"})
+	if len(inScope) != 1 || inScope[0].Engine != quiesceMySQL {
+		t.Errorf("only integrations on datasets in scope apply, got %v", inScope)
+	}
+	if !reflect.DeepEqual(skipped, []string{"postgres"}) {
+		t.Errorf("integrations out of scope should be reported, got %v", skipped)
+	}
+}
+
+func TestQuiesceClientsNeverPromptOrHang(t *testing.T) {
+	_, args := QuiesceConfig{Engine: quiescePostgreSQL, Host: "/run/postgresql"}.clientCommand()
+	if !reflect.DeepEqual(args[:3], []string{"-X", "-q", "-w"}) {
+		t.Errorf("psql must never prompt for a password, got %v", args)
+	}
+
+	_, args = QuiesceConfig{Engine: quiesceMySQL, DefaultsFile: "/root/.my.cnf"}.clientCommand()
+	if args[0] != "--defaults-extra-file=/root/.my.cnf" || !strings.Contains(strings.Join(args, " "), "--connect-timeout=10") {
+		t.Errorf("mysql must give up connecting well within the quiesce window, got %v", args)
+	}
+	_, args = QuiesceConfig{Engine: quiesceMySQL, TimeoutSeconds: 3}.clientCommand()
+	if !strings.Contains(strings.Join(args, " "), "--connect-timeout=3") {
+		t.Errorf("the connect timeout must not outlast a shorter step timeout, got %v", args)
+	}
+}
+
+func TestLoadQuiesceSettingsRejectsUnknownEngine(t *testing.T) {
+	useTempHome(t)
+	path, _ := getQuiesceFilePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`{"pools": {"NIXROOT": [{"dataset": "db", "engine": "oracle"}]}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadQuiesceSettings(); err == nil {
+		t.Error("an unknown engine must fail loudly rather than skip the quiesce")
+	}
+}
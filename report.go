@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -13,22 +14,22 @@ import (
 
 // PoolInventoryDataset holds ZFS dataset properties for reporting
 type PoolInventoryDataset struct {
-	Name       string
-	Used       string
-	Available  string
-	Refer      string
-	Mountpoint string
-	Quota      string
-	Compress   string
+	Name       string `json:"name"`
+	Used       string `json:"used"`
+	Available  string `json:"available"`
+	Refer      string `json:"refer"`
+	Mountpoint string `json:"mountpoint"`
+	Quota      string `json:"quota,omitempty"`
+	Compress   string `json:"compression,omitempty"`
 }
 
 // PoolInventory holds pool and dataset information for the report
 type PoolInventory struct {
-	PoolName    string
-	StatusText  string // Raw output from zpool status
-	UsageText   string // Raw output from zpool list -v
-	Datasets    []PoolInventoryDataset
-	SnapshotText string // Raw output from zfs list -t snapshot
+	PoolName    string                 `json:"pool"`
+	StatusText  string                 `json:"status_text,omitempty"`   // Raw output from zpool status
+	UsageText   string                 `json:"usage_text,omitempty"`    // Raw output from zpool list -v
+	Datasets    []PoolInventoryDataset `json:"datasets,omitempty"`
+	SnapshotText string                `json:"snapshot_text,omitempty"` // Raw output from zfs list -t snapshot
 }
 
 // ReportInfo holds the context needed to generate a backup report
@@ -41,10 +42,26 @@ type ReportInfo struct {
 	EndTime         time.Time
 	DatasetProgress []DatasetProgress
 	Success         bool
+	Partial         bool // Finished, but some datasets failed to replicate
 	ErrorMessage    string
 	OperationLog    string // The raw output from the backup operation
 	SourceInventory *PoolInventory
 	DestInventory   *PoolInventory
+	Comparison      *runComparison    // nil for the first run of its kind
+	DestStats       *destinationStats // backup pool capacity and snapshot counts, if captured
+	PoolHistory     []poolUsagePoint  // backup pool capacity over past runs, for the PDF chart
+
+	runFindings // what the run measured and did, as its perform* function returned it
+}
+
+// runFindings is what a run measured and did that its report, history and
+// notification show. The perform* functions return it alongside their log,
+// so none of it depends on the wording of a log line.
+type runFindings struct {
+	SnapshotsPruned int          // on the source and the backup pool
+	ChangeRates     []changeRate // what each dataset wrote since its previous backup
+	Anomalies       []string     // change-rate anomalies, described
+	Labelled        []string     // labelled snapshots replicated or re-pinned
 }
 
 // getRealUserHome returns the home directory of the real user, even when running
@@ -143,6 +160,9 @@ func generateMarkdownReport(info ReportInfo) string {
 	b.WriteString(writeNarrativeSummary(info, totalDuration))
 	b.WriteString("\n")
 
+	writeMarkdownChangeAnomalies(&b, info.Anomalies)
+	writeMarkdownLabelledSnapshots(&b, info.Labelled)
+
 	// Technical summary table
 	b.WriteString("## Technical Summary\n\n")
 	b.WriteString("| | |\n")
@@ -313,6 +333,8 @@ func generateMarkdownReport(info ReportInfo) string {
 		b.WriteString(fmt.Sprintf("```\n%s\n```\n\n", info.ErrorMessage))
 	}
 
+	writeMarkdownComparison(&b, info.Comparison)
+
 	// Pool Inventory sections
 	writeMarkdownPoolInventory(&b, info.SourceInventory, "Source Pool")
 	writeMarkdownPoolInventory(&b, info.DestInventory, "Destination Pool")
@@ -537,36 +559,59 @@ func collectPoolInventory(pool string) *PoolInventory {
 	return inv
 }
 
-// writeBackupReport writes the report as markdown and attempts PDF conversion.
-// Returns the paths to the generated files and any error.
-func writeBackupReport(info ReportInfo) (mdPath, pdfPath string, err error) {
+// writeBackupReport writes the report as markdown plus the other formats
+// configured in reports.json. Returns the paths to the generated files; only a
+// failure to write the markdown is an error, other formats are best effort.
+func writeBackupReport(info ReportInfo) (reportFiles, error) {
+	var files reportFiles
 	dir, err := getReportsDir()
 	if err != nil {
-		return "", "", fmt.Errorf("failed to create reports directory: %w", err)
+		return files, fmt.Errorf("failed to create reports directory: %w", err)
+	}
+	config, err := LoadReportConfig()
+	if err != nil {
+		return files, err
 	}
 
 	baseName := generateReportFilename(info)
-	mdPath = filepath.Join(dir, baseName+".md")
-	pdfPath = filepath.Join(dir, baseName+".pdf")
+	mdPath := filepath.Join(dir, baseName+".md")
 
 	markdown := generateMarkdownReport(info)
 
 	if err := os.WriteFile(mdPath, []byte(markdown), 0644); err != nil {
-		return "", "", fmt.Errorf("failed to write markdown report: %w", err)
+		return files, fmt.Errorf("failed to write markdown report: %w", err)
 	}
+	files.Markdown = mdPath
 
-	pdfErr := generatePDF(info, pdfPath)
-	if pdfErr != nil {
-		pdfPath = ""
+	if config.wants(reportPDF) {
+		pdfPath := filepath.Join(dir, baseName+".pdf")
+		if err := generatePDF(info, pdfPath); err == nil {
+			files.PDF = pdfPath
+		}
+	}
+	if config.wants(reportHTML) {
+		htmlPath := filepath.Join(dir, baseName+".html")
+		if err := os.WriteFile(htmlPath, []byte(generateHTMLReport(info)), 0644); err == nil {
+			files.HTML = htmlPath
+		}
+	}
+	if config.wants(reportJSON) {
+		jsonPath := filepath.Join(dir, baseName+".json")
+		if data, err := generateJSONReport(info); err == nil {
+			if err := os.WriteFile(jsonPath, append(data, '\n'), 0644); err == nil {
+				files.JSON = jsonPath
+			}
+		}
 	}
 
 	// Fix file ownership when running under sudo so the real user can access them
-	chownToRealUser(mdPath)
-	if pdfPath != "" {
-		chownToRealUser(pdfPath)
+	for _, path := range []string{files.Markdown, files.PDF, files.HTML, files.JSON} {
+		if path != "" {
+			chownToRealUser(path)
+		}
 	}
 
-	return mdPath, pdfPath, nil
+	return files, nil
 }
 
 // chownToRealUser changes file ownership to the real user when running under sudo
@@ -733,19 +778,8 @@ func generatePDF(info ReportInfo, pdfPath string) error {
 	totalDuration := info.EndTime.Sub(info.StartTime)
 
 	// Header bar
-	pdf.SetFillColor(dark[0], dark[1], dark[2])
-	pdf.Rect(0, 0, 210, 28, "F")
-	pdf.SetTextColor(gold[0], gold[1], gold[2])
-	pdf.SetFont("Helvetica", "B", 18)
-	pdf.SetXY(15, 8)
-	pdf.CellFormat(0, 10, "Kartoza ZFS Backup Report", "", 1, "L", false, 0, "")
-	pdf.SetTextColor(blue[0], blue[1], blue[2])
-	pdf.SetFont("Helvetica", "", 9)
-	pdf.SetXY(15, 18)
-	pdf.CellFormat(0, 5, fmt.Sprintf("%s v%s  |  %s",
-		appName, appVersion, info.StartTime.Format("Monday, 02 January 2006 at 15:04")), "", 1, "L", false, 0, "")
-
-	pdf.Ln(10)
+	pdfHeaderBar(pdf, dark, gold, blue, "Kartoza ZFS Backup Report",
+		info.StartTime.Format("Monday, 02 January 2006 at 15:04"))
 
 	// Result banner
 	pdf.SetFont("Helvetica", "B", 14)
@@ -769,6 +803,9 @@ func generatePDF(info ReportInfo, pdfPath string) error {
 	pdf.MultiCell(0, 4.5, narrative, "", "L", false)
 	pdf.Ln(3)
 
+	pdfChangeAnomalySection(pdf, info.Anomalies, dark, gray, red)
+	pdfLabelledSnapshotSection(pdf, info.Labelled, dark, gray)
+
 	// Technical Summary section
 	pdfSectionHeader(pdf, dark, gray, "Technical Summary")
 
@@ -963,6 +1000,12 @@ func generatePDF(info ReportInfo, pdfPath string) error {
 		pdf.Ln(3)
 	}
 
+	// Charts
+	pdfChartsSection(pdf, info, dark, gray, red, teal, gold, blue)
+
+	// Compared with the previous run
+	pdfComparisonSection(pdf, info.Comparison, dark, gray, red)
+
 	// Pool Inventory: Source
 	pdfPoolInventorySection(pdf, info.SourceInventory, "Source Pool", dark, gray, teal)
 
@@ -999,14 +1042,35 @@ func generatePDF(info ReportInfo, pdfPath string) error {
 	pdf.Ln(5)
 
 	// Footer
+	pdfFooter(pdf, gray)
+
+	return pdf.OutputFileAndClose(pdfPath)
+}
+
+// pdfHeaderBar renders the dark Kartoza title bar across the top of the page
+func pdfHeaderBar(pdf *fpdf.Fpdf, dark, gold, blue [3]int, title, subtitle string) {
+	pdf.SetFillColor(dark[0], dark[1], dark[2])
+	pdf.Rect(0, 0, 210, 28, "F")
+	pdf.SetTextColor(gold[0], gold[1], gold[2])
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.SetXY(15, 8)
+	pdf.CellFormat(0, 10, title, "", 1, "L", false, 0, "")
+	pdf.SetTextColor(blue[0], blue[1], blue[2])
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.SetXY(15, 18)
+	pdf.CellFormat(0, 5, fmt.Sprintf("%s v%s  |  %s", appName, appVersion, subtitle), "", 1, "L", false, 0, "")
+
+	pdf.Ln(10)
+}
+
+// pdfFooter renders the closing rule and credit line
+func pdfFooter(pdf *fpdf.Fpdf, gray [3]int) {
 	pdf.SetDrawColor(gray[0], gray[1], gray[2])
 	pdf.Line(15, pdf.GetY(), 195, pdf.GetY())
 	pdf.Ln(3)
 	pdf.SetFont("Helvetica", "I", 8)
 	pdf.SetTextColor(gray[0], gray[1], gray[2])
 	pdf.CellFormat(0, 4, fmt.Sprintf("%s v%s  |  Made with love by Kartoza  |  %s", appName, appVersion, kartozaURL), "", 1, "C", false, 0, "")
-
-	return pdf.OutputFileAndClose(pdfPath)
 }
 
 // pdfKeyValue renders a key-value pair in the PDF
@@ -1102,3 +1166,49 @@ func datasetStatusBadge(status DatasetSyncStatus) string {
 		return "[-]"
 	}
 }
+
+// cliReportInfo builds the report info for a run started from the command
+// line, which has no result screen to collect per-dataset progress from. An
+// incomplete run names its failed datasets; the rest of a local source's scope
+// is taken to have replicated.
+func cliReportInfo(operation, source, destination, remoteHost string, started time.Time, log string, findings runFindings, runErr error) ReportInfo {
+	info := ReportInfo{
+		Operation:    operation,
+		SourcePool:   source,
+		DestPool:     destination,
+		RemoteHost:   remoteHost,
+		StartTime:    started,
+		EndTime:      time.Now(),
+		Success:      runErr == nil,
+		OperationLog: log,
+		DestStats:    peekDestinationStats(destination),
+		runFindings:  findings,
+	}
+
+	failed := map[string]bool{}
+	if runErr != nil {
+		info.ErrorMessage = runErr.Error()
+		var incomplete *incompleteError
+		if !errors.As(runErr, &incomplete) {
+			return info
+		}
+		info.Partial = true
+		for _, ds := range incomplete.failed {
+			failed[ds] = true
+			info.DatasetProgress = append(info.DatasetProgress, DatasetProgress{Name: ds, Status: DatasetError})
+		}
+	}
+
+	// A pulled run's scope lives on the remote host.
+	if operation == "remote-backup" {
+		return info
+	}
+	if datasets, _, err := resolveBackupDatasets(source); err == nil {
+		for _, ds := range datasets {
+			if !failed[ds] {
+				info.DatasetProgress = append(info.DatasetProgress, DatasetProgress{Name: ds, Status: DatasetDone})
+			}
+		}
+	}
+	return info
+}
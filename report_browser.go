@@ -0,0 +1,722 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// =============================================================================
+// Report browser - status, filters, search and side-by-side comparison
+// =============================================================================
+//
+// Browse Reports lists every run's report. Each entry's outcome and host are
+// read from its JSON or markdown when the list loads, so the list can show a
+// status column and be narrowed by operation, status, host and date. Search
+// looks inside the markdown, and two marked reports can be compared line by
+// line.
+
+// reportReader reads report files, decompressing each monthly archive once
+// however many of its reports are read, and only the markdown and JSON the
+// browser reads from it - never the PDFs and HTML beside them.
+type reportReader struct {
+	wanted   map[string]map[string]bool // archive path -> members to read
+	archives map[string]map[string][]byte
+}
+
+// newReportReader returns a reader for the markdown and JSON of entries.
+func newReportReader(entries ...reportEntry) *reportReader {
+	r := &reportReader{wanted: map[string]map[string]bool{}}
+	for _, entry := range entries {
+		for _, path := range []string{entry.Path, entry.JSONPath} {
+			archivePath, member, ok := splitArchivePath(path)
+			if !ok {
+				continue
+			}
+			if r.wanted[archivePath] == nil {
+				r.wanted[archivePath] = map[string]bool{}
+			}
+			r.wanted[archivePath][member] = true
+		}
+	}
+	return r
+}
+
+// read returns a report file's contents, like readReportFile. A file the
+// reader was not made for is read on its own.
+func (r *reportReader) read(path string) ([]byte, error) {
+	archivePath, member, ok := splitArchivePath(path)
+	if !ok || !r.wanted[archivePath][member] {
+		return readReportFile(path)
+	}
+	files, cached := r.archives[archivePath]
+	if !cached {
+		members, err := readReportArchive(archivePath, r.wanted[archivePath])
+		if err != nil {
+			return nil, err
+		}
+		files = map[string][]byte{}
+		for _, m := range members {
+			if m.data != nil {
+				files[m.name] = m.data
+			}
+		}
+		if r.archives == nil {
+			r.archives = map[string]map[string][]byte{}
+		}
+		r.archives[archivePath] = files
+	}
+	data, found := files[member]
+	if !found {
+		return nil, fmt.Errorf("%s: no %s in archive", archivePath, member)
+	}
+	return data, nil
+}
+
+// summariseReport reads a report's outcome (notifySuccess, notifyPartial or
+// notifyFailure) and the remote host it ran against, from its JSON or else
+// its markdown. The outcome is empty when neither can be read. The markdown
+// only records success or failure, so a partial run written without JSON
+// shows as failed.
+func summariseReport(entry reportEntry, read func(string) ([]byte, error)) (outcome, remoteHost string) {
+	if entry.JSONPath != "" {
+		if data, err := read(entry.JSONPath); err == nil {
+			var report struct {
+				Outcome    string `json:"outcome"`
+				Success    bool   `json:"success"`
+				RemoteHost string `json:"remote_host"`
+			}
+			if json.Unmarshal(data, &report) == nil {
+				outcome = report.Outcome
+				if outcome == "" {
+					outcome = notifyFailure
+					if report.Success {
+						outcome = notifySuccess
+					}
+				}
+				return outcome, hostOnly(report.RemoteHost)
+			}
+		}
+	}
+	if entry.Path != "" {
+		if data, err := read(entry.Path); err == nil {
+			scanner := bufio.NewScanner(bytes.NewReader(data))
+			for i := 0; i < 40 && scanner.Scan(); i++ {
+				line := strings.TrimSpace(scanner.Text())
+				switch {
+				case line == "**Result: BACKUP COMPLETED SUCCESSFULLY**":
+					outcome = notifySuccess
+				case line == "**Result: BACKUP FAILED**":
+					outcome = notifyFailure
+				case strings.HasPrefix(line, "| **Remote Host** |"):
+					value := strings.TrimPrefix(line, "| **Remote Host** |")
+					remoteHost = hostOnly(strings.Trim(value, " |`"))
+				}
+			}
+		}
+	}
+	return outcome, remoteHost
+}
+
+// hostOnly strips the user@ from an ssh destination.
+func hostOnly(destination string) string {
+	if idx := strings.LastIndex(destination, "@"); idx >= 0 {
+		return destination[idx+1:]
+	}
+	return destination
+}
+
+// summariseReports fills in each report's status and host. Runs against no
+// remote host are credited to this machine.
+func summariseReports(entries []reportEntry, localHost string) {
+	reader := newReportReader(entries...)
+	for i := range entries {
+		entries[i].Status, entries[i].Host = summariseReport(entries[i], reader.read)
+		if entries[i].Host == "" {
+			entries[i].Host = localHost
+		}
+	}
+}
+
+// reportStatusLabel is the status column's text for an outcome.
+func reportStatusLabel(status string) string {
+	switch status {
+	case notifySuccess:
+		return "OK"
+	case notifyPartial:
+		return "PARTIAL"
+	case notifyFailure:
+		return "FAILED"
+	default:
+		return "?"
+	}
+}
+
+// =============================================================================
+// Filtering and search
+// =============================================================================
+
+// reportFilter narrows the report list. Zero values match everything.
+type reportFilter struct {
+	Operation string    // name prefix, e.g. PullBackup
+	Status    string    // notifySuccess, notifyPartial or notifyFailure
+	Host      string    // machine the run involved
+	From      time.Time // run started at or after
+	To        time.Time // run started before
+	Query     string    // text the markdown must contain
+}
+
+// active reports whether any filter is set.
+func (f reportFilter) active() bool {
+	return f != reportFilter{}
+}
+
+// matches reports whether a report passes the filter. found holds the names
+// of the reports whose markdown contains the query.
+func (f reportFilter) matches(entry reportEntry, found map[string]bool) bool {
+	if f.Operation != "" && reportKind(entry) != f.Operation {
+		return false
+	}
+	if f.Status != "" && entry.Status != f.Status {
+		return false
+	}
+	if f.Host != "" && !strings.EqualFold(entry.Host, f.Host) {
+		return false
+	}
+	started := reportTime(entry)
+	if !f.From.IsZero() && started.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !started.Before(f.To) {
+		return false
+	}
+	if f.Query != "" && !found[entry.Name] {
+		return false
+	}
+	return true
+}
+
+// filterReports returns the reports passing the filter, in list order.
+func filterReports(entries []reportEntry, f reportFilter, found map[string]bool) []reportEntry {
+	var matched []reportEntry
+	for _, entry := range entries {
+		if f.matches(entry, found) {
+			matched = append(matched, entry)
+		}
+	}
+	return matched
+}
+
+// describe summarises the active filters for the list header.
+func (f reportFilter) describe() string {
+	var parts []string
+	if f.Operation != "" {
+		parts = append(parts, "operation "+f.Operation)
+	}
+	if f.Status != "" {
+		parts = append(parts, "status "+reportStatusLabel(f.Status))
+	}
+	if f.Host != "" {
+		parts = append(parts, "host "+f.Host)
+	}
+	switch {
+	case !f.From.IsZero() && !f.To.IsZero():
+		parts = append(parts, fmt.Sprintf("%s to %s", f.From.Format("2006-01-02"), f.To.AddDate(0, 0, -1).Format("2006-01-02")))
+	case !f.From.IsZero():
+		parts = append(parts, "since "+f.From.Format("2006-01-02 15:04"))
+	case !f.To.IsZero():
+		parts = append(parts, "until "+f.To.AddDate(0, 0, -1).Format("2006-01-02"))
+	}
+	if f.Query != "" {
+		parts = append(parts, fmt.Sprintf("containing %q", f.Query))
+	}
+	return strings.Join(parts, " • ")
+}
+
+// parseReportRange parses the date range prompt: a start accepted by
+// parseSince (7d, 36h, 2026-09-01), or FROM..TO with dates. TO is inclusive,
+// and either side may be left empty. An empty range clears the filter.
+func parseReportRange(value string, now time.Time) (from, to time.Time, err error) {
+	value = strings.TrimSpace(value)
+	start, end, isRange := strings.Cut(value, "..")
+	if start = strings.TrimSpace(start); start != "" {
+		if from, err = parseSince(start, now); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid start %q - use a date like 2026-09-01 or a duration like 7d", start)
+		}
+	}
+	if end = strings.TrimSpace(end); isRange && end != "" {
+		day, err := time.ParseInLocation("2006-01-02", end, now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid end %q - use a date like 2026-09-30", end)
+		}
+		to = day.AddDate(0, 0, 1)
+	}
+	return from, to, nil
+}
+
+// nextValue cycles through the choices, with "" (no filter) before the first.
+func nextValue(current string, choices []string) string {
+	for i, choice := range choices {
+		if choice == current && i+1 < len(choices) {
+			return choices[i+1]
+		}
+	}
+	if current == "" && len(choices) > 0 {
+		return choices[0]
+	}
+	return ""
+}
+
+// reportChoices lists the distinct values of a report field, sorted.
+func reportChoices(entries []reportEntry, value func(reportEntry) string) []string {
+	seen := map[string]bool{}
+	var choices []string
+	for _, entry := range entries {
+		if v := value(entry); v != "" && !seen[v] {
+			seen[v] = true
+			choices = append(choices, v)
+		}
+	}
+	sort.Strings(choices)
+	return choices
+}
+
+// reportSearchMsg carries the reports whose markdown contains a query.
+type reportSearchMsg struct {
+	query string
+	found map[string]bool
+}
+
+// searchReports looks for query, case-insensitively, in every report's
+// markdown, or its JSON where there is no markdown. Reports that cannot be
+// read do not match.
+func searchReports(entries []reportEntry, query string) tea.Cmd {
+	return func() tea.Msg {
+		needle := strings.ToLower(query)
+		reader := newReportReader(entries...)
+		found := map[string]bool{}
+		for _, entry := range entries {
+			data, err := reader.read(entry.viewPath())
+			if err == nil && strings.Contains(strings.ToLower(string(data)), needle) {
+				found[entry.Name] = true
+			}
+		}
+		return reportSearchMsg{query: query, found: found}
+	}
+}
+
+// =============================================================================
+// Side-by-side comparison
+// =============================================================================
+
+// maxDiffCells bounds the line diff's table. Beyond it, the differing middle
+// of two reports is shown as one changed block rather than aligned.
+const maxDiffCells = 4 << 20
+
+// diffRow is one row of a side-by-side diff. A row with only Left was
+// removed, one with only Right was added, and one with both that differ was
+// changed.
+type diffRow struct {
+	Left, Right       string
+	HasLeft, HasRight bool
+}
+
+// changed reports whether the row differs between the two sides.
+func (r diffRow) changed() bool {
+	return r.HasLeft != r.HasRight || r.Left != r.Right
+}
+
+// diffLines aligns two texts line by line on their longest common
+// subsequence. Runs of removed and added lines are paired up so a changed
+// line sits beside its replacement.
+func diffLines(a, b []string) []diffRow {
+	// Trim the common prefix and suffix, which is most of two reports.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var rows []diffRow
+	for _, line := range a[:prefix] {
+		rows = append(rows, diffRow{Left: line, Right: line, HasLeft: true, HasRight: true})
+	}
+	rows = append(rows, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		rows = append(rows, diffRow{Left: line, Right: line, HasLeft: true, HasRight: true})
+	}
+	return rows
+}
+
+// diffMiddle diffs the part of two texts between their common prefix and
+// suffix.
+func diffMiddle(a, b []string) []diffRow {
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		return pairChanges(a, b)
+	}
+
+	// lcs[i][j] is the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var rows []diffRow
+	var removed, added []string
+	flush := func() {
+		rows = append(rows, pairChanges(removed, added)...)
+		removed, added = nil, nil
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			flush()
+			rows = append(rows, diffRow{Left: a[i], Right: b[j], HasLeft: true, HasRight: true})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			removed = append(removed, a[i])
+			i++
+		default:
+			added = append(added, b[j])
+			j++
+		}
+	}
+	flush()
+	return rows
+}
+
+// pairChanges puts removed lines beside added ones, row by row.
+func pairChanges(removed, added []string) []diffRow {
+	rows := make([]diffRow, max(len(removed), len(added)))
+	for i := range rows {
+		if i < len(removed) {
+			rows[i].Left, rows[i].HasLeft = removed[i], true
+		}
+		if i < len(added) {
+			rows[i].Right, rows[i].HasRight = added[i], true
+		}
+	}
+	return rows
+}
+
+// fitColumn truncates or pads a line to exactly width cells.
+func fitColumn(line string, width int) string {
+	line = strings.ReplaceAll(line, "\t", "    ")
+	runes := []rune(line)
+	if len(runes) > width {
+		if width <= 1 {
+			return string(runes[:width])
+		}
+		return string(runes[:width-1]) + "…"
+	}
+	return line + strings.Repeat(" ", width-len(runes))
+}
+
+// renderSideBySide lays a diff out in two columns within width. Removed
+// lines are red on the left, added lines green on the right, and changed
+// lines are marked in the gutter.
+func renderSideBySide(rows []diffRow, leftTitle, rightTitle string, width int) string {
+	column := max((width-3)/2, 10)
+	var b strings.Builder
+	b.WriteString(selectedItemStyle.Render(fitColumn(leftTitle, column)) + " │ " +
+		selectedItemStyle.Render(fitColumn(rightTitle, column)) + "\n")
+	b.WriteString(strings.Repeat("─", column) + "─┼─" + strings.Repeat("─", column) + "\n")
+
+	changes := 0
+	for _, row := range rows {
+		left, right := fitColumn(row.Left, column), fitColumn(row.Right, column)
+		gutter := " │ "
+		if row.changed() {
+			changes++
+			gutter = " ≠ "
+			if row.HasLeft {
+				left = errorStyle.Render(left)
+			}
+			if row.HasRight {
+				right = statusStyle.Render(right)
+			}
+		}
+		b.WriteString(left + gutter + right + "\n")
+	}
+	if changes == 0 {
+		b.WriteString("\n" + infoStyle.Render("The two reports are identical.") + "\n")
+	}
+	return b.String()
+}
+
+// loadReportDiff reads two reports and compares them side by side, the older
+// on the left.
+func loadReportDiff(a, b reportEntry, width int) tea.Cmd {
+	return func() tea.Msg {
+		if reportTime(b).Before(reportTime(a)) {
+			a, b = b, a
+		}
+		reader := newReportReader(a, b)
+		left, err := reader.read(a.viewPath())
+		if err != nil {
+			return reportContentMsg{err: err}
+		}
+		right, err := reader.read(b.viewPath())
+		if err != nil {
+			return reportContentMsg{err: err}
+		}
+		rows := diffLines(strings.Split(string(left), "\n"), strings.Split(string(right), "\n"))
+		return reportContentMsg{
+			title:   "Comparing Reports",
+			content: renderSideBySide(rows, a.Name, b.Name, width),
+		}
+	}
+}
+
+// =============================================================================
+// Report browser screen
+// =============================================================================
+
+// visibleReports returns the reports the list shows.
+func (m model) visibleReports() []reportEntry {
+	return filterReports(m.reportFiles, m.reportFilter, m.reportFound)
+}
+
+// reportMarked reports whether a report is marked for comparison.
+func (m model) reportMarked(name string) bool {
+	for _, marked := range m.reportMarks {
+		if marked == name {
+			return true
+		}
+	}
+	return false
+}
+
+// newReportInput returns the prompt used for searching and date ranges.
+func newReportInput(placeholder, value string) textinput.Model {
+	ti := textinput.New()
+	ti.Placeholder = placeholder
+	ti.CharLimit = 100
+	ti.Width = 40
+	ti.PromptStyle = lipgloss.NewStyle().Foreground(colorHighlight2)
+	ti.TextStyle = lipgloss.NewStyle().Foreground(colorHighlight1)
+	ti.SetValue(value)
+	ti.Focus()
+	return ti
+}
+
+// updateReportPrompt handles keys while the search or date range prompt is
+// open.
+func (m model) updateReportPrompt(msg tea.KeyMsg) (model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		m.quitting = true
+		return m, tea.Quit
+	case "esc":
+		m.reportPrompt = ""
+		m.reportPromptErr = ""
+		return m, nil
+	case "enter":
+		value := strings.TrimSpace(m.reportInput.Value())
+		switch m.reportPrompt {
+		case "search":
+			m.reportPrompt = ""
+			m.reportIndex = 0
+			m.reportFilter.Query = value
+			if value == "" {
+				m.reportFound = nil
+				return m, nil
+			}
+			return m, searchReports(m.reportFiles, value)
+		case "range":
+			from, to, err := parseReportRange(value, time.Now())
+			if err != nil {
+				m.reportPromptErr = err.Error()
+				return m, nil
+			}
+			m.reportPrompt = ""
+			m.reportPromptErr = ""
+			m.reportIndex = 0
+			m.reportFilter.From, m.reportFilter.To = from, to
+		}
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.reportInput, cmd = m.reportInput.Update(msg)
+	return m, cmd
+}
+
+// updateReportsList handles keys for the report list.
+func (m model) updateReportsList(msg tea.KeyMsg) (model, tea.Cmd) {
+	if m.reportPrompt != "" {
+		return m.updateReportPrompt(msg)
+	}
+
+	visible := m.visibleReports()
+	var selected *reportEntry
+	if m.reportIndex < len(visible) {
+		selected = &visible[m.reportIndex]
+	}
+
+	switch msg.String() {
+	case "ctrl+c":
+		m.quitting = true
+		return m, tea.Quit
+	case "esc", "q":
+		m.state = stateMenu
+		return m, nil
+	case "up", "k":
+		if m.reportIndex > 0 {
+			m.reportIndex--
+		}
+	case "down", "j":
+		if m.reportIndex < len(visible)-1 {
+			m.reportIndex++
+		}
+	case "enter":
+		if selected != nil {
+			if path := selected.viewPath(); path != "" {
+				return m, loadReportContent(path)
+			}
+		}
+	case "p":
+		// Open report (PDF, then HTML, then markdown)
+		if selected != nil {
+			_ = openReportFile(selected.openPath())
+		}
+	case "d":
+		// Delete selected report, in every format
+		if selected != nil {
+			_ = removeReport(*selected)
+			if m.reportIndex >= len(visible)-1 && m.reportIndex > 0 {
+				m.reportIndex--
+			}
+			return m, loadReportFiles()
+		}
+	case " ":
+		// Mark for comparison; marking a third replaces the oldest mark
+		if selected != nil {
+			if m.reportMarked(selected.Name) {
+				var marks []string
+				for _, name := range m.reportMarks {
+					if name != selected.Name {
+						marks = append(marks, name)
+					}
+				}
+				m.reportMarks = marks
+			} else {
+				m.reportMarks = append(m.reportMarks, selected.Name)
+				if len(m.reportMarks) > 2 {
+					m.reportMarks = m.reportMarks[1:]
+				}
+			}
+		}
+	case "c":
+		// Compare the two marked reports, or the one marked with the cursor
+		var pair []reportEntry
+		for _, entry := range m.reportFiles {
+			if m.reportMarked(entry.Name) {
+				pair = append(pair, entry)
+			}
+		}
+		if len(pair) == 1 && selected != nil && selected.Name != pair[0].Name {
+			pair = append(pair, *selected)
+		}
+		if len(pair) == 2 {
+			return m, loadReportDiff(pair[0], pair[1], max(m.width-12, 40))
+		}
+	case "o":
+		m.reportFilter.Operation = nextValue(m.reportFilter.Operation, reportChoices(m.reportFiles, reportKind))
+		m.reportIndex = 0
+	case "f":
+		m.reportFilter.Status = nextValue(m.reportFilter.Status, []string{notifySuccess, notifyPartial, notifyFailure})
+		m.reportIndex = 0
+	case "h":
+		m.reportFilter.Host = nextValue(m.reportFilter.Host, reportChoices(m.reportFiles, func(r reportEntry) string { return r.Host }))
+		m.reportIndex = 0
+	case "t":
+		value := ""
+		if !m.reportFilter.From.IsZero() {
+			value = m.reportFilter.From.Format("2006-01-02")
+		}
+		if !m.reportFilter.To.IsZero() {
+			value += ".." + m.reportFilter.To.AddDate(0, 0, -1).Format("2006-01-02")
+		}
+		m.reportPrompt = "range"
+		m.reportInput = newReportInput("7d, 2026-09-01 or 2026-09-01..2026-09-30", value)
+		return m, textinput.Blink
+	case "/":
+		m.reportPrompt = "search"
+		m.reportInput = newReportInput("text to find in the reports", m.reportFilter.Query)
+		return m, textinput.Blink
+	case "x":
+		m.reportFilter = reportFilter{}
+		m.reportFound = nil
+		m.reportMarks = nil
+		m.reportIndex = 0
+	}
+	return m, nil
+}
+
+// renderReportRow renders one line of the report list: the cursor, the
+// comparison mark, the status column, then the name, date and formats.
+func renderReportRow(r reportEntry, selected, marked bool) string {
+	cursor := "  "
+	if selected {
+		cursor = "> "
+	}
+	mark := "  "
+	if marked {
+		mark = "◆ "
+	}
+
+	status := fmt.Sprintf("%-8s", reportStatusLabel(r.Status))
+	switch r.Status {
+	case notifySuccess:
+		status = statusStyle.Render(status)
+	case notifyPartial:
+		status = warningStyle.Render(status)
+	default:
+		status = errorStyle.Render(status)
+	}
+
+	style := subtitleStyle
+	if selected {
+		style = selectedItemStyle
+	}
+	line := r.Name
+	if !r.ModTime.IsZero() {
+		line += "  " + r.ModTime.Format("02 Jan 15:04")
+	}
+	for _, tag := range []struct{ path, label string }{
+		{r.Path, "[MD]"}, {r.PdfPath, "[PDF]"}, {r.HTMLPath, "[HTML]"}, {r.JSONPath, "[JSON]"},
+	} {
+		if tag.path != "" {
+			line += "  " + tag.label
+		}
+	}
+	if r.Archive != "" {
+		line += "  [archived " + r.Archive + "]"
+	}
+	return style.Render(cursor+mark) + status + " " + style.Render(line)
+}
@@ -0,0 +1,165 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestSummariseReportPrefersJSON(t *testing.T) {
+	files := map[string]string{
+		"a.json": `{"outcome": "partial", "success": false, "remote_host": "backup@server"}`,
+		"a.md":   "**Result: BACKUP FAILED**\n",
+		"b.md":   "# Kartoza ZFS Backup Report\n\n**Result: BACKUP COMPLETED SUCCESSFULLY**\n\n| **Remote Host** | `root@laptop` |\n",
+	}
+	read := func(path string) ([]byte, error) {
+		if content, ok := files[path]; ok {
+			return []byte(content), nil
+		}
+		return nil, os.ErrNotExist
+	}
+
+	if outcome, host := summariseReport(reportEntry{JSONPath: "a.json", Path: "a.md"}, read); outcome != notifyPartial || host != "server" {
+		t.Errorf("expected the JSON's partial outcome against server, got %q %q", outcome, host)
+	}
+	if outcome, host := summariseReport(reportEntry{JSONPath: "missing.json", Path: "b.md"}, read); outcome != notifySuccess || host != "laptop" {
+		t.Errorf("expected the markdown's success against laptop, got %q %q", outcome, host)
+	}
+	if outcome, _ := summariseReport(reportEntry{Path: "missing.md"}, read); outcome != "" {
+		t.Errorf("an unreadable report has no outcome, got %q", outcome)
+	}
+}
+
+func TestFilterReports(t *testing.T) {
+	entries := []reportEntry{
+		{Name: "Backup-NIXROOT-to-NIXBACKUPS-18Oct2026-02h00-Report", Status: notifySuccess, Host: "abyss"},
+		{Name: "PullBackup-server-to-NIXBACKUPS-17Oct2026-02h00-Report", Status: notifyFailure, Host: "server"},
+		{Name: "Backup-NIXROOT-to-NIXBACKUPS-30Sep2026-02h00-Report", Status: notifyPartial, Host: "abyss"},
+	}
+	names := func(f reportFilter, found map[string]bool) []string {
+		var matched []string
+		for _, e := range filterReports(entries, f, found) {
+			matched = append(matched, e.Name)
+		}
+		return matched
+	}
+
+	if got := names(reportFilter{Operation: "Backup", Host: "ABYSS"}, nil); len(got) != 2 {
+		t.Errorf("expected both local backups, got %v", got)
+	}
+	if got := names(reportFilter{Status: notifyFailure}, nil); !reflect.DeepEqual(got, []string{entries[1].Name}) {
+		t.Errorf("expected only the failed pull, got %v", got)
+	}
+	if got := names(reportFilter{Query: "syncoid"}, map[string]bool{entries[2].Name: true}); !reflect.DeepEqual(got, []string{entries[2].Name}) {
+		t.Errorf("expected only the report containing the search, got %v", got)
+	}
+
+	from, to, err := parseReportRange("2026-10-01..2026-10-17", time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(reportFilter{From: from, To: to}, nil); !reflect.DeepEqual(got, []string{entries[1].Name}) {
+		t.Errorf("expected the range to include its last day only, got %v", got)
+	}
+	if _, _, err := parseReportRange("2026-10-01..yesterday", time.Now()); err == nil {
+		t.Error("an end that is not a date should be rejected")
+	}
+}
+
+func TestDiffLinesPairsChangedLines(t *testing.T) {
+	a := []string{"# Report", "home: done", "atuin: error", "Duration: 5m", "end"}
+	b := []string{"# Report", "home: done", "atuin: done", "nix: done", "Duration: 5m", "end"}
+
+	var changed []diffRow
+	rows := diffLines(a, b)
+	for _, row := range rows {
+		if row.changed() {
+			changed = append(changed, row)
+		}
+	}
+	want := []diffRow{
+		{Left: "atuin: error", Right: "atuin: done", HasLeft: true, HasRight: true},
+		{Right: "nix: done", HasRight: true},
+	}
+	if len(rows) != 6 || !reflect.DeepEqual(changed, want) {
+		t.Errorf("expected the changed line beside its replacement and one added line, got %+v", rows)
+	}
+	for _, row := range diffLines(a, a) {
+		if row.changed() {
+			t.Errorf("identical reports should have no changes, got %+v", row)
+		}
+	}
+}
+
+func TestSearchReportsLooksInsideArchives(t *testing.T) {
+	dir := t.TempDir()
+	loose := "Backup-NIXROOT-to-NIXBACKUPS-18Oct2026-02h00-Report"
+	archived := "Backup-NIXROOT-to-NIXBACKUPS-14Aug2026-02h00-Report"
+	writeReportFiles(t, dir, loose, ".md")
+	if err := os.WriteFile(filepath.Join(dir, archived+".md"), []byte("atuin: Syncoid failed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	archiveDir := filepath.Join(dir, reportArchiveDirName)
+	if err := os.MkdirAll(archiveDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := addToReportArchive(filepath.Join(archiveDir, "2026-08.tar.gz"), []string{filepath.Join(dir, archived+".md")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, archived+".md")); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := listReportEntries(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := searchReports(entries, "syncoid FAILED")().(reportSearchMsg)
+	if !reflect.DeepEqual(msg.found, map[string]bool{archived: true}) {
+		t.Errorf("expected the archived report to match case-insensitively, got %v", msg.found)
+	}
+}
+
+func TestReportReaderOnlyDecompressesMarkdownAndJSON(t *testing.T) {
+	dir := t.TempDir()
+	name := "Backup-NIXROOT-to-NIXBACKUPS-14Aug2026-02h00-Report"
+	writeReportFiles(t, dir, name, ".md", ".json", ".pdf", ".html")
+	archiveDir := filepath.Join(dir, reportArchiveDirName)
+	if err := os.MkdirAll(archiveDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	archivePath := filepath.Join(archiveDir, "2026-08.tar.gz")
+	var files []string
+	for _, ext := range []string{".md", ".json", ".pdf", ".html"} {
+		files = append(files, filepath.Join(dir, name+ext))
+	}
+	if err := addToReportArchive(archivePath, files); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := listArchivedReportEntries(archiveDir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one archived report, got %v, %v", entries, err)
+	}
+	reader := newReportReader(entries...)
+	if _, err := reader.read(entries[0].Path); err != nil {
+		t.Fatal(err)
+	}
+	var read []string
+	for member := range reader.archives[archivePath] {
+		read = append(read, member)
+	}
+	sort.Strings(read)
+	if !reflect.DeepEqual(read, []string{name + ".json", name + ".md"}) {
+		t.Errorf("expected only the markdown and JSON decompressed, got %v", read)
+	}
+	if data, err := reader.read(entries[0].PdfPath); err != nil || len(data) == 0 {
+		t.Errorf("a file the reader was not made for is still read on its own, got %q, %v", data, err)
+	}
+}
@@ -0,0 +1,296 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// =============================================================================
+// PDF charts
+// =============================================================================
+//
+// The PDF report's tables answer "what exactly happened"; the charts answer
+// "what does it look like" for readers who want the picture. They are drawn
+// with the same fpdf primitives as the rest of the report - rectangles, lines
+// and circles - so the PDF stays free of external dependencies.
+
+// maxPoolHistoryPoints caps the pool capacity chart at the most recent runs.
+const maxPoolHistoryPoints = 60
+
+// poolUsagePoint is the backup pool's capacity at the end of one run.
+type poolUsagePoint struct {
+	Time      time.Time
+	Size      int64
+	Allocated int64
+}
+
+// chartBar is one bar of a bar chart.
+type chartBar struct {
+	Label string
+	Value float64
+	Text  string // value as shown next to the bar
+}
+
+// poolUsageHistory returns the destination pool's capacity after each recorded
+// run, oldest first, ending with this run's.
+func poolUsageHistory(records []historyRecord, info ReportInfo) []poolUsagePoint {
+	var points []poolUsagePoint
+	for _, r := range records {
+		if r.Destination != info.DestPool || r.PoolSizeBytes <= 0 || !r.StartTime.Before(info.StartTime) {
+			continue
+		}
+		points = append(points, poolUsagePoint{Time: r.EndTime, Size: r.PoolSizeBytes, Allocated: r.PoolAllocatedBytes})
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	if info.DestStats != nil && info.DestStats.Capacity != nil && info.DestStats.Capacity.Size > 0 {
+		c := info.DestStats.Capacity
+		points = append(points, poolUsagePoint{Time: info.EndTime, Size: c.Size, Allocated: c.Allocated})
+	}
+	if len(points) > maxPoolHistoryPoints {
+		points = points[len(points)-maxPoolHistoryPoints:]
+	}
+	return points
+}
+
+// loadPoolUsageHistory is poolUsageHistory over the recorded history. An
+// unreadable history just leaves the chart with this run alone.
+func loadPoolUsageHistory(info ReportInfo) []poolUsagePoint {
+	records, _ := loadRunHistory()
+	return poolUsageHistory(records, info)
+}
+
+// datasetSizeBars charts each dataset's size.
+func datasetSizeBars(info ReportInfo) []chartBar {
+	var bars []chartBar
+	for _, ds := range info.DatasetProgress {
+		if n, ok := parseZFSSize(ds.Size); ok {
+			bars = append(bars, chartBar{Label: ds.Name, Value: float64(n), Text: ds.Size})
+		}
+	}
+	return bars
+}
+
+// datasetDurationBars charts how long each dataset took to sync.
+func datasetDurationBars(info ReportInfo) []chartBar {
+	var bars []chartBar
+	for _, ds := range info.DatasetProgress {
+		if ds.Duration > 0 {
+			bars = append(bars, chartBar{Label: ds.Name, Value: ds.Duration.Seconds(), Text: formatDuration(ds.Duration)})
+		}
+	}
+	return bars
+}
+
+// snapshotCountPairs charts each dataset's snapshots on the source against
+// the destination. Empty when the destination could not be read.
+func snapshotCountPairs(info ReportInfo) (source, dest []chartBar) {
+	if info.DestStats == nil || len(info.DestStats.Snapshots) == 0 {
+		return nil, nil
+	}
+	for _, ds := range info.DatasetProgress {
+		n := len(ds.Snapshots)
+		source = append(source, chartBar{Label: ds.Name, Value: float64(n), Text: fmt.Sprintf("%d", n)})
+		d := info.DestStats.Snapshots[path.Base(ds.Name)]
+		dest = append(dest, chartBar{Label: ds.Name, Value: float64(d), Text: fmt.Sprintf("%d", d)})
+	}
+	return source, dest
+}
+
+// pdfEnsureSpace starts a new page unless height fits on this one. Drawn
+// shapes are not covered by the automatic page break.
+func pdfEnsureSpace(pdf *fpdf.Fpdf, height float64) {
+	_, pageHeight := pdf.GetPageSize()
+	_, _, _, bottom := pdf.GetMargins()
+	if pdf.GetY()+height > pageHeight-bottom {
+		pdf.AddPage()
+	}
+}
+
+// pdfChartTitle renders a chart's title.
+func pdfChartTitle(pdf *fpdf.Fpdf, title string, teal [3]int) {
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.SetTextColor(teal[0], teal[1], teal[2])
+	pdf.CellFormat(0, 5, title, "", 1, "L", false, 0, "")
+	pdf.Ln(1)
+}
+
+// pdfBarChart draws a horizontal bar chart, one bar per row.
+func pdfBarChart(pdf *fpdf.Fpdf, title string, bars []chartBar, color, dark, teal [3]int) {
+	maxValue := 0.0
+	for _, bar := range bars {
+		maxValue = max(maxValue, bar.Value)
+	}
+	if maxValue <= 0 {
+		return
+	}
+
+	const rowHeight, labelWidth, barWidth = 5.0, 35.0, 115.0
+	pdfEnsureSpace(pdf, 8+float64(len(bars))*rowHeight)
+	pdfChartTitle(pdf, title, teal)
+
+	left, _, _, _ := pdf.GetMargins()
+	pdf.SetFont("Helvetica", "", 8)
+	for _, bar := range bars {
+		y := pdf.GetY()
+		pdf.SetTextColor(dark[0], dark[1], dark[2])
+		pdf.SetXY(left, y)
+		pdf.CellFormat(labelWidth, rowHeight, bar.Label, "", 0, "L", false, 0, "")
+		width := barWidth * bar.Value / maxValue
+		pdf.SetFillColor(color[0], color[1], color[2])
+		pdf.Rect(left+labelWidth, y+1, max(width, 0.3), rowHeight-2, "F")
+		pdf.SetXY(left+labelWidth+width+2, y)
+		pdf.CellFormat(25, rowHeight, bar.Text, "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(4)
+}
+
+// pdfPairedBarChart draws two bars per row, e.g. source against destination.
+func pdfPairedBarChart(pdf *fpdf.Fpdf, title string, first, second []chartBar, firstName, secondName string, firstColor, secondColor, dark, teal [3]int) {
+	maxValue := 0.0
+	for i := range first {
+		maxValue = max(maxValue, first[i].Value, second[i].Value)
+	}
+	if maxValue <= 0 {
+		return
+	}
+
+	const rowHeight, labelWidth, barWidth = 7.0, 35.0, 115.0
+	pdfEnsureSpace(pdf, 14+float64(len(first))*rowHeight)
+	pdfChartTitle(pdf, title, teal)
+
+	// Legend
+	left, _, _, _ := pdf.GetMargins()
+	pdf.SetFont("Helvetica", "", 7)
+	pdf.SetTextColor(dark[0], dark[1], dark[2])
+	y := pdf.GetY()
+	for i, entry := range []struct {
+		name  string
+		color [3]int
+	}{{firstName, firstColor}, {secondName, secondColor}} {
+		x := left + labelWidth + float64(i)*40
+		pdf.SetFillColor(entry.color[0], entry.color[1], entry.color[2])
+		pdf.Rect(x, y+1, 3, 3, "F")
+		pdf.SetXY(x+4, y)
+		pdf.CellFormat(30, 5, entry.name, "", 0, "L", false, 0, "")
+	}
+	pdf.SetXY(left, y+6)
+
+	pdf.SetFont("Helvetica", "", 8)
+	for i := range first {
+		y := pdf.GetY()
+		pdf.SetTextColor(dark[0], dark[1], dark[2])
+		pdf.SetXY(left, y)
+		pdf.CellFormat(labelWidth, rowHeight, first[i].Label, "", 0, "L", false, 0, "")
+		for j, bar := range []chartBar{first[i], second[i]} {
+			color := firstColor
+			if j == 1 {
+				color = secondColor
+			}
+			barY := y + 0.5 + float64(j)*3
+			width := barWidth * bar.Value / maxValue
+			pdf.SetFillColor(color[0], color[1], color[2])
+			pdf.Rect(left+labelWidth, barY, max(width, 0.3), 2.5, "F")
+			pdf.SetFont("Helvetica", "", 6.5)
+			pdf.SetXY(left+labelWidth+width+2, barY-0.5)
+			pdf.CellFormat(20, 3.5, bar.Text, "", 0, "L", false, 0, "")
+		}
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.SetXY(left, y+rowHeight)
+	}
+	pdf.Ln(4)
+}
+
+// pdfPoolUsageChart draws the backup pool's allocated share over time.
+func pdfPoolUsageChart(pdf *fpdf.Fpdf, title string, points []poolUsagePoint, color, dark, gray, red, teal [3]int) {
+	if len(points) == 0 {
+		return
+	}
+
+	const axisWidth, chartWidth, chartHeight = 12.0, 150.0, 40.0
+	pdfEnsureSpace(pdf, chartHeight+18)
+	pdfChartTitle(pdf, title, teal)
+
+	left, _, _, _ := pdf.GetMargins()
+	x0, top := left+axisWidth, pdf.GetY()+2
+	bottom := top + chartHeight
+	yFor := func(percent float64) float64 { return bottom - chartHeight*percent/100 }
+
+	// Grid and axis labels
+	pdf.SetFont("Helvetica", "", 6.5)
+	pdf.SetTextColor(gray[0], gray[1], gray[2])
+	pdf.SetLineWidth(0.1)
+	pdf.SetDrawColor(gray[0], gray[1], gray[2])
+	for _, percent := range []float64{0, 25, 50, 75, 100} {
+		y := yFor(percent)
+		pdf.Line(x0, y, x0+chartWidth, y)
+		pdf.SetXY(left, y-1.5)
+		pdf.CellFormat(axisWidth-1, 3, fmt.Sprintf("%.0f%%", percent), "", 0, "R", false, 0, "")
+	}
+
+	// 80% is where ZFS performance starts to suffer.
+	pdf.SetDrawColor(red[0], red[1], red[2])
+	pdf.SetDashPattern([]float64{1, 1}, 0)
+	pdf.Line(x0, yFor(80), x0+chartWidth, yFor(80))
+	pdf.SetDashPattern([]float64{}, 0)
+
+	// Usage line and points
+	step := 0.0
+	if len(points) > 1 {
+		step = chartWidth / float64(len(points)-1)
+	}
+	pdf.SetDrawColor(color[0], color[1], color[2])
+	pdf.SetFillColor(color[0], color[1], color[2])
+	pdf.SetLineWidth(0.5)
+	var prevX, prevY float64
+	for i, p := range points {
+		x := x0 + float64(i)*step
+		y := yFor(100 * float64(p.Allocated) / float64(p.Size))
+		if i > 0 {
+			pdf.Line(prevX, prevY, x, y)
+		}
+		pdf.Circle(x, y, 0.8, "F")
+		prevX, prevY = x, y
+	}
+	pdf.SetLineWidth(0.2)
+
+	// First and last dates under the axis
+	pdf.SetTextColor(gray[0], gray[1], gray[2])
+	pdf.SetXY(x0-10, bottom+1)
+	pdf.CellFormat(20, 3, points[0].Time.Format("02 Jan"), "", 0, "C", false, 0, "")
+	if len(points) > 1 {
+		pdf.SetXY(x0+chartWidth-10, bottom+1)
+		pdf.CellFormat(20, 3, points[len(points)-1].Time.Format("02 Jan"), "", 0, "C", false, 0, "")
+	}
+
+	last := points[len(points)-1]
+	pdf.SetXY(left, bottom+5)
+	pdf.SetFont("Helvetica", "", 8)
+	pdf.SetTextColor(dark[0], dark[1], dark[2])
+	pdf.CellFormat(0, 4, fmt.Sprintf("Now %s of %s used (%.0f%%)",
+		formatSize(last.Allocated), formatSize(last.Size), 100*float64(last.Allocated)/float64(last.Size)), "", 1, "L", false, 0, "")
+	pdf.Ln(4)
+}
+
+// pdfChartsSection draws the report's charts: dataset sizes, sync times,
+// snapshot counts on each side and the backup pool's usage over time.
+func pdfChartsSection(pdf *fpdf.Fpdf, info ReportInfo, dark, gray, red, teal, gold, blue [3]int) {
+	sizes := datasetSizeBars(info)
+	durations := datasetDurationBars(info)
+	source, dest := snapshotCountPairs(info)
+	if len(sizes) == 0 && len(durations) == 0 && len(source) == 0 && len(info.PoolHistory) == 0 {
+		return
+	}
+
+	pdfSectionHeader(pdf, dark, gray, "Charts")
+	pdfBarChart(pdf, "Dataset Size", sizes, blue, dark, teal)
+	pdfBarChart(pdf, "Sync Time", durations, gold, dark, teal)
+	pdfPairedBarChart(pdf, "Snapshots per Dataset", source, dest, "Source", "Backup pool", teal, gold, dark, teal)
+	pdfPoolUsageChart(pdf, fmt.Sprintf("Backup Pool Usage: %s", info.DestPool), info.PoolHistory, blue, dark, gray, red, teal)
+}
@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPoolUsageHistoryEndsWithThisRun(t *testing.T) {
+	info := sampleReportInfo()
+	info.DestStats = &destinationStats{Capacity: &poolCapacity{Pool: "NIXBACKUPS", Size: 100, Allocated: 60}}
+	day := func(n int) time.Time { return info.StartTime.AddDate(0, 0, n) }
+	records := []historyRecord{
+		{Destination: "NIXBACKUPS", StartTime: day(-1), EndTime: day(-1), PoolSizeBytes: 100, PoolAllocatedBytes: 50},
+		{Destination: "NIXBACKUPS", StartTime: day(-2), EndTime: day(-2), PoolSizeBytes: 100, PoolAllocatedBytes: 40},
+		{Destination: "OTHER", StartTime: day(-1), EndTime: day(-1), PoolSizeBytes: 100, PoolAllocatedBytes: 90},
+		{Destination: "NIXBACKUPS", StartTime: day(-3), EndTime: day(-3)}, // capacity not captured
+	}
+
+	var allocated []int64
+	for _, p := range poolUsageHistory(records, info) {
+		allocated = append(allocated, p.Allocated)
+	}
+	if want := []int64{40, 50, 60}; !reflect.DeepEqual(allocated, want) {
+		t.Errorf("expected the pool's usage oldest first ending with this run, %v, got %v", want, allocated)
+	}
+}
+
+func TestSnapshotCountPairsMatchDestinationBySuffix(t *testing.T) {
+	info := sampleReportInfo()
+	info.DatasetProgress[0].Snapshots = make([]SnapshotDot, 3)
+	if source, _ := snapshotCountPairs(info); source != nil {
+		t.Error("without destination figures there is nothing to compare")
+	}
+
+	info.DestStats = &destinationStats{Snapshots: map[string]int{"home": 12}}
+	source, dest := snapshotCountPairs(info)
+	if len(source) != 2 || source[0].Value != 3 || dest[0].Value != 12 || dest[1].Value != 0 {
+		t.Errorf("unexpected snapshot counts %+v against %+v", source, dest)
+	}
+}
+
+func TestGeneratePDFWithCharts(t *testing.T) {
+	info := reportWithInventory()
+	info.DatasetProgress[0].Size = "120G"
+	info.DatasetProgress[0].Duration = 5 * time.Minute
+	info.DestStats = &destinationStats{
+		Capacity:  &poolCapacity{Pool: "NIXBACKUPS", Size: 2 << 40, Allocated: 1 << 40},
+		Snapshots: map[string]int{"home": 30, "atuin": 28},
+	}
+	for i := 0; i < 40; i++ {
+		info.PoolHistory = append(info.PoolHistory, poolUsagePoint{
+			Time: info.StartTime.AddDate(0, 0, i-40), Size: 2 << 40, Allocated: int64(i) << 34,
+		})
+	}
+
+	pdfPath := filepath.Join(t.TempDir(), "report.pdf")
+	if err := generatePDF(info, pdfPath); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(pdfPath); err != nil || fi.Size() == 0 {
+		t.Errorf("expected a PDF to be written: %v", err)
+	}
+}
@@ -0,0 +1,408 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// =============================================================================
+// Run-over-run comparison
+// =============================================================================
+//
+// A report on its own says what one run did. Compared with the previous run of
+// the same operation between the same pools it also says what changed: which
+// datasets grew, which got slower, which entered or left the scope. Sudden
+// growth is how runaway logs - or ransomware rewriting a home directory - show
+// up first, so large jumps are flagged as anomalies.
+
+const (
+	// anomalyGrowthFactor flags a dataset that grew this many times over.
+	anomalyGrowthFactor = 10
+	// anomalyThroughputDrop flags a dataset that synced at less than this
+	// fraction of its previous throughput.
+	anomalyThroughputDrop = 0.5
+	// comparisonMinBytes ignores growth and throughput on anything smaller;
+	// tiny datasets and incrementals swing wildly without meaning anything.
+	comparisonMinBytes = 64 << 20
+)
+
+// runComparison is a run compared with the previous run of the same kind.
+type runComparison struct {
+	Previous                historyRecord
+	Datasets                []datasetComparison // datasets in both runs
+	Added                   []string            // datasets new to the scope
+	Removed                 []string            // datasets no longer in scope
+	Duration                time.Duration
+	PreviousDuration        time.Duration
+	SnapshotsPruned         int
+	PreviousSnapshotsPruned int
+	Anomalies               []string
+}
+
+// datasetComparison is one dataset in both runs. Byte counts are -1 and
+// throughputs 0 when unknown.
+type datasetComparison struct {
+	Name               string
+	Size               int64
+	PreviousSize       int64
+	SizeText           string
+	PreviousSizeText   string
+	Duration           time.Duration
+	PreviousDuration   time.Duration
+	Throughput         float64 // bytes per second
+	PreviousThroughput float64
+}
+
+// zfsSizePattern matches the human-readable sizes zfs prints: 0B, 512K, 1.21G.
+var zfsSizePattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)([BKMGTPE]?)$`)
+
+// parseZFSSize converts a zfs human-readable size to bytes.
+func parseZFSSize(s string) (int64, bool) {
+	m := zfsSizePattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	exp := strings.Index("BKMGTPE", m[2])
+	if exp < 0 {
+		exp = 0
+	}
+	return int64(value * math.Pow(1024, float64(exp))), true
+}
+
+// syncedSnapshotBytes adds up the sizes of a dataset's synced snapshots,
+// which is roughly what the sync had to send.
+func syncedSnapshotBytes(ds DatasetProgress) int64 {
+	var total int64
+	for _, snap := range ds.Snapshots {
+		if snap.Status != SnapDone {
+			continue
+		}
+		if n, ok := parseZFSSize(snap.Size); ok {
+			total += n
+		}
+	}
+	return total
+}
+
+// previousRun finds the latest recorded run before info of the same operation
+// between the same pools and host.
+func previousRun(records []historyRecord, info ReportInfo) (historyRecord, bool) {
+	var best historyRecord
+	found := false
+	for _, r := range records {
+		if r.Operation != info.Operation || r.Source != info.SourcePool ||
+			r.Destination != info.DestPool || r.RemoteHost != info.RemoteHost {
+			continue
+		}
+		if !r.StartTime.Before(info.StartTime) {
+			continue
+		}
+		if !found || r.StartTime.After(best.StartTime) {
+			best, found = r, true
+		}
+	}
+	return best, found
+}
+
+// compareRuns compares a finished run with the previous run of its kind.
+func compareRuns(info ReportInfo, previous historyRecord) *runComparison {
+	c := &runComparison{
+		Previous:                previous,
+		Duration:                info.EndTime.Sub(info.StartTime),
+		PreviousDuration:        time.Duration(previous.DurationSeconds * float64(time.Second)),
+		SnapshotsPruned:         info.SnapshotsPruned,
+		PreviousSnapshotsPruned: previous.SnapshotsPruned,
+	}
+
+	before := map[string]historyDataset{}
+	for _, ds := range previous.Datasets {
+		before[ds.Name] = ds
+	}
+	current := map[string]bool{}
+	for _, ds := range info.DatasetProgress {
+		current[ds.Name] = true
+		prev, ok := before[ds.Name]
+		if !ok {
+			c.Added = append(c.Added, ds.Name)
+			continue
+		}
+		dc := datasetComparison{
+			Name:             ds.Name,
+			Size:             -1,
+			PreviousSize:     -1,
+			SizeText:         ds.Size,
+			PreviousSizeText: prev.Size,
+			Duration:         ds.Duration,
+			PreviousDuration: time.Duration(prev.DurationSeconds * float64(time.Second)),
+		}
+		if n, ok := parseZFSSize(ds.Size); ok {
+			dc.Size = n
+		}
+		if n, ok := parseZFSSize(prev.Size); ok {
+			dc.PreviousSize = n
+		}
+		if sent := syncedSnapshotBytes(ds); sent >= comparisonMinBytes && ds.Duration > 0 {
+			dc.Throughput = float64(sent) / ds.Duration.Seconds()
+		}
+		if prev.BytesSent >= comparisonMinBytes && prev.DurationSeconds > 0 {
+			dc.PreviousThroughput = float64(prev.BytesSent) / prev.DurationSeconds
+		}
+		c.Datasets = append(c.Datasets, dc)
+
+		if dc.PreviousSize >= comparisonMinBytes && dc.Size >= anomalyGrowthFactor*dc.PreviousSize {
+			c.Anomalies = append(c.Anomalies, fmt.Sprintf("%s grew %.1fx, from %s to %s",
+				ds.Name, float64(dc.Size)/float64(dc.PreviousSize), prev.Size, ds.Size))
+		}
+		if dc.Throughput > 0 && dc.PreviousThroughput > 0 && dc.Throughput < anomalyThroughputDrop*dc.PreviousThroughput {
+			c.Anomalies = append(c.Anomalies, fmt.Sprintf("%s synced at %s, down from %s",
+				ds.Name, throughputLabel(dc.Throughput), throughputLabel(dc.PreviousThroughput)))
+		}
+	}
+	for _, ds := range previous.Datasets {
+		if !current[ds.Name] {
+			c.Removed = append(c.Removed, ds.Name)
+		}
+	}
+	return c
+}
+
+// compareWithPreviousRun compares a finished run with the previous run of its
+// kind in the history. Returns nil for the first run or when the history
+// cannot be read; the comparison is extra detail, never a reason to fail.
+func compareWithPreviousRun(info ReportInfo) *runComparison {
+	records, err := loadRunHistory()
+	if err != nil {
+		return nil
+	}
+	previous, ok := previousRun(records, info)
+	if !ok {
+		return nil
+	}
+	return compareRuns(info, previous)
+}
+
+// throughputLabel formats bytes per second.
+func throughputLabel(bytesPerSecond float64) string {
+	return formatSize(int64(bytesPerSecond)) + "/s"
+}
+
+// changeLabel describes a change as a percentage, e.g. "+20%".
+func changeLabel(before, after float64) string {
+	if before <= 0 {
+		return "-"
+	}
+	pct := (after - before) / before * 100
+	if math.Abs(pct) < 0.5 {
+		return "no change"
+	}
+	return fmt.Sprintf("%+.0f%%", pct)
+}
+
+// comparisonRows returns the per-dataset comparison as table cells: dataset,
+// size, size change, sync time, throughput.
+func comparisonRows(c *runComparison) [][]string {
+	var rows [][]string
+	for _, ds := range c.Datasets {
+		size, sizeChange := "-", "-"
+		if ds.SizeText != "" || ds.PreviousSizeText != "" {
+			size = fmt.Sprintf("%s → %s", dashIfEmpty(ds.PreviousSizeText), dashIfEmpty(ds.SizeText))
+		}
+		if ds.Size >= 0 && ds.PreviousSize >= 0 {
+			sizeChange = changeLabel(float64(ds.PreviousSize), float64(ds.Size))
+		}
+		syncTime := "-"
+		if ds.Duration > 0 || ds.PreviousDuration > 0 {
+			syncTime = fmt.Sprintf("%s → %s", durationOrDash(ds.PreviousDuration), durationOrDash(ds.Duration))
+		}
+		throughput := "-"
+		if ds.Throughput > 0 && ds.PreviousThroughput > 0 {
+			throughput = fmt.Sprintf("%s → %s", throughputLabel(ds.PreviousThroughput), throughputLabel(ds.Throughput))
+		}
+		rows = append(rows, []string{ds.Name, size, sizeChange, syncTime, throughput})
+	}
+	return rows
+}
+
+// comparisonIntro names the run being compared against.
+func comparisonIntro(c *runComparison) string {
+	return fmt.Sprintf("Compared with the previous run on %s, which ended in %s.",
+		c.Previous.StartTime.Format("2006-01-02 15:04"), c.Previous.Outcome)
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" || s == "?" {
+		return "-"
+	}
+	return s
+}
+
+func durationOrDash(d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	return formatDuration(d)
+}
+
+// writeMarkdownComparison renders the comparison section of the markdown
+// report.
+func writeMarkdownComparison(b *strings.Builder, c *runComparison) {
+	if c == nil {
+		return
+	}
+
+	b.WriteString("## Compared with Previous Run\n\n")
+	b.WriteString(comparisonIntro(c) + "\n\n")
+
+	if len(c.Anomalies) > 0 {
+		b.WriteString("**Anomalies - check these before trusting this backup:**\n\n")
+		for _, a := range c.Anomalies {
+			b.WriteString(fmt.Sprintf("- ⚠ %s\n", a))
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("| | Previous | This run | Change |\n")
+	b.WriteString("|---|---|---|---|\n")
+	b.WriteString(fmt.Sprintf("| **Duration** | %s | %s | %s |\n",
+		durationOrDash(c.PreviousDuration), durationOrDash(c.Duration),
+		changeLabel(c.PreviousDuration.Seconds(), c.Duration.Seconds())))
+	b.WriteString(fmt.Sprintf("| **Snapshots pruned** | %d | %d | %+d |\n",
+		c.PreviousSnapshotsPruned, c.SnapshotsPruned, c.SnapshotsPruned-c.PreviousSnapshotsPruned))
+	b.WriteString("\n")
+
+	if len(c.Added) > 0 {
+		b.WriteString(fmt.Sprintf("**Added to the scope:** `%s`\n\n", strings.Join(c.Added, "`, `")))
+	}
+	if len(c.Removed) > 0 {
+		b.WriteString(fmt.Sprintf("**Removed from the scope:** `%s`\n\n", strings.Join(c.Removed, "`, `")))
+	}
+
+	if rows := comparisonRows(c); len(rows) > 0 {
+		b.WriteString("| Dataset | Size | Size Change | Sync Time | Throughput |\n")
+		b.WriteString("|---------|------|-------------|-----------|------------|\n")
+		for _, row := range rows {
+			b.WriteString(fmt.Sprintf("| `%s` | %s | %s | %s | %s |\n", row[0], row[1], row[2], row[3], row[4]))
+		}
+		b.WriteString("\n")
+	}
+}
+
+// writeHTMLComparison renders the comparison section of the HTML report.
+func writeHTMLComparison(b *strings.Builder, c *runComparison) {
+	if c == nil {
+		return
+	}
+	esc := html.EscapeString
+
+	b.WriteString("<h2>Compared with Previous Run</h2>\n")
+	b.WriteString("<p>" + esc(comparisonIntro(c)) + "</p>\n")
+	if len(c.Anomalies) > 0 {
+		b.WriteString("<ul>\n")
+		for _, a := range c.Anomalies {
+			b.WriteString("<li class=\"failed\">&#9888; " + esc(a) + "</li>\n")
+		}
+		b.WriteString("</ul>\n")
+	}
+
+	b.WriteString("<table>\n<tr><th></th><th>Previous</th><th>This run</th><th>Change</th></tr>\n")
+	b.WriteString(fmt.Sprintf("<tr><th>Duration</th><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+		esc(durationOrDash(c.PreviousDuration)), esc(durationOrDash(c.Duration)),
+		esc(changeLabel(c.PreviousDuration.Seconds(), c.Duration.Seconds()))))
+	b.WriteString(fmt.Sprintf("<tr><th>Snapshots pruned</th><td>%d</td><td>%d</td><td>%+d</td></tr>\n",
+		c.PreviousSnapshotsPruned, c.SnapshotsPruned, c.SnapshotsPruned-c.PreviousSnapshotsPruned))
+	b.WriteString("</table>\n")
+
+	if len(c.Added) > 0 {
+		b.WriteString("<p><strong>Added to the scope:</strong> " + esc(strings.Join(c.Added, ", ")) + "</p>\n")
+	}
+	if len(c.Removed) > 0 {
+		b.WriteString("<p><strong>Removed from the scope:</strong> " + esc(strings.Join(c.Removed, ", ")) + "</p>\n")
+	}
+
+	if rows := comparisonRows(c); len(rows) > 0 {
+		b.WriteString("<table>\n<tr><th>Dataset</th><th>Size</th><th>Size Change</th><th>Sync Time</th><th>Throughput</th></tr>\n")
+		for _, row := range rows {
+			b.WriteString(fmt.Sprintf("<tr><td><code>%s</code></td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+				esc(row[0]), esc(row[1]), esc(row[2]), esc(row[3]), esc(row[4])))
+		}
+		b.WriteString("</table>\n")
+	}
+}
+
+// pdfComparisonSection renders the comparison section of the PDF report.
+func pdfComparisonSection(pdf *fpdf.Fpdf, c *runComparison, dark, gray, red [3]int) {
+	if c == nil {
+		return
+	}
+
+	pdfSectionHeader(pdf, dark, gray, "Compared With Previous Run")
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.SetTextColor(dark[0], dark[1], dark[2])
+	pdf.MultiCell(0, 4.5, comparisonIntro(c), "", "L", false)
+	pdf.Ln(2)
+
+	if len(c.Anomalies) > 0 {
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.SetTextColor(red[0], red[1], red[2])
+		for _, a := range c.Anomalies {
+			pdf.MultiCell(0, 4.5, "Anomaly: "+a, "", "L", false)
+		}
+		pdf.Ln(2)
+	}
+
+	pdfKeyValue(pdf, dark, gray, "Duration", fmt.Sprintf("%s -> %s (%s)",
+		durationOrDash(c.PreviousDuration), durationOrDash(c.Duration),
+		changeLabel(c.PreviousDuration.Seconds(), c.Duration.Seconds())))
+	pdfKeyValue(pdf, dark, gray, "Snapshots Pruned", fmt.Sprintf("%d -> %d", c.PreviousSnapshotsPruned, c.SnapshotsPruned))
+	if len(c.Added) > 0 {
+		pdfKeyValue(pdf, dark, gray, "Added", strings.Join(c.Added, ", "))
+	}
+	if len(c.Removed) > 0 {
+		pdfKeyValue(pdf, dark, gray, "Removed", strings.Join(c.Removed, ", "))
+	}
+	pdf.Ln(3)
+
+	rows := comparisonRows(c)
+	if len(rows) == 0 {
+		return
+	}
+	colWidths := []float64{30, 40, 22, 40, 48}
+	headers := []string{"Dataset", "Size", "Change", "Sync Time", "Throughput"}
+	pdf.SetFont("Helvetica", "B", 8)
+	pdf.SetFillColor(dark[0], dark[1], dark[2])
+	pdf.SetTextColor(255, 255, 255)
+	for i, h := range headers {
+		pdf.CellFormat(colWidths[i], 6, h, "1", 0, "C", true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont("Helvetica", "", 8)
+	pdf.SetTextColor(dark[0], dark[1], dark[2])
+	for _, row := range rows {
+		for i, cell := range row {
+			// The core PDF fonts have no arrow glyph.
+			cell = strings.ReplaceAll(cell, "→", "->")
+			align := "R"
+			if i == 0 {
+				align = "L"
+			}
+			pdf.CellFormat(colWidths[i], 5, cell, "1", 0, align, false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	pdf.Ln(5)
+}
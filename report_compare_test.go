@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseZFSSize(t *testing.T) {
+	cases := map[string]int64{"0B": 0, "512": 512, "45K": 45 << 10, "1.5G": 3 << 29, "2T": 2 << 40}
+	for in, want := range cases {
+		got, ok := parseZFSSize(in)
+		if !ok || got != want {
+			t.Errorf("parseZFSSize(%q) = %d, %v; want %d", in, got, ok, want)
+		}
+	}
+	for _, in := range []string{"", "?", "-", "1.2GB"} {
+		if _, ok := parseZFSSize(in); ok {
+			t.Errorf("parseZFSSize(%q) should not parse", in)
+		}
+	}
+}
+
+func TestWritePruneResultCountsWhatItPruned(t *testing.T) {
+	var output strings.Builder
+	var findings runFindings
+	findings.SnapshotsPruned += writePruneResult(&output, pruneResult{Pruned: []string{"NIXROOT/home@a", "NIXROOT/home@b"}})
+	findings.SnapshotsPruned += writePruneResult(&output, pruneResult{})
+	findings.SnapshotsPruned += writePruneResult(&output, pruneResult{Pruned: []string{"x@1", "x@2", "x@3"}, Warnings: []string{"x@4 held"}})
+	if findings.SnapshotsPruned != 5 {
+		t.Errorf("expected 5 pruned snapshots on the source and destination, got %d", findings.SnapshotsPruned)
+	}
+}
+
+func TestPreviousRunMatchesOperationAndPools(t *testing.T) {
+	info := sampleReportInfo()
+	at := func(h int) time.Time { return info.StartTime.Add(time.Duration(h) * time.Hour) }
+	records := []historyRecord{
+		{Operation: "backup", Source: "NIXROOT", Destination: "NIXBACKUPS", StartTime: at(-48)},
+		{Operation: "backup", Source: "NIXROOT", Destination: "NIXBACKUPS", StartTime: at(-24)},
+		{Operation: "backup", Source: "NIXROOT", Destination: "OTHER", StartTime: at(-1)},
+		{Operation: "push-backup", Source: "NIXROOT", Destination: "NIXBACKUPS", StartTime: at(-2)},
+		{Operation: "backup", Source: "NIXROOT", Destination: "NIXBACKUPS", StartTime: at(1)},
+	}
+	previous, ok := previousRun(records, info)
+	if !ok || !previous.StartTime.Equal(at(-24)) {
+		t.Errorf("expected the backup a day earlier, got %+v (%v)", previous, ok)
+	}
+}
+
+func TestCompareRunsFlagsGrowthRegressionsAndScopeChanges(t *testing.T) {
+	info := sampleReportInfo()
+	info.DatasetProgress[0].Size = "12G"
+	info.DatasetProgress[0].Duration = 100 * time.Second
+	info.DatasetProgress[0].Snapshots = []SnapshotDot{{Tag: "t", Status: SnapDone, Size: "1G"}}
+	info.SnapshotsPruned = 4
+	previous := historyRecord{
+		StartTime:       info.StartTime.Add(-24 * time.Hour),
+		Outcome:         notifySuccess,
+		DurationSeconds: 300,
+		SnapshotsPruned: 1,
+		Datasets: []historyDataset{
+			{Name: "home", Size: "1G", DurationSeconds: 10, BytesSent: 1 << 30},
+			{Name: "nix", Size: "50G"},
+		},
+	}
+
+	c := compareRuns(info, previous)
+	if !reflect.DeepEqual(c.Added, []string{"atuin"}) || !reflect.DeepEqual(c.Removed, []string{"nix"}) {
+		t.Errorf("expected atuin added and nix removed, got %v and %v", c.Added, c.Removed)
+	}
+	if c.SnapshotsPruned != 4 || c.PreviousSnapshotsPruned != 1 {
+		t.Errorf("expected 1 then 4 pruned snapshots, got %d then %d", c.PreviousSnapshotsPruned, c.SnapshotsPruned)
+	}
+	if len(c.Anomalies) != 2 || !strings.Contains(c.Anomalies[0], "home grew 12.0x") || !strings.Contains(c.Anomalies[1], "home synced at") {
+		t.Errorf("expected the growth and the throughput drop flagged, got %v", c.Anomalies)
+	}
+
+	info.Comparison = c
+	report := generateMarkdownReport(info)
+	for _, want := range []string{"## Compared with Previous Run", "| `home` | 1G → 12G | +1100% |", "**Removed from the scope:** `nix`"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("the markdown report should contain %q", want)
+		}
+	}
+}
+
+func TestCompareRunsIgnoresSmallDatasets(t *testing.T) {
+	info := sampleReportInfo()
+	info.DatasetProgress[0].Size = "50M"
+	previous := historyRecord{Datasets: []historyDataset{{Name: "home", Size: "1M"}, {Name: "atuin", Size: "1M"}}}
+	if c := compareRuns(info, previous); len(c.Anomalies) != 0 {
+		t.Errorf("growth below the size floor should not be flagged, got %v", c.Anomalies)
+	}
+}
+
+func TestRunReportIsWrittenInTheBackground(t *testing.T) {
+	useTempHome(t)
+	info := sampleReportInfo()
+	earlier := info
+	earlier.StartTime = info.StartTime.Add(-24 * time.Hour)
+	earlier.EndTime = earlier.StartTime.Add(6 * time.Minute)
+	if err := appendRunHistory(earlier, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := writeRunReportCmd(info)().(runReportMsg)
+	if msg.info.Comparison == nil {
+		t.Error("expected the comparison with the previous run returned in the message")
+	}
+	if msg.files.Markdown == "" || !strings.Contains(msg.summary, "Report saved: "+msg.files.Markdown) {
+		t.Errorf("expected the report written and announced, got %+v, %q", msg.files, msg.summary)
+	}
+	if records, err := loadRunHistory(); err != nil || len(records) != 2 {
+		t.Errorf("expected the run recorded in the history, got %d records, %v", len(records), err)
+	}
+}
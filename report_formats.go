@@ -0,0 +1,499 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// Report formats
+// =============================================================================
+//
+// Every run writes a markdown report: the TUI displays it, notifications
+// attach it and the run history links to it. PDF, HTML and JSON copies are
+// chosen in ~/.config/zfs-backup/reports.json:
+//
+//	{"formats": ["markdown", "pdf", "html", "json"]}
+//
+// Without the file, markdown and PDF are written, as before.
+
+// Report format names, as used in reports.json and as file extensions.
+const (
+	reportMarkdown = "markdown"
+	reportPDF      = "pdf"
+	reportHTML     = "html"
+	reportJSON     = "json"
+)
+
+// reportFormatExtensions maps each format to its file extension.
+var reportFormatExtensions = map[string]string{
+	reportMarkdown: ".md",
+	reportPDF:      ".pdf",
+	reportHTML:     ".html",
+	reportJSON:     ".json",
+}
+
+// ReportConfig is the on-disk report configuration.
+type ReportConfig struct {
+	// Formats lists the report formats to write. Markdown is always written.
+	Formats []string `json:"formats,omitempty"`
+	// Retention expires old reports; without it every report is kept.
+	Retention *ReportRetention `json:"retention,omitempty"`
+}
+
+// reportConfigFileName is the config file holding the report configuration.
+const reportConfigFileName = "reports.json"
+
+// defaultReportFormats are written when no formats are configured.
+var defaultReportFormats = []string{reportMarkdown, reportPDF}
+
+// getReportConfigFilePath returns the path to the report config file.
+func getReportConfigFilePath() (string, error) {
+	dir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, reportConfigFileName), nil
+}
+
+// LoadReportConfig reads the report configuration. A missing file gives the
+// defaults; an unknown format is an error rather than a silently missing
+// report.
+func LoadReportConfig() (*ReportConfig, error) {
+	configPath, err := getReportConfigFilePath()
+	if err != nil {
+		return &ReportConfig{}, err
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &ReportConfig{}, nil
+		}
+		return &ReportConfig{}, err
+	}
+
+	var config ReportConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return &ReportConfig{}, fmt.Errorf("%s: %w", configPath, err)
+	}
+	for _, format := range config.Formats {
+		if _, ok := reportFormatExtensions[format]; !ok {
+			return &ReportConfig{}, fmt.Errorf("%s: unknown report format %q (want markdown, pdf, html or json)", configPath, format)
+		}
+	}
+	if err := config.Retention.validate(); err != nil {
+		return &ReportConfig{}, fmt.Errorf("%s: %w", configPath, err)
+	}
+	return &config, nil
+}
+
+// wants reports whether a format should be written.
+func (c *ReportConfig) wants(format string) bool {
+	if format == reportMarkdown {
+		return true
+	}
+	formats := c.Formats
+	if len(formats) == 0 {
+		formats = defaultReportFormats
+	}
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// reportFiles are the paths one run's report was written to. Formats that
+// were not written are empty.
+type reportFiles struct {
+	Markdown string
+	PDF      string
+	HTML     string
+	JSON     string
+}
+
+// =============================================================================
+// JSON report
+// =============================================================================
+
+// jsonReportVersion is bumped when a field of the JSON report changes
+// meaning. Fields are only ever added within a version.
+const jsonReportVersion = 1
+
+// jsonReport is the canonical, machine-readable form of a report: ReportInfo
+// with durations in seconds and statuses as words.
+type jsonReport struct {
+	Version         int                 `json:"version"`
+	Tool            string              `json:"tool"`
+	ToolVersion     string              `json:"tool_version"`
+	Operation       string              `json:"operation"`
+	Source          string              `json:"source"`
+	Destination     string              `json:"destination"`
+	RemoteHost      string              `json:"remote_host,omitempty"`
+	StartTime       time.Time           `json:"start_time"`
+	EndTime         time.Time           `json:"end_time"`
+	DurationSeconds float64             `json:"duration_seconds"`
+	Success         bool                `json:"success"`
+	Partial         bool                `json:"partial"`
+	Outcome         string              `json:"outcome"`
+	Error           string              `json:"error,omitempty"`
+	Datasets        []jsonReportDataset `json:"datasets"`
+	Anomalies       []string            `json:"change_rate_anomalies,omitempty"`
+	Labelled        []string            `json:"labelled_snapshots,omitempty"`
+	SourceInventory *PoolInventory      `json:"source_inventory,omitempty"`
+	DestInventory   *PoolInventory      `json:"destination_inventory,omitempty"`
+	OperationLog    string              `json:"operation_log,omitempty"`
+}
+
+// jsonReportDataset is one dataset of a JSON report.
+type jsonReportDataset struct {
+	Name            string               `json:"name"`
+	Status          string               `json:"status"`
+	Error           string               `json:"error,omitempty"`
+	DurationSeconds float64              `json:"duration_seconds"`
+	Size            string               `json:"size,omitempty"`
+	Snapshots       []jsonReportSnapshot `json:"snapshots"`
+}
+
+// jsonReportSnapshot is one snapshot of a dataset in a JSON report.
+type jsonReportSnapshot struct {
+	Tag    string `json:"tag"`
+	Status string `json:"status"`
+	Size   string `json:"size,omitempty"`
+}
+
+// snapshotStatusName names a snapshot status for the JSON report.
+func snapshotStatusName(status SnapshotStatus) string {
+	switch status {
+	case SnapSyncing:
+		return "syncing"
+	case SnapDone:
+		return "done"
+	case SnapError:
+		return "error"
+	default:
+		return "pending"
+	}
+}
+
+// generateJSONReport serialises a run's report info and pool inventories.
+func generateJSONReport(info ReportInfo) ([]byte, error) {
+	report := jsonReport{
+		Version:         jsonReportVersion,
+		Tool:            appName,
+		ToolVersion:     appVersion,
+		Operation:       info.Operation,
+		Source:          info.SourcePool,
+		Destination:     info.DestPool,
+		RemoteHost:      info.RemoteHost,
+		StartTime:       info.StartTime,
+		EndTime:         info.EndTime,
+		DurationSeconds: info.EndTime.Sub(info.StartTime).Seconds(),
+		Success:         info.Success,
+		Partial:         info.Partial,
+		Outcome:         runOutcome(info),
+		Error:           info.ErrorMessage,
+		Datasets:        []jsonReportDataset{},
+		Anomalies:       info.Anomalies,
+		Labelled:        info.Labelled,
+		SourceInventory: info.SourceInventory,
+		DestInventory:   info.DestInventory,
+		OperationLog:    info.OperationLog,
+	}
+	for _, ds := range info.DatasetProgress {
+		dataset := jsonReportDataset{
+			Name:            ds.Name,
+			Status:          datasetStatusName(ds.Status),
+			Error:           ds.ErrorMsg,
+			DurationSeconds: ds.Duration.Seconds(),
+			Size:            ds.Size,
+			Snapshots:       []jsonReportSnapshot{},
+		}
+		for _, snap := range ds.Snapshots {
+			dataset.Snapshots = append(dataset.Snapshots, jsonReportSnapshot{
+				Tag:    snap.Tag,
+				Status: snapshotStatusName(snap.Status),
+				Size:   snap.Size,
+			})
+		}
+		report.Datasets = append(report.Datasets, dataset)
+	}
+	return json.MarshalIndent(report, "", "  ")
+}
+
+// =============================================================================
+// HTML report
+// =============================================================================
+
+// htmlReportStyle is the report's inline stylesheet, in the Kartoza colours
+// the PDF uses, so the file needs nothing else to display properly.
+const htmlReportStyle = `
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #1E1E1E; margin: 0; background: #fafafa; }
+header { background: #1E1E1E; padding: 18px 32px; }
+header h1 { color: #DF9E2F; margin: 0; font-size: 24px; }
+header p { color: #569FC6; margin: 4px 0 0; font-size: 13px; }
+main { max-width: 1000px; margin: 0 auto; padding: 16px 32px 32px; }
+h2 { border-bottom: 1px solid #8A8B8B; padding-bottom: 4px; margin-top: 32px; }
+h3 { color: #06969A; }
+.result { font-size: 18px; font-weight: bold; }
+.ok { color: #06969A; } .failed { color: #CC0403; } .warn { color: #DF9E2F; } .dim { color: #8A8B8B; }
+table { border-collapse: collapse; width: 100%; font-size: 13px; margin: 8px 0; }
+th, td { border: 1px solid #ddd; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f0f0f0; }
+pre { background: #f4f4f4; padding: 8px; overflow-x: auto; font-size: 12px; }
+.tree { line-height: 1.5; }
+.dots span { display: inline-block; width: 12px; height: 12px; border-radius: 50%; margin: 1px; }
+.dot-done { background: #569FC6; } .dot-error { background: #CC0403; } .dot-pending { background: #ccc; } .dot-syncing { background: #DF9E2F; }
+footer { color: #8A8B8B; font-size: 12px; text-align: center; margin-top: 32px; }
+`
+
+// htmlNarrative converts the narrative summary's **bold** markdown to HTML.
+func htmlNarrative(text string) string {
+	var b strings.Builder
+	for _, para := range strings.Split(strings.TrimSpace(text), "\n\n") {
+		parts := strings.Split(html.EscapeString(para), "**")
+		b.WriteString("<p>")
+		for i, part := range parts {
+			if i%2 == 1 {
+				b.WriteString("<strong>" + part + "</strong>")
+			} else {
+				b.WriteString(part)
+			}
+		}
+		b.WriteString("</p>\n")
+	}
+	return b.String()
+}
+
+// htmlStatusClass picks the CSS class for a dataset status.
+func htmlStatusClass(status DatasetSyncStatus) string {
+	switch status {
+	case DatasetDone:
+		return "ok"
+	case DatasetError:
+		return "failed"
+	case DatasetSkipped:
+		return "warn"
+	default:
+		return "dim"
+	}
+}
+
+// writeHTMLPoolInventory writes a pool inventory section of the HTML report.
+func writeHTMLPoolInventory(b *strings.Builder, inv *PoolInventory, label string) {
+	if inv == nil {
+		return
+	}
+	esc := html.EscapeString
+
+	b.WriteString(fmt.Sprintf("<h2>%s: %s</h2>\n", esc(label), esc(inv.PoolName)))
+	if inv.UsageText != "" {
+		b.WriteString("<h3>Pool Usage</h3>\n<pre>" + esc(inv.UsageText) + "</pre>\n")
+	}
+	if len(inv.Datasets) > 0 {
+		b.WriteString("<h3>Datasets</h3>\n<table>\n")
+		b.WriteString("<tr><th>Name</th><th>Used</th><th>Available</th><th>Refer</th><th>Quota</th><th>Compression</th><th>Mountpoint</th></tr>\n")
+		for _, ds := range inv.Datasets {
+			quota := ds.Quota
+			if quota == "" || quota == "none" {
+				quota = "-"
+			}
+			compress := ds.Compress
+			if compress == "" {
+				compress = "-"
+			}
+			b.WriteString(fmt.Sprintf("<tr><td><code>%s</code></td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td><code>%s</code></td></tr>\n",
+				esc(ds.Name), esc(ds.Used), esc(ds.Available), esc(ds.Refer), esc(quota), esc(compress), esc(ds.Mountpoint)))
+		}
+		b.WriteString("</table>\n")
+	}
+	if inv.StatusText != "" {
+		b.WriteString("<h3>Pool Status</h3>\n<details><summary>Click to expand</summary>\n<pre>" + esc(inv.StatusText) + "</pre>\n</details>\n")
+	}
+	if inv.SnapshotText != "" {
+		b.WriteString("<h3>Snapshots</h3>\n<details><summary>Click to expand</summary>\n<pre>" + esc(inv.SnapshotText) + "</pre>\n</details>\n")
+	}
+}
+
+// generateHTMLReport creates a self-contained HTML report with the same
+// sections as the markdown report, plus the snapshot matrix the TUI shows.
+func generateHTMLReport(info ReportInfo) string {
+	var b strings.Builder
+	esc := html.EscapeString
+	totalDuration := info.EndTime.Sub(info.StartTime)
+
+	b.WriteString("<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n")
+	b.WriteString(fmt.Sprintf("<title>%s</title>\n", esc(generateReportFilename(info))))
+	b.WriteString("<style>" + htmlReportStyle + "</style>\n</head>\n<body>\n")
+
+	// Header with Kartoza branding
+	b.WriteString("<header>\n<h1>Kartoza ZFS Backup Report</h1>\n")
+	b.WriteString(fmt.Sprintf("<p>%s v%s | %s</p>\n</header>\n<main>\n",
+		esc(appName), esc(appVersion), esc(info.StartTime.Format("Monday, 02 January 2006 at 15:04"))))
+
+	// Result banner
+	if info.Success {
+		b.WriteString("<p class=\"result ok\">BACKUP COMPLETED SUCCESSFULLY</p>\n")
+	} else {
+		b.WriteString("<p class=\"result failed\">BACKUP FAILED</p>\n")
+	}
+
+	// What happened - plain language overview
+	b.WriteString("<h2>What happened</h2>\n")
+	b.WriteString(htmlNarrative(writeNarrativeSummary(info, totalDuration)))
+	writeHTMLChangeAnomalies(&b, info.Anomalies)
+	writeHTMLLabelledSnapshots(&b, info.Labelled)
+
+	// Technical summary table
+	b.WriteString("<h2>Technical Summary</h2>\n<table>\n")
+	row := func(key, value string) {
+		b.WriteString(fmt.Sprintf("<tr><th>%s</th><td>%s</td></tr>\n", esc(key), esc(value)))
+	}
+	row("Operation", operationLabel(info.Operation))
+	row("Source", info.SourcePool)
+	row("Destination", info.DestPool)
+	if info.RemoteHost != "" {
+		row("Remote Host", info.RemoteHost)
+	}
+	row("Started", info.StartTime.Format("2006-01-02 15:04:05"))
+	row("Finished", info.EndTime.Format("2006-01-02 15:04:05"))
+	row("Total Duration", formatDuration(totalDuration))
+	b.WriteString("</table>\n")
+
+	if len(info.DatasetProgress) > 0 {
+		// Dataset sync results
+		b.WriteString("<h2>Dataset Sync Results</h2>\n<table>\n")
+		b.WriteString("<tr><th>Dataset</th><th>Size</th><th>Snapshots</th><th>Sync Time</th><th>Status</th></tr>\n")
+		for _, ds := range info.DatasetProgress {
+			size := ds.Size
+			if size == "" || size == "?" {
+				size = "-"
+			}
+			dur := "-"
+			if ds.Duration > 0 {
+				dur = formatDuration(ds.Duration)
+			}
+			b.WriteString(fmt.Sprintf("<tr><td><code>%s</code></td><td>%s</td><td>%d</td><td>%s</td><td class=\"%s\">%s</td></tr>\n",
+				esc(ds.Name), esc(size), len(ds.Snapshots), esc(dur), htmlStatusClass(ds.Status), datasetStatusLabel(ds.Status)))
+		}
+		b.WriteString("</table>\n")
+
+		// Backup tree: pool > datasets > snapshots
+		b.WriteString("<h2>Backup Tree</h2>\n<ul class=\"tree\">\n")
+		poolName := info.SourcePool
+		if poolName == "" {
+			poolName = "pool"
+		}
+		poolClass, poolIcon := "ok", "✓"
+		if !info.Success {
+			poolClass, poolIcon = "failed", "✕"
+		}
+		b.WriteString(fmt.Sprintf("<li class=\"%s\">%s <strong>%s</strong>\n<ul>\n", poolClass, poolIcon, esc(poolName)))
+		for _, ds := range info.DatasetProgress {
+			icon := "✓"
+			switch ds.Status {
+			case DatasetError:
+				icon = "✕"
+			case DatasetSkipped, DatasetPending:
+				icon = "○"
+			}
+			line := esc(ds.Name)
+			if ds.Size != "" && ds.Size != "?" {
+				line += fmt.Sprintf(" <span class=\"dim\">[%s]</span>", esc(ds.Size))
+			}
+			if ds.Duration > 0 {
+				line += fmt.Sprintf(" <span class=\"dim\">%s</span>", esc(formatDuration(ds.Duration)))
+			}
+			b.WriteString(fmt.Sprintf("<li class=\"%s\">%s %s\n<ul>\n", htmlStatusClass(ds.Status), icon, line))
+			for _, snap := range ds.Snapshots {
+				snapIcon, snapClass := "✓", "ok"
+				switch snap.Status {
+				case SnapError:
+					snapIcon, snapClass = "✕", "failed"
+				case SnapPending:
+					snapIcon, snapClass = "○", "dim"
+				}
+				snapLine := "@" + esc(snap.Tag)
+				if snap.Size != "" && snap.Size != "0" && snap.Size != "0B" {
+					snapLine += fmt.Sprintf(" <span class=\"dim\">(%s)</span>", esc(snap.Size))
+				}
+				b.WriteString(fmt.Sprintf("<li class=\"%s\">%s %s</li>\n", snapClass, snapIcon, snapLine))
+			}
+			b.WriteString("</ul>\n</li>\n")
+		}
+		b.WriteString("</ul>\n</li>\n</ul>\n")
+
+		// Snapshot matrix: one row of dots per dataset, as in the TUI
+		b.WriteString("<h2>Snapshot Matrix</h2>\n<table>\n")
+		b.WriteString("<tr><th>Dataset</th><th>Snapshots</th></tr>\n")
+		for _, ds := range info.DatasetProgress {
+			b.WriteString(fmt.Sprintf("<tr><td><code>%s</code></td><td class=\"dots\">", esc(ds.Name)))
+			for _, snap := range ds.Snapshots {
+				b.WriteString(fmt.Sprintf("<span class=\"dot-%s\" title=\"@%s\"></span>",
+					snapshotStatusName(snap.Status), esc(snap.Tag)))
+			}
+			b.WriteString("</td></tr>\n")
+		}
+		b.WriteString("</table>\n")
+
+		// Errors section
+		var errorsHTML strings.Builder
+		for _, ds := range info.DatasetProgress {
+			if ds.ErrorMsg != "" {
+				errorsHTML.WriteString(fmt.Sprintf("<h3><code>%s</code></h3>\n<p><strong>Status:</strong> %s</p>\n<pre>%s</pre>\n",
+					esc(ds.Name), datasetStatusLabel(ds.Status), esc(ds.ErrorMsg)))
+			}
+		}
+		if errorsHTML.Len() > 0 {
+			b.WriteString("<h2>Errors</h2>\n")
+			b.WriteString("<p>The following datasets encountered problems during sync. " +
+				"These errors do not necessarily mean data was lost - the backup " +
+				"tool will retry failed datasets on the next run.</p>\n")
+			b.WriteString(errorsHTML.String())
+		}
+	} else if info.ErrorMessage != "" {
+		b.WriteString("<h2>Error Details</h2>\n<pre>" + esc(info.ErrorMessage) + "</pre>\n")
+	}
+
+	// Pool inventory sections
+	writeHTMLComparison(&b, info.Comparison)
+	writeHTMLPoolInventory(&b, info.SourceInventory, "Source Pool")
+	writeHTMLPoolInventory(&b, info.DestInventory, "Destination Pool")
+
+	// Operation log
+	if info.OperationLog != "" {
+		b.WriteString("<h2>Operation Log</h2>\n<details><summary>Click to expand</summary>\n")
+		b.WriteString("<pre>" + esc(info.OperationLog) + "</pre>\n</details>\n")
+	}
+
+	// What to do next
+	b.WriteString("<h2>What to do next</h2>\n")
+	if info.Success {
+		b.WriteString("<p>Your data is safely backed up. No action is required.</p>\n<ul>\n")
+		b.WriteString("<li>To verify the backup, use <strong>Show zpool info</strong> in the application</li>\n")
+		b.WriteString("<li>To safely disconnect the backup drive, use <strong>Unmount Backup Disk</strong></li>\n")
+		b.WriteString("<li>Previous reports are stored in <code>~/.local/share/zfs-backup/reports/</code></li>\n</ul>\n")
+	} else {
+		b.WriteString("<p>The backup did not complete successfully. Here are some things to try:</p>\n<ol>\n")
+		b.WriteString("<li><strong>Run the backup again</strong> - transient errors often resolve on retry</li>\n")
+		b.WriteString("<li><strong>Use Recover Failed Backup</strong> to clear stale receive state</li>\n")
+		b.WriteString("<li><strong>Check disk health</strong> with Pool Maintenance &gt; Scrub</li>\n")
+		b.WriteString("<li><strong>Use Force Backup</strong> as a last resort to reset the sync chain</li>\n</ol>\n")
+	}
+
+	// Footer
+	b.WriteString(fmt.Sprintf("<footer>%s v%s | Made with &lt;3 by <a href=\"%s\">Kartoza</a> | <a href=\"%s\">Donate</a> | <a href=\"%s\">GitHub</a></footer>\n",
+		esc(appName), esc(appVersion), kartozaURL, donateURL, githubURL))
+	b.WriteString("</main>\n</body>\n</html>\n")
+	return b.String()
+}
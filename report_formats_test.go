@@ -0,0 +1,165 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeReportConfig(t *testing.T, content string) {
+	t.Helper()
+	path, err := getReportConfigFilePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func reportWithInventory() ReportInfo {
+	info := sampleReportInfo()
+	info.DatasetProgress[0].Snapshots = []SnapshotDot{{Tag: "2026-10-18.02h-00-Backup", Status: SnapDone, Size: "1.2G"}}
+	info.SourceInventory = &PoolInventory{
+		PoolName: "NIXROOT",
+		Datasets: []PoolInventoryDataset{{Name: "NIXROOT/home", Used: "120G", Available: "300G", Refer: "100G", Mountpoint: "/home"}},
+	}
+	info.DestInventory = &PoolInventory{PoolName: "NIXBACKUPS", UsageText: "NIXBACKUPS 2T 1T 1T"}
+	return info
+}
+
+func TestJSONReportSerialisesReportInfoAndInventories(t *testing.T) {
+	data, err := generateJSONReport(reportWithInventory())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var report jsonReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Operation != "backup" || report.Outcome != notifyPartial || report.DurationSeconds != 360 {
+		t.Errorf("unexpected run summary %+v", report)
+	}
+	want := []jsonReportDataset{
+		{Name: "home", Status: "done", Snapshots: []jsonReportSnapshot{{Tag: "2026-10-18.02h-00-Backup", Status: "done", Size: "1.2G"}}},
+		{Name: "atuin", Status: "error", Error: "syncoid failed", Snapshots: []jsonReportSnapshot{}},
+	}
+	if !reflect.DeepEqual(report.Datasets, want) {
+		t.Errorf("expected datasets %+v, got %+v", want, report.Datasets)
+	}
+	if report.SourceInventory == nil || report.SourceInventory.Datasets[0].Mountpoint != "/home" {
+		t.Errorf("the source inventory should be included, got %+v", report.SourceInventory)
+	}
+	if report.DestInventory == nil || report.DestInventory.UsageText != "NIXBACKUPS 2T 1T 1T" {
+		t.Errorf("the destination inventory should be included, got %+v", report.DestInventory)
+	}
+	if !strings.Contains(string(data), `"mountpoint": "/home"`) {
+		t.Error("inventory fields should use the report's snake_case names")
+	}
+}
+
+func TestHTMLReportHasSectionsAndEscapes(t *testing.T) {
+	info := reportWithInventory()
+	info.DatasetProgress[1].ErrorMsg = "cannot receive: <dataset> busy"
+	page := generateHTMLReport(info)
+
+	for _, section := range []string{"What happened", "Technical Summary", "Dataset Sync Results", "Backup Tree", "Snapshot Matrix", "Source Pool: NIXROOT", "Destination Pool: NIXBACKUPS"} {
+		if !strings.Contains(page, section) {
+			t.Errorf("the HTML report should have a %q section", section)
+		}
+	}
+	if !strings.Contains(page, "&lt;dataset&gt; busy") || strings.Contains(page, "<dataset>") {
+		t.Error("error messages must be escaped")
+	}
+	if !strings.Contains(page, "<style>") || strings.Contains(page, "<link") {
+		t.Error("the HTML report must be self-contained")
+	}
+}
+
+func TestReportConfigFormats(t *testing.T) {
+	useTempHome(t)
+	config, err := LoadReportConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.wants(reportMarkdown) || !config.wants(reportPDF) || config.wants(reportHTML) || config.wants(reportJSON) {
+		t.Error("without a config, markdown and PDF are written as before")
+	}
+
+	writeReportConfig(t, `{"formats": ["json"]}`)
+	config, err = LoadReportConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.wants(reportMarkdown) || config.wants(reportPDF) || !config.wants(reportJSON) {
+		t.Error("markdown is always written; everything else is as configured")
+	}
+
+	writeReportConfig(t, `{"formats": ["docx"]}`)
+	if _, err := LoadReportConfig(); err == nil {
+		t.Error("an unknown format should be an error")
+	}
+}
+
+func TestWriteBackupReportWritesConfiguredFormats(t *testing.T) {
+	home := useTempHome(t)
+	writeReportConfig(t, `{"formats": ["markdown", "html", "json"]}`)
+
+	files, err := writeBackupReport(reportWithInventory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files.Markdown == "" || files.HTML == "" || files.JSON == "" || files.PDF != "" {
+		t.Errorf("expected markdown, HTML and JSON but no PDF, got %+v", files)
+	}
+
+	entries, err := listReportEntries(filepath.Join(home, ".local", "share", "zfs-backup", "reports"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("every format of one run is one entry, got %+v", entries)
+	}
+	if e := entries[0]; e.Path != files.Markdown || e.HTMLPath != files.HTML || e.JSONPath != files.JSON {
+		t.Errorf("the entry should list every format, got %+v", e)
+	}
+	if got := entries[0].openPath(); got != files.HTML {
+		t.Errorf("without a PDF the HTML report is opened, got %s", got)
+	}
+}
+
+func TestListReportEntriesNewestFirst(t *testing.T) {
+	dir := t.TempDir()
+	for i, name := range []string{"B-Report.md", "A-Report.json", "notes.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		stamp := time.Date(2026, 10, 1+i, 0, 0, 0, 0, time.UTC)
+		if err := os.Chtimes(path, stamp, stamp); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := listReportEntries(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Name != "A-Report" || entries[1].Name != "B-Report" {
+		t.Errorf("expected the two reports newest first, got %+v", entries)
+	}
+	if entries[0].viewPath() != entries[0].JSONPath {
+		t.Error("a report with only JSON is viewed as JSON")
+	}
+}
@@ -0,0 +1,468 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// Report retention - expiring and archiving old reports
+// =============================================================================
+//
+// Retention is configured alongside the formats in reports.json:
+//
+//	{"retention": {"keep_days": 90, "keep_last_per_operation": 20,
+//	               "keep_failures_days": 365, "archive": true}}
+//
+// A report is kept while it is younger than keep_days, or among the newest
+// keep_last_per_operation of its kind, or - if the run failed - younger than
+// keep_failures_days. Anything else expires: it is moved into a monthly
+// archive, reports/archive/YYYY-MM.tar.gz, when archive is set, and deleted
+// otherwise. Without a retention section nothing ever expires.
+
+// ReportRetention is the report retention policy. Zero values disable a rule.
+type ReportRetention struct {
+	KeepDays             int  `json:"keep_days,omitempty"`
+	KeepLastPerOperation int  `json:"keep_last_per_operation,omitempty"`
+	KeepFailuresDays     int  `json:"keep_failures_days,omitempty"`
+	Archive              bool `json:"archive,omitempty"`
+}
+
+// enabled reports whether any rule can expire a report.
+func (r *ReportRetention) enabled() bool {
+	return r != nil && (r.KeepDays > 0 || r.KeepLastPerOperation > 0)
+}
+
+// validate rejects negative values, which would otherwise expire everything.
+func (r *ReportRetention) validate() error {
+	if r == nil {
+		return nil
+	}
+	if r.KeepDays < 0 || r.KeepLastPerOperation < 0 || r.KeepFailuresDays < 0 {
+		return fmt.Errorf("report retention values cannot be negative")
+	}
+	return nil
+}
+
+// reportArchiveDirName is the reports subdirectory holding monthly archives.
+const reportArchiveDirName = "archive"
+
+// reportTimestamp matches the start time generateReportFilename puts in a
+// report's name, e.g. Backup-NIXROOT-to-NIXBACKUPS-18May2026-10h00-Report.
+var reportTimestamp = regexp.MustCompile(`-(\d{2}[A-Z][a-z]{2}\d{4}-\d{2}h\d{2})-Report$`)
+
+// reportTime returns when a report's run started, from its name, falling back
+// to the file's modification time.
+func reportTime(entry reportEntry) time.Time {
+	if m := reportTimestamp.FindStringSubmatch(entry.Name); m != nil {
+		if t, err := time.ParseInLocation("02Jan2006-15h04", m[1], time.Local); err == nil {
+			return t
+		}
+	}
+	return entry.ModTime
+}
+
+// reportKind groups reports for keep_last_per_operation: the operation prefix
+// of the name, e.g. PullBackup.
+func reportKind(entry reportEntry) string {
+	if idx := strings.Index(entry.Name, "-"); idx > 0 {
+		return entry.Name[:idx]
+	}
+	return entry.Name
+}
+
+// reportFailed reports whether a report's run failed, from its JSON or
+// markdown. A report that cannot be read is treated as failed, so it is kept
+// for the longer failure period rather than expiring early.
+func reportFailed(entry reportEntry) bool {
+	outcome, _ := summariseReport(entry, readReportFile)
+	return outcome != notifySuccess
+}
+
+// expiredReports picks the reports the policy no longer keeps.
+func expiredReports(entries []reportEntry, policy *ReportRetention, now time.Time, failed func(reportEntry) bool) []reportEntry {
+	if !policy.enabled() {
+		return nil
+	}
+	days := func(n int) time.Duration { return time.Duration(n) * 24 * time.Hour }
+
+	// Newest run first, by when it ran rather than when its files were
+	// last touched.
+	entries = append([]reportEntry(nil), entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return reportTime(entries[i]).After(reportTime(entries[j]))
+	})
+
+	var expired []reportEntry
+	seenOfKind := map[string]int{}
+	for _, entry := range entries {
+		kind := reportKind(entry)
+		seenOfKind[kind]++
+		age := now.Sub(reportTime(entry))
+
+		if policy.KeepDays > 0 && age <= days(policy.KeepDays) {
+			continue
+		}
+		if policy.KeepLastPerOperation > 0 && seenOfKind[kind] <= policy.KeepLastPerOperation {
+			continue
+		}
+		if policy.KeepFailuresDays > 0 && age <= days(policy.KeepFailuresDays) && failed(entry) {
+			continue
+		}
+		expired = append(expired, entry)
+	}
+	return expired
+}
+
+// rotateReports applies the retention policy to the reports directory.
+// Returns how many reports expired.
+func rotateReports(now time.Time) (int, error) {
+	config, err := LoadReportConfig()
+	if err != nil {
+		return 0, err
+	}
+	if !config.Retention.enabled() {
+		return 0, nil
+	}
+	dir, err := getReportsDir()
+	if err != nil {
+		return 0, err
+	}
+
+	entries, err := listLooseReportEntries(dir)
+	if err != nil {
+		return 0, err
+	}
+	expired := expiredReports(entries, config.Retention, now, reportFailed)
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	if !config.Retention.Archive {
+		for _, entry := range expired {
+			for _, path := range entry.files() {
+				if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+					return 0, fmt.Errorf("failed to remove expired report: %w", err)
+				}
+			}
+		}
+		return len(expired), nil
+	}
+
+	// Archive month by month, so each archive is rewritten once.
+	byMonth := map[string][]string{}
+	for _, entry := range expired {
+		month := reportTime(entry).Format("2006-01")
+		byMonth[month] = append(byMonth[month], entry.files()...)
+	}
+	archiveDir := filepath.Join(dir, reportArchiveDirName)
+	if err := os.MkdirAll(archiveDir, 0755); err != nil {
+		return 0, err
+	}
+	chownToRealUser(archiveDir)
+	for month, files := range byMonth {
+		archivePath := filepath.Join(archiveDir, month+".tar.gz")
+		if err := addToReportArchive(archivePath, files); err != nil {
+			return 0, fmt.Errorf("failed to archive reports for %s: %w", month, err)
+		}
+		chownToRealUser(archivePath)
+		// Only remove the originals once the archive holding them is in place.
+		for _, path := range files {
+			_ = os.Remove(path)
+		}
+	}
+	return len(expired), nil
+}
+
+// =============================================================================
+// Monthly archives
+// =============================================================================
+
+// archiveMember is one file inside a report archive.
+type archiveMember struct {
+	name    string
+	modTime time.Time
+	data    []byte
+}
+
+// readReportArchive returns every file in an archive. With names nil every
+// file's contents are read; otherwise only the named files' are, and the rest
+// are listed without data.
+func readReportArchive(archivePath string, names map[string]bool) ([]archiveMember, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", archivePath, err)
+	}
+	defer gz.Close()
+
+	var members []archiveMember
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", archivePath, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		member := archiveMember{name: hdr.Name, modTime: hdr.ModTime}
+		if names == nil || names[hdr.Name] {
+			if member.data, err = io.ReadAll(tr); err != nil {
+				return nil, fmt.Errorf("%s: %w", archivePath, err)
+			}
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// writeReportArchive replaces an archive with the given members, atomically,
+// so an interrupted rotation never loses the reports already archived.
+func writeReportArchive(archivePath string, members []archiveMember) error {
+	tmp, err := os.CreateTemp(filepath.Dir(archivePath), "."+filepath.Base(archivePath)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // no-op once renamed
+
+	gz := gzip.NewWriter(tmp)
+	tw := tar.NewWriter(gz)
+	for _, m := range members {
+		hdr := &tar.Header{Name: m.name, Mode: 0644, Size: int64(len(m.data)), ModTime: m.modTime, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			tmp.Close()
+			return err
+		}
+		if _, err := tw.Write(m.data); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, archivePath)
+}
+
+// addToReportArchive adds files to a monthly archive, creating it if needed.
+// A file already in the archive is replaced.
+func addToReportArchive(archivePath string, files []string) error {
+	var members []archiveMember
+	if _, err := os.Stat(archivePath); err == nil {
+		if members, err = readReportArchive(archivePath, nil); err != nil {
+			return err
+		}
+	}
+
+	index := map[string]int{}
+	for i, m := range members {
+		index[m.name] = i
+	}
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		member := archiveMember{name: filepath.Base(path), data: data, modTime: time.Now()}
+		if info, err := os.Stat(path); err == nil {
+			member.modTime = info.ModTime()
+		}
+		if i, ok := index[member.name]; ok {
+			members[i] = member
+			continue
+		}
+		index[member.name] = len(members)
+		members = append(members, member)
+	}
+	sort.SliceStable(members, func(i, j int) bool { return members[i].name < members[j].name })
+	return writeReportArchive(archivePath, members)
+}
+
+// =============================================================================
+// Reading archived reports
+// =============================================================================
+//
+// Archived reports are listed with paths inside their archive, e.g.
+// reports/archive/2026-08.tar.gz/Backup-...-Report.md, so the report browser
+// handles them like any other report file.
+
+// splitArchivePath splits a path inside a report archive into the archive and
+// the member name. ok is false for ordinary files.
+func splitArchivePath(path string) (archivePath, member string, ok bool) {
+	dir := filepath.Dir(path)
+	if !strings.HasSuffix(dir, ".tar.gz") || filepath.Base(filepath.Dir(dir)) != reportArchiveDirName {
+		return "", "", false
+	}
+	return dir, filepath.Base(path), true
+}
+
+// listArchivedReportEntries groups the reports in every monthly archive under
+// archiveDir by run. A missing archive directory has no reports.
+func listArchivedReportEntries(archiveDir string) ([]reportEntry, error) {
+	archives, err := filepath.Glob(filepath.Join(archiveDir, "*.tar.gz"))
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []reportEntry
+	for _, archivePath := range archives {
+		members, err := readReportArchive(archivePath, map[string]bool{})
+		if err != nil {
+			return nil, err
+		}
+		month := strings.TrimSuffix(filepath.Base(archivePath), ".tar.gz")
+		byName := map[string]int{}
+		for _, m := range members {
+			ext := filepath.Ext(m.name)
+			if !isReportExtension(ext) {
+				continue
+			}
+			baseName := strings.TrimSuffix(m.name, ext)
+			i, seen := byName[baseName]
+			if !seen {
+				i = len(reports)
+				byName[baseName] = i
+				reports = append(reports, reportEntry{Name: baseName, Archive: month})
+			}
+			entry := &reports[i]
+			path := filepath.Join(archivePath, m.name)
+			switch ext {
+			case ".md":
+				entry.Path = path
+			case ".pdf":
+				entry.PdfPath = path
+			case ".html":
+				entry.HTMLPath = path
+			case ".json":
+				entry.JSONPath = path
+			}
+			if m.modTime.After(entry.ModTime) {
+				entry.ModTime = m.modTime
+			}
+		}
+	}
+	return reports, nil
+}
+
+// isReportExtension reports whether ext belongs to one of the report formats.
+func isReportExtension(ext string) bool {
+	for _, e := range reportFormatExtensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// readReportFile reads a report file, from its archive if it was rotated.
+func readReportFile(path string) ([]byte, error) {
+	archivePath, member, ok := splitArchivePath(path)
+	if !ok {
+		return os.ReadFile(path)
+	}
+	members, err := readReportArchive(archivePath, map[string]bool{member: true})
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range members {
+		if m.name == member {
+			return m.data, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: no %s in archive", archivePath, member)
+}
+
+// openReportFile opens a report in the desktop viewer. An archived report is
+// extracted to ~/.cache/zfs-backup/reports first.
+func openReportFile(path string) error {
+	if _, _, ok := splitArchivePath(path); !ok {
+		return openFileForUser(path)
+	}
+	data, err := readReportFile(path)
+	if err != nil {
+		return err
+	}
+	home, err := getRealUserHome()
+	if err != nil {
+		return err
+	}
+	cacheDir := filepath.Join(home, ".cache", "zfs-backup", "reports")
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return err
+	}
+	extracted := filepath.Join(cacheDir, filepath.Base(path))
+	if err := os.WriteFile(extracted, data, 0644); err != nil {
+		return err
+	}
+	chownToRealUser(extracted)
+	return openFileForUser(extracted)
+}
+
+// removeReport deletes a report in every format, rewriting its archive if it
+// was rotated.
+func removeReport(entry reportEntry) error {
+	files := entry.files()
+	if entry.Archive == "" {
+		for _, path := range files {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		return nil
+	}
+
+	archivePath, _, _ := splitArchivePath(files[0])
+	drop := map[string]bool{}
+	for _, path := range files {
+		drop[filepath.Base(path)] = true
+	}
+	members, err := readReportArchive(archivePath, nil)
+	if err != nil {
+		return err
+	}
+	kept := members[:0]
+	for _, m := range members {
+		if !drop[m.name] {
+			kept = append(kept, m)
+		}
+	}
+	if len(kept) == 0 {
+		return os.Remove(archivePath)
+	}
+	return writeReportArchive(archivePath, kept)
+}
@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeReportFiles creates one run's report in dir, in the given formats.
+func writeReportFiles(t *testing.T, dir, name string, exts ...string) {
+	t.Helper()
+	for _, ext := range exts {
+		content := "# Kartoza ZFS Backup Report\n\n**Result: BACKUP COMPLETED SUCCESSFULLY**\n"
+		if err := os.WriteFile(filepath.Join(dir, name+ext), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExpiredReportsKeepsRecentLastNAndFailures(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+	entries := []reportEntry{
+		{Name: "Backup-NIXROOT-to-NIXBACKUPS-17Oct2026-02h00-Report"},
+		{Name: "PullBackup-server-to-NIXBACKUPS-01Aug2026-02h00-Report"},
+		{Name: "Backup-NIXROOT-to-NIXBACKUPS-01Aug2026-02h00-Report"},
+		{Name: "Backup-NIXROOT-to-NIXBACKUPS-31Jul2026-02h00-Report"},
+		{Name: "Backup-NIXROOT-to-NIXBACKUPS-01Jan2026-02h00-Report"},
+	}
+	failed := func(e reportEntry) bool { return e.Name == entries[3].Name || e.Name == entries[4].Name }
+	policy := &ReportRetention{KeepDays: 30, KeepLastPerOperation: 2, KeepFailuresDays: 180}
+
+	expired := expiredReports(entries, policy, now, failed)
+	// Kept: [0] is recent, [1] is the only pull, [2] is the second newest
+	// backup, [3] failed within 180 days. [4] failed too long ago.
+	if len(expired) != 1 || expired[0].Name != entries[4].Name {
+		t.Errorf("expected only the January report to expire, got %+v", expired)
+	}
+
+	if got := expiredReports(entries, &ReportRetention{KeepFailuresDays: 30}, now, failed); got != nil {
+		t.Errorf("a policy with only keep_failures_days never expires anything, got %+v", got)
+	}
+}
+
+func TestRotateReportsArchivesByMonthAndListsArchives(t *testing.T) {
+	home := useTempHome(t)
+	writeReportConfig(t, `{"retention": {"keep_last_per_operation": 1, "archive": true}}`)
+	dir := filepath.Join(home, ".local", "share", "zfs-backup", "reports")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	newest := "Backup-NIXROOT-to-NIXBACKUPS-18Oct2026-02h00-Report"
+	august := "Backup-NIXROOT-to-NIXBACKUPS-14Aug2026-02h00-Report"
+	writeReportFiles(t, dir, newest, ".md")
+	writeReportFiles(t, dir, august, ".md", ".json")
+
+	count, err := rotateReports(time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected one report to expire, got %d", count)
+	}
+	if _, err := os.Stat(filepath.Join(dir, august+".md")); !os.IsNotExist(err) {
+		t.Error("the expired report should have been moved out of the reports directory")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "archive", "2026-08.tar.gz")); err != nil {
+		t.Errorf("the report should be in its month's archive: %v", err)
+	}
+
+	entries, err := listReportEntries(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("archived reports should still be listed, got %+v", entries)
+	}
+	var archived reportEntry
+	for _, e := range entries {
+		if e.Name == august {
+			archived = e
+		}
+	}
+	if archived.Archive != "2026-08" || archived.JSONPath == "" {
+		t.Fatalf("expected the August report from its archive in both formats, got %+v", archived)
+	}
+	data, err := readReportFile(archived.Path)
+	if err != nil || string(data) != "# Kartoza ZFS Backup Report\n\n**Result: BACKUP COMPLETED SUCCESSFULLY**\n" {
+		t.Errorf("the archived markdown should read back unchanged, got %q (%v)", data, err)
+	}
+
+	if err := removeReport(archived); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "archive", "2026-08.tar.gz")); !os.IsNotExist(err) {
+		t.Error("deleting the only report in an archive should remove the archive")
+	}
+}
+
+func TestRotateReportsAddsToExistingArchive(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "2026-08.tar.gz")
+	writeReportFiles(t, dir, "A-Report", ".md")
+	writeReportFiles(t, dir, "B-Report", ".md")
+
+	if err := addToReportArchive(archivePath, []string{filepath.Join(dir, "A-Report.md")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := addToReportArchive(archivePath, []string{filepath.Join(dir, "B-Report.md")}); err != nil {
+		t.Fatal(err)
+	}
+	members, err := readReportArchive(archivePath, map[string]bool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 2 || members[0].name != "A-Report.md" || members[1].name != "B-Report.md" {
+		t.Errorf("the archive should hold both reports, got %+v", members)
+	}
+}
+
+func TestReportConfigRejectsNegativeRetention(t *testing.T) {
+	useTempHome(t)
+	writeReportConfig(t, `{"retention": {"keep_days": -1}}`)
+	if _, err := LoadReportConfig(); err == nil {
+		t.Error("a negative retention value should be an error")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -67,6 +68,8 @@ type SnapshotEntry struct {
 	Creation  time.Time
 	Used      string
 	Referenced string
+	Label     string // zfs-backup snapshot --label, if any
+	Pinned    bool
 }
 
 // RestoreModel holds the state for restore mode
@@ -1331,6 +1334,13 @@ func getPoolSnapshots(pool string) ([]SnapshotEntry, error) {
 		snapshots[i], snapshots[j] = snapshots[j], snapshots[i]
 	}
 
+	// Labels are shown alongside the name; without them the list still works.
+	if labels, err := listSnapshotLabels(context.Background(), defaultRunner, pool, 0); err == nil {
+		for i, snap := range snapshots {
+			snapshots[i].Label, snapshots[i].Pinned = labels[snap.Name].Label, labels[snap.Name].Pinned
+		}
+	}
+
 	return snapshots, nil
 }
 
@@ -1720,6 +1730,18 @@ func (m RestoreModel) renderLeftPanel(width, height int) string {
 			if len(name) > width-30 {
 				name = "..." + name[len(name)-width+33:]
 			}
+			if snap.Label != "" {
+				label := snap.Label
+				if snap.Pinned {
+					label = "📌 " + label
+				}
+				if room := width - 8 - len(name); room > 3 {
+					if runes := []rune(label); len(runes) > room {
+						label = string(runes[:room-3]) + "..."
+					}
+					name += "  " + label
+				}
+			}
 
 			var line string
 			if idx == m.snapshotIndex && m.focus == focusLeft {
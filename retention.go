@@ -0,0 +1,352 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// Immutable retention window
+// =============================================================================
+//
+// With a retention window configured, every zfs-backup snapshot on the backup
+// pool carries a zfs-backup-retain hold until it is older than the window.
+// `zfs destroy` refuses a held snapshot, so neither a compromised source host
+// running zfs-backup nor a mistaken Force Backup can wipe the backup history:
+// pruning skips retained snapshots, Force Backup and --retire refuse to run
+// over them, and only `zfs-backup release-retention` - a separate, typed
+// confirmation - lets them go early.
+
+// RetentionConfig is the on-disk retention configuration.
+type RetentionConfig struct {
+	// ImmutableDays is how long each backup snapshot is held after it was
+	// taken. 0 disables the window: no new holds are placed, and holds
+	// already in place are kept until released by hand.
+	ImmutableDays int `json:"immutable_days"`
+}
+
+// retentionFileName is the config file holding the retention window.
+const retentionFileName = "retention.json"
+
+// getRetentionFilePath returns the path to the retention config file.
+func getRetentionFilePath() (string, error) {
+	dir, err := getConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, retentionFileName), nil
+}
+
+// LoadRetentionConfig reads the retention configuration. A missing file
+// disables the window; a broken one is an error, so retention never lapses
+// because of a typo.
+func LoadRetentionConfig() (*RetentionConfig, error) {
+	retentionPath, err := getRetentionFilePath()
+	if err != nil {
+		return &RetentionConfig{}, err
+	}
+
+	data, err := os.ReadFile(retentionPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &RetentionConfig{}, nil
+		}
+		return &RetentionConfig{}, err
+	}
+
+	var config RetentionConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return &RetentionConfig{}, fmt.Errorf("%s: %w", retentionPath, err)
+	}
+	if config.ImmutableDays < 0 {
+		return &RetentionConfig{}, fmt.Errorf("%s: immutable_days must not be negative", retentionPath)
+	}
+	return &config, nil
+}
+
+// window is the retention window, zero when disabled.
+func (c *RetentionConfig) window() time.Duration {
+	return time.Duration(c.ImmutableDays) * 24 * time.Hour
+}
+
+// retentionHoldTag is the user hold placed on snapshots inside the window.
+const retentionHoldTag = "zfs-backup-retain"
+
+// errRetained is returned when a destroy path reaches a snapshot inside the
+// retention window.
+var errRetained = errors.New("snapshot is inside the immutable retention window")
+
+// hasHold reports whether tags includes tag.
+func hasHold(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// retentionExpired reports whether a snapshot taken at created has aged out
+// of the window. With no window nothing ever expires: holds placed under an
+// earlier window are kept rather than dropped by a config change.
+func retentionExpired(created time.Time, window time.Duration, now time.Time) bool {
+	return window > 0 && !now.Before(created.Add(window))
+}
+
+// retainedSnapshot is one snapshot carrying the retention hold.
+type retainedSnapshot struct {
+	snapshotEntry
+	Expired bool // older than the window, so free to release
+}
+
+// listRetained lists the snapshots at or below target that carry the
+// retention hold, oldest first, with depth as for listSnapshotEntries.
+func listRetained(ctx context.Context, r commandRunner, target string, depth int, window time.Duration, now time.Time) ([]retainedSnapshot, error) {
+	holds, err := listHoldsUnder(ctx, r, target, depth)
+	if err != nil {
+		return nil, err
+	}
+	held := map[string]bool{}
+	for _, h := range holds {
+		if h.Tag == retentionHoldTag {
+			held[h.Snapshot] = true
+		}
+	}
+	if len(held) == 0 {
+		return nil, nil
+	}
+	entries, err := listSnapshotEntries(ctx, r, target, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	var retained []retainedSnapshot
+	for _, e := range entries {
+		if held[e.Name] {
+			retained = append(retained, retainedSnapshot{snapshotEntry: e, Expired: retentionExpired(e.Creation, window, now)})
+		}
+	}
+	sort.Slice(retained, func(i, j int) bool { return retained[i].Creation.Before(retained[j].Creation) })
+	return retained, nil
+}
+
+// applyRetentionHolds holds every zfs-backup snapshot of a backup dataset
+// that is inside the window and releases the holds that have aged out. It
+// returns how many holds it placed and released.
+func applyRetentionHolds(ctx context.Context, r commandRunner, dataset string, window time.Duration, now time.Time) (held, released int, err error) {
+	holds, err := listHoldsUnder(ctx, r, dataset, 1)
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not list holds on %s: %w", dataset, err)
+	}
+	retained := map[string]bool{}
+	for _, h := range holds {
+		if h.Tag == retentionHoldTag {
+			retained[h.Snapshot] = true
+		}
+	}
+	entries, err := listSnapshotEntries(ctx, r, dataset, 1)
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not list snapshots of %s: %w", dataset, err)
+	}
+
+	for _, e := range entries {
+		switch {
+		case retentionExpired(e.Creation, window, now):
+			if !retained[e.Name] {
+				continue
+			}
+			if err := r.Run(ctx, "zfs", "release", retentionHoldTag, e.Name); err != nil {
+				return held, released, fmt.Errorf("could not release %s: %w", e.Name, err)
+			}
+			released++
+		case isBackupSnapshotTag(e.Tag) && !retained[e.Name]:
+			if err := r.Run(ctx, "zfs", "hold", retentionHoldTag, e.Name); err != nil {
+				return held, released, fmt.Errorf("could not hold %s: %w", e.Name, err)
+			}
+			held++
+		}
+	}
+	return held, released, nil
+}
+
+// retainOnDestination applies the retention window to one backup dataset
+// after it has synced, and reports the outcome in the run's output.
+func retainOnDestination(ctx context.Context, r commandRunner, dataset string, config *RetentionConfig, output *strings.Builder) {
+	if config.ImmutableDays == 0 {
+		return
+	}
+	held, released, err := applyRetentionHolds(ctx, r, dataset, config.window(), time.Now())
+	if err != nil {
+		output.WriteString(fmt.Sprintf("Warning: retention holds on %s: %v\n", dataset, err))
+		return
+	}
+	if held > 0 || released > 0 {
+		output.WriteString(fmt.Sprintf("Retention on %s: %d snapshot(s) held for %d days, %d released\n",
+			dataset, held, config.ImmutableDays, released))
+	}
+}
+
+// guardRetention is Force Backup's check before it touches the backup pool:
+// it releases retention holds that have aged out on the given destinations,
+// and fails if any snapshot there is still inside the window, since
+// `syncoid --force-delete` would have to destroy it.
+func guardRetention(ctx context.Context, r commandRunner, pool string, destinations []string, window time.Duration, now time.Time) error {
+	retained, err := listRetained(ctx, r, pool, 0, window, now)
+	if err != nil {
+		return fmt.Errorf("could not read retention holds on %s: %w", pool, err)
+	}
+
+	guarded := map[string]bool{}
+	for _, dest := range destinations {
+		guarded[dest] = true
+	}
+	var inside []retainedSnapshot
+	for _, s := range retained {
+		if !underAny(s.Dataset, guarded) {
+			continue
+		}
+		if !s.Expired {
+			inside = append(inside, s)
+			continue
+		}
+		if err := r.Run(ctx, "zfs", "release", retentionHoldTag, s.Name); err != nil {
+			return fmt.Errorf("could not release %s: %w", s.Name, err)
+		}
+	}
+	if len(inside) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d snapshot(s) on %s are inside the retention window, the newest %s - "+
+		"Force Backup would destroy them. Release them first with: sudo zfs-backup release-retention --pool %s",
+		len(inside), pool, inside[len(inside)-1].Name, pool)
+}
+
+// =============================================================================
+// release-retention
+// =============================================================================
+
+// releaseOptions are the command-line options for release-retention.
+type releaseOptions struct {
+	Pool    string
+	Dataset string // limit to this dataset and its children
+	Confirm bool   // --yes: actually release
+	Force   bool   // --force: skip the typed confirmation
+}
+
+// runReleaseRetention lists the retained snapshots on a backup pool and, with
+// --yes and the typed confirmation, releases their retention holds. Each
+// release is recorded in the run history. It returns the process exit code.
+func runReleaseRetention(ctx context.Context, r commandRunner, opts releaseOptions, confirmFn func(string) bool) int {
+	config, err := LoadRetentionConfig()
+	if err != nil {
+		fmt.Println(errorStyle.Render("Error: " + err.Error()))
+		return 1
+	}
+	target := opts.Pool
+	if opts.Dataset != "" {
+		target = opts.Dataset
+	}
+	now := time.Now()
+	retained, err := listRetained(ctx, r, target, 0, config.window(), now)
+	if err != nil {
+		fmt.Println(errorStyle.Render(fmt.Sprintf("Error: could not read retention holds on %s: %v", target, err)))
+		return 1
+	}
+
+	fmt.Println(titleStyle.Render("Release retention: " + target))
+	fmt.Println()
+	if len(retained) == 0 {
+		fmt.Println(statusStyle.Render("No snapshot carries a retention hold."))
+		fmt.Println()
+		return 0
+	}
+	inside := 0
+	for _, s := range retained {
+		until := "aged out"
+		if !s.Expired {
+			inside++
+			until = "retained"
+			if config.ImmutableDays > 0 {
+				until = "retained until " + s.Creation.Add(config.window()).Local().Format("2006-01-02 15:04")
+			}
+		}
+		fmt.Printf("  %-60s %s\n", s.Name, until)
+	}
+	fmt.Println()
+
+	if !opts.Confirm {
+		fmt.Println(infoStyle.Render(fmt.Sprintf(
+			"Dry run - nothing has been released. Re-run with --yes to release these %d hold(s).", len(retained))))
+		fmt.Println()
+		return 0
+	}
+
+	fmt.Println(destructiveWarningStyle.Render("  RELEASED SNAPSHOTS CAN BE DESTROYED  "))
+	fmt.Println()
+	fmt.Println(warningStyle.Render(fmt.Sprintf(
+		"%d of these snapshot(s) are still inside the retention window. Once released,\n"+
+			"pruning, Force Backup or anyone with access to the pool can destroy them.", inside)))
+	fmt.Println()
+	if !opts.Force && !confirmFn("Type RELEASE to continue: ") {
+		fmt.Println(statusStyle.Render("Aborted. Nothing was released."))
+		fmt.Println()
+		return 1
+	}
+
+	record := historyRecord{
+		Version:     historyVersion,
+		Operation:   "release-retention",
+		Host:        getLocalHostname(),
+		Destination: opts.Pool,
+		StartTime:   now,
+		Outcome:     notifySuccess,
+	}
+	failed := 0
+	for _, s := range retained {
+		entry := historyDataset{Name: s.Name, Status: "done"}
+		if err := r.Run(ctx, "zfs", "release", retentionHoldTag, s.Name); err != nil {
+			entry.Status = "error"
+			entry.Error = err.Error()
+			failed++
+			fmt.Println(errorStyle.Render(fmt.Sprintf("  failed %s: %v", s.Name, err)))
+		} else {
+			fmt.Printf("  released %s\n", s.Name)
+		}
+		record.Datasets = append(record.Datasets, entry)
+	}
+	record.EndTime = time.Now()
+	record.DurationSeconds = record.EndTime.Sub(record.StartTime).Seconds()
+	switch {
+	case failed == len(retained):
+		record.Outcome = notifyFailure
+	case failed > 0:
+		record.Outcome = notifyPartial
+	}
+	if err := appendHistoryRecord(record); err != nil {
+		fmt.Println(warningStyle.Render("Warning: " + err.Error()))
+	}
+
+	fmt.Println()
+	fmt.Println(statusStyle.Render(fmt.Sprintf("Released %d of %d hold(s).", len(retained)-failed, len(retained))))
+	fmt.Println()
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// confirmRelease asks the operator to type RELEASE before any retention hold
+// is released.
+func confirmRelease(prompt string) bool {
+	return confirmTyped(prompt, "RELEASE")
+}
@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// retentionFixture is a backup pool with four snapshots of abyss/home, 1, 10,
+// 40 and 50 days old, and a 30-day window's holds on some of them.
+func retentionFixture(now time.Time, held ...string) (*fakeRunner, []string) {
+	names := []string{
+		"NIXBACKUPS/abyss/home@2026-10-17.02h-00-Backup",
+		"NIXBACKUPS/abyss/home@2026-10-08.02h-00-Backup",
+		"NIXBACKUPS/abyss/home@2026-09-08.02h-00-Backup",
+		"NIXBACKUPS/abyss/home@syncoid_abyss_2026-08-29",
+	}
+	ages := []int{1, 10, 40, 50}
+	var listing strings.Builder
+	for i, name := range names {
+		fmt.Fprintf(&listing, "%s\t%d\t1024\n", name, now.AddDate(0, 0, -ages[i]).Unix())
+	}
+	holds := map[string][]string{}
+	for _, name := range held {
+		holds[name] = []string{retentionHoldTag}
+	}
+	r := pruneFixtureRunner(map[string]string{
+		"NIXBACKUPS":            listing.String(),
+		"NIXBACKUPS/abyss/home": listing.String(),
+	}, holds)
+	return r, names
+}
+
+func TestApplyRetentionHolds(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	r, names := retentionFixture(now, "NIXBACKUPS/abyss/home@2026-10-08.02h-00-Backup", "NIXBACKUPS/abyss/home@2026-09-08.02h-00-Backup")
+
+	held, released, err := applyRetentionHolds(context.Background(), r, "NIXBACKUPS/abyss/home", 30*24*time.Hour, now)
+	if err != nil || held != 1 || released != 1 {
+		t.Fatalf("expected one new hold and one release, got %d, %d, %v", held, released, err)
+	}
+	if !r.ran("hold "+retentionHoldTag, names[0]) || !r.ran("release "+retentionHoldTag, names[2]) {
+		t.Errorf("expected the new snapshot held and the aged-out one released, ran %v", r.commandLines())
+	}
+	if r.ran("hold", names[3]) {
+		t.Error("only zfs-backup's own snapshots are retained")
+	}
+}
+
+func TestRetainedSnapshotsSurviveEveryDestroyPath(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	r, names := retentionFixture(now, "NIXBACKUPS/abyss/home@2026-10-08.02h-00-Backup", "NIXBACKUPS/abyss/home@2026-09-08.02h-00-Backup")
+
+	err := guardRetention(context.Background(), r, "NIXBACKUPS", []string{"NIXBACKUPS/abyss/home"}, 30*24*time.Hour, now)
+	if err == nil || !strings.Contains(err.Error(), "release-retention") {
+		t.Errorf("Force Backup must refuse a destination with retained snapshots, got %v", err)
+	}
+	if !r.ran("release "+retentionHoldTag, names[2]) || r.ran("release "+retentionHoldTag, names[1]) {
+		t.Errorf("expected only the aged-out hold released, ran %v", r.commandLines())
+	}
+	if err := guardRetention(context.Background(), r, "NIXBACKUPS", []string{"NIXBACKUPS/abyss/nix"}, 30*24*time.Hour, now); err != nil {
+		t.Errorf("other destinations are not guarded by home's snapshots, got %v", err)
+	}
+
+	if err := bookmarkAndDestroy(context.Background(), r, names[1]); err == nil || r.ran("destroy "+names[1]) {
+		t.Errorf("pruning must keep a retained snapshot, got %v", err)
+	}
+	if failed := destroySnapshots(context.Background(), r, []string{names[1]}); !reflect.DeepEqual(failed, []string{names[1]}) {
+		t.Errorf("destroySnapshots must report a retained snapshot as not destroyed, got %v", failed)
+	}
+	if r.ran("destroy " + names[1]) {
+		t.Error("a retained snapshot must never reach zfs destroy")
+	}
+}
+
+func TestReleaseRetentionNeedsConfirmation(t *testing.T) {
+	useTempHome(t)
+	path, err := getRetentionFilePath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`{"immutable_days": 30}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, names := retentionFixture(time.Now(), "NIXBACKUPS/abyss/home@2026-10-08.02h-00-Backup")
+	opts := releaseOptions{Pool: "NIXBACKUPS"}
+
+	if code := runReleaseRetention(context.Background(), r, opts, func(string) bool { return true }); code != 0 || r.ran("release") {
+		t.Errorf("a dry run must release nothing, got exit %d and %v", code, r.commandLines())
+	}
+	opts.Confirm = true
+	if code := runReleaseRetention(context.Background(), r, opts, func(string) bool { return false }); code != 1 || r.ran("release") {
+		t.Errorf("a declined confirmation must release nothing, got exit %d", code)
+	}
+	if code := runReleaseRetention(context.Background(), r, opts, func(string) bool { return true }); code != 0 || !r.ran("release "+retentionHoldTag, names[1]) {
+		t.Errorf("expected the hold released once confirmed, got exit %d and %v", code, r.commandLines())
+	}
+	records, err := loadRunHistory()
+	if err != nil || len(records) != 1 || records[0].Operation != "release-retention" {
+		t.Errorf("expected the release recorded in the history, got %+v, %v", records, err)
+	}
+}
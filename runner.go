@@ -7,6 +7,8 @@ import (
 	"context"
 	"fmt"
 	"os/exec"
+	"syscall"
+	"time"
 )
 
 // commandRunner abstracts external command execution so that the snapshot,
@@ -20,6 +22,23 @@ type commandRunner interface {
 	Output(ctx context.Context, name string, args ...string) (string, error)
 }
 
+// commandStopGrace is how long a cancelled command gets to exit on its own
+// before it is killed. syncoid needs it to tear down its send/receive pair
+// instead of leaving a partial receive on the backup pool.
+const commandStopGrace = 30 * time.Second
+
+// commandContext is exec.CommandContext, except that cancelling ctx asks the
+// command to stop with SIGTERM and waits up to commandStopGrace for it, rather
+// than killing it outright.
+func commandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(syscall.SIGTERM)
+	}
+	cmd.WaitDelay = commandStopGrace
+	return cmd
+}
+
 // execRunner is the production commandRunner, backed by os/exec.
 type execRunner struct{}
 
@@ -28,7 +47,7 @@ func (execRunner) Run(ctx context.Context, name string, args ...string) error {
 }
 
 func (execRunner) Output(ctx context.Context, name string, args ...string) (string, error) {
-	cmd := exec.CommandContext(ctx, name, args...)
+	cmd := commandContext(ctx, name, args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		if ctx.Err() != nil {
@@ -41,3 +60,17 @@ func (execRunner) Output(ctx context.Context, name string, args ...string) (stri
 
 // defaultRunner is the commandRunner used by the application entry points.
 var defaultRunner commandRunner = execRunner{}
+
+// sshRunner runs commands on a remote host over ssh, so the same ZFS logic
+// can act on either end of a remote backup.
+type sshRunner struct {
+	Host string
+}
+
+func (s sshRunner) Run(ctx context.Context, name string, args ...string) error {
+	return runCommandWithContext(ctx, "ssh", append([]string{s.Host, name}, args...)...)
+}
+
+func (s sshRunner) Output(ctx context.Context, name string, args ...string) (string, error) {
+	return execRunner{}.Output(ctx, "ssh", append([]string{s.Host, name}, args...)...)
+}
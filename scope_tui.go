@@ -203,12 +203,12 @@ type doctorLoadedMsg struct {
 // loadDoctorReport runs the read-only health check for a pool.
 func loadDoctorReport(pool string) tea.Cmd {
 	return func() tea.Msg {
-		scan, err := collectOrphanScan(context.Background(), defaultRunner, pool)
+		scan, err := prepareDoctorScan(context.Background(), defaultRunner, pool, "")
 		if err != nil {
 			return doctorLoadedMsg{pool: pool, err: err}
 		}
-		content, problems := renderDoctorReport(scan)
-		return doctorLoadedMsg{pool: pool, content: content, problems: problems}
+		report := runDoctorChecks(context.Background(), defaultRunner, scan, doctorChecks)
+		return doctorLoadedMsg{pool: pool, content: renderDoctorReport(report), problems: len(report.Findings)}
 	}
 }
 
@@ -225,6 +225,10 @@ func (m model) updateDoctorScreen(msg tea.KeyMsg) (model, tea.Cmd) {
 	case "r":
 		m.doctorReady = false
 		return m, loadDoctorReport(m.doctorPool)
+	case "c":
+		m.cleanupIndex = 0
+		m.cleanupMessage = ""
+		return m, loadOrphanSelection(m.doctorPool)
 	default:
 		var cmd tea.Cmd
 		m.doctorViewport, cmd = m.doctorViewport.Update(msg)
@@ -253,14 +257,13 @@ func (m model) renderDoctorContent(width int) string {
 	verdict := statusStyle.Render("Healthy - nothing to clean up")
 	if m.doctorProblems > 0 {
 		verdict = warningStyle.Render(fmt.Sprintf(
-			"%d issue group(s) - run 'sudo zfs-backup cleanup-orphans' to reclaim space",
-			m.doctorProblems))
+			"%d finding(s) - each lists its fix", m.doctorProblems))
 	}
 	b.WriteString(lipgloss.NewStyle().Width(width).Align(lipgloss.Center).Render(verdict))
 	b.WriteString("\n")
 
 	scrollInfo := subtitleStyle.Render(fmt.Sprintf(
-		"Scroll: j/k or arrows | %d%% | r refresh | esc/q to return",
+		"Scroll: j/k or arrows | %d%% | c clean up orphans | r refresh | esc/q to return",
 		int(m.doctorViewport.ScrollPercent()*100)))
 	b.WriteString(lipgloss.NewStyle().Width(width).Align(lipgloss.Center).Render(scrollInfo))
 
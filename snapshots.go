@@ -5,6 +5,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"regexp"
 	"sort"
@@ -84,6 +85,8 @@ type snapshotEntry struct {
 	Tag      string    // 2026-08-13.23h-47-Backup
 	Creation time.Time // creation time
 	Used     int64     // bytes uniquely referenced by this snapshot (-1 if unknown)
+	Label    string    // set by labelSnapshotEntries for a labelled snapshot
+	Pinned   bool      // pinned snapshots are never pruned
 }
 
 // parseSnapshotEntries parses the output of
@@ -207,14 +210,19 @@ func createDatasetSnapshots(ctx context.Context, r commandRunner, pool string, d
 }
 
 // destroySnapshots destroys the given snapshots, skipping protected ones. It
-// returns the names it could not destroy. Errors are not fatal: this is used
-// on cleanup paths where the caller is already reporting a failure.
+// returns the names it could not destroy, including any inside the retention
+// window. Errors are not fatal: this is used on cleanup paths where the
+// caller is already reporting a failure.
 func destroySnapshots(ctx context.Context, r commandRunner, names []string) []string {
 	var failed []string
 	for _, name := range names {
 		if _, tag, ok := splitSnapshot(name); ok && isProtectedSnapshotTag(tag) {
 			continue
 		}
+		if tags, _ := snapshotHoldTags(ctx, r, name); hasHold(tags, retentionHoldTag) {
+			failed = append(failed, name)
+			continue
+		}
 		if err := r.Run(ctx, "zfs", "destroy", name); err != nil {
 			failed = append(failed, name)
 		}
@@ -249,46 +257,18 @@ func snapshotsForDatasets(snapshots []string, datasets []string) []string {
 const localBackupSnapshotsKept = 7
 
 // selectSnapshotsToPrune returns the snapshots to convert to bookmarks and
-// destroy, keeping the newest `keep` entries. Only zfs-backup's own snapshots
-// are ever considered - sanoid autosnaps, syncoid sync-snapshots and anything
-// the user made are left untouched.
+// destroy, keeping the newest `keep` entries and any pinned ones. Only
+// zfs-backup's own snapshots are ever considered - sanoid autosnaps, syncoid
+// sync-snapshots and anything the user made are left untouched.
 func selectSnapshotsToPrune(entries []snapshotEntry, keep int) []snapshotEntry {
-	own := filterBackupSnapshots(entries)
-	sortSnapshotsNewestFirst(own)
-
-	if keep < 1 {
-		keep = 1 // never prune the newest: it is the incremental base
-	}
-	if len(own) <= keep {
-		return nil
-	}
-	return own[keep:]
+	return prunedEntries(explainLocalPrune(entries, keep))
 }
 
 // selectDestinationSnapshotsToPrune returns the destination snapshots to prune,
-// keeping monthly archives for the given months plus the newest snapshot,
-// which is the base for the next incremental send.
+// keeping monthly archives for the given months, pinned snapshots and the
+// newest snapshot, which is the base for the next incremental send.
 func selectDestinationSnapshotsToPrune(entries []snapshotEntry, keepMonths []string) []snapshotEntry {
-	own := filterBackupSnapshots(entries)
-	sortSnapshotsNewestFirst(own)
-
-	var prune []snapshotEntry
-	for i, e := range own {
-		if i == 0 {
-			continue // always keep the newest - it is the incremental base
-		}
-		keep := false
-		for _, month := range keepMonths {
-			if strings.HasPrefix(e.Tag, month) {
-				keep = true
-				break
-			}
-		}
-		if !keep {
-			prune = append(prune, e)
-		}
-	}
-	return prune
+	return prunedEntries(explainDestinationPrune(entries, keepMonths))
 }
 
 // recentMonths returns the year-month prefixes to retain on the backup pool.
@@ -303,7 +283,8 @@ func recentMonths(now time.Time, count int) []string {
 // bookmarkAndDestroy converts a snapshot to a bookmark of the same name and
 // then destroys the snapshot. The destroy only happens once the bookmark is
 // confirmed to exist, so a failed bookmark can never cost us the incremental
-// base.
+// base. A snapshot held as the incremental base, or inside the retention
+// window, is left alone and reported with errIncrementalBase or errRetained.
 func bookmarkAndDestroy(ctx context.Context, r commandRunner, snapshot string) error {
 	dataset, tag, ok := splitSnapshot(snapshot)
 	if !ok {
@@ -312,6 +293,13 @@ func bookmarkAndDestroy(ctx context.Context, r commandRunner, snapshot string) e
 	if isProtectedSnapshotTag(tag) {
 		return fmt.Errorf("refusing to touch protected snapshot %s", snapshot)
 	}
+	tags, _ := snapshotHoldTags(ctx, r, snapshot) // zfs destroy still refuses a held snapshot
+	switch {
+	case hasHold(tags, baseHoldTag):
+		return fmt.Errorf("%w: %s", errIncrementalBase, snapshot)
+	case hasHold(tags, retentionHoldTag):
+		return fmt.Errorf("%w: %s", errRetained, snapshot)
+	}
 
 	bookmark := dataset + "#" + tag
 	// A bookmark may already exist from a previous run; that is fine, so the
@@ -350,10 +338,15 @@ func pruneLocalSnapshots(ctx context.Context, r commandRunner, pool string, data
 			result.Warnings = append(result.Warnings, fmt.Sprintf("%s: could not list snapshots: %v", fullDS, err))
 			continue
 		}
+		labelSnapshotEntries(ctx, r, fullDS, entries)
 
 		for _, entry := range selectSnapshotsToPrune(entries, keep) {
 			if err := bookmarkAndDestroy(ctx, r, entry.Name); err != nil {
-				result.Warnings = append(result.Warnings, err.Error())
+				// The held incremental base and retained snapshots are kept
+				// on purpose.
+				if !errors.Is(err, errIncrementalBase) && !errors.Is(err, errRetained) {
+					result.Warnings = append(result.Warnings, err.Error())
+				}
 				continue
 			}
 			result.Pruned = append(result.Pruned, entry.Name)
@@ -378,10 +371,15 @@ func pruneDestinationSnapshots(ctx context.Context, r commandRunner, destination
 			// shouting about - it simply has nothing to prune.
 			continue
 		}
+		labelSnapshotEntries(ctx, r, dest, entries)
 
 		for _, entry := range selectDestinationSnapshotsToPrune(entries, keepMonths) {
 			if err := bookmarkAndDestroy(ctx, r, entry.Name); err != nil {
-				result.Warnings = append(result.Warnings, err.Error())
+				// The held incremental base and retained snapshots are kept
+				// on purpose.
+				if !errors.Is(err, errIncrementalBase) && !errors.Is(err, errRetained) {
+					result.Warnings = append(result.Warnings, err.Error())
+				}
 				continue
 			}
 			result.Pruned = append(result.Pruned, entry.Name)
@@ -221,20 +221,37 @@ func TestCreateDatasetSnapshotsRefusesEmptyScope(t *testing.T) {
 	}
 }
 
-// pruneFixtureRunner answers snapshot listings for the given datasets.
-func pruneFixtureRunner(listings map[string]string) *fakeRunner {
+// pruneFixtureRunner answers snapshot listings and hold queries from canned
+// data: listings by dataset and holds by snapshot, as "tag" strings. holds
+// may be nil where nothing is held.
+func pruneFixtureRunner(listings map[string]string, holds map[string][]string) *fakeRunner {
 	return &fakeRunner{
 		respond: func(_ string, args []string) (string, error) {
 			if len(args) == 0 {
 				return "", nil
 			}
-			if args[0] == "list" {
-				target := args[len(args)-1]
+			target := args[len(args)-1]
+			switch args[0] {
+			case "list":
 				if strings.Contains(strings.Join(args, " "), "-t bookmark") {
 					// Bookmark existence check: pretend creation succeeded.
 					return target + "\n", nil
 				}
 				return listings[target], nil
+			case "get":
+				var b strings.Builder
+				for snapshot, tags := range holds {
+					if strings.HasPrefix(snapshot, target+"@") || strings.HasPrefix(snapshot, target+"/") {
+						fmt.Fprintf(&b, "%s\t%d\n", snapshot, len(tags))
+					}
+				}
+				return b.String(), nil
+			case "holds":
+				var b strings.Builder
+				for _, tag := range holds[target] {
+					fmt.Fprintf(&b, "%s\t%s\tSun Oct 18 02:00 2026\n", target, tag)
+				}
+				return b.String(), nil
 			}
 			return "", nil
 		},
@@ -255,7 +272,7 @@ func TestPruneLocalSnapshotsCoversEveryDatasetInScope(t *testing.T) {
 	runner := pruneFixtureRunner(map[string]string{
 		"NIXROOT/home":  listing("NIXROOT/home"),
 		"NIXROOT/atuin": listing("NIXROOT/atuin"),
-	})
+	}, nil)
 
 	result := pruneLocalSnapshots(context.Background(), runner, "NIXROOT",
 		[]string{"home", "atuin"}, 7)
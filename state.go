@@ -1,9 +1,13 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
@@ -156,7 +160,16 @@ const (
 
 // BackupState represents the current state of a backup operation
 type BackupState struct {
+	// ID keys the state file. It is derived from the operation, source and
+	// destination so an interrupted pull from one host is never overwritten
+	// by a local backup to another pool.
+	ID             string                 `json:"id"`
 	Operation      string                 `json:"operation"`       // "backup" or "force-backup"
+	// Source and Destination name the two ends of the run: a pool, or
+	// host:dataset for the remote side of a pull or push.
+	Source         string                 `json:"source,omitempty"`
+	Destination    string                 `json:"destination,omitempty"`
+	RemoteHost     string                 `json:"remote_host,omitempty"` // SSH host for pull/push runs
 	StartTime      time.Time              `json:"start_time"`
 	CompletedStages map[BackupStage]bool  `json:"completed_stages"`
 	CurrentStage   BackupStage            `json:"current_stage"`
@@ -174,9 +187,50 @@ type BackupState struct {
 	StageTimings   map[BackupStage]time.Duration `json:"stage_timings"` // Historical timings
 }
 
-// getStateFilePath returns the path to the state file.
+// legacyStateFileName is the single state file used before states were keyed
+// per operation. It is migrated into the states directory on first listing.
+const legacyStateFileName = "backup-state.json"
+
+// remoteEndpoint formats the remote end of a pull or push as host:path.
+func remoteEndpoint(sshHost, path string) string {
+	return sshHost + ":" + path
+}
+
+// backupStateID derives the state key for an operation between two endpoints.
+// Characters that are awkward in a filename (/, @, :, _) become dashes, so the
+// ID doubles as the file name and can be typed on the command line. That
+// mapping loses information - tim@office:2222 and tim-office-2222 would share
+// a file - so whenever a character is replaced, a short hash of the raw
+// endpoints is appended to keep the runs apart.
+func backupStateID(operation, source, destination string) string {
+	var parts []string
+	replaced := false
+	for _, p := range []string{operation, source, destination} {
+		if p == "" {
+			continue
+		}
+		parts = append(parts, strings.Map(func(r rune) rune {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+				return r
+			case r == '.' || r == '-':
+				return r
+			default:
+				replaced = true
+				return '-'
+			}
+		}, p))
+	}
+	if replaced {
+		sum := sha256.Sum256([]byte(operation + "\x00" + source + "\x00" + destination))
+		parts = append(parts, hex.EncodeToString(sum[:4]))
+	}
+	return strings.Join(parts, "_")
+}
+
+// getStateCacheDir returns ~/.cache/zfs-backup, creating it if needed.
 // Uses the real user's home directory even when running under sudo.
-func getStateFilePath() (string, error) {
+func getStateCacheDir() (string, error) {
 	home, err := getRealUserHome()
 	if err != nil {
 		return "", err
@@ -190,12 +244,84 @@ func getStateFilePath() (string, error) {
 
 	chownToRealUser(appDir)
 
-	return filepath.Join(appDir, "backup-state.json"), nil
+	return appDir, nil
+}
+
+// getStatesDir returns the directory holding one state file per resumable run.
+func getStatesDir() (string, error) {
+	appDir, err := getStateCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	statesDir := filepath.Join(appDir, "states")
+	if err := os.MkdirAll(statesDir, 0755); err != nil {
+		return "", err
+	}
+
+	chownToRealUser(statesDir)
+
+	return statesDir, nil
+}
+
+// getStateFilePath returns the path to the state file for the given ID.
+func getStateFilePath(id string) (string, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("invalid state ID %q", id)
+	}
+	dir, err := getStatesDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, id+".json"), nil
+}
+
+// writeFileAtomic replaces path with data so a reader sees either the old
+// contents or the new, never a truncated file. The data is written to a
+// temporary file in the same directory, flushed to disk, and renamed over
+// the target; the directory is then synced so the rename itself survives a
+// power loss.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	// Only removes anything if we bail out before the rename.
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+	return nil
 }
 
 // SaveBackupState saves the current backup state to disk
 func SaveBackupState(state *BackupState) error {
-	statePath, err := getStateFilePath()
+	if state.ID == "" {
+		state.ID = backupStateID(state.Operation, state.Source, state.Destination)
+	}
+	statePath, err := getStateFilePath(state.ID)
 	if err != nil {
 		return err
 	}
@@ -207,12 +333,16 @@ func SaveBackupState(state *BackupState) error {
 		return err
 	}
 
-	return os.WriteFile(statePath, data, 0644)
+	if err := writeFileAtomic(statePath, data, 0644); err != nil {
+		return err
+	}
+	chownToRealUser(statePath)
+	return nil
 }
 
-// LoadBackupState loads the backup state from disk
-func LoadBackupState() (*BackupState, error) {
-	statePath, err := getStateFilePath()
+// LoadBackupState loads the backup state with the given ID from disk
+func LoadBackupState(id string) (*BackupState, error) {
+	statePath, err := getStateFilePath(id)
 	if err != nil {
 		return nil, err
 	}
@@ -227,15 +357,76 @@ func LoadBackupState() (*BackupState, error) {
 
 	var state BackupState
 	if err := json.Unmarshal(data, &state); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("state %s is unreadable: %w", id, err)
 	}
+	state.ID = id
 
 	return &state, nil
 }
 
-// ClearBackupState removes the state file
-func ClearBackupState() error {
-	statePath, err := getStateFilePath()
+// ListBackupStates returns every resumable state, most recently updated
+// first. A file that cannot be parsed is skipped rather than failing the
+// whole listing, so one damaged state never hides the others.
+func ListBackupStates() ([]*BackupState, error) {
+	migrateLegacyBackupState()
+
+	dir, err := getStatesDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var states []*BackupState
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		state, err := LoadBackupState(strings.TrimSuffix(name, ".json"))
+		if err != nil || state == nil {
+			continue
+		}
+		states = append(states, state)
+	}
+
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].LastUpdate.After(states[j].LastUpdate)
+	})
+	return states, nil
+}
+
+// migrateLegacyBackupState moves a pre-keyed backup-state.json into the
+// states directory. Such a state records no endpoints, so it is keyed by
+// operation alone and resumes through the usual pool selection.
+func migrateLegacyBackupState() {
+	appDir, err := getStateCacheDir()
+	if err != nil {
+		return
+	}
+	legacyPath := filepath.Join(appDir, legacyStateFileName)
+
+	data, err := os.ReadFile(legacyPath)
+	if err != nil {
+		return
+	}
+
+	var state BackupState
+	if err := json.Unmarshal(data, &state); err == nil && state.Operation != "" {
+		state.ID = ""
+		if err := SaveBackupState(&state); err != nil {
+			return
+		}
+	}
+	_ = os.Remove(legacyPath)
+}
+
+// ClearBackupState removes the state file with the given ID
+func ClearBackupState(id string) error {
+	statePath, err := getStateFilePath(id)
 	if err != nil {
 		return err
 	}
@@ -248,10 +439,14 @@ func ClearBackupState() error {
 	return nil
 }
 
-// NewBackupState creates a new backup state
-func NewBackupState(operation string) *BackupState {
+// NewBackupState creates a new backup state for an operation between two
+// endpoints
+func NewBackupState(operation, source, destination string) *BackupState {
 	return &BackupState{
+		ID:              backupStateID(operation, source, destination),
 		Operation:       operation,
+		Source:          source,
+		Destination:     destination,
 		StartTime:       time.Now(),
 		CompletedStages: make(map[BackupStage]bool),
 		StageTimings:    make(map[BackupStage]time.Duration),
@@ -300,3 +495,12 @@ func (s *BackupState) EstimateTimeRemaining(totalStages int) time.Duration {
 
 	return avgTimePerStage * time.Duration(remainingStages)
 }
+
+// describeStateEndpoints renders a state's source and destination for the
+// resume picker and the CLI listing.
+func describeStateEndpoints(s *BackupState) string {
+	if s.Source == "" && s.Destination == "" {
+		return "(pools not recorded)"
+	}
+	return s.Source + " → " + s.Destination
+}
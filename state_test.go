@@ -0,0 +1,146 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useTempHome points the state directory at a throwaway home for one test.
+func useTempHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SUDO_USER", "")
+	return home
+}
+
+func TestBackupStateIDKeepsRunsApart(t *testing.T) {
+	ids := map[string]bool{}
+	for _, st := range []*BackupState{
+		NewBackupState("backup", "NIXROOT", "NIXBACKUPS"),
+		NewBackupState("backup", "NIXROOT", "OFFSITE"),
+		NewBackupState("force-backup", "NIXROOT", "NIXBACKUPS"),
+		NewBackupState("remote-backup", remoteEndpoint("tim@office", "NIXROOT/home"), "NIXBACKUPS"),
+		NewBackupState("remote-backup", remoteEndpoint("tim@lab", "NIXROOT/home"), "NIXBACKUPS"),
+		// Pairs that read the same once the awkward characters are dashes.
+		NewBackupState("push-backup", "NIXROOT", remoteEndpoint("tim@office:2222", "NIXBACKUPS")),
+		NewBackupState("push-backup", "NIXROOT", "tim-office-2222-NIXBACKUPS"),
+		NewBackupState("backup", "a/b_c", "NIXBACKUPS"),
+		NewBackupState("backup", "a-b/c", "NIXBACKUPS"),
+	} {
+		if ids[st.ID] {
+			t.Errorf("state ID %q collides with another run", st.ID)
+		}
+		ids[st.ID] = true
+	}
+}
+
+func TestBackupStateIDIsASafeFileName(t *testing.T) {
+	id := backupStateID("remote-backup", remoteEndpoint("tim@office:2222", "NIXROOT/home"), "NIXBACKUPS")
+
+	if want := "remote-backup_tim-office-2222-NIXROOT-home_NIXBACKUPS_b8c3038b"; id != want {
+		t.Errorf("expected %q, got %q", want, id)
+	}
+	if id := backupStateID("backup", "NIXROOT", "NIXBACKUPS"); id != "backup_NIXROOT_NIXBACKUPS" {
+		t.Errorf("an ID with nothing replaced needs no hash, got %q", id)
+	}
+	if id != filepath.Base(id) {
+		t.Errorf("a state ID must not contain path separators, got %q", id)
+	}
+}
+
+func TestSaveAndLoadBackupStateRoundTrip(t *testing.T) {
+	useTempHome(t)
+
+	state := NewBackupState("backup", "NIXROOT", "NIXBACKUPS")
+	state.MarkStageCompleted(StageImportPool, 0)
+	if err := SaveBackupState(state); err != nil {
+		t.Fatalf("SaveBackupState: %v", err)
+	}
+
+	loaded, err := LoadBackupState(state.ID)
+	if err != nil || loaded == nil {
+		t.Fatalf("LoadBackupState: %v, %v", loaded, err)
+	}
+	if loaded.Source != "NIXROOT" || loaded.Destination != "NIXBACKUPS" || !loaded.IsStageCompleted(StageImportPool) {
+		t.Errorf("the loaded state should match what was saved, got %+v", loaded)
+	}
+}
+
+func TestListBackupStatesSkipsDamagedFiles(t *testing.T) {
+	useTempHome(t)
+
+	for _, st := range []*BackupState{
+		NewBackupState("backup", "NIXROOT", "NIXBACKUPS"),
+		NewBackupState("push-backup", "NIXROOT", remoteEndpoint("tim@office", "BACKUPS")),
+	} {
+		if err := SaveBackupState(st); err != nil {
+			t.Fatalf("SaveBackupState: %v", err)
+		}
+	}
+
+	// A state truncated by a power loss on an older version.
+	dir, err := getStatesDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "backup_OLD.json"), []byte(`{"operation": "ba`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	states, err := ListBackupStates()
+	if err != nil {
+		t.Fatalf("ListBackupStates: %v", err)
+	}
+	if len(states) != 2 {
+		t.Errorf("expected the two intact states and no damaged one, got %d", len(states))
+	}
+}
+
+func TestListBackupStatesMigratesLegacyFile(t *testing.T) {
+	home := useTempHome(t)
+
+	legacyDir := filepath.Join(home, ".cache", "zfs-backup")
+	if err := os.MkdirAll(legacyDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	legacy := filepath.Join(legacyDir, legacyStateFileName)
+	if err := os.WriteFile(legacy, []byte(`{"operation": "backup", "completed_stages": {}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	states, err := ListBackupStates()
+	if err != nil {
+		t.Fatalf("ListBackupStates: %v", err)
+	}
+	if len(states) != 1 || states[0].ID != "backup" {
+		t.Errorf("the legacy state should be listed under its operation, got %v", states)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Error("the legacy state file should be removed once migrated")
+	}
+}
+
+func TestWriteFileAtomicLeavesNoTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	for _, content := range []string{"first", "second"} {
+		if err := writeFileAtomic(path, []byte(content), 0644); err != nil {
+			t.Fatalf("writeFileAtomic: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "second" {
+		t.Errorf("expected the file to hold the last write, got %q (%v)", data, err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("the temporary file must be renamed away, found %d entries", len(entries))
+	}
+}
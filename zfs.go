@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"os/signal"
 	"regexp"
 	"strings"
+	"syscall"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -169,16 +171,16 @@ type progressUpdate struct {
 // runBackup performs an incremental backup with progress updates
 func runBackup(ctx context.Context, password, sourcePool, destPool string, resumeFrom *BackupState, progressChan chan<- progressUpdate) tea.Cmd {
 	return func() tea.Msg {
-		msg, err := performBackup(ctx, password, sourcePool, destPool, resumeFrom, progressChan)
-		return operationResultMsg{message: msg, err: err}
+		msg, findings, err := performBackup(ctx, password, sourcePool, destPool, resumeFrom, progressChan)
+		return operationResultMsg{message: msg, findings: findings, err: err}
 	}
 }
 
 // runForceBackup performs a destructive force backup with progress updates
 func runForceBackup(ctx context.Context, password, sourcePool, destPool string, resumeFrom *BackupState, progressChan chan<- progressUpdate) tea.Cmd {
 	return func() tea.Msg {
-		msg, err := performForceBackup(ctx, password, sourcePool, destPool, resumeFrom, progressChan)
-		return operationResultMsg{message: msg, err: err}
+		msg, findings, err := performForceBackup(ctx, password, sourcePool, destPool, resumeFrom, progressChan)
+		return operationResultMsg{message: msg, findings: findings, err: err}
 	}
 }
 
@@ -209,68 +211,131 @@ func runRecover(ctx context.Context, password, sourcePool, destPool string, prog
 // runPushBackup performs a push backup to a remote server via SSH
 func runPushBackup(ctx context.Context, password, sourcePool, remoteHost, remoteDestPool string, resumeFrom *BackupState, progressChan chan<- progressUpdate) tea.Cmd {
 	return func() tea.Msg {
-		msg, err := performPushBackup(ctx, password, sourcePool, remoteHost, remoteDestPool, resumeFrom, progressChan)
-		return operationResultMsg{message: msg, err: err}
+		msg, findings, err := performPushBackup(ctx, password, sourcePool, remoteHost, remoteDestPool, resumeFrom, progressChan)
+		return operationResultMsg{message: msg, findings: findings, err: err}
 	}
 }
 
 // runRemoteBackup performs a remote backup via SSH with progress updates
 func runRemoteBackup(ctx context.Context, password, remoteHost, remoteDataset, destPool string, resumeFrom *BackupState, progressChan chan<- progressUpdate) tea.Cmd {
 	return func() tea.Msg {
-		msg, err := performRemoteBackup(ctx, password, remoteHost, remoteDataset, destPool, resumeFrom, progressChan)
-		return operationResultMsg{message: msg, err: err}
+		msg, findings, err := performRemoteBackup(ctx, password, remoteHost, remoteDataset, destPool, resumeFrom, progressChan)
+		return operationResultMsg{message: msg, findings: findings, err: err}
+	}
+}
+
+// cliContext returns the context for a CLI run. The first SIGINT or SIGTERM
+// cancels it, so the running command is asked to stop and the run cleans up
+// after itself; a second signal kills the process as usual.
+func cliContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-signals:
+			// Hand later signals back to the default handler.
+			signal.Stop(signals)
+			fmt.Fprintln(os.Stderr, warningStyle.Render(
+				"\nCancelling - waiting for the current command to stop. Press Ctrl-C again to abort immediately."))
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
+// finishCLIRun sends a command-line run's notifications, records it in the
+// run history and writes its metrics. None of these may change the run's outcome, so failures are printed as
+// warnings.
+func finishCLIRun(operation, source, destination, remoteHost string, started time.Time, log string, findings runFindings, runErr error) {
+	info := cliReportInfo(operation, source, destination, remoteHost, started, log, findings, runErr)
+	errs := notifyRun(info, "")
+	if err := appendRunHistory(info, ""); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := rotateReports(time.Now()); err != nil {
+		errs = append(errs, fmt.Errorf("could not rotate reports: %w", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	if err := writeRunMetrics(ctx, defaultRunner, info); err != nil {
+		errs = append(errs, err)
+	}
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, warningStyle.Render("Warning: "+err.Error()))
 	}
 }
 
 // Synchronous versions for CLI mode
 func runBackupSync() {
 	// Prompt for password
-	fmt.Print("Enter encryption password for NIXBACKUPS: ")
+	fmt.Fprint(cliOut, "Enter encryption password for NIXBACKUPS: ")
 	var password string
 	fmt.Scanln(&password)
 
-	ctx := context.Background()
-	msg, err := performBackup(ctx, password, "NIXROOT", "NIXBACKUPS", nil, nil)
+	ctx, stop := cliContext()
+	defer stop()
+	runEvents.runStart("backup", "NIXROOT", "NIXBACKUPS")
+	started := time.Now()
+	msg, findings, err := performBackup(ctx, password, "NIXROOT", "NIXBACKUPS", nil, nil)
+	runEvents.result(started, err)
+	finishCLIRun("backup", "NIXROOT", "NIXBACKUPS", "", started, msg, findings, err)
 	if err != nil {
-		fmt.Println(errorStyle.Render("Error:" + err.Error()))
+		fmt.Fprintln(cliOut, errorStyle.Render("Error:"+err.Error()))
 		return
 	}
-	fmt.Println(statusStyle.Render(msg))
+	fmt.Fprintln(cliOut, statusStyle.Render(msg))
 }
 
 func runForceBackupSync() {
 	// Prompt for password
-	fmt.Print("Enter encryption password for NIXBACKUPS: ")
+	fmt.Fprint(cliOut, "Enter encryption password for NIXBACKUPS: ")
 	var password string
 	fmt.Scanln(&password)
 
-	ctx := context.Background()
-	msg, err := performForceBackup(ctx, password, "NIXROOT", "NIXBACKUPS", nil, nil)
+	ctx, stop := cliContext()
+	defer stop()
+	runEvents.runStart("force-backup", "NIXROOT", "NIXBACKUPS")
+	started := time.Now()
+	msg, findings, err := performForceBackup(ctx, password, "NIXROOT", "NIXBACKUPS", nil, nil)
+	runEvents.result(started, err)
+	finishCLIRun("force-backup", "NIXROOT", "NIXBACKUPS", "", started, msg, findings, err)
 	if err != nil {
-		fmt.Println(errorStyle.Render("Error:" + err.Error()))
+		fmt.Fprintln(cliOut, errorStyle.Render("Error:"+err.Error()))
 		return
 	}
-	fmt.Println(statusStyle.Render(msg))
+	fmt.Fprintln(cliOut, statusStyle.Render(msg))
 }
 
 func runUnmountSync() {
+	runEvents.runStart("unmount", "", "NIXBACKUPS")
+	started := time.Now()
 	msg, err := performUnmount("NIXBACKUPS")
+	runEvents.result(started, err)
 	if err != nil {
-		fmt.Println(errorStyle.Render("Error:" + err.Error()))
+		fmt.Fprintln(cliOut, errorStyle.Render("Error:"+err.Error()))
 		return
 	}
-	fmt.Println(statusStyle.Render(msg))
+	fmt.Fprintln(cliOut, statusStyle.Render(msg))
 }
 
-func performBackup(ctx context.Context, password, sourcePool, destPool string, resumeFrom *BackupState, progressChan chan<- progressUpdate) (string, error) {
+func performBackup(ctx context.Context, password, sourcePool, destPool string, resumeFrom *BackupState, progressChan chan<- progressUpdate) (string, runFindings, error) {
 	var output strings.Builder
+	var findings runFindings
 
 	// Validate pool names
 	if sourcePool == "" {
-		return "", fmt.Errorf("source pool not selected")
+		return "", findings, fmt.Errorf("source pool not selected")
 	}
 	if destPool == "" {
-		return "", fmt.Errorf("destination pool not selected")
+		return "", findings, fmt.Errorf("destination pool not selected")
 	}
 
 	output.WriteString(fmt.Sprintf("Backing up %s → %s\n\n", sourcePool, destPool))
@@ -280,27 +345,40 @@ func performBackup(ctx context.Context, password, sourcePool, destPool string, r
 	// another phase ignores - see the snapshot scope invariant in datasets.go.
 	datasets, missingDatasets, err := resolveBackupDatasets(sourcePool)
 	if err != nil {
-		return "", fmt.Errorf("failed to resolve backup scope: %w", err)
+		return "", findings, fmt.Errorf("failed to resolve backup scope: %w", err)
 	}
 	if len(datasets) == 0 {
-		return "", fmt.Errorf("no datasets in scope for %s - nothing to back up", sourcePool)
+		return "", findings, fmt.Errorf("no datasets in scope for %s - nothing to back up", sourcePool)
 	}
 	output.WriteString(describeScope(sourcePool, datasets, missingDatasets) + "\n\n")
 
+	hooks, err := newRunHooks("backup", sourcePool, destPool, []string{sourcePool, destPool}, &output)
+	if err != nil {
+		return "", findings, err
+	}
+	quiesce, err := loadQuiesceForRun(sourcePool, datasets, &output)
+	if err != nil {
+		return "", findings, err
+	}
+	retention, err := LoadRetentionConfig()
+	if err != nil {
+		return "", findings, fmt.Errorf("failed to load retention settings: %w", err)
+	}
+
 	// Initialize or load backup state
 	var state *BackupState
 	if resumeFrom != nil {
 		state = resumeFrom
 		output.WriteString("[RESUME]Resuming backup from previous session...\n\n")
 	} else {
-		state = NewBackupState("backup")
+		state = NewBackupState("backup", sourcePool, destPool)
 	}
 	state.Datasets = datasets
 	state.FailedDatasets = nil
 
 	// Save initial state
 	if err := SaveBackupState(state); err != nil {
-		return "", fmt.Errorf("failed to save state: %w", err)
+		return "", findings, fmt.Errorf("failed to save state: %w", err)
 	}
 
 	totalStages := 7
@@ -331,6 +409,7 @@ func performBackup(ctx context.Context, password, sourcePool, destPool string, r
 	executeStage := func(stageEnum BackupStage, stageName string, fn func() error) error {
 		if state.IsStageCompleted(stageEnum) {
 			output.WriteString(fmt.Sprintf("✓ Skipping completed stage: %s\n", stageName))
+			runEvents.stageSkipped(stageEnum, stageName)
 			currentStage++
 			return nil
 		}
@@ -340,20 +419,33 @@ func performBackup(ctx context.Context, password, sourcePool, destPool string, r
 		}
 
 		stageStart := time.Now()
+		logMark := output.Len()
+		runEvents.stageStart(stageEnum, stageName, currentStage-1, totalStages)
 		state.CurrentStage = stageEnum
 		_ = SaveBackupState(state)
 
-		if err := fn(); err != nil {
+		err := fn()
+		duration := time.Since(stageStart)
+		runEvents.stageEnd(stageEnum, stageName, duration, output.String()[logMark:], err)
+		if err != nil {
 			return err
 		}
 
-		duration := time.Since(stageStart)
 		state.MarkStageCompleted(stageEnum, duration)
 		_ = SaveBackupState(state)
 
 		return nil
 	}
 
+	// importedByRun records whether this run imported the backup pool, so
+	// a cancelled run can export it again instead of leaving it imported.
+	importedByRun := false
+	fail := func(err error) (string, runFindings, error) {
+		hooks.fire(ctx, HookOnFailure, hookContext{Stage: state.CurrentStage, Result: "failure", Error: err.Error()})
+		cleanUpCancelledRun(ctx, defaultRunner, state, destPool, importedByRun, &output)
+		return output.String(), findings, err
+	}
+
 	// Stage 1: Import pool
 	err = executeStage(StageImportPool, fmt.Sprintf("[POOL]Importing %s pool", destPool), func() error {
 		output.WriteString("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n")
@@ -373,13 +465,14 @@ func performBackup(ctx context.Context, password, sourcePool, destPool string, r
 			if err := runCommandWithContext(ctx, "zpool", "import", destPool); err != nil {
 				return fmt.Errorf("failed to import pool: %w", err)
 			}
+			importedByRun = true
 		} else {
 			output.WriteString(fmt.Sprintf("[OK]%s is already imported\n", destPool))
 		}
 		return nil
 	})
 	if err != nil {
-		return output.String(), err
+		return fail(err)
 	}
 
 	// Stage 2: Load encryption key
@@ -407,7 +500,7 @@ func performBackup(ctx context.Context, password, sourcePool, destPool string, r
 		return nil
 	})
 	if err != nil {
-		return output.String(), err
+		return fail(err)
 	}
 
 	// Stage 3: Snapshot the datasets in scope - one per dataset, never -r
@@ -422,10 +515,25 @@ func performBackup(ctx context.Context, password, sourcePool, destPool string, r
 		output.WriteString("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n\n")
 
 		snapshotTag := snapshotTagForTime(time.Now())
+
+		// A failing pre-hook aborts before anything is snapshotted, but the
+		// post-hooks still run so whatever the pre-hooks stopped is restarted.
+		hc := hookContext{Stage: StageCreateSnapshot, Snapshot: snapshotTag}
+		if err := hooks.preSnapshot(ctx, hc); err != nil {
+			hc.Result, hc.Error = "aborted", err.Error()
+			hooks.fire(ctx, HookPostSnapshot, hc)
+			return err
+		}
+
 		state.SnapshotName = fmt.Sprintf("%s@%s", sourcePool, snapshotTag)
 		_ = SaveBackupState(state)
 
-		created, err := createDatasetSnapshots(ctx, defaultRunner, sourcePool, datasets, snapshotTag)
+		created, err := snapshotQuiesced(ctx, defaultRunner, sourcePool, datasets, snapshotTag, quiesce, &output)
+		hc.Result = hookResult(err)
+		if err != nil {
+			hc.Error = err.Error()
+		}
+		hooks.fire(ctx, HookPostSnapshot, hc)
 		if err != nil {
 			return err
 		}
@@ -434,13 +542,18 @@ func performBackup(ctx context.Context, password, sourcePool, destPool string, r
 
 		for _, name := range created {
 			output.WriteString(fmt.Sprintf("Created snapshot: %s\n", name))
+			runEvents.snapshotCreated(name)
 		}
 		return nil
 	})
 	if err != nil {
-		return output.String(), err
+		return fail(err)
 	}
 
+	// Measured on every run, resumed or not, so the prune stage knows which
+	// datasets changed too much to have their backups pruned.
+	anomalous := checkChangeRates(ctx, defaultRunner, sourcePool, datasets, snapshotTagOf(state.SnapshotName), &output, &findings)
+
 	// Datasets whose replication failed. Collected during the sync stage and
 	// reported at the end of the run so the process exits non-zero.
 	var failedDatasets []string
@@ -476,6 +589,12 @@ func performBackup(ctx context.Context, password, sourcePool, destPool string, r
 		sendDatasetProgress(progressChan, "Syncing data to backup disk", currentStage-1, totalStages, state, dsProgress, -1)
 
 		for i, ds := range datasets {
+			// Once cancelled nothing further replicates, so this and every
+			// remaining dataset count as failed and lose this run's snapshot.
+			if ctx.Err() != nil {
+				failedDatasets = append(failedDatasets, datasets[i:]...)
+				break
+			}
 			syncDest := resolveBackupDestination(destPool, hostname, ds)
 			syncSrc := fmt.Sprintf("%s/%s", sourcePool, ds)
 			dsStart := time.Now()
@@ -502,6 +621,10 @@ func performBackup(ctx context.Context, password, sourcePool, destPool string, r
 				dsProgress[i].Duration = time.Since(dsStart)
 				setAllSnapshotStatus(dsProgress[i].Snapshots, SnapError)
 				sendDatasetProgress(progressChan, "Syncing data to backup disk", currentStage-1, totalStages, state, dsProgress, i)
+				if ctx.Err() != nil {
+					failedDatasets = append(failedDatasets, ds)
+					continue
+				}
 				return fmt.Errorf("error waiting for existing receive on %s: %w", ds, err)
 			}
 
@@ -523,18 +646,29 @@ func performBackup(ctx context.Context, password, sourcePool, destPool string, r
 				output.WriteString(fmt.Sprintf("Warning:Sync of %s failed: %v\n", ds, syncErr))
 			} else {
 				dsProgress[i].Status = DatasetDone
+				base, err := holdIncrementalBase(ctx, defaultRunner, syncSrc, defaultRunner, syncDest)
+				writeBaseHold(&output, syncSrc, base, err)
+				retainOnDestination(ctx, defaultRunner, syncDest, retention, &output)
+				copied, err := copySnapshotLabels(ctx, defaultRunner, syncSrc, defaultRunner, syncDest)
+				writeSnapshotLabels(&output, syncSrc, copied, err, &findings)
 			}
 			dsProgress[i].Duration = time.Since(dsStart)
 			sendDatasetProgress(progressChan, "Syncing data to backup disk", currentStage-1, totalStages, state, dsProgress, i)
+			dsHook := hookContext{Stage: StageSyncData, Dataset: syncSrc, Snapshot: snapshotTagOf(state.SnapshotName), Result: hookResult(syncErr)}
+			if syncErr != nil {
+				dsHook.Error = syncErr.Error()
+			}
+			hooks.fire(ctx, HookPostDatasetSync, dsHook)
 		}
 
 		// A dataset that failed to replicate must not keep the snapshot this
 		// run created for it: nothing downstream would ever prune it.
 		discardSnapshotsForFailedDatasets(ctx, defaultRunner, sourcePool, state, failedDatasets, &output)
-		return nil
+		// A cancelled sync must not be marked complete, or resume would skip it.
+		return ctx.Err()
 	})
 	if err != nil {
-		return output.String(), err
+		return fail(err)
 	}
 
 	// Stage 5: Prune local snapshots
@@ -548,11 +682,11 @@ func performBackup(ctx context.Context, password, sourcePool, destPool string, r
 		output.WriteString("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n\n")
 
 		output.WriteString("Creating bookmarks and pruning old snapshots...\n")
-		writePruneResult(&output, pruneLocalSnapshots(ctx, defaultRunner, sourcePool, datasets, localBackupSnapshotsKept))
+		findings.SnapshotsPruned += writePruneResult(&output, pruneLocalSnapshots(ctx, defaultRunner, sourcePool, datasets, localBackupSnapshotsKept))
 		return nil
 	})
 	if err != nil {
-		return output.String(), err
+		return fail(err)
 	}
 
 	// Stage 6: Prune backup snapshots
@@ -562,16 +696,15 @@ func performBackup(ctx context.Context, password, sourcePool, destPool string, r
 		output.WriteString("   Old snapshots on the backup drive are pruned to save space.\n")
 		output.WriteString("   We keep recent snapshots plus monthly archives for the last\n")
 		output.WriteString("   3 months. Pruned snapshots are converted to bookmarks first\n")
-		output.WriteString("   to maintain the incremental backup chain.\n")
+		output.WriteString("   to maintain the incremental backup chain. Only the newest\n")
+		output.WriteString(fmt.Sprintf("   %d bookmarks per dataset, plus the latest common base, are kept.\n", bookmarksKept))
 		output.WriteString("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n\n")
 
-		output.WriteString("Keeping monthly archives...\n")
-		destinations := backupDestinations(destPool, getLocalHostname(), datasets)
-		writePruneResult(&output, pruneDestinationSnapshots(ctx, defaultRunner, destinations, time.Now()))
+		findings.SnapshotsPruned += pruneBackupPool(ctx, defaultRunner, sourcePool, destPool, getLocalHostname(), datasets, anomalous, &output)
 		return nil
 	})
 	if err != nil {
-		return output.String(), err
+		return fail(err)
 	}
 
 	// Stage 7: Export and power off
@@ -592,6 +725,9 @@ func performBackup(ctx context.Context, password, sourcePool, destPool string, r
 			output.WriteString("\n" + report + "\n")
 		}
 
+		// The pool cannot be read once exported, so metrics read it now.
+		captureDestinationStats(ctx, defaultRunner, destPool, backupDestinations(destPool, getLocalHostname(), datasets))
+
 		output.WriteString("Exporting the backup zpool\n")
 		device, err := getBackupDevice(destPool)
 		if err == nil {
@@ -609,10 +745,11 @@ func performBackup(ctx context.Context, password, sourcePool, destPool string, r
 				return fmt.Errorf("failed to export pool: %w", err)
 			}
 		}
+		hooks.fire(ctx, HookPostExport, hookContext{Stage: StageExportPool, Result: "success"})
 		return nil
 	})
 	if err != nil {
-		return output.String(), err
+		return fail(err)
 	}
 
 	// The disk has been exported safely, so report the outcome honestly: a run
@@ -621,22 +758,25 @@ func performBackup(ctx context.Context, password, sourcePool, destPool string, r
 		output.WriteString(fmt.Sprintf(
 			"\nWarning:%d dataset(s) failed to replicate: %s\n",
 			len(failedDatasets), strings.Join(failedDatasets, ", ")))
-		return output.String(), fmt.Errorf("backup incomplete: %s failed to replicate", strings.Join(failedDatasets, ", "))
+		return fail(&incompleteError{run: "backup", failed: failedDatasets})
 	}
 
+	// Nothing left to resume, so the state file goes.
+	_ = ClearBackupState(state.ID)
 	output.WriteString("\n[OK]Backup completed successfully!")
-	return output.String(), nil
+	return output.String(), findings, nil
 }
 
-func performForceBackup(ctx context.Context, password, sourcePool, destPool string, resumeFrom *BackupState, progressChan chan<- progressUpdate) (string, error) {
+func performForceBackup(ctx context.Context, password, sourcePool, destPool string, resumeFrom *BackupState, progressChan chan<- progressUpdate) (string, runFindings, error) {
 	var output strings.Builder
+	var findings runFindings
 
 	// Validate pool names
 	if sourcePool == "" {
-		return "", fmt.Errorf("source pool not selected")
+		return "", findings, fmt.Errorf("source pool not selected")
 	}
 	if destPool == "" {
-		return "", fmt.Errorf("destination pool not selected")
+		return "", findings, fmt.Errorf("destination pool not selected")
 	}
 
 	output.WriteString(fmt.Sprintf("Force backing up %s → %s\n\n", sourcePool, destPool))
@@ -644,27 +784,40 @@ func performForceBackup(ctx context.Context, password, sourcePool, destPool stri
 	// One canonical dataset list for every phase - see datasets.go.
 	datasets, missingDatasets, err := resolveBackupDatasets(sourcePool)
 	if err != nil {
-		return "", fmt.Errorf("failed to resolve backup scope: %w", err)
+		return "", findings, fmt.Errorf("failed to resolve backup scope: %w", err)
 	}
 	if len(datasets) == 0 {
-		return "", fmt.Errorf("no datasets in scope for %s - nothing to back up", sourcePool)
+		return "", findings, fmt.Errorf("no datasets in scope for %s - nothing to back up", sourcePool)
 	}
 	output.WriteString(describeScope(sourcePool, datasets, missingDatasets) + "\n\n")
 
+	hooks, err := newRunHooks("force-backup", sourcePool, destPool, []string{sourcePool, destPool}, &output)
+	if err != nil {
+		return "", findings, err
+	}
+	quiesce, err := loadQuiesceForRun(sourcePool, datasets, &output)
+	if err != nil {
+		return "", findings, err
+	}
+	retention, err := LoadRetentionConfig()
+	if err != nil {
+		return "", findings, fmt.Errorf("failed to load retention settings: %w", err)
+	}
+
 	// Initialize or load backup state
 	var state *BackupState
 	if resumeFrom != nil {
 		state = resumeFrom
 		output.WriteString("[RESUME]Resuming force backup from previous session...\n\n")
 	} else {
-		state = NewBackupState("force-backup")
+		state = NewBackupState("force-backup", sourcePool, destPool)
 	}
 	state.Datasets = datasets
 	state.FailedDatasets = nil
 
 	// Save initial state
 	if err := SaveBackupState(state); err != nil {
-		return "", fmt.Errorf("failed to save state: %w", err)
+		return "", findings, fmt.Errorf("failed to save state: %w", err)
 	}
 
 	totalStages := 5
@@ -695,6 +848,7 @@ func performForceBackup(ctx context.Context, password, sourcePool, destPool stri
 	executeStage := func(stageEnum BackupStage, stageName string, fn func() error) error {
 		if state.IsStageCompleted(stageEnum) {
 			output.WriteString(fmt.Sprintf("✓ Skipping completed stage: %s\n", stageName))
+			runEvents.stageSkipped(stageEnum, stageName)
 			currentStage++
 			return nil
 		}
@@ -704,20 +858,31 @@ func performForceBackup(ctx context.Context, password, sourcePool, destPool stri
 		}
 
 		stageStart := time.Now()
+		logMark := output.Len()
+		runEvents.stageStart(stageEnum, stageName, currentStage-1, totalStages)
 		state.CurrentStage = stageEnum
 		_ = SaveBackupState(state)
 
-		if err := fn(); err != nil {
+		err := fn()
+		duration := time.Since(stageStart)
+		runEvents.stageEnd(stageEnum, stageName, duration, output.String()[logMark:], err)
+		if err != nil {
 			return err
 		}
 
-		duration := time.Since(stageStart)
 		state.MarkStageCompleted(stageEnum, duration)
 		_ = SaveBackupState(state)
 
 		return nil
 	}
 
+	importedByRun := false
+	fail := func(err error) (string, runFindings, error) {
+		hooks.fire(ctx, HookOnFailure, hookContext{Stage: state.CurrentStage, Result: "failure", Error: err.Error()})
+		cleanUpCancelledRun(ctx, defaultRunner, state, destPool, importedByRun, &output)
+		return output.String(), findings, err
+	}
+
 	// Stage 1: Import pool
 	err = executeStage(StageImportPool, fmt.Sprintf("[POOL]Importing %s pool", destPool), func() error {
 		output.WriteString("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n")
@@ -730,10 +895,11 @@ func performForceBackup(ctx context.Context, password, sourcePool, destPool stri
 		if err := runCommandWithContext(ctx, "zpool", "import", destPool); err != nil {
 			return fmt.Errorf("failed to import pool: %w", err)
 		}
+		importedByRun = true
 		return nil
 	})
 	if err != nil {
-		return output.String(), err
+		return fail(err)
 	}
 
 	// Stage 2: Load encryption key
@@ -750,7 +916,13 @@ func performForceBackup(ctx context.Context, password, sourcePool, destPool stri
 		return nil
 	})
 	if err != nil {
-		return output.String(), err
+		return fail(err)
+	}
+
+	// Refuse before anything is snapshotted: --force-delete would have to
+	// destroy backup snapshots still inside the retention window.
+	if err := guardRetention(ctx, defaultRunner, destPool, backupDestinations(destPool, getLocalHostname(), datasets), retention.window(), time.Now()); err != nil {
+		return fail(err)
 	}
 
 	// Stage 3: Snapshot the datasets in scope - one per dataset, never -r
@@ -761,10 +933,23 @@ func performForceBackup(ctx context.Context, password, sourcePool, destPool stri
 		output.WriteString("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━\n\n")
 
 		snapshotTag := snapshotTagForTime(time.Now())
+
+		hc := hookContext{Stage: StageCreateSnapshot, Snapshot: snapshotTag}
+		if err := hooks.preSnapshot(ctx, hc); err != nil {
+			hc.Result, hc.Error = "aborted", err.Error()
+			hooks.fire(ctx, HookPostSnapshot, hc)
+			return err
+		}
+
 		state.SnapshotName = fmt.Sprintf("%s@%s", sourcePool, snapshotTag)
 		_ = SaveBackupState(state)
 
-		created, err := createDatasetSnapshots(ctx, defaultRunner, sourcePool, datasets, snapshotTag)
+		created, err := snapshotQuiesced(ctx, defaultRunner, sourcePool, datasets, snapshotTag, quiesce, &output)
+		hc.Result = hookResult(err)
+		if err != nil {
+			hc.Error = err.Error()
+		}
+		hooks.fire(ctx, HookPostSnapshot, hc)
 		if err != nil {
 			return err
 		}
@@ -773,11 +958,12 @@ func performForceBackup(ctx context.Context, password, sourcePool, destPool stri
 
 		for _, name := range created {
 			output.WriteString(fmt.Sprintf("Created snapshot: %s\n", name))
+			runEvents.snapshotCreated(name)
 		}
 		return nil
 	})
 	if err != nil {
-		return output.String(), err
+		return fail(err)
 	}
 
 	// Datasets whose replication failed, reported at the end of the run.
@@ -810,6 +996,12 @@ func performForceBackup(ctx context.Context, password, sourcePool, destPool stri
 		sendDatasetProgress(progressChan, "Force syncing to backup disk", currentStage-1, totalStages, state, dsProgress, -1)
 
 		for i, ds := range datasets {
+			// Once cancelled nothing further replicates, so this and every
+			// remaining dataset count as failed and lose this run's snapshot.
+			if ctx.Err() != nil {
+				failedDatasets = append(failedDatasets, datasets[i:]...)
+				break
+			}
 			syncDest := resolveBackupDestination(destPool, hostname, ds)
 			syncSrc := fmt.Sprintf("%s/%s", sourcePool, ds)
 			dsStart := time.Now()
@@ -834,6 +1026,10 @@ func performForceBackup(ctx context.Context, password, sourcePool, destPool stri
 				dsProgress[i].Duration = time.Since(dsStart)
 				setAllSnapshotStatus(dsProgress[i].Snapshots, SnapError)
 				sendDatasetProgress(progressChan, "Force syncing to backup disk", currentStage-1, totalStages, state, dsProgress, i)
+				if ctx.Err() != nil {
+					failedDatasets = append(failedDatasets, ds)
+					continue
+				}
 				return fmt.Errorf("error waiting for existing receive on %s: %w", ds, err)
 			}
 
@@ -845,6 +1041,9 @@ func performForceBackup(ctx context.Context, password, sourcePool, destPool stri
 					sendDatasetProgress(progressChan, fmt.Sprintf("Force syncing %s", ds), currentStage-1, totalStages, state, dsProgress, i)
 				},
 				func() error {
+					if err := releaseBaseHolds(ctx, defaultRunner, syncDest); err != nil {
+						return err
+					}
 					return runSyncoidWithTimeout(ctx, syncoidTimeout, syncoidBaseArgs(syncSrc, syncDest, "--force-delete")...)
 				},
 			)
@@ -855,16 +1054,27 @@ func performForceBackup(ctx context.Context, password, sourcePool, destPool stri
 				output.WriteString(fmt.Sprintf("Warning:Force sync of %s failed: %v\n", ds, syncErr))
 			} else {
 				dsProgress[i].Status = DatasetDone
+				base, err := holdIncrementalBase(ctx, defaultRunner, syncSrc, defaultRunner, syncDest)
+				writeBaseHold(&output, syncSrc, base, err)
+				retainOnDestination(ctx, defaultRunner, syncDest, retention, &output)
+				copied, err := copySnapshotLabels(ctx, defaultRunner, syncSrc, defaultRunner, syncDest)
+				writeSnapshotLabels(&output, syncSrc, copied, err, &findings)
 			}
 			dsProgress[i].Duration = time.Since(dsStart)
 			sendDatasetProgress(progressChan, "Force syncing to backup disk", currentStage-1, totalStages, state, dsProgress, i)
+			dsHook := hookContext{Stage: StageSyncData, Dataset: syncSrc, Snapshot: snapshotTagOf(state.SnapshotName), Result: hookResult(syncErr)}
+			if syncErr != nil {
+				dsHook.Error = syncErr.Error()
+			}
+			hooks.fire(ctx, HookPostDatasetSync, dsHook)
 		}
 
 		discardSnapshotsForFailedDatasets(ctx, defaultRunner, sourcePool, state, failedDatasets, &output)
-		return nil
+		// A cancelled sync must not be marked complete, or resume would skip it.
+		return ctx.Err()
 	})
 	if err != nil {
-		return output.String(), err
+		return fail(err)
 	}
 
 	// Stage 5: List snapshots
@@ -881,21 +1091,23 @@ func performForceBackup(ctx context.Context, password, sourcePool, destPool stri
 		} else {
 			output.WriteString(snapshots + "\n")
 		}
+		captureDestinationStats(ctx, defaultRunner, destPool, backupDestinations(destPool, getLocalHostname(), datasets))
 		return nil
 	})
 	if err != nil {
-		return output.String(), err
+		return fail(err)
 	}
 
 	if len(failedDatasets) > 0 {
 		output.WriteString(fmt.Sprintf(
 			"\nWarning:%d dataset(s) failed to replicate: %s\n",
 			len(failedDatasets), strings.Join(failedDatasets, ", ")))
-		return output.String(), fmt.Errorf("force backup incomplete: %s failed to replicate", strings.Join(failedDatasets, ", "))
+		return fail(&incompleteError{run: "force backup", failed: failedDatasets})
 	}
 
+	_ = ClearBackupState(state.ID)
 	output.WriteString("\n[OK]Force backup completed successfully!")
-	return output.String(), nil
+	return output.String(), findings, nil
 }
 
 func performPrepare(device, poolName, password string) (string, error) {
@@ -1236,17 +1448,18 @@ func performRecover(ctx context.Context, password, sourcePool, destPool string,
 	return output.String(), nil
 }
 
-func performRemoteBackup(ctx context.Context, password, remoteHost, remoteDataset, destPool string, resumeFrom *BackupState, progressChan chan<- progressUpdate) (string, error) {
+func performRemoteBackup(ctx context.Context, password, remoteHost, remoteDataset, destPool string, resumeFrom *BackupState, progressChan chan<- progressUpdate) (string, runFindings, error) {
 	var output strings.Builder
+	var findings runFindings
 
 	if remoteHost == "" {
-		return "", fmt.Errorf("remote host not specified")
+		return "", findings, fmt.Errorf("remote host not specified")
 	}
 	if remoteDataset == "" {
-		return "", fmt.Errorf("remote dataset not specified")
+		return "", findings, fmt.Errorf("remote dataset not specified")
 	}
 	if destPool == "" {
-		return "", fmt.Errorf("destination pool not selected")
+		return "", findings, fmt.Errorf("destination pool not selected")
 	}
 
 	// Extract hostname for namespacing
@@ -1260,17 +1473,28 @@ func performRemoteBackup(ctx context.Context, password, remoteHost, remoteDatase
 
 	output.WriteString(fmt.Sprintf("Remote backup: %s:%s -> %s/%s/\n\n", remoteHost, remoteDataset, destPool, hostname))
 
+	// The remote end is not a local pool, so only the destination's hooks apply.
+	hooks, err := newRunHooks("remote-backup", remoteEndpoint(remoteHost, remoteDataset), destPool, []string{destPool}, &output)
+	if err != nil {
+		return "", findings, err
+	}
+	retention, err := LoadRetentionConfig()
+	if err != nil {
+		return "", findings, fmt.Errorf("failed to load retention settings: %w", err)
+	}
+
 	// Initialize or load backup state
 	var state *BackupState
 	if resumeFrom != nil {
 		state = resumeFrom
 		output.WriteString("[RESUME] Resuming remote backup from previous session...\n\n")
 	} else {
-		state = NewBackupState("remote-backup")
+		state = NewBackupState("remote-backup", remoteEndpoint(remoteHost, remoteDataset), destPool)
+		state.RemoteHost = remoteHost
 	}
 
 	if err := SaveBackupState(state); err != nil {
-		return "", fmt.Errorf("failed to save state: %w", err)
+		return "", findings, fmt.Errorf("failed to save state: %w", err)
 	}
 
 	totalStages := 5
@@ -1298,6 +1522,7 @@ func performRemoteBackup(ctx context.Context, password, remoteHost, remoteDatase
 	executeStage := func(stageEnum BackupStage, stageName string, fn func() error) error {
 		if state.IsStageCompleted(stageEnum) {
 			output.WriteString(fmt.Sprintf("Skipping completed stage: %s\n", stageName))
+			runEvents.stageSkipped(stageEnum, stageName)
 			currentStage++
 			return nil
 		}
@@ -1307,21 +1532,32 @@ func performRemoteBackup(ctx context.Context, password, remoteHost, remoteDatase
 		}
 
 		stageStart := time.Now()
+		logMark := output.Len()
+		runEvents.stageStart(stageEnum, stageName, currentStage-1, totalStages)
 		state.CurrentStage = stageEnum
 		_ = SaveBackupState(state)
 
-		if err := fn(); err != nil {
+		err := fn()
+		duration := time.Since(stageStart)
+		runEvents.stageEnd(stageEnum, stageName, duration, output.String()[logMark:], err)
+		if err != nil {
 			return err
 		}
 
-		duration := time.Since(stageStart)
 		state.MarkStageCompleted(stageEnum, duration)
 		_ = SaveBackupState(state)
 		return nil
 	}
 
+	importedByRun := false
+	fail := func(err error) (string, runFindings, error) {
+		hooks.fire(ctx, HookOnFailure, hookContext{Stage: state.CurrentStage, Result: "failure", Error: err.Error()})
+		cleanUpCancelledRun(ctx, defaultRunner, state, destPool, importedByRun, &output)
+		return output.String(), findings, err
+	}
+
 	// Stage 1: Import destination pool
-	err := executeStage(StageImportPool, fmt.Sprintf("Importing %s pool", destPool), func() error {
+	err = executeStage(StageImportPool, fmt.Sprintf("Importing %s pool", destPool), func() error {
 		output.WriteString("-----------------------------------------------------------\n")
 		output.WriteString("IMPORT POOL\n")
 		output.WriteString("   Importing the external backup pool.\n")
@@ -1337,13 +1573,14 @@ func performRemoteBackup(ctx context.Context, password, remoteHost, remoteDatase
 			if err := runCommandWithContext(ctx, "zpool", "import", destPool); err != nil {
 				return fmt.Errorf("failed to import pool: %w", err)
 			}
+			importedByRun = true
 		} else {
 			output.WriteString(fmt.Sprintf("[OK] %s is already imported\n", destPool))
 		}
 		return nil
 	})
 	if err != nil {
-		return output.String(), err
+		return fail(err)
 	}
 
 	// Stage 2: Load encryption key
@@ -1369,7 +1606,7 @@ func performRemoteBackup(ctx context.Context, password, remoteHost, remoteDatase
 		return nil
 	})
 	if err != nil {
-		return output.String(), err
+		return fail(err)
 	}
 
 	// Stage 3: Ensure hostname dataset exists
@@ -1393,11 +1630,13 @@ func performRemoteBackup(ctx context.Context, password, remoteHost, remoteDatase
 		return nil
 	})
 	if err != nil {
-		return output.String(), err
+		return fail(err)
 	}
 
 	// Datasets whose replication failed, reported at the end of the run.
 	var failedDatasets []string
+	// Destination datasets this run syncs to, read for metrics before export.
+	var syncedDestinations []string
 
 	// Stage 4: Remote sync via syncoid (all datasets)
 	err = executeStage(StageSyncData, "Syncing data from remote host", func() error {
@@ -1442,6 +1681,9 @@ func performRemoteBackup(ctx context.Context, password, remoteHost, remoteDatase
 			}
 		}
 		dsProgress := initDatasetProgress(dsNames)
+		for _, suffix := range dsNames {
+			syncedDestinations = append(syncedDestinations, getHostnameDatasetPath(destPool, hostname, suffix))
+		}
 		for i, ds := range datasetsToSync {
 			snapInfos := getRemoteSnapshotsForDataset(remoteHost, ds)
 			dsProgress[i].Snapshots = makeSnapshotDots(snapInfos, SnapPending)
@@ -1454,6 +1696,9 @@ func performRemoteBackup(ctx context.Context, password, remoteHost, remoteDatase
 		sendDatasetProgress(progressChan, "Syncing data from remote host", currentStage-1, totalStages, state, dsProgress, -1)
 
 		for i, ds := range datasetsToSync {
+			if ctx.Err() != nil {
+				break
+			}
 			suffix := dsNames[i]
 			syncDest := getHostnameDatasetPath(destPool, hostname, suffix)
 			syncSrc := fmt.Sprintf("%s:%s", remoteHost, ds)
@@ -1504,14 +1749,25 @@ func performRemoteBackup(ctx context.Context, password, remoteHost, remoteDatase
 				output.WriteString(fmt.Sprintf("Warning:Sync of %s failed: %v\n", ds, syncErr))
 			} else {
 				dsProgress[i].Status = DatasetDone
+				base, err := holdPulledBase(ctx, sshRunner{Host: remoteHost}, ds, defaultRunner, syncDest)
+				writeBaseHold(&output, syncDest, base, err)
+				retainOnDestination(ctx, defaultRunner, syncDest, retention, &output)
+				copied, err := copySnapshotLabels(ctx, sshRunner{Host: remoteHost}, ds, defaultRunner, syncDest)
+				writeSnapshotLabels(&output, syncDest, copied, err, &findings)
 			}
 			dsProgress[i].Duration = time.Since(dsStart)
 			sendDatasetProgress(progressChan, "Syncing data from remote host", currentStage-1, totalStages, state, dsProgress, i)
+			dsHook := hookContext{Stage: StageSyncData, Dataset: syncSrc, Snapshot: snapshotTagOf(state.SnapshotName), Result: hookResult(syncErr)}
+			if syncErr != nil {
+				dsHook.Error = syncErr.Error()
+			}
+			hooks.fire(ctx, HookPostDatasetSync, dsHook)
 		}
-		return nil
+		// Nothing was snapshotted here, but a cancelled sync is still unfinished.
+		return ctx.Err()
 	})
 	if err != nil {
-		return output.String(), err
+		return fail(err)
 	}
 
 	// Stage 5: Export and power off
@@ -1521,6 +1777,9 @@ func performRemoteBackup(ctx context.Context, password, remoteHost, remoteDatase
 		output.WriteString("   Safely exporting the pool and powering off the drive.\n")
 		output.WriteString("-----------------------------------------------------------\n\n")
 
+		// The pool cannot be read once exported, so metrics read it now.
+		captureDestinationStats(ctx, defaultRunner, destPool, syncedDestinations)
+
 		device, err := getBackupDevice(destPool)
 		if err == nil {
 			if err := runCommandWithContext(ctx, "zpool", "export", destPool); err != nil {
@@ -1537,34 +1796,37 @@ func performRemoteBackup(ctx context.Context, password, remoteHost, remoteDatase
 				return fmt.Errorf("failed to export pool: %w", err)
 			}
 		}
+		hooks.fire(ctx, HookPostExport, hookContext{Stage: StageExportPool, Result: "success"})
 		return nil
 	})
 	if err != nil {
-		return output.String(), err
+		return fail(err)
 	}
 
 	if len(failedDatasets) > 0 {
 		output.WriteString(fmt.Sprintf(
 			"\nWarning: %d dataset(s) failed to replicate: %s\n",
 			len(failedDatasets), strings.Join(failedDatasets, ", ")))
-		return output.String(), fmt.Errorf("remote backup incomplete: %s failed to replicate", strings.Join(failedDatasets, ", "))
+		return fail(&incompleteError{run: "remote backup", failed: failedDatasets})
 	}
 
+	_ = ClearBackupState(state.ID)
 	output.WriteString("\n[OK] Remote backup completed successfully!")
-	return output.String(), nil
+	return output.String(), findings, nil
 }
 
-func performPushBackup(ctx context.Context, password, sourcePool, remoteHost, remoteDestPool string, resumeFrom *BackupState, progressChan chan<- progressUpdate) (string, error) {
+func performPushBackup(ctx context.Context, password, sourcePool, remoteHost, remoteDestPool string, resumeFrom *BackupState, progressChan chan<- progressUpdate) (string, runFindings, error) {
 	var output strings.Builder
+	var findings runFindings
 
 	if sourcePool == "" {
-		return "", fmt.Errorf("source pool not selected")
+		return "", findings, fmt.Errorf("source pool not selected")
 	}
 	if remoteHost == "" {
-		return "", fmt.Errorf("remote host not specified")
+		return "", findings, fmt.Errorf("remote host not specified")
 	}
 	if remoteDestPool == "" {
-		return "", fmt.Errorf("remote destination pool not specified")
+		return "", findings, fmt.Errorf("remote destination pool not specified")
 	}
 
 	hostname := getLocalHostname()
@@ -1574,25 +1836,40 @@ func performPushBackup(ctx context.Context, password, sourcePool, remoteHost, re
 	// One canonical dataset list for every phase - see datasets.go.
 	datasets, missingDatasets, err := resolveBackupDatasets(sourcePool)
 	if err != nil {
-		return "", fmt.Errorf("failed to resolve backup scope: %w", err)
+		return "", findings, fmt.Errorf("failed to resolve backup scope: %w", err)
 	}
 	if len(datasets) == 0 {
-		return "", fmt.Errorf("no datasets in scope for %s - nothing to back up", sourcePool)
+		return "", findings, fmt.Errorf("no datasets in scope for %s - nothing to back up", sourcePool)
 	}
 	output.WriteString(describeScope(sourcePool, datasets, missingDatasets) + "\n\n")
 
+	// The backup pool is remote, so only the source pool's hooks apply.
+	hooks, err := newRunHooks("push-backup", sourcePool, remoteEndpoint(remoteHost, remoteDestPool), []string{sourcePool}, &output)
+	if err != nil {
+		return "", findings, err
+	}
+	quiesce, err := loadQuiesceForRun(sourcePool, datasets, &output)
+	if err != nil {
+		return "", findings, err
+	}
+	retention, err := LoadRetentionConfig()
+	if err != nil {
+		return "", findings, fmt.Errorf("failed to load retention settings: %w", err)
+	}
+
 	var state *BackupState
 	if resumeFrom != nil {
 		state = resumeFrom
 		output.WriteString("[RESUME] Resuming push backup from previous session...\n\n")
 	} else {
-		state = NewBackupState("push-backup")
+		state = NewBackupState("push-backup", sourcePool, remoteEndpoint(remoteHost, remoteDestPool))
+		state.RemoteHost = remoteHost
 	}
 	state.Datasets = datasets
 	state.FailedDatasets = nil
 
 	if err := SaveBackupState(state); err != nil {
-		return "", fmt.Errorf("failed to save state: %w", err)
+		return "", findings, fmt.Errorf("failed to save state: %w", err)
 	}
 
 	totalStages := 3
@@ -1620,6 +1897,7 @@ func performPushBackup(ctx context.Context, password, sourcePool, remoteHost, re
 	executeStage := func(stageEnum BackupStage, stageName string, fn func() error) error {
 		if state.IsStageCompleted(stageEnum) {
 			output.WriteString(fmt.Sprintf("Skipping completed stage: %s\n", stageName))
+			runEvents.stageSkipped(stageEnum, stageName)
 			currentStage++
 			return nil
 		}
@@ -1629,19 +1907,30 @@ func performPushBackup(ctx context.Context, password, sourcePool, remoteHost, re
 		}
 
 		stageStart := time.Now()
+		logMark := output.Len()
+		runEvents.stageStart(stageEnum, stageName, currentStage-1, totalStages)
 		state.CurrentStage = stageEnum
 		_ = SaveBackupState(state)
 
-		if err := fn(); err != nil {
+		err := fn()
+		duration := time.Since(stageStart)
+		runEvents.stageEnd(stageEnum, stageName, duration, output.String()[logMark:], err)
+		if err != nil {
 			return err
 		}
 
-		duration := time.Since(stageStart)
 		state.MarkStageCompleted(stageEnum, duration)
 		_ = SaveBackupState(state)
 		return nil
 	}
 
+	// The backup pool is remote, so there is nothing local to export.
+	fail := func(err error) (string, runFindings, error) {
+		hooks.fire(ctx, HookOnFailure, hookContext{Stage: state.CurrentStage, Result: "failure", Error: err.Error()})
+		cleanUpCancelledRun(ctx, defaultRunner, state, "", false, &output)
+		return output.String(), findings, err
+	}
+
 	// Stage 1: Snapshot the datasets in scope - one per dataset, never -r
 	err = executeStage(StageCreateSnapshot, "Creating local snapshot", func() error {
 		output.WriteString("-----------------------------------------------------------\n")
@@ -1650,10 +1939,25 @@ func performPushBackup(ctx context.Context, password, sourcePool, remoteHost, re
 		output.WriteString("-----------------------------------------------------------\n\n")
 
 		snapshotTag := snapshotTagForTime(time.Now())
+
+		// A failing pre-hook aborts before anything is snapshotted, but the
+		// post-hooks still run so whatever the pre-hooks stopped is restarted.
+		hc := hookContext{Stage: StageCreateSnapshot, Snapshot: snapshotTag}
+		if err := hooks.preSnapshot(ctx, hc); err != nil {
+			hc.Result, hc.Error = "aborted", err.Error()
+			hooks.fire(ctx, HookPostSnapshot, hc)
+			return err
+		}
+
 		state.SnapshotName = fmt.Sprintf("%s@%s", sourcePool, snapshotTag)
 		_ = SaveBackupState(state)
 
-		created, err := createDatasetSnapshots(ctx, defaultRunner, sourcePool, datasets, snapshotTag)
+		created, err := snapshotQuiesced(ctx, defaultRunner, sourcePool, datasets, snapshotTag, quiesce, &output)
+		hc.Result = hookResult(err)
+		if err != nil {
+			hc.Error = err.Error()
+		}
+		hooks.fire(ctx, HookPostSnapshot, hc)
 		if err != nil {
 			return err
 		}
@@ -1662,13 +1966,18 @@ func performPushBackup(ctx context.Context, password, sourcePool, remoteHost, re
 
 		for _, name := range created {
 			output.WriteString(fmt.Sprintf("Created snapshot: %s\n", name))
+			runEvents.snapshotCreated(name)
 		}
 		return nil
 	})
 	if err != nil {
-		return output.String(), err
+		return fail(err)
 	}
 
+	// Push runs never prune the remote, so the measurement only flags and
+	// records the change rates.
+	checkChangeRates(ctx, defaultRunner, sourcePool, datasets, snapshotTagOf(state.SnapshotName), &output, &findings)
+
 	// Datasets whose replication failed, reported at the end of the run.
 	var failedDatasets []string
 
@@ -1692,6 +2001,12 @@ func performPushBackup(ctx context.Context, password, sourcePool, remoteHost, re
 		sendDatasetProgress(progressChan, "Pushing data to remote host", currentStage-1, totalStages, state, dsProgress, -1)
 
 		for i, ds := range datasets {
+			// Once cancelled nothing further replicates, so this and every
+			// remaining dataset count as failed and lose this run's snapshot.
+			if ctx.Err() != nil {
+				failedDatasets = append(failedDatasets, datasets[i:]...)
+				break
+			}
 			syncSrc := fmt.Sprintf("%s/%s", sourcePool, ds)
 			remoteDatasetPath := fmt.Sprintf("%s/%s/%s", remoteDestPool, hostname, ds)
 			remoteDest := fmt.Sprintf("%s:%s", remoteHost, remoteDatasetPath)
@@ -1729,16 +2044,27 @@ func performPushBackup(ctx context.Context, password, sourcePool, remoteHost, re
 				output.WriteString(fmt.Sprintf("Warning: push of %s failed: %v\n", ds, syncErr))
 			} else {
 				dsProgress[i].Status = DatasetDone
+				base, err := holdIncrementalBase(ctx, defaultRunner, syncSrc, sshRunner{Host: remoteHost}, remoteDatasetPath)
+				writeBaseHold(&output, syncSrc, base, err)
+				retainOnDestination(ctx, sshRunner{Host: remoteHost}, remoteDatasetPath, retention, &output)
+				copied, err := copySnapshotLabels(ctx, defaultRunner, syncSrc, sshRunner{Host: remoteHost}, remoteDatasetPath)
+				writeSnapshotLabels(&output, syncSrc, copied, err, &findings)
 			}
 			dsProgress[i].Duration = time.Since(dsStart)
 			sendDatasetProgress(progressChan, "Pushing data to remote host", currentStage-1, totalStages, state, dsProgress, i)
+			dsHook := hookContext{Stage: StageSyncData, Dataset: syncSrc, Snapshot: snapshotTagOf(state.SnapshotName), Result: hookResult(syncErr)}
+			if syncErr != nil {
+				dsHook.Error = syncErr.Error()
+			}
+			hooks.fire(ctx, HookPostDatasetSync, dsHook)
 		}
 
 		discardSnapshotsForFailedDatasets(ctx, defaultRunner, sourcePool, state, failedDatasets, &output)
-		return nil
+		// A cancelled sync must not be marked complete, or resume would skip it.
+		return ctx.Err()
 	})
 	if err != nil {
-		return output.String(), err
+		return fail(err)
 	}
 
 	// Stage 3: Prune local snapshots
@@ -1748,22 +2074,23 @@ func performPushBackup(ctx context.Context, password, sourcePool, remoteHost, re
 		output.WriteString("   Cleaning up old local snapshots to save space.\n")
 		output.WriteString("-----------------------------------------------------------\n\n")
 
-		writePruneResult(&output, pruneLocalSnapshots(ctx, defaultRunner, sourcePool, datasets, localBackupSnapshotsKept))
+		findings.SnapshotsPruned += writePruneResult(&output, pruneLocalSnapshots(ctx, defaultRunner, sourcePool, datasets, localBackupSnapshotsKept))
 		return nil
 	})
 	if err != nil {
-		return output.String(), err
+		return fail(err)
 	}
 
 	if len(failedDatasets) > 0 {
 		output.WriteString(fmt.Sprintf(
 			"\nWarning: %d dataset(s) failed to replicate: %s\n",
 			len(failedDatasets), strings.Join(failedDatasets, ", ")))
-		return output.String(), fmt.Errorf("push backup incomplete: %s failed to replicate", strings.Join(failedDatasets, ", "))
+		return fail(&incompleteError{run: "push backup", failed: failedDatasets})
 	}
 
+	_ = ClearBackupState(state.ID)
 	output.WriteString("\n[OK] Push backup completed successfully!")
-	return output.String(), nil
+	return output.String(), findings, nil
 }
 
 // Helper functions
@@ -1778,7 +2105,7 @@ func runCommand(name string, args ...string) error {
 }
 
 func runCommandWithContext(ctx context.Context, name string, args ...string) error {
-	cmd := exec.CommandContext(ctx, name, args...)
+	cmd := commandContext(ctx, name, args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		// Check if cancelled
@@ -2157,6 +2484,9 @@ func getDatasetSize(dataset string) string {
 // Deep-copies each dataset's Snapshots slice so the background poller in
 // trackSyncProgress can keep mutating dot statuses without racing the UI.
 func sendDatasetProgress(progressChan chan<- progressUpdate, stage string, stageNum, totalStages int, state *BackupState, datasets []DatasetProgress, currentIdx int) {
+	for _, d := range datasets {
+		runEvents.datasetStatus(d.Name, d.Status, d.ErrorMsg)
+	}
 	if progressChan == nil {
 		return
 	}
@@ -2316,11 +2646,16 @@ func backupDestinations(destPool, hostname string, datasets []string) []string {
 
 // discardSnapshotsForFailedDatasets destroys the snapshots this run created for
 // datasets whose replication failed, so a failed run leaves no residue behind.
+// It also runs when the run was cancelled, so it works under its own deadline
+// rather than the run's context.
 func discardSnapshotsForFailedDatasets(ctx context.Context, r commandRunner, sourcePool string, state *BackupState, failed []string, output *strings.Builder) {
 	if len(failed) == 0 || len(state.SnapshotNames) == 0 {
 		return
 	}
 
+	ctx, cancel := cleanupContext(ctx)
+	defer cancel()
+
 	stale := snapshotsForDatasets(state.SnapshotNames, qualifyDatasets(sourcePool, failed))
 	if len(stale) == 0 {
 		return
@@ -2351,19 +2686,93 @@ func discardSnapshotsForFailedDatasets(ctx context.Context, r commandRunner, sou
 	_ = SaveBackupState(state)
 }
 
-// writePruneResult renders a prune pass into the run log.
-func writePruneResult(output *strings.Builder, result pruneResult) {
+// cleanupTimeout bounds the cleanup a cancelled run does on its way out.
+const cleanupTimeout = 2 * time.Minute
+
+// cleanupContext derives a context for cleanup that outlives the run's own
+// cancellation but still cannot hang forever.
+func cleanupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+}
+
+// incompleteError is returned by a run that reached the end but could not
+// replicate every dataset, so callers can tell a partial failure from one
+// that stopped the run.
+type incompleteError struct {
+	run    string // "backup", "push backup", ...
+	failed []string
+}
+
+func (e *incompleteError) Error() string {
+	return fmt.Sprintf("%s incomplete: %s failed to replicate", e.run, strings.Join(e.failed, ", "))
+}
+
+// cleanUpCancelledRun is the last thing a cancelled run does - whether it was
+// stopped by SIGINT/SIGTERM in CLI mode or ctrl+c in the TUI. The state is
+// marked Cancelled so resume offers it, and a pool this run imported is
+// exported again so stopping the systemd unit never leaves the USB pool
+// imported. The import and key stages are then un-marked, because a resumed
+// run has to import the pool again. A run that failed for any other reason is
+// left as it was.
+func cleanUpCancelledRun(ctx context.Context, r commandRunner, state *BackupState, destPool string, importedByRun bool, output *strings.Builder) {
+	if ctx.Err() == nil || state == nil {
+		return
+	}
+
+	output.WriteString("\nWarning:Run cancelled - cleaning up before exit\n")
+	state.Cancelled = true
+
+	if importedByRun && destPool != "" {
+		cleanupCtx, cancel := cleanupContext(ctx)
+		defer cancel()
+
+		output.WriteString(fmt.Sprintf("Exporting %s, which this run imported\n", destPool))
+		if err := r.Run(cleanupCtx, "zpool", "export", destPool); err != nil {
+			output.WriteString(fmt.Sprintf("Warning:Could not export %s: %v\n", destPool, err))
+		} else {
+			delete(state.CompletedStages, StageImportPool)
+			delete(state.CompletedStages, StageLoadKey)
+		}
+	}
+
+	_ = SaveBackupState(state)
+}
+
+// writePruneResult renders a prune pass into the run log and returns how
+// many snapshots it pruned.
+func writePruneResult(output *strings.Builder, result pruneResult) int {
 	if len(result.Pruned) == 0 {
 		output.WriteString("Nothing to prune.\n")
 	} else {
 		output.WriteString(fmt.Sprintf("Bookmarked and removed %d snapshot(s):\n", len(result.Pruned)))
 		for _, name := range result.Pruned {
 			output.WriteString(fmt.Sprintf("  %s\n", name))
+			runEvents.snapshotPruned(name)
 		}
 	}
 	for _, warning := range result.Warnings {
 		output.WriteString(fmt.Sprintf("Warning:%s\n", warning))
 	}
+	return len(result.Pruned)
+}
+
+// pruneBackupPool prunes the backup pool's old snapshots and the old
+// bookmarks on both sides for every dataset but the anomalous ones, which are
+// left exactly as they are. It returns how many snapshots it pruned.
+func pruneBackupPool(ctx context.Context, r commandRunner, sourcePool, destPool, hostname string, datasets []string, anomalous map[string]bool, output *strings.Builder) int {
+	pruned := datasets
+	if len(anomalous) > 0 {
+		pruned = withoutDatasets(datasets, anomalous)
+		output.WriteString(fmt.Sprintf("Not pruning %d dataset(s) with a change-rate anomaly\n", len(datasets)-len(pruned)))
+	}
+	output.WriteString("Keeping monthly archives...\n")
+	destinations := backupDestinations(destPool, hostname, pruned)
+	count := writePruneResult(output, pruneDestinationSnapshots(ctx, r, destinations, time.Now()))
+
+	output.WriteString("Pruning old bookmarks on both sides...\n")
+	writeBookmarkResult(output, pruneBookmarks(ctx, r,
+		planBookmarks(ctx, r, qualifyDatasets(sourcePool, pruned), destinations, bookmarksKept)))
+	return count
 }
 
 func listSnapshots() (string, error) {
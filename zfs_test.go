@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: Tim Sutton / Kartoza
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func cancelledContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+func TestCleanUpCancelledRunExportsAPoolItImported(t *testing.T) {
+	useTempHome(t)
+	runner := &fakeRunner{}
+	state := NewBackupState("backup", "NIXROOT", "NIXBACKUPS")
+	state.MarkStageCompleted(StageImportPool, 0)
+	state.MarkStageCompleted(StageLoadKey, 0)
+	state.MarkStageCompleted(StageCreateSnapshot, 0)
+
+	var output strings.Builder
+	cleanUpCancelledRun(cancelledContext(), runner, state, "NIXBACKUPS", true, &output)
+
+	if !runner.ran("zpool", "export", "NIXBACKUPS") {
+		t.Errorf("a pool this run imported should be exported on cancel, ran %v", runner.commandLines())
+	}
+	if !state.Cancelled {
+		t.Error("the state should record that the run was cancelled")
+	}
+	if state.IsStageCompleted(StageImportPool) || state.IsStageCompleted(StageLoadKey) {
+		t.Error("once exported, resume must import the pool and load the key again")
+	}
+	if !state.IsStageCompleted(StageCreateSnapshot) {
+		t.Error("stages after the import are unaffected by the export")
+	}
+
+	saved, err := LoadBackupState(state.ID)
+	if err != nil || saved == nil || !saved.Cancelled {
+		t.Errorf("the cancelled state should be saved for resume, got %+v (%v)", saved, err)
+	}
+}
+
+func TestCleanUpCancelledRunLeavesAPoolItFoundImported(t *testing.T) {
+	useTempHome(t)
+	runner := &fakeRunner{}
+	state := NewBackupState("backup", "NIXROOT", "NIXBACKUPS")
+
+	var output strings.Builder
+	cleanUpCancelledRun(cancelledContext(), runner, state, "NIXBACKUPS", false, &output)
+
+	if runner.mentions("export") {
+		t.Errorf("a pool that was already imported must stay imported, ran %v", runner.commandLines())
+	}
+	if !state.Cancelled {
+		t.Error("the state should record that the run was cancelled")
+	}
+}
+
+func TestCleanUpCancelledRunIgnoresOrdinaryFailures(t *testing.T) {
+	runner := &fakeRunner{}
+	state := NewBackupState("backup", "NIXROOT", "NIXBACKUPS")
+
+	var output strings.Builder
+	cleanUpCancelledRun(context.Background(), runner, state, "NIXBACKUPS", true, &output)
+
+	if len(runner.calls) != 0 || state.Cancelled {
+		t.Errorf("a run that failed without being cancelled should be left alone, ran %v", runner.commandLines())
+	}
+}